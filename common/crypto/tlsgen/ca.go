@@ -29,6 +29,9 @@ type CA interface {
 	// CertBytes returns the certificate of the CA in PEM encoding
 	CertBytes() []byte
 
+	// KeyBytes returns the private key of the CA in PEM encoding
+	KeyBytes() []byte
+
 	NewIntermediateCA() (CA, error)
 
 	// newCertKeyPair returns a certificate and private key pair and nil,
@@ -72,6 +75,11 @@ func (c *ca) CertBytes() []byte {
 	return c.caCert.Cert
 }
 
+// KeyBytes returns the private key of the CA in PEM encoding
+func (c *ca) KeyBytes() []byte {
+	return c.caCert.Key
+}
+
 // newClientCertKeyPair returns a certificate and private key pair and nil,
 // or nil, error in case of failure
 // The certificate is signed by the CA and is used as a client TLS certificate
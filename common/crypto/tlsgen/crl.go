@@ -0,0 +1,79 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tlsgen
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GenerateCRL returns a PEM encoded certificate revocation list signed by
+// the CA with the given PEM encoded certificate and private key, revoking
+// the certificates with the given serial numbers
+func GenerateCRL(caCert, caKey []byte, revokedSerials []*big.Int) ([]byte, error) {
+	block, _ := pem.Decode(caCert)
+	if block == nil {
+		return nil, errors.New("CA certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse CA certificate")
+	}
+	signer, err := parseSigner(caKey)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal CA public key")
+	}
+	if !bytes.Equal(pubKey, cert.RawSubjectPublicKeyInfo) {
+		return nil, errors.New("CA key does not match the CA certificate")
+	}
+
+	now := time.Now()
+	revoked := make([]pkix.RevokedCertificate, 0, len(revokedSerials))
+	for _, serial := range revokedSerials {
+		revoked = append(revoked, pkix.RevokedCertificate{
+			SerialNumber:   serial,
+			RevocationTime: now,
+		})
+	}
+	crl, err := cert.CreateCRL(rand.Reader, signer, revoked, now, now.Add(time.Hour*24))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create CRL")
+	}
+	return encodePEM("X509 CRL", crl), nil
+}
+
+// parseSigner parses a PEM encoded PKCS#8 or SEC 1 private key
+func parseSigner(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("CA key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.Errorf("CA key of type %T cannot sign", key)
+		}
+		return signer, nil
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse CA key")
+	}
+	return key, nil
+}
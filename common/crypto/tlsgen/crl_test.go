@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tlsgen
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateCRL(t *testing.T) {
+	ca, err := NewCA()
+	require.NoError(t, err)
+	revoked, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+
+	crlPEM, err := GenerateCRL(ca.CertBytes(), ca.KeyBytes(), []*big.Int{revoked.TLSCert.SerialNumber, big.NewInt(42)})
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(crlPEM)
+	require.NotNil(t, block)
+	require.Equal(t, "X509 CRL", block.Type)
+	crl, err := x509.ParseCRL(block.Bytes)
+	require.NoError(t, err)
+
+	caBlock, _ := pem.Decode(ca.CertBytes())
+	caCert, err := x509.ParseCertificate(caBlock.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, caCert.CheckCRLSignature(crl))
+	require.Len(t, crl.TBSCertList.RevokedCertificates, 2)
+	require.Equal(t, revoked.TLSCert.SerialNumber, crl.TBSCertList.RevokedCertificates[0].SerialNumber)
+	require.Equal(t, big.NewInt(42), crl.TBSCertList.RevokedCertificates[1].SerialNumber)
+
+	// an empty list revokes nothing
+	crlPEM, err = GenerateCRL(ca.CertBytes(), ca.KeyBytes(), nil)
+	require.NoError(t, err)
+	block, _ = pem.Decode(crlPEM)
+	crl, err = x509.ParseCRL(block.Bytes)
+	require.NoError(t, err)
+	require.Empty(t, crl.TBSCertList.RevokedCertificates)
+}
+
+func TestGenerateCRLInvalidInput(t *testing.T) {
+	ca, err := NewCA()
+	require.NoError(t, err)
+	other, err := NewCA()
+	require.NoError(t, err)
+
+	_, err = GenerateCRL([]byte("not a certificate"), ca.KeyBytes(), nil)
+	require.EqualError(t, err, "CA certificate is not PEM encoded")
+	_, err = GenerateCRL(ca.CertBytes(), []byte("not a key"), nil)
+	require.EqualError(t, err, "CA key is not PEM encoded")
+	_, err = GenerateCRL(ca.CertBytes(), other.KeyBytes(), nil)
+	require.EqualError(t, err, "CA key does not match the CA certificate")
+}
@@ -0,0 +1,58 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type methodAllowlist map[string]struct{}
+
+func newMethodAllowlist(methods []string) methodAllowlist {
+	allowed := methodAllowlist{}
+	for _, method := range methods {
+		allowed[method] = struct{}{}
+	}
+	return allowed
+}
+
+func (m methodAllowlist) check(method string) error {
+	if _, ok := m[method]; !ok {
+		return status.Errorf(codes.PermissionDenied, "method %s is not allowed by the client", method)
+	}
+	return nil
+}
+
+// NewMethodAllowlistInterceptor returns a unary client interceptor that only
+// permits calls to the listed full method names (e.g.
+// /package.Service/Method). Other calls fail locally with PermissionDenied
+// without being sent to the server.
+func NewMethodAllowlistInterceptor(methods []string) grpc.UnaryClientInterceptor {
+	allowed := newMethodAllowlist(methods)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := allowed.check(method); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// NewMethodAllowlistStreamInterceptor is the stream client interceptor
+// counterpart of NewMethodAllowlistInterceptor.
+func NewMethodAllowlistStreamInterceptor(methods []string) grpc.StreamClientInterceptor {
+	allowed := newMethodAllowlist(methods)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := allowed.check(method); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
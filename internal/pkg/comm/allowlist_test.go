@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMethodAllowlistInterceptor(t *testing.T) {
+	t.Parallel()
+
+	var lock sync.Mutex
+	var received []string
+	record := func(method string) {
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, method)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+		UnaryInterceptors: []grpc.UnaryServerInterceptor{
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				record(info.FullMethod)
+				return handler(ctx, req)
+			},
+		},
+		StreamInterceptors: []grpc.StreamServerInterceptor{
+			func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				record(info.FullMethod)
+				return handler(srv, ss)
+			},
+		},
+	})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	allowed := []string{"/EmptyService/EmptyCall"}
+	conn, err := grpc.Dial(
+		lis.Addr().String(),
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithUnaryInterceptor(comm.NewMethodAllowlistInterceptor(allowed)),
+		grpc.WithStreamInterceptor(comm.NewMethodAllowlistStreamInterceptor(allowed)),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	require.NoError(t, err)
+
+	_, err = testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.Equal(t, "method /EchoService/EchoCall is not allowed by the client", status.Convert(err).Message())
+
+	_, err = testpb.NewEmptyServiceClient(conn).EmptyStream(context.Background())
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.Equal(t, "method /EmptyService/EmptyStream is not allowed by the client", status.Convert(err).Message())
+
+	// only the allowed call reached the server
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(t, []string{"/EmptyService/EmptyCall"}, received)
+}
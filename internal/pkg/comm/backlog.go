@@ -0,0 +1,39 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// setListenBacklog changes the accept queue length of a listening TCP
+// socket. The net package always listens with the system maximum, so the
+// socket is put into the listening state again with the requested backlog,
+// which these kernels accept on a socket that is already listening.
+func setListenBacklog(lis net.Listener, backlog int) error {
+	tcpListener, ok := lis.(*net.TCPListener)
+	if !ok {
+		return errors.Errorf("cannot set the backlog of a %T", lis)
+	}
+	rawConn, err := tcpListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	err = rawConn.Control(func(fd uintptr) {
+		listenErr = unix.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(listenErr, "failed to set the listen backlog")
+}
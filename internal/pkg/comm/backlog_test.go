@@ -0,0 +1,54 @@
+// +build linux
+
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenBacklog(t *testing.T) {
+	t.Parallel()
+
+	// the server is never started, so nothing is accepted and connections
+	// queue in the kernel
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{ListenBacklog: 1})
+	require.NoError(t, err)
+	defer srv.Stop()
+
+	var established int
+	for i := 0; i < 10; i++ {
+		conn, err := net.DialTimeout("tcp", srv.Address(), 250*time.Millisecond)
+		if err != nil {
+			break
+		}
+		defer conn.Close()
+		established++
+	}
+	// Linux queues one connection more than the backlog
+	require.Equal(t, 2, established)
+}
+
+func TestListenBacklogDefault(t *testing.T) {
+	t.Parallel()
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	require.NoError(t, err)
+	defer srv.Stop()
+
+	for i := 0; i < 10; i++ {
+		conn, err := net.DialTimeout("tcp", srv.Address(), time.Second)
+		require.NoError(t, err)
+		defer conn.Close()
+	}
+}
@@ -0,0 +1,19 @@
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+func setListenBacklog(net.Listener, int) error {
+	return errors.New("setting the listen backlog is not supported on this platform")
+}
@@ -0,0 +1,74 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// certExpiryStatus returns the overall health status of the server given
+// the expiry of its certificate and, while it is serving, the time at which
+// the certificate enters the expiry window
+func (gServer *GRPCServer) certExpiryStatus() (healthpb.HealthCheckResponse_ServingStatus, time.Time) {
+	// servers selecting their certificates with GetCertificate have none
+	cert, ok := gServer.serverCertificate.Load().(tls.Certificate)
+	if !ok || len(cert.Certificate) == 0 {
+		return healthpb.HealthCheckResponse_SERVING, time.Time{}
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		gServer.logger.Warningf("Reporting NOT_SERVING, failed to parse the server certificate: %s", err)
+		return healthpb.HealthCheckResponse_NOT_SERVING, time.Time{}
+	}
+
+	notServingAt := leaf.NotAfter.Add(-gServer.certExpiryWindow)
+	if !time.Now().Before(notServingAt) {
+		gServer.logger.Warningf("Reporting NOT_SERVING, the server certificate expires at %s, within %s", leaf.NotAfter, gServer.certExpiryWindow)
+		return healthpb.HealthCheckResponse_NOT_SERVING, time.Time{}
+	}
+	return healthpb.HealthCheckResponse_SERVING, notServingAt
+}
+
+// updateCertExpiryStatus sets the overall health status of the server
+// from the expiry of its certificate and returns the time at which it
+// needs to be updated, if any
+func (gServer *GRPCServer) updateCertExpiryStatus() time.Time {
+	status, notServingAt := gServer.certExpiryStatus()
+	gServer.healthServer.SetServingStatus("", status)
+	return notServingAt
+}
+
+// monitorCertExpiry updates the overall health status at notServingAt and
+// whenever the server certificate is replaced, until the server is stopped
+func (gServer *GRPCServer) monitorCertExpiry(notServingAt time.Time) {
+	for {
+		var timer *time.Timer
+		var expiring <-chan time.Time
+		if !notServingAt.IsZero() {
+			timer = time.NewTimer(time.Until(notServingAt))
+			expiring = timer.C
+		}
+
+		select {
+		case <-expiring:
+		case <-gServer.certChanged:
+		case <-gServer.stopChan:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		notServingAt = gServer.updateCertExpiryStatus()
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	. "github.com/onsi/gomega"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// expiringCerts returns a PEM-encoded CA and PEM-encoded server key pairs
+// issued by it for 127.0.0.1 that expire at each of the given times
+func expiringCerts(gt *GomegaWithT, notAfter ...time.Time) (caPEM []byte, certs []tls.Certificate, certPEMs, keyPEMs [][]byte) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	gt.Expect(err).NotTo(HaveOccurred())
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "expiry-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	for i, expiry := range notAfter {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		gt.Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: "expiry-server"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     expiry,
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+		gt.Expect(err).NotTo(HaveOccurred())
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		gt.Expect(err).NotTo(HaveOccurred())
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		gt.Expect(err).NotTo(HaveOccurred())
+		certs = append(certs, cert)
+		certPEMs = append(certPEMs, certPEM)
+		keyPEMs = append(keyPEMs, keyPEM)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), certs, certPEMs, keyPEMs
+}
+
+func TestHealthCertExpiry(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	window := time.Hour
+	caPEM, certs, certPEMs, keyPEMs := expiringCerts(gt,
+		time.Now().Add(2*time.Hour),
+		time.Now().Add(30*time.Minute),
+		time.Now().Add(window+2*time.Second),
+	)
+
+	healthStatus := func(srv *comm.GRPCServer) func() healthpb.HealthCheckResponse_ServingStatus {
+		client, err := comm.NewGRPCClient(comm.ClientConfig{
+			SecOpts: comm.SecureOptions{
+				UseTLS:        true,
+				ServerRootCAs: [][]byte{caPEM},
+			},
+			Timeout: testTimeout,
+		})
+		gt.Expect(err).NotTo(HaveOccurred())
+		conn, err := client.NewConnection(srv.Address())
+		gt.Expect(err).NotTo(HaveOccurred())
+		t.Cleanup(func() { conn.Close() })
+		health := healthpb.NewHealthClient(conn)
+		return func() healthpb.HealthCheckResponse_ServingStatus {
+			resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+			gt.Expect(err).NotTo(HaveOccurred())
+			return resp.Status
+		}
+	}
+	serve := func(i int) *comm.GRPCServer {
+		srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+			SecOpts: comm.SecureOptions{
+				UseTLS:      true,
+				Certificate: certPEMs[i],
+				Key:         keyPEMs[i],
+			},
+			HealthCheckEnabled:     true,
+			HealthCertExpiryWindow: window,
+		})
+		gt.Expect(err).NotTo(HaveOccurred())
+		go srv.Start()
+		t.Cleanup(srv.Stop)
+		return srv
+	}
+
+	t.Run("valid certificate", func(t *testing.T) {
+		srv := serve(0)
+		status := healthStatus(srv)
+		gt.Expect(status()).To(Equal(healthpb.HealthCheckResponse_SERVING))
+
+		// a certificate expiring within the window flips the status
+		srv.SetServerCertificate(certs[1])
+		gt.Eventually(status, 5*time.Second).Should(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+
+		// renewing it restores it
+		srv.SetServerCertificate(certs[0])
+		gt.Eventually(status, 5*time.Second).Should(Equal(healthpb.HealthCheckResponse_SERVING))
+	})
+
+	t.Run("near-expired certificate", func(t *testing.T) {
+		srv := serve(1)
+		gt.Expect(healthStatus(srv)()).To(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+	})
+
+	t.Run("certificate entering the window", func(t *testing.T) {
+		srv := serve(2)
+		status := healthStatus(srv)
+		gt.Expect(status()).To(Equal(healthpb.HealthCheckResponse_SERVING))
+		gt.Eventually(status, 10*time.Second).Should(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+	})
+}
+
+func TestHealthCertExpiryInvalidConfig(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	_, _, certPEMs, keyPEMs := expiringCerts(gt, time.Now().Add(time.Hour))
+
+	_, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:      true,
+			Certificate: certPEMs[0],
+			Key:         keyPEMs[0],
+		},
+		HealthCertExpiryWindow: time.Minute,
+	})
+	gt.Expect(err).To(MatchError("serverConfig.HealthCertExpiryWindow requires HealthCheckEnabled to be true"))
+
+	_, err = comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		HealthCheckEnabled:     true,
+		HealthCertExpiryWindow: time.Minute,
+	})
+	gt.Expect(err).To(MatchError("serverConfig.HealthCertExpiryWindow requires UseTLS to be true"))
+}
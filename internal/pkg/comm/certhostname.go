@@ -0,0 +1,66 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// requireCertHostname returns a TLSOption verifying the server certificate
+// chain against the root CAs of the configuration and hostname rather than
+// the server name. It must be applied after the options changing the root
+// CAs. The verified chains are passed on to the VerifyPeerCertificate
+// function already configured, if any.
+func requireCertHostname(hostname string) TLSOption {
+	return func(tlsConfig *tls.Config) {
+		roots := tlsConfig.RootCAs
+		now := tlsConfig.Time
+		verify := tlsConfig.VerifyPeerCertificate
+
+		// the standard verification checks the server name, so it is done
+		// by VerifyPeerCertificate instead
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("no server certificate to verify")
+			}
+			intermediates := x509.NewCertPool()
+			var leaf *x509.Certificate
+			for i, rawCert := range rawCerts {
+				cert, err := x509.ParseCertificate(rawCert)
+				if err != nil {
+					return errors.Wrap(err, "failed to parse server certificate")
+				}
+				if i == 0 {
+					leaf = cert
+					continue
+				}
+				intermediates.AddCert(cert)
+			}
+
+			opts := x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				DNSName:       hostname,
+			}
+			if now != nil {
+				opts.CurrentTime = now()
+			}
+			chains, err := leaf.Verify(opts)
+			if err != nil {
+				return errors.WithMessagef(err, "server certificate %s rejected for required hostname %s", leaf.Subject, hostname)
+			}
+			if verify != nil {
+				return verify(rawCerts, chains)
+			}
+			return nil
+		}
+	}
+}
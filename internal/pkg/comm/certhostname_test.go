@@ -0,0 +1,124 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredCertHostname(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	otherCA, err := tlsgen.NewCA()
+	require.NoError(t, err)
+
+	// the server certificates have no IP address SAN, so the default
+	// verification of 127.0.0.1 would reject them
+	serve := func(host string) string {
+		serverKeyPair, err := ca.NewServerCertKeyPair(host)
+		require.NoError(t, err)
+		srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+			SecOpts: comm.SecureOptions{
+				UseTLS:      true,
+				Certificate: serverKeyPair.Cert,
+				Key:         serverKeyPair.Key,
+			},
+		})
+		require.NoError(t, err)
+		testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+		go srv.Start()
+		t.Cleanup(srv.Stop)
+		return srv.Address()
+	}
+	matching := serve("orderer.example.com")
+	nonMatching := serve("other.example.com")
+
+	tests := []struct {
+		name    string
+		address string
+		rootCAs [][]byte
+		verify  func([][]byte, [][]*x509.Certificate) error
+		success bool
+	}{
+		{name: "matching SAN", address: matching, rootCAs: [][]byte{ca.CertBytes()}, success: true},
+		{name: "non-matching SAN", address: nonMatching, rootCAs: [][]byte{ca.CertBytes()}},
+		{name: "untrusted CA", address: matching, rootCAs: [][]byte{otherCA.CertBytes()}},
+		{
+			name:    "custom verification",
+			address: matching,
+			rootCAs: [][]byte{ca.CertBytes()},
+			verify: func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+				if len(verifiedChains) == 0 {
+					return errors.New("no verified chains")
+				}
+				return nil
+			},
+			success: true,
+		},
+		{
+			name:    "failing custom verification",
+			address: matching,
+			rootCAs: [][]byte{ca.CertBytes()},
+			verify: func([][]byte, [][]*x509.Certificate) error {
+				return errors.New("custom verification failed")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := comm.NewGRPCClient(comm.ClientConfig{
+				SecOpts: comm.SecureOptions{
+					UseTLS:               true,
+					ServerRootCAs:        tt.rootCAs,
+					RequiredCertHostname: "orderer.example.com",
+					VerifyCertificate:    tt.verify,
+				},
+				Timeout: testTimeout,
+			})
+			require.NoError(t, err)
+
+			conn, err := client.NewConnection(tt.address)
+			if !tt.success {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("without required hostname", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := comm.NewGRPCClient(comm.ClientConfig{
+			SecOpts: comm.SecureOptions{
+				UseTLS:        true,
+				ServerRootCAs: [][]byte{ca.CertBytes()},
+			},
+			Timeout: testTimeout,
+		})
+		require.NoError(t, err)
+		_, err = client.NewConnection(matching)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"sync"
+	"time"
+)
+
+// CertificateRotatedReason is the debug data of the GOAWAY frames sent to
+// the connections recycled by RecycleConnections
+const CertificateRotatedReason = "server certificate rotated"
+
+type certificateUpdate struct {
+	recycle      bool
+	recycleGrace time.Duration
+}
+
+// CertificateOption configures SetServerCertificate
+type CertificateOption func(*certificateUpdate)
+
+// RecycleConnections makes SetServerCertificate ask the clients of the
+// connections established before the call to reconnect, so that clients
+// pinning the server certificate pick up the new one. The clients are sent
+// a graceful GOAWAY right away: the calls in progress complete while new
+// calls use a new connection. The connections still open after grace are
+// closed. Connections are only recycled when ServerConfig.SendDrainReason
+// is set, and not when they are secured by transport credentials passed
+// through ExtraServerOptions.
+func RecycleConnections(grace time.Duration) CertificateOption {
+	return func(u *certificateUpdate) {
+		u.recycle = true
+		u.recycleGrace = grace
+	}
+}
+
+// connSet tracks the open TLS connections of a server
+type connSet struct {
+	lock  sync.Mutex
+	conns map[*drainReasonConn]struct{}
+}
+
+func newConnSet() *connSet {
+	return &connSet{conns: map[*drainReasonConn]struct{}{}}
+}
+
+func (s *connSet) add(conn *drainReasonConn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.conns[conn] = struct{}{}
+}
+
+func (s *connSet) remove(conn *drainReasonConn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.conns, conn)
+}
+
+func (s *connSet) snapshot() []*drainReasonConn {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	conns := make([]*drainReasonConn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// recycleConnections sends a graceful GOAWAY to the open TLS connections
+// and closes the ones still open after grace
+func (gServer *GRPCServer) recycleConnections(grace time.Duration) {
+	if !gServer.sendDrainReason {
+		gServer.logger.Warning("Not recycling the connections after the certificate rotation, SendDrainReason is not set")
+		return
+	}
+	conns := gServer.tlsConns.snapshot()
+	if len(conns) == 0 {
+		return
+	}
+	gServer.logger.Infof("Recycling %d connections on %s after a server certificate rotation, closing the remaining ones in %s", len(conns), gServer.address, grace)
+	for _, conn := range conns {
+		if err := conn.goAway(CertificateRotatedReason); err != nil {
+			gServer.logger.Debugf("Failed sending GOAWAY to %s: %s", conn.RemoteAddr(), err)
+		}
+	}
+
+	time.AfterFunc(grace, func() {
+		open := map[*drainReasonConn]struct{}{}
+		for _, conn := range gServer.tlsConns.snapshot() {
+			open[conn] = struct{}{}
+		}
+		for _, conn := range conns {
+			if _, ok := open[conn]; ok {
+				gServer.logger.Debugf("Closing connection from %s still open after the grace period of the certificate rotation", conn.RemoteAddr())
+				conn.Close()
+			}
+		}
+	})
+}
@@ -0,0 +1,162 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+type rotationFixture struct {
+	srv       *comm.GRPCServer
+	conn      *grpc.ClientConn
+	goAways   chan string
+	first     *tlsgen.CertKeyPair
+	second    tls.Certificate
+	secondRaw *x509.Certificate
+}
+
+func newRotationFixture(t *testing.T, gt *GomegaWithT, sendDrainReason bool) *rotationFixture {
+	ca, err := tlsgen.NewCA()
+	gt.Expect(err).NotTo(HaveOccurred())
+	first, err := ca.NewServerCertKeyPair("127.0.0.1")
+	gt.Expect(err).NotTo(HaveOccurred())
+	secondKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	gt.Expect(err).NotTo(HaveOccurred())
+	second, err := tls.X509KeyPair(secondKeyPair.Cert, secondKeyPair.Key)
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:      true,
+			Certificate: first.Cert,
+			Key:         first.Key,
+		},
+		SendDrainReason: sendDrainReason,
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	t.Cleanup(srv.Stop)
+
+	goAways := make(chan string, 10)
+	client, err := comm.NewGRPCClient(comm.ClientConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:        true,
+			ServerRootCAs: [][]byte{ca.CertBytes()},
+		},
+		Timeout: testTimeout,
+		GoAwayHandler: func(address, reason string) {
+			goAways <- reason
+		},
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	conn, err := client.NewConnection(srv.Address())
+	gt.Expect(err).NotTo(HaveOccurred())
+	t.Cleanup(func() { conn.Close() })
+
+	return &rotationFixture{
+		srv:       srv,
+		conn:      conn,
+		goAways:   goAways,
+		first:     first,
+		second:    second,
+		secondRaw: secondKeyPair.TLSCert,
+	}
+}
+
+// serverCertificate returns the certificate the server presented to a call
+func (f *rotationFixture) serverCertificate() (*x509.Certificate, error) {
+	var p peer.Peer
+	_, err := testpb.NewEmptyServiceClient(f.conn).EmptyCall(context.Background(), &testpb.Empty{}, grpc.Peer(&p))
+	if err != nil {
+		return nil, err
+	}
+	return p.AuthInfo.(credentials.TLSInfo).State.PeerCertificates[0], nil
+}
+
+func TestSetServerCertificateRecycleConnections(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+	f := newRotationFixture(t, gt, true)
+
+	cert, err := f.serverCertificate()
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(cert.Equal(f.first.TLSCert)).To(BeTrue())
+
+	stream, err := testpb.NewEmptyServiceClient(f.conn).EmptyStream(context.Background())
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(stream.Send(&testpb.Empty{})).To(Succeed())
+	_, err = stream.Recv()
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	f.srv.SetServerCertificate(f.second, comm.RecycleConnections(time.Second))
+	gt.Eventually(f.goAways, 5*time.Second).Should(Receive(Equal(comm.CertificateRotatedReason)))
+
+	// new calls use a new connection presenting the new certificate
+	gt.Eventually(func() bool {
+		cert, err := f.serverCertificate()
+		return err == nil && cert.Equal(f.secondRaw)
+	}, 5*time.Second, 10*time.Millisecond).Should(BeTrue())
+
+	// while the stream in progress keeps working during the grace period
+	gt.Expect(stream.Send(&testpb.Empty{})).To(Succeed())
+	_, err = stream.Recv()
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	// and is closed after it
+	errs := make(chan error, 1)
+	go func() {
+		_, err := stream.Recv()
+		errs <- err
+	}()
+	gt.Eventually(errs, 5*time.Second).Should(Receive(HaveOccurred()))
+}
+
+func TestSetServerCertificateRecycleConnectionsWithoutDrainReason(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+	f := newRotationFixture(t, gt, false)
+
+	cert, err := f.serverCertificate()
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(cert.Equal(f.first.TLSCert)).To(BeTrue())
+
+	// the connections are not recycled without SendDrainReason
+	f.srv.SetServerCertificate(f.second, comm.RecycleConnections(time.Second))
+	gt.Consistently(f.goAways, 200*time.Millisecond).ShouldNot(Receive())
+	cert, err = f.serverCertificate()
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(cert.Equal(f.first.TLSCert)).To(BeTrue())
+}
+
+func TestSetServerCertificateKeepsConnections(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+	f := newRotationFixture(t, gt, true)
+
+	cert, err := f.serverCertificate()
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(cert.Equal(f.first.TLSCert)).To(BeTrue())
+
+	f.srv.SetServerCertificate(f.second)
+	gt.Consistently(f.goAways, 200*time.Millisecond).ShouldNot(Receive())
+	cert, err = f.serverCertificate()
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(cert.Equal(f.first.TLSCert)).To(BeTrue())
+}
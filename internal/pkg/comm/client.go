@@ -10,11 +10,15 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 )
 
 type GRPCClient struct {
@@ -28,6 +32,18 @@ type GRPCClient struct {
 	maxRecvMsgSize int
 	// Maximum message size the client can send
 	maxSendMsgSize int
+	// Options appended after the derived dial options
+	extraDialOpts []grpc.DialOption
+	// Whether server root CAs containing invalid certificates are rejected
+	strictServerRootCAs bool
+	// Called with the debug data of GOAWAY frames received from servers
+	goAwayHandler func(address, reason string)
+	// Hostname server certificates are verified against, if not empty
+	requiredCertHostname string
+	// Called after every connection is dialed
+	onDial func(address string, err error, d time.Duration)
+	// TCP_NODELAY option of the connections, if it is set
+	disableNagle *bool
 }
 
 // NewGRPCClient creates a new implementation of GRPCClient given an address
@@ -41,24 +57,55 @@ func NewGRPCClient(config ClientConfig) (*GRPCClient, error) {
 		return client, err
 	}
 
-	// keepalive options
-
-	kap := keepalive.ClientParameters{
-		Time:                config.KaOpts.ClientInterval,
-		Timeout:             config.KaOpts.ClientTimeout,
-		PermitWithoutStream: true,
-	}
 	// set keepalive
-	client.dialOpts = append(client.dialOpts, grpc.WithKeepaliveParams(kap))
+	kaOpts, err := resolveKeepalive(config.KeepaliveProfile, config.KaOpts)
+	if err != nil {
+		return client, err
+	}
+	client.dialOpts = append(client.dialOpts, ClientKeepaliveOptions(kaOpts)...)
+	params := kaOpts.EffectiveClientKeepaliveParams()
+	commLogger.Debugw("Creating client with effective keepalive settings",
+		"time", params.Time,
+		"timeout", params.Timeout,
+		"permitWithoutStream", params.PermitWithoutStream,
+	)
+
 	// Unless asynchronous connect is set, make connection establishment blocking.
 	if !config.AsyncConnect {
 		client.dialOpts = append(client.dialOpts, grpc.WithBlock())
 		client.dialOpts = append(client.dialOpts, grpc.FailOnNonTempDialError(true))
 	}
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	client.dialOpts = append(client.dialOpts, grpc.WithUserAgent(userAgent))
+	if config.DefaultWaitForReady {
+		client.dialOpts = append(client.dialOpts,
+			grpc.WithChainUnaryInterceptor(waitForReadyUnaryInterceptor),
+			grpc.WithChainStreamInterceptor(waitForReadyStreamInterceptor),
+		)
+	}
+	if config.PerRPCCredentials != nil {
+		client.dialOpts = append(client.dialOpts, grpc.WithPerRPCCredentials(config.PerRPCCredentials))
+	}
+	if _, err := lookupCompressor(config.Compressor); err != nil {
+		return client, err
+	}
+	if config.Compressor != "" {
+		client.dialOpts = append(client.dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(config.Compressor)))
+	}
+	if config.DisableRetry {
+		client.dialOpts = append(client.dialOpts, grpc.WithDisableRetry())
+	}
 	client.timeout = config.Timeout
 	// set send/recv message size to package defaults
 	client.maxRecvMsgSize = MaxRecvMsgSize
 	client.maxSendMsgSize = MaxSendMsgSize
+	client.extraDialOpts = config.ExtraDialOptions
+	client.goAwayHandler = config.GoAwayHandler
+	client.onDial = config.OnDial
+	client.disableNagle = config.DisableNagle
 
 	return client, nil
 }
@@ -66,22 +113,42 @@ func NewGRPCClient(config ClientConfig) (*GRPCClient, error) {
 func (client *GRPCClient) parseSecureOptions(opts SecureOptions) error {
 	// if TLS is not enabled, return
 	if !opts.UseTLS {
-		return nil
+		return opts.checkIgnoredTLSFields(commLogger)
 	}
 
+	if err := opts.checkCurvePreferences(); err != nil {
+		return err
+	}
+	verifyCertificate := opts.VerifyCertificate
+	if opts.RequireSCT {
+		verifyCertificate = requireEmbeddedSCTs(verifyCertificate)
+	}
+	if len(opts.CRLs) > 0 {
+		crls, err := parseCRLs(opts.CRLs)
+		if err != nil {
+			return err
+		}
+		verifyCertificate = rejectRevoked(crls, verifyCertificate)
+	}
 	client.tlsConfig = &tls.Config{
-		VerifyPeerCertificate: opts.VerifyCertificate,
+		VerifyPeerCertificate: verifyCertificate,
 		MinVersion:            tls.VersionTLS12,
+		Renegotiation:         opts.Renegotiation,
+		KeyLogWriter:          opts.KeyLogWriter,
+		CurvePreferences:      opts.CurvePreferences,
+	}
+	if opts.KeyLogWriter != nil {
+		commLogger.Warning("TLS key logging is enabled for the client, the traffic of its connections can be decrypted; it must not be used in production")
 	}
+	client.strictServerRootCAs = opts.StrictServerRootCAs
+	client.requiredCertHostname = opts.RequiredCertHostname
 	if len(opts.ServerRootCAs) > 0 {
-		client.tlsConfig.RootCAs = x509.NewCertPool()
-		for _, certBytes := range opts.ServerRootCAs {
-			err := AddPemToCertPool(certBytes, client.tlsConfig.RootCAs)
-			if err != nil {
-				commLogger.Debugf("error adding root certificate: %v", err)
-				return errors.WithMessage(err, "error adding root certificate")
-			}
+		certPool, err := newRootCertPool(opts.ServerRootCAs, opts.StrictServerRootCAs)
+		if err != nil {
+			commLogger.Debugf("error adding root certificate: %v", err)
+			return errors.WithMessage(err, "error adding root certificate")
 		}
+		client.tlsConfig.RootCAs = certPool
 	}
 	if opts.RequireClientCert {
 		// make sure we have both Key and Certificate
@@ -147,12 +214,9 @@ func (client *GRPCClient) SetServerRootCAs(serverRoots [][]byte) error {
 
 	// NOTE: if no serverRoots are specified, the current cert pool will be
 	// replaced with an empty one
-	certPool := x509.NewCertPool()
-	for _, root := range serverRoots {
-		err := AddPemToCertPool(root, certPool)
-		if err != nil {
-			return errors.WithMessage(err, "error adding root certificate")
-		}
+	certPool, err := newRootCertPool(serverRoots, client.strictServerRootCAs)
+	if err != nil {
+		return errors.WithMessage(err, "error adding root certificate")
 	}
 	client.tlsConfig.RootCAs = certPool
 	return nil
@@ -176,36 +240,167 @@ func CertPoolOverride(pool *x509.CertPool) TLSOption {
 // overrides the server name used to verify the hostname on the
 // certificate returned by a server when using TLS
 func (client *GRPCClient) NewConnection(address string, tlsOptions ...TLSOption) (*grpc.ClientConn, error) {
+	return client.NewLabeledConnection("", address, tlsOptions...)
+}
 
+// NewLabeledConnection is like NewConnection but tags the connection with a
+// logical name, such as orderer-1, to correlate the logs and metrics
+// referring to it. The label is added to the client TLS handshake logs,
+// where it defaults to address when empty, and, unless empty, to the
+// context of every call made on the connection, where interceptors can
+// retrieve it with ConnectionLabelFromContext. The response size guard logs
+// and counts the responses it rejects with it.
+func (client *GRPCClient) NewLabeledConnection(label, address string, tlsOptions ...TLSOption) (*grpc.ClientConn, error) {
 	var dialOpts []grpc.DialOption
+	if label != "" {
+		// the label interceptors come first so that every other chained
+		// interceptor sees the label
+		dialOpts = append(dialOpts,
+			grpc.WithChainUnaryInterceptor(connectionLabelUnaryInterceptor(label)),
+			grpc.WithChainStreamInterceptor(connectionLabelStreamInterceptor(label)),
+		)
+	}
+	handshakeLabel := label
+	if handshakeLabel == "" {
+		handshakeLabel = address
+	}
 	dialOpts = append(dialOpts, client.dialOpts...)
 
 	// set transport credentials and max send/recv message sizes
 	// immediately before creating a connection in order to allow
 	// SetServerRootCAs / SetMaxRecvMsgSize / SetMaxSendMsgSize
 	//  to take effect on a per connection basis
+	var dialer func(context.Context, string) (net.Conn, error)
+	if client.disableNagle != nil {
+		dialer = noDelayDialer(*client.disableNagle)
+	}
+	var onGoAway func(reason string)
+	if client.goAwayHandler != nil {
+		onGoAway = func(reason string) { client.goAwayHandler(address, reason) }
+	}
 	if client.tlsConfig != nil {
-		dialOpts = append(dialOpts, grpc.WithTransportCredentials(
-			&DynamicClientCredentials{
-				TLSConfig:  client.tlsConfig,
-				TLSOptions: tlsOptions,
-			},
-		))
+		if client.requiredCertHostname != "" {
+			// applied last to verify against the root CAs set by the others
+			tlsOptions = append(tlsOptions[:len(tlsOptions):len(tlsOptions)], requireCertHostname(client.requiredCertHostname))
+		}
+		var creds credentials.TransportCredentials = &DynamicClientCredentials{
+			TLSConfig:  client.tlsConfig,
+			TLSOptions: tlsOptions,
+			Label:      handshakeLabel,
+		}
+		if onGoAway != nil {
+			creds = &goAwayCredentials{TransportCredentials: creds, onGoAway: onGoAway}
+		}
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(creds))
 	} else {
 		dialOpts = append(dialOpts, grpc.WithInsecure())
+		if onGoAway != nil {
+			dialer = goAwayDialer(dialer, onGoAway)
+		}
+	}
+	if dialer != nil {
+		dialOpts = append(dialOpts, grpc.WithContextDialer(dialer))
 	}
 
 	dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(
 		grpc.MaxCallRecvMsgSize(client.maxRecvMsgSize),
 		grpc.MaxCallSendMsgSize(client.maxSendMsgSize),
 	))
+	// extra dial options come last so they can override the ones above
+	dialOpts = append(dialOpts, client.extraDialOpts...)
 
 	ctx, cancel := context.WithTimeout(context.Background(), client.timeout)
 	defer cancel()
+	start := time.Now()
 	conn, err := grpc.DialContext(ctx, address, dialOpts...)
 	if err != nil {
-		return nil, errors.WithMessage(errors.WithStack(err),
+		err = errors.WithMessage(errors.WithStack(err),
 			"failed to create new connection")
 	}
+	if client.onDial != nil {
+		client.onDial(address, err, time.Since(start))
+	}
+	if err != nil {
+		return nil, err
+	}
 	return conn, nil
 }
+
+type connectionLabelKey struct{}
+
+// ConnectionLabelFromContext returns the label of the connection a call is
+// made on, as set by NewLabeledConnection, or an empty string if the
+// connection has no label
+func ConnectionLabelFromContext(ctx context.Context) string {
+	label, _ := ctx.Value(connectionLabelKey{}).(string)
+	return label
+}
+
+func connectionLabelUnaryInterceptor(label string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(context.WithValue(ctx, connectionLabelKey{}, label), method, req, reply, cc, opts...)
+	}
+}
+
+func connectionLabelStreamInterceptor(label string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(context.WithValue(ctx, connectionLabelKey{}, label), desc, cc, method, opts...)
+	}
+}
+
+// waitForReadyUnaryInterceptor makes calls wait for the connection to be
+// ready; call options set by the caller come last and take precedence
+func waitForReadyUnaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(ctx, method, req, reply, cc, append([]grpc.CallOption{grpc.WaitForReady(true)}, opts...)...)
+}
+
+// waitForReadyStreamInterceptor is the stream counterpart of
+// waitForReadyUnaryInterceptor
+func waitForReadyStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(ctx, desc, cc, method, append([]grpc.CallOption{grpc.WaitForReady(true)}, opts...)...)
+}
+
+// WaitUntilReady blocks until conn is ready or ctx is done. In the latter
+// case, the returned error includes the last state of the connection.
+func WaitUntilReady(ctx context.Context, conn *grpc.ClientConn) error {
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Shutdown:
+			return errors.Errorf("connection to %s is shut down", conn.Target())
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return errors.Errorf("connection to %s not ready: %s (last state %s)", conn.Target(), ctx.Err(), state)
+		}
+	}
+}
+
+// NewConnectionWithFallback creates a client from config and connects to the
+// first of addresses that can be reached, trying them in order. Each attempt
+// blocks until the connection is ready or config.Timeout expires, regardless
+// of config.AsyncConnect. If no address can be reached, the returned error
+// lists the failure of every attempt.
+func NewConnectionWithFallback(addresses []string, config ClientConfig) (*grpc.ClientConn, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no addresses to connect to")
+	}
+
+	config.AsyncConnect = false
+	client, err := NewGRPCClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []string
+	for _, address := range addresses {
+		conn, err := client.NewConnection(address)
+		if err == nil {
+			return conn, nil
+		}
+		commLogger.Debugf("Failed connecting to %s, trying next address: %s", address, err)
+		failures = append(failures, fmt.Sprintf("%s: %s", address, err))
+	}
+	return nil, errors.Errorf("failed to connect to any of %d addresses: %s", len(addresses), strings.Join(failures, "; "))
+}
@@ -11,6 +11,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"io"
 	"io/ioutil"
 	"net"
 	"path/filepath"
@@ -27,8 +28,12 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
 )
 
 const testTimeout = 1 * time.Second // conservative
@@ -203,7 +208,7 @@ func TestNewConnection(t *testing.T) {
 				Timeout: time.Second,
 			},
 			success:  false,
-			errorMsg: "context deadline exceeded",
+			errorMsg: "core/comm: the server does not use TLS, the client must not use TLS either: .* answered in plaintext",
 		},
 		{
 			name: "client TLS / server TLS match",
@@ -428,6 +433,145 @@ func TestSetServerRootCAs(t *testing.T) {
 	require.Contains(t, err.Error(), "error adding root certificate")
 }
 
+func TestServerRootCAsPartialBundle(t *testing.T) {
+	t.Parallel()
+	testCerts := loadCerts(t)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{testCerts.serverCert},
+	})))
+	defer srv.Stop()
+	go srv.Serve(lis)
+
+	mixedEntry := append([]byte(badPEM), testCerts.caPEM...)
+	tests := []struct {
+		name   string
+		roots  [][]byte
+		strict bool
+		errMsg string
+	}{
+		{
+			name:  "lenient mixed entries",
+			roots: [][]byte{[]byte(badPEM), testCerts.caPEM, []byte("not a certificate")},
+		},
+		{
+			name:  "lenient mixed entry",
+			roots: [][]byte{mixedEntry},
+		},
+		{
+			name:   "lenient no valid certificates",
+			roots:  [][]byte{[]byte(badPEM), []byte("not a certificate")},
+			errMsg: "error adding root certificate: no valid root certificates found",
+		},
+		{
+			name:   "strict mixed entries",
+			roots:  [][]byte{testCerts.caPEM, []byte(badPEM)},
+			strict: true,
+			errMsg: "error adding root certificate: invalid certificate in root CA entry 1: ",
+		},
+		{
+			name:   "strict mixed entry",
+			roots:  [][]byte{mixedEntry},
+			strict: true,
+			errMsg: "error adding root certificate: invalid certificate in root CA entry 0: ",
+		},
+		{
+			name:   "strict entry without certificates",
+			roots:  [][]byte{testCerts.caPEM, []byte("not a certificate")},
+			strict: true,
+			errMsg: "error adding root certificate: no valid certificates in root CA entry 1",
+		},
+		{
+			name:   "strict valid entries",
+			roots:  [][]byte{testCerts.caPEM},
+			strict: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			secOpts := comm.SecureOptions{
+				UseTLS:              true,
+				ServerRootCAs:       tt.roots,
+				StrictServerRootCAs: tt.strict,
+			}
+
+			client, err := comm.NewGRPCClient(comm.ClientConfig{SecOpts: secOpts, Timeout: testTimeout})
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			conn, err := client.NewConnection(lis.Addr().String())
+			require.NoError(t, err)
+			conn.Close()
+
+			// SetServerRootCAs applies the same mode
+			err = client.SetServerRootCAs(tt.roots)
+			require.NoError(t, err)
+			err = client.SetServerRootCAs([][]byte{testCerts.caPEM, []byte(badPEM)})
+			if tt.strict {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "error adding root certificate: invalid certificate in root CA entry 1: ")
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRenegotiation(t *testing.T) {
+	t.Parallel()
+	testCerts := loadCerts(t)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{testCerts.serverCert},
+	})))
+	defer srv.Stop()
+	go srv.Serve(lis)
+
+	tests := []struct {
+		name     string
+		policy   tls.RenegotiationSupport
+		expected tls.RenegotiationSupport
+	}{
+		{name: "default", expected: tls.RenegotiateNever},
+		{name: "once", policy: tls.RenegotiateOnceAsClient, expected: tls.RenegotiateOnceAsClient},
+		{name: "freely", policy: tls.RenegotiateFreelyAsClient, expected: tls.RenegotiateFreelyAsClient},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := comm.NewGRPCClient(comm.ClientConfig{
+				SecOpts: comm.SecureOptions{
+					UseTLS:        true,
+					ServerRootCAs: [][]byte{testCerts.caPEM},
+					Renegotiation: tt.policy,
+				},
+				Timeout: testTimeout,
+			})
+			require.NoError(t, err)
+
+			var renegotiation tls.RenegotiationSupport
+			conn, err := client.NewConnection(lis.Addr().String(), func(tlsConfig *tls.Config) {
+				renegotiation = tlsConfig.Renegotiation
+			})
+			require.NoError(t, err)
+			conn.Close()
+			require.Equal(t, tt.expected, renegotiation)
+		})
+	}
+}
+
 func TestSetMessageSize(t *testing.T) {
 	t.Parallel()
 
@@ -525,6 +669,224 @@ func TestSetMessageSize(t *testing.T) {
 	}
 }
 
+type countingStatsHandler struct {
+	conns uint32
+	rpcs  uint32
+}
+
+func (h *countingStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	atomic.AddUint32(&h.rpcs, 1)
+	return ctx
+}
+
+func (h *countingStatsHandler) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (h *countingStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	atomic.AddUint32(&h.conns, 1)
+	return ctx
+}
+
+func (h *countingStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestExtraDialOptions(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{})
+	require.NoError(t, err)
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	defer srv.Stop()
+	go srv.Start()
+
+	statsHandler := &countingStatsHandler{}
+	client, err := comm.NewGRPCClient(comm.ClientConfig{
+		Timeout: testTimeout,
+		ExtraDialOptions: []grpc.DialOption{
+			grpc.WithStatsHandler(statsHandler),
+			// overrides the default call options derived from the client
+			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(1)),
+		},
+	})
+	require.NoError(t, err)
+
+	conn, err := client.NewConnection(lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{Payload: []byte{0, 0, 0, 0, 0}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "received message larger than max")
+	require.Equal(t, uint32(1), atomic.LoadUint32(&statsHandler.conns))
+	require.Equal(t, uint32(1), atomic.LoadUint32(&statsHandler.rpcs))
+}
+
+func TestNewConnectionWithFallback(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{})
+	require.NoError(t, err)
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	defer srv.Stop()
+	go srv.Start()
+
+	deadLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadAddress := deadLis.Addr().String()
+	deadLis.Close()
+
+	config := comm.ClientConfig{Timeout: testTimeout, AsyncConnect: true}
+
+	conn, err := comm.NewConnectionWithFallback([]string{deadAddress, lis.Addr().String()}, config)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, lis.Addr().String(), conn.Target())
+	_, err = testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{})
+	require.NoError(t, err)
+
+	_, err = comm.NewConnectionWithFallback([]string{deadAddress, deadAddress}, config)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to connect to any of 2 addresses: "+deadAddress+": ")
+	require.Contains(t, err.Error(), "; "+deadAddress+": ")
+
+	_, err = comm.NewConnectionWithFallback(nil, config)
+	require.EqualError(t, err, "no addresses to connect to")
+}
+
+func TestUserAgent(t *testing.T) {
+	t.Parallel()
+
+	userAgents := make(chan []string, 1)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+		UnaryInterceptors: []grpc.UnaryServerInterceptor{
+			func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				userAgents <- md.Get("user-agent")
+				return handler(ctx, req)
+			},
+		},
+	})
+	require.NoError(t, err)
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	defer srv.Stop()
+	go srv.Start()
+
+	userAgent := func(config comm.ClientConfig) string {
+		config.Timeout = testTimeout
+		client, err := comm.NewGRPCClient(config)
+		require.NoError(t, err)
+		conn, err := client.NewConnection(lis.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{})
+		require.NoError(t, err)
+		received := <-userAgents
+		require.Len(t, received, 1)
+		return received[0]
+	}
+
+	require.Regexp(t, `^hyperledger-fabric/\S+ grpc-go/`, userAgent(comm.ClientConfig{}))
+	require.Regexp(t, `^orderer-cli/1.0 grpc-go/`, userAgent(comm.ClientConfig{UserAgent: "orderer-cli/1.0"}))
+}
+
+func TestWaitUntilReady(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{})
+	require.NoError(t, err)
+	defer srv.Stop()
+	go srv.Start()
+
+	deadLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadAddress := deadLis.Addr().String()
+	deadLis.Close()
+
+	client, err := comm.NewGRPCClient(comm.ClientConfig{Timeout: testTimeout, AsyncConnect: true})
+	require.NoError(t, err)
+
+	conn, err := client.NewConnection(lis.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, comm.WaitUntilReady(context.Background(), conn))
+	conn.Close()
+	require.EqualError(t, comm.WaitUntilReady(context.Background(), conn), "connection to "+lis.Addr().String()+" is shut down")
+
+	conn, err = client.NewConnection(deadAddress)
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = comm.WaitUntilReady(ctx, conn)
+	require.Error(t, err)
+	require.Regexp(t, `^connection to `+deadAddress+` not ready: context deadline exceeded \(last state (CONNECTING|TRANSIENT_FAILURE)\)$`, err.Error())
+}
+
+func TestDefaultWaitForReady(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := lis.Addr().String()
+	lis.Close()
+
+	newConn := func(waitForReady bool) *grpc.ClientConn {
+		client, err := comm.NewGRPCClient(comm.ClientConfig{
+			Timeout:             testTimeout,
+			AsyncConnect:        true,
+			DefaultWaitForReady: waitForReady,
+		})
+		require.NoError(t, err)
+		conn, err := client.NewConnection(address)
+		require.NoError(t, err)
+		return conn
+	}
+
+	failFast := newConn(false)
+	defer failFast.Close()
+	_, err = testpb.NewEchoServiceClient(failFast).EchoCall(context.Background(), &testpb.Echo{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	waiting := newConn(true)
+	defer waiting.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	// the per call option takes precedence over the default
+	_, err = testpb.NewEchoServiceClient(waiting).EchoCall(ctx, &testpb.Echo{}, grpc.WaitForReady(false))
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = testpb.NewEchoServiceClient(waiting).EchoCall(ctx, &testpb.Echo{})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	result := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		stream, err := testpb.NewEmptyServiceClient(waiting).EmptyStream(ctx)
+		if err == nil {
+			err = stream.CloseSend()
+		}
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		result <- err
+	}()
+
+	// the call waits for the server to come up
+	lis, err = net.Listen("tcp", address)
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	defer srv.Stop()
+	go srv.Start()
+	require.Equal(t, io.EOF, <-result)
+}
+
 type testCerts struct {
 	caPEM      []byte
 	certPEM    []byte
@@ -666,3 +1028,275 @@ func TestDynamicClientTLSLoading(t *testing.T) {
 	server.Stop()
 	wg.Wait()
 }
+
+func TestNewLabeledConnection(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	var lock sync.Mutex
+	var labels []string
+	record := func(ctx context.Context) {
+		lock.Lock()
+		defer lock.Unlock()
+		labels = append(labels, comm.ConnectionLabelFromContext(ctx))
+	}
+	client, err := comm.NewGRPCClient(comm.ClientConfig{
+		Timeout: testTimeout,
+		ExtraDialOptions: []grpc.DialOption{
+			grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				record(ctx)
+				return invoker(ctx, method, req, reply, cc, opts...)
+			}),
+			grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				record(ctx)
+				return streamer(ctx, desc, cc, method, opts...)
+			}),
+		},
+	})
+	require.NoError(t, err)
+
+	call := func(conn *grpc.ClientConn) []string {
+		defer conn.Close()
+		lock.Lock()
+		labels = nil
+		lock.Unlock()
+
+		emptyClient := testpb.NewEmptyServiceClient(conn)
+		_, err := emptyClient.EmptyCall(context.Background(), &testpb.Empty{})
+		require.NoError(t, err)
+		stream, err := emptyClient.EmptyStream(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, stream.CloseSend())
+
+		lock.Lock()
+		defer lock.Unlock()
+		return labels
+	}
+
+	conn, err := client.NewLabeledConnection("orderer-1", lis.Addr().String())
+	require.NoError(t, err)
+	require.Equal(t, []string{"orderer-1", "orderer-1"}, call(conn))
+
+	// connections without a label do not add it to the calls
+	conn, err = client.NewLabeledConnection("", lis.Addr().String())
+	require.NoError(t, err)
+	require.Equal(t, []string{"", ""}, call(conn))
+
+	conn, err = client.NewConnection(lis.Addr().String())
+	require.NoError(t, err)
+	require.Equal(t, []string{"", ""}, call(conn))
+
+	require.Empty(t, comm.ConnectionLabelFromContext(context.Background()))
+}
+
+type failingEmptyServiceServer struct {
+	emptyServiceServer
+	calls uint32
+}
+
+func (fs *failingEmptyServiceServer) EmptyCall(context.Context, *testpb.Empty) (*testpb.Empty, error) {
+	atomic.AddUint32(&fs.calls, 1)
+	return nil, status.Error(codes.Unavailable, "try again")
+}
+
+func TestDisableRetry(t *testing.T) {
+	t.Parallel()
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	require.NoError(t, err)
+	svc := &failingEmptyServiceServer{}
+	testpb.RegisterEmptyServiceServer(srv.Server(), svc)
+	go srv.Start()
+	defer srv.Stop()
+
+	client, err := comm.NewGRPCClient(comm.ClientConfig{
+		Timeout:      testTimeout,
+		DisableRetry: true,
+		ExtraDialOptions: []grpc.DialOption{
+			grpc.WithDefaultServiceConfig(`{
+				"methodConfig": [{
+					"name": [{"service": "EmptyService"}],
+					"retryPolicy": {
+						"maxAttempts": 5,
+						"initialBackoff": "0.01s",
+						"maxBackoff": "0.01s",
+						"backoffMultiplier": 1,
+						"retryableStatusCodes": ["UNAVAILABLE"]
+					}
+				}]
+			}`),
+		},
+	})
+	require.NoError(t, err)
+	conn, err := client.NewConnection(srv.Address())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// without DisableRetry the call is attempted five times when gRPC
+	// retries are enabled with GRPC_GO_RETRY=on
+	_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, uint32(1), atomic.LoadUint32(&svc.calls))
+}
+
+func TestOnDial(t *testing.T) {
+	t.Parallel()
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	// nothing listens on the address of a closed listener
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := lis.Addr().String()
+	lis.Close()
+
+	type dial struct {
+		address string
+		err     error
+		d       time.Duration
+	}
+	var dials []dial
+	client, err := comm.NewGRPCClient(comm.ClientConfig{
+		Timeout: 100 * time.Millisecond,
+		OnDial: func(address string, err error, d time.Duration) {
+			dials = append(dials, dial{address: address, err: err, d: d})
+		},
+	})
+	require.NoError(t, err)
+
+	conn, err := client.NewConnection(srv.Address())
+	require.NoError(t, err)
+	conn.Close()
+	_, err = client.NewConnection(unreachable)
+	require.Error(t, err)
+
+	require.Len(t, dials, 2)
+	require.Equal(t, srv.Address(), dials[0].address)
+	require.NoError(t, dials[0].err)
+	require.True(t, dials[0].d > 0)
+	require.Equal(t, unreachable, dials[1].address)
+	require.Equal(t, err, dials[1].err)
+	require.True(t, dials[1].d > 0)
+}
+
+func TestCurvePreferences(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:           true,
+			Certificate:      serverKeyPair.Cert,
+			Key:              serverKeyPair.Key,
+			CurvePreferences: []tls.CurveID{tls.CurveP384},
+		},
+	})
+	require.NoError(t, err)
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	tests := []struct {
+		name   string
+		curves []tls.CurveID
+		err    string
+	}{
+		// clients offering every default curve negotiate the server's one
+		{name: "default", curves: nil},
+		{name: "matching", curves: []tls.CurveID{tls.CurveP384}},
+		{name: "matching among others", curves: []tls.CurveID{tls.CurveP256, tls.CurveP384}},
+		// a client restricted to a curve only offers that one
+		{name: "mismatch", curves: []tls.CurveID{tls.CurveP256}, err: "handshake failure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := comm.NewGRPCClient(comm.ClientConfig{
+				SecOpts: comm.SecureOptions{
+					UseTLS:           true,
+					ServerRootCAs:    [][]byte{ca.CertBytes()},
+					CurvePreferences: tt.curves,
+				},
+				Timeout: testTimeout,
+			})
+			require.NoError(t, err)
+			conn, err := client.NewConnection(srv.Address())
+			if tt.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestCurvePreferencesEmpty(t *testing.T) {
+	t.Parallel()
+
+	secOpts := comm.SecureOptions{
+		UseTLS:           true,
+		CurvePreferences: []tls.CurveID{},
+	}
+	_, err := comm.NewGRPCClient(comm.ClientConfig{SecOpts: secOpts})
+	require.EqualError(t, err, "SecureOptions.CurvePreferences must not be empty when set")
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	secOpts.Certificate, secOpts.Key = serverKeyPair.Cert, serverKeyPair.Key
+	_, err = comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{SecOpts: secOpts})
+	require.EqualError(t, err, "SecureOptions.CurvePreferences must not be empty when set")
+}
+
+func TestDisableNagle(t *testing.T) {
+	t.Parallel()
+
+	disableNagle := false
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{DisableNagle: &disableNagle, SendDrainReason: true})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	goAways := make(chan string, 1)
+	client, err := comm.NewGRPCClient(comm.ClientConfig{
+		Timeout:      testTimeout,
+		DisableNagle: &disableNagle,
+		GoAwayHandler: func(address, reason string) {
+			goAways <- reason
+		},
+	})
+	require.NoError(t, err)
+	conn, err := client.NewConnection(srv.Address())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	require.NoError(t, err)
+
+	// the GOAWAY frames are still reported on connections dialed with
+	// Nagle's algorithm enabled
+	srv.GracefulStop("maintenance")
+	select {
+	case reason := <-goAways:
+		require.Equal(t, "maintenance", reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal("GOAWAY not reported")
+	}
+}
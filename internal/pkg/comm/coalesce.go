@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// CoalescingKeyFunc returns the key used to coalesce a unary call. Concurrent
+// calls that share a key are coalesced into a single call whose response is
+// shared by all of them. Returning false excludes the call from coalescing.
+//
+// Coalescing is only safe for idempotent reads; the key function must return
+// false for every method with side effects.
+type CoalescingKeyFunc func(method string, req interface{}) (key string, ok bool)
+
+// MethodRequestHashKey is a CoalescingKeyFunc that keys a call on its full
+// method name and the SHA-256 hash of the deterministically marshaled
+// request. It can be wrapped by a function that restricts coalescing to
+// methods known to be idempotent reads.
+func MethodRequestHashKey(method string, req interface{}) (string, bool) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return "", false
+	}
+	buf := proto.NewBuffer(nil)
+	buf.SetDeterministic(true)
+	if err := buf.Marshal(msg); err != nil {
+		return "", false
+	}
+	hash := sha256.Sum256(buf.Bytes())
+	return method + "/" + hex.EncodeToString(hash[:]), true
+}
+
+type coalescedCall struct {
+	done  chan struct{}
+	reply proto.Message
+	err   error
+	// whether the call failed because the context of its first caller was
+	// done, in which case the other callers perform the call again
+	callerDone bool
+}
+
+type callCoalescer struct {
+	lock  sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// NewCoalescingInterceptor returns a unary client interceptor that coalesces
+// concurrent identical calls, as identified by key, into a single call to the
+// server. The first caller performs the call using its own context; the other
+// callers wait for its result, or for their own context to be done, and
+// receive a copy of the response or the same error. If the call fails
+// because the context of the first caller is done, the callers whose context
+// is not done perform the call again.
+func NewCoalescingInterceptor(key CoalescingKeyFunc) grpc.UnaryClientInterceptor {
+	cc := &callCoalescer{calls: map[string]*coalescedCall{}}
+
+	return func(ctx context.Context, method string, req, reply interface{}, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		k, ok := key(method, req)
+		if !ok {
+			return invoker(ctx, method, req, reply, conn, opts...)
+		}
+		replyMsg, ok := reply.(proto.Message)
+		if !ok {
+			return invoker(ctx, method, req, reply, conn, opts...)
+		}
+
+		for {
+			cc.lock.Lock()
+			call, ok := cc.calls[k]
+			if !ok {
+				break
+			}
+			cc.lock.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			if call.callerDone && ctx.Err() == nil {
+				continue
+			}
+			if call.err != nil {
+				return call.err
+			}
+			replyMsg.Reset()
+			proto.Merge(replyMsg, call.reply)
+			return nil
+		}
+		call := &coalescedCall{done: make(chan struct{})}
+		cc.calls[k] = call
+		cc.lock.Unlock()
+
+		call.err = invoker(ctx, method, req, reply, conn, opts...)
+		if call.err == nil {
+			call.reply = proto.Clone(replyMsg)
+		} else {
+			call.callerDone = ctx.Err() != nil
+		}
+
+		cc.lock.Lock()
+		delete(cc.calls, k)
+		cc.lock.Unlock()
+		close(call.done)
+
+		return call.err
+	}
+}
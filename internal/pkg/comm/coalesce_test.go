@@ -0,0 +1,163 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type blockingEchoServer struct {
+	calls   uint32
+	release chan struct{}
+}
+
+func (bs *blockingEchoServer) EchoCall(ctx context.Context, echo *testpb.Echo) (*testpb.Echo, error) {
+	atomic.AddUint32(&bs.calls, 1)
+	<-bs.release
+	return echo, nil
+}
+
+func TestCoalescingInterceptor(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{})
+	require.NoError(t, err)
+	echoSvc := &blockingEchoServer{release: make(chan struct{})}
+	testpb.RegisterEchoServiceServer(srv.Server(), echoSvc)
+	defer srv.Stop()
+	go srv.Start()
+
+	var keyCalls uint32
+	key := func(method string, req interface{}) (string, bool) {
+		atomic.AddUint32(&keyCalls, 1)
+		return comm.MethodRequestHashKey(method, req)
+	}
+	client, err := comm.NewGRPCClient(comm.ClientConfig{
+		Timeout:          testTimeout,
+		ExtraDialOptions: []grpc.DialOption{grpc.WithUnaryInterceptor(comm.NewCoalescingInterceptor(key))},
+	})
+	require.NoError(t, err)
+	conn, err := client.NewConnection(lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	svcClient := testpb.NewEchoServiceClient(conn)
+
+	const concurrency = 10
+	var wg sync.WaitGroup
+	responses := make([]*testpb.Echo, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := svcClient.EchoCall(context.Background(), &testpb.Echo{Payload: []byte("same")})
+			require.NoError(t, err)
+			responses[i] = resp
+		}(i)
+	}
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadUint32(&keyCalls) == concurrency && atomic.LoadUint32(&echoSvc.calls) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	// give the followers time to join the in-flight call
+	time.Sleep(50 * time.Millisecond)
+	close(echoSvc.release)
+	wg.Wait()
+
+	require.Equal(t, uint32(1), atomic.LoadUint32(&echoSvc.calls))
+	for _, resp := range responses {
+		require.Equal(t, []byte("same"), resp.Payload)
+	}
+	// responses are copies and not shared between callers
+	responses[0].Payload[0] = 'S'
+	require.Equal(t, []byte("same"), responses[1].Payload)
+
+	// different requests are not coalesced
+	_, err = svcClient.EchoCall(context.Background(), &testpb.Echo{Payload: []byte("one")})
+	require.NoError(t, err)
+	_, err = svcClient.EchoCall(context.Background(), &testpb.Echo{Payload: []byte("two")})
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), atomic.LoadUint32(&echoSvc.calls))
+}
+
+func TestCoalescingInterceptorFirstCallerCanceled(t *testing.T) {
+	t.Parallel()
+
+	var keyCalls uint32
+	interceptor := comm.NewCoalescingInterceptor(func(method string, req interface{}) (string, bool) {
+		atomic.AddUint32(&keyCalls, 1)
+		return comm.MethodRequestHashKey(method, req)
+	})
+
+	var invocations uint32
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddUint32(&invocations, 1) == 1 {
+			<-ctx.Done()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		reply.(*testpb.Echo).Payload = []byte("same")
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leaderErr := make(chan error, 1)
+	go func() {
+		leaderErr <- interceptor(ctx, "/EchoService/EchoCall", &testpb.Echo{Payload: []byte("same")}, &testpb.Echo{}, nil, invoker)
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadUint32(&invocations) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	reply := &testpb.Echo{}
+	waiterErr := make(chan error, 1)
+	go func() {
+		waiterErr <- interceptor(context.Background(), "/EchoService/EchoCall", &testpb.Echo{Payload: []byte("same")}, reply, nil, invoker)
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadUint32(&keyCalls) == 2 }, 5*time.Second, 10*time.Millisecond)
+	// give the waiter time to join the in-flight call
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	require.Equal(t, codes.Canceled, status.Code(<-leaderErr))
+	require.NoError(t, <-waiterErr)
+	require.Equal(t, []byte("same"), reply.Payload)
+	require.Equal(t, uint32(2), atomic.LoadUint32(&invocations))
+}
+
+func TestCoalescingInterceptorExcludedCalls(t *testing.T) {
+	t.Parallel()
+
+	interceptor := comm.NewCoalescingInterceptor(func(string, interface{}) (string, bool) {
+		return "", false
+	})
+
+	var invocations uint32
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		atomic.AddUint32(&invocations, 1)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		err := interceptor(context.Background(), "/EchoService/EchoCall", &testpb.Echo{}, &testpb.Echo{}, nil, invoker)
+		require.NoError(t, err)
+	}
+	require.Equal(t, uint32(3), invocations)
+
+	_, ok := comm.MethodRequestHashKey("/EchoService/EchoCall", "not a message")
+	require.False(t, ok)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// PooledCodec is a protobuf codec that marshals messages into scratch
+// buffers obtained from a sync.Pool in order to reduce the garbage generated
+// by large messages such as blocks.
+//
+// gRPC hands the slice returned by Marshal to the transport, which may write
+// it asynchronously. For that reason the scratch buffer itself is never
+// returned to gRPC; the encoded message is copied into an exactly sized
+// slice and the scratch buffer is put back into the pool.
+type PooledCodec struct {
+	pool sync.Pool
+}
+
+// NewPooledCodec creates a new PooledCodec.
+func NewPooledCodec() *PooledCodec {
+	return &PooledCodec{
+		pool: sync.Pool{
+			New: func() interface{} {
+				return proto.NewBuffer(nil)
+			},
+		},
+	}
+}
+
+// Marshal returns the wire format of v.
+func (c *PooledCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+
+	buf := c.pool.Get().(*proto.Buffer)
+	defer c.pool.Put(buf)
+
+	buf.Reset()
+	if err := buf.Marshal(msg); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(buf.Bytes()))
+	copy(out, buf.Bytes())
+	return out, nil
+}
+
+// Unmarshal parses the wire format into v.
+func (c *PooledCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+	}
+	msg.Reset()
+
+	buf := c.pool.Get().(*proto.Buffer)
+	defer c.pool.Put(buf)
+
+	buf.SetBuf(data)
+	err := buf.Unmarshal(msg)
+	// drop the reference to data so the pool does not retain it
+	buf.SetBuf(nil)
+	return err
+}
+
+// Name returns the name of the codec. The pooled codec produces the standard
+// protobuf wire format so it registers under the same content-subtype.
+func (c *PooledCodec) Name() string {
+	return "proto"
+}
+
+// String returns the name of the codec.
+func (c *PooledCodec) String() string {
+	return c.Name()
+}
@@ -0,0 +1,104 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/proto"
+)
+
+func TestPooledCodecRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	codec := comm.NewPooledCodec()
+	require.Equal(t, "proto", codec.Name())
+
+	var encoded [][]byte
+	var sent []*testpb.Echo
+	for _, size := range []int{0, 1, 4 << 20, 1 << 20, 8 << 20} {
+		msg := &testpb.Echo{Payload: bytes.Repeat([]byte{byte(size)}, size)}
+		out, err := codec.Marshal(msg)
+		require.NoError(t, err)
+		encoded = append(encoded, out)
+		sent = append(sent, msg)
+	}
+
+	// previously returned slices must not be reused by later calls
+	for i, data := range encoded {
+		received := &testpb.Echo{}
+		err := codec.Unmarshal(data, received)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(sent[i], received))
+	}
+
+	_, err := codec.Marshal("not a message")
+	require.EqualError(t, err, "failed to marshal, message is string, want proto.Message")
+	err = codec.Unmarshal(nil, "not a message")
+	require.EqualError(t, err, "failed to unmarshal, message is string, want proto.Message")
+}
+
+func TestPooledCodecGRPCServer(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+		Codec: comm.NewPooledCodec(),
+	})
+	require.NoError(t, err)
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	client, err := comm.NewGRPCClient(comm.ClientConfig{Timeout: testTimeout})
+	require.NoError(t, err)
+	conn, err := client.NewConnection(lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	svcClient := testpb.NewEchoServiceClient(conn)
+	for _, size := range []int{16 << 20, 2 << 20, 32 << 20} {
+		echo := &testpb.Echo{Payload: bytes.Repeat([]byte{byte(size >> 20)}, size)}
+		resp, err := svcClient.EchoCall(context.Background(), echo)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(echo, resp))
+	}
+}
+
+var benchmarkSizes = []int{1 << 20, 3 << 20, 2 << 20, 4 << 20}
+
+func benchmarkMarshal(b *testing.B, codec encoding.Codec) {
+	var msgs []*testpb.Echo
+	for _, size := range benchmarkSizes {
+		msgs = append(msgs, &testpb.Echo{Payload: make([]byte, size)})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := codec.Marshal(msgs[i%len(msgs)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDefaultCodecMarshal(b *testing.B) {
+	benchmarkMarshal(b, encoding.GetCodec("proto"))
+}
+
+func BenchmarkPooledCodecMarshal(b *testing.B) {
+	benchmarkMarshal(b, comm.NewPooledCodec())
+}
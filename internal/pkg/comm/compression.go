@@ -0,0 +1,61 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// Names of the compressors that can be selected in the ServerConfig and the
+// ClientConfig. The zstd compressor is only available in binaries built with
+// cgo.
+const (
+	GzipCompressor = gzip.Name
+	ZstdCompressor = "zstd"
+)
+
+// lookupCompressor returns the registered compressor with the given name,
+// or nil if name is empty
+func lookupCompressor(name string) (encoding.Compressor, error) {
+	if name == "" {
+		return nil, nil
+	}
+	compressor := encoding.GetCompressor(name)
+	if compressor == nil {
+		return nil, errors.Errorf("compressor %s is not registered", name)
+	}
+	return compressor, nil
+}
+
+// legacyCompressor adapts an encoding.Compressor to the grpc.Compressor
+// interface used to set the compressor of servers
+type legacyCompressor struct {
+	encoding.Compressor
+}
+
+var _ grpc.Compressor = legacyCompressor{}
+
+func (c legacyCompressor) Do(w io.Writer, p []byte) error {
+	wc, err := c.Compress(w)
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(p); err != nil {
+		wc.Close()
+		return err
+	}
+	return wc.Close()
+}
+
+func (c legacyCompressor) Type() string {
+	return c.Name()
+}
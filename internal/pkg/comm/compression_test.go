@@ -0,0 +1,182 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/encoding"
+)
+
+// availableCompressors returns the compressors registered in this build
+func availableCompressors() []string {
+	var compressors []string
+	for _, name := range []string{comm.GzipCompressor, comm.ZstdCompressor} {
+		if encoding.GetCompressor(name) != nil {
+			compressors = append(compressors, name)
+		}
+	}
+	return compressors
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	payload := make([]byte, 10000)
+	for _, serverCompressor := range append([]string{""}, availableCompressors()...) {
+		for _, clientCompressor := range append([]string{""}, availableCompressors()...) {
+			serverCompressor, clientCompressor := serverCompressor, clientCompressor
+			t.Run(fmt.Sprintf("server %q client %q", serverCompressor, clientCompressor), func(t *testing.T) {
+				gt := NewGomegaWithT(t)
+
+				received, sent := newOrgTotals(), newOrgTotals()
+				lis, err := net.Listen("tcp", "127.0.0.1:0")
+				gt.Expect(err).NotTo(HaveOccurred())
+				srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+					Compressor: serverCompressor,
+					OrgStatsHandler: &comm.OrgStatsHandler{
+						RPCsCounter:          newOrgTotals(),
+						BytesReceivedCounter: received,
+						BytesSentCounter:     sent,
+					},
+				})
+				gt.Expect(err).NotTo(HaveOccurred())
+				testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+				go srv.Start()
+				defer srv.Stop()
+
+				client, err := comm.NewGRPCClient(comm.ClientConfig{Timeout: testTimeout, Compressor: clientCompressor})
+				gt.Expect(err).NotTo(HaveOccurred())
+				conn, err := client.NewConnection(lis.Addr().String())
+				gt.Expect(err).NotTo(HaveOccurred())
+				defer conn.Close()
+
+				resp, err := testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{Payload: payload})
+				gt.Expect(err).NotTo(HaveOccurred())
+				gt.Expect(resp.Payload).To(Equal(payload))
+
+				// responses use the server compressor, or that of the request
+				responseCompressed := serverCompressor != "" || clientCompressor != ""
+				gt.Eventually(func() float64 { return sent.get(comm.UnknownOrg) }).ShouldNot(BeZero())
+				gt.Eventually(func() float64 { return received.get(comm.UnknownOrg) }).ShouldNot(BeZero())
+				gt.Expect(received.get(comm.UnknownOrg) < 1000).To(Equal(clientCompressor != ""))
+				gt.Expect(sent.get(comm.UnknownOrg) < 1000).To(Equal(responseCompressed))
+			})
+		}
+	}
+}
+
+func TestCompressionNotRegistered(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	_, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{Compressor: "lz4"})
+	gt.Expect(err).To(MatchError("compressor lz4 is not registered"))
+	_, err = comm.NewGRPCClient(comm.ClientConfig{Compressor: "lz4"})
+	gt.Expect(err).To(MatchError("compressor lz4 is not registered"))
+}
+
+// benchmarkBlock returns a marshaled block of endorser transactions with
+// random identifiers and signatures among repetitive read-write sets
+func benchmarkBlock(b *testing.B) []byte {
+	random := rand.New(rand.NewSource(0))
+	randomBytes := func(n int) []byte {
+		buf := make([]byte, n)
+		random.Read(buf)
+		return buf
+	}
+
+	block := &common.Block{
+		Header:   &common.BlockHeader{Number: 42, PreviousHash: randomBytes(32), DataHash: randomBytes(32)},
+		Data:     &common.BlockData{},
+		Metadata: &common.BlockMetadata{Metadata: [][]byte{randomBytes(256), {}, {}, {}, {}}},
+	}
+	for i := 0; i < 100; i++ {
+		var rwset bytes.Buffer
+		for k := 0; k < 20; k++ {
+			fmt.Fprintf(&rwset, `{"key":"asset%d","version":{"block_num":%d,"tx_num":%d},"value":{"owner":"Org1MSP","size":%d}}`, random.Intn(10000), 40+k, k, random.Intn(100))
+		}
+		payload, err := proto.Marshal(&common.Payload{
+			Header: &common.Header{
+				ChannelHeader:   randomBytes(120),
+				SignatureHeader: append(bytes.Repeat([]byte("-----BEGIN CERTIFICATE-----"), 20), randomBytes(64)...),
+			},
+			Data: rwset.Bytes(),
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		envelope, err := proto.Marshal(&common.Envelope{Payload: payload, Signature: randomBytes(72)})
+		if err != nil {
+			b.Fatal(err)
+		}
+		block.Data.Data = append(block.Data.Data, envelope)
+	}
+
+	marshaled, err := proto.Marshal(block)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return marshaled
+}
+
+func BenchmarkCompressors(b *testing.B) {
+	block := benchmarkBlock(b)
+
+	compress := func(compressor encoding.Compressor, dst *bytes.Buffer) {
+		dst.Reset()
+		w, err := compressor.Compress(dst)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := w.Write(block); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, name := range availableCompressors() {
+		compressor := encoding.GetCompressor(name)
+		compressed := &bytes.Buffer{}
+		compress(compressor, compressed)
+
+		b.Run(name+"/compress", func(b *testing.B) {
+			b.SetBytes(int64(len(block)))
+			var buf bytes.Buffer
+			for i := 0; i < b.N; i++ {
+				compress(compressor, &buf)
+			}
+			b.ReportMetric(float64(compressed.Len())/float64(len(block)), "ratio")
+		})
+
+		b.Run(name+"/decompress", func(b *testing.B) {
+			b.SetBytes(int64(len(block)))
+			for i := 0; i < b.N; i++ {
+				r, err := compressor.Decompress(bytes.NewReader(compressed.Bytes()))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := ioutil.ReadAll(r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
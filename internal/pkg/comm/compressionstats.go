@@ -0,0 +1,74 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/stats"
+)
+
+// NoCompression is the name CompressionStats reports connections whose
+// clients do not compress their requests under
+const NoCompression = "none"
+
+// compressionStatsHandler records the compressor used by the clients of
+// every connection. Clients pick a compressor for each call and name it in
+// the grpc-encoding header, so the compressor of the first call of a
+// connection is recorded.
+type compressionStatsHandler struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+type compressionConnKey struct{}
+
+func newCompressionStatsHandler() *compressionStatsHandler {
+	return &compressionStatsHandler{counts: map[string]int{}}
+}
+
+// snapshot returns the number of connections by compressor
+func (h *compressionStatsHandler) snapshot() map[string]int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	counts := make(map[string]int, len(h.counts))
+	for name, count := range h.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+func (h *compressionStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, compressionConnKey{}, &sync.Once{})
+}
+
+func (h *compressionStatsHandler) HandleConn(ctx context.Context, s stats.ConnStats) {}
+
+func (h *compressionStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *compressionStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	header, ok := s.(*stats.InHeader)
+	if !ok || header.Client {
+		return
+	}
+	once, ok := ctx.Value(compressionConnKey{}).(*sync.Once)
+	if !ok {
+		return
+	}
+	once.Do(func() {
+		name := header.Compression
+		if name == "" || name == "identity" {
+			name = NoCompression
+		}
+		h.lock.Lock()
+		h.counts[name]++
+		h.lock.Unlock()
+	})
+}
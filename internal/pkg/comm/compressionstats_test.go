@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+)
+
+func TestCompressionStats(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{TrackCompression: true})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+	gt.Expect(srv.CompressionStats()).To(BeEmpty())
+
+	call := func(compressor string, calls int) {
+		client, err := comm.NewGRPCClient(comm.ClientConfig{Timeout: testTimeout, Compressor: compressor})
+		gt.Expect(err).NotTo(HaveOccurred())
+		conn, err := client.NewConnection(srv.Address())
+		gt.Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		for i := 0; i < calls; i++ {
+			_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+			gt.Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
+	call("", 1)
+	// a connection is counted once however many calls it carries
+	call(comm.GzipCompressor, 3)
+	call(comm.GzipCompressor, 1)
+
+	gt.Eventually(srv.CompressionStats).Should(Equal(map[string]int{
+		comm.NoCompression:  1,
+		comm.GzipCompressor: 2,
+	}))
+}
+
+func TestCompressionStatsNotTracked(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer srv.Stop()
+	gt.Expect(srv.CompressionStats()).To(BeNil())
+}
@@ -9,11 +9,17 @@ package comm
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
 	"time"
 
 	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/common/metadata"
 	"github.com/hyperledger/fabric/common/metrics"
+	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
 )
 
@@ -41,6 +47,10 @@ var (
 	}
 	// default connection timeout
 	DefaultConnectionTimeout = 5 * time.Second
+	// default interval between client root CA refreshes
+	DefaultClientRootCARefreshInterval = time.Minute
+	// default user agent of grpc clients; gRPC appends its own version
+	DefaultUserAgent = "hyperledger-fabric/" + metadata.Version
 )
 
 // ServerConfig defines the parameters for configuring a GRPCServer instance
@@ -52,6 +62,9 @@ type ServerConfig struct {
 	SecOpts SecureOptions
 	// KaOpts defines the keepalive parameters
 	KaOpts KeepaliveOptions
+	// KeepaliveProfile, if not empty, is the name of a profile registered
+	// with RegisterKeepaliveProfile whose options are used instead of KaOpts
+	KeepaliveProfile string
 	// StreamInterceptors specifies a list of interceptors to apply to
 	// streaming RPCs.  They are executed in order.
 	StreamInterceptors []grpc.StreamServerInterceptor
@@ -62,8 +75,269 @@ type ServerConfig struct {
 	Logger *flogging.FabricLogger
 	// HealthCheckEnabled enables the gRPC Health Checking Protocol for the server
 	HealthCheckEnabled bool
+	// HealthCertExpiryWindow, if positive, makes the overall status of the
+	// health service NOT_SERVING while the server certificate is expired or
+	// expires within this window, so that the server is taken out of
+	// rotation before its handshakes start failing. It requires
+	// HealthCheckEnabled and TLS.
+	HealthCertExpiryWindow time.Duration
 	// ServerStatsHandler should be set if metrics on connections are to be reported.
 	ServerStatsHandler *ServerStatsHandler
+	// OrgStatsHandler should be set if metrics on RPCs grouped by the org of
+	// the client are to be reported.
+	OrgStatsHandler *OrgStatsHandler
+	// MessageSizeStatsHandler should be set if the sizes of the messages
+	// exchanged by every method are to be reported.
+	MessageSizeStatsHandler *MessageSizeStatsHandler
+	// StreamCountStatsHandler should be set if the active streams of every
+	// connection are to be tracked.
+	StreamCountStatsHandler *StreamCountStatsHandler
+	// Codec, if not nil, replaces the default protobuf codec used by the
+	// server. Use NewPooledCodec to reduce allocations for large messages.
+	Codec grpc.Codec
+	// PrecheckPayloads makes the server inspect the wire format of requests
+	// before unmarshaling them. Requests that are not framed as protobuf
+	// messages, or that exceed PrecheckMaxPayloadSize when it is positive,
+	// are rejected with InvalidArgument before any interceptor or handler
+	// sees them. Only the top level fields are checked, so this is a cheap
+	// first line of defense rather than a validation of the messages.
+	PrecheckPayloads       bool
+	PrecheckMaxPayloadSize int
+	// ClientRootCAProvider, if not nil, is periodically called to fetch the
+	// PEM-encoded client root CAs. The returned CAs atomically replace the
+	// current client root CA pool. If the provider returns an error, the
+	// error is logged and the current pool is retained.
+	// Requires TLS to be enabled.
+	ClientRootCAProvider func() ([][]byte, error)
+	// RefreshInterval specifies how often ClientRootCAProvider is called.
+	// If not set, DefaultClientRootCARefreshInterval is used.
+	RefreshInterval time.Duration
+	// ClientRootCAFiles are paths of files containing PEM-encoded client
+	// root CAs. The files are loaded when the server is created and are
+	// watched for changes; every change replaces the client root CA pool
+	// with the CAs of all the files. If a file cannot be loaded, the error
+	// is logged and the current pool is retained. The watcher stops when the
+	// server is stopped. Requires TLS to be enabled.
+	ClientRootCAFiles []string
+	// MethodStatsRecorder should be set if per method call counts and
+	// in-flight calls are to be reported. Its interceptors run before
+	// StreamInterceptors and UnaryInterceptors.
+	MethodStatsRecorder *MethodStatsRecorder
+	// ReusePort sets SO_REUSEPORT on the listener created by NewGRPCServer,
+	// allowing several server processes to bind the same address with the
+	// kernel distributing connections among them. It is supported on Linux,
+	// macOS and the BSDs; on other platforms NewGRPCServer returns an error.
+	// It has no effect on NewGRPCServerFromListener.
+	ReusePort bool
+	// DisableNagle, if not nil, sets TCP_NODELAY on the connections
+	// accepted by the server to its value: true disables Nagle's algorithm,
+	// as Go does by default, and false enables it, trading the latency of
+	// small messages for fewer packets. Nil keeps the default of Go.
+	DisableNagle *bool
+	// ListenBacklog, when positive, limits the number of connections the
+	// kernel queues for the listener created by NewGRPCServer before the
+	// server accepts them. Once the queue is full, new connection attempts
+	// are refused or dropped by the kernel instead of being accepted into an
+	// overloaded server. Linux silently caps the value at net.core.somaxconn.
+	// It is supported on Linux, macOS and the BSDs; on other platforms a
+	// warning is logged and the system default backlog is kept. It has no
+	// effect on NewGRPCServerFromListener.
+	//
+	// The server accepts connections as fast as it can and performs TLS
+	// handshakes after accepting them, bounded only by ConnectionTimeout, so
+	// connections waiting for a handshake do not count against the backlog.
+	// The backlog only fills up once the accept loop itself falls behind.
+	ListenBacklog int
+	// ListenerWrappers are applied in order to the listener of the server
+	// when it starts: the first one wraps the listener and each following
+	// one wraps the result of the previous one. Accept calls therefore go
+	// through the last wrapper first, and connections are returned through
+	// the first wrapper first, so a wrapper that must see the raw
+	// connections, such as a PROXY protocol decoder, must come first. The
+	// listener wrappers of the package itself are applied after them, in
+	// this order: TrackOpenConnections, plaintext detection when TLS is
+	// disabled, ConnectionErrorHistory and SendDrainReason. The one of
+	// DisableNagle is the only one applied before them, to see the TCP
+	// connections. Listener and ListenerFile return the unwrapped listener.
+	ListenerWrappers []func(net.Listener) net.Listener
+	// ConnectionErrorHistory is the number of the most recent connection
+	// errors, such as failed TLS handshakes and connections reset by their
+	// peer, returned by GRPCServer.RecentConnectionErrors. Connection errors
+	// are not kept unless it is positive.
+	ConnectionErrorHistory int
+	// ExtraServerOptions are appended after the server options derived from
+	// this configuration, so an extra option that sets the same parameter as
+	// a derived option takes precedence over it. Additional interceptors must
+	// be added with grpc.ChainUnaryInterceptor or grpc.ChainStreamInterceptor;
+	// they run after UnaryInterceptors and StreamInterceptors. gRPC does not
+	// allow grpc.UnaryInterceptor or grpc.StreamInterceptor to be combined
+	// with interceptors from this configuration.
+	ExtraServerOptions []grpc.ServerOption
+	// MethodRateLimits maps full method names (e.g. /package.Service/Method)
+	// to the rate limit enforced across all callers of the method. Calls
+	// exceeding the limit fail with ResourceExhausted and RetryInfo details.
+	MethodRateLimits map[string]RateLimit
+	// MethodConcurrencyLimits maps full method names to the maximum number
+	// of calls to the method handled at once, across all callers. Calls
+	// beyond it fail with ResourceExhausted and RetryInfo details instead of
+	// waiting. Methods without a positive limit are not limited.
+	MethodConcurrencyLimits map[string]int
+	// TLSPolicyDryRun makes failures of SecOpts.VerifyCertificate and of
+	// the SecOpts.CRLs revocation checks log the subject of the client
+	// certificate and the failed check instead of aborting the handshake.
+	// It allows stricter certificate policies to be observed before they
+	// are enforced. Standard certificate chain verification is still
+	// enforced.
+	TLSPolicyDryRun bool
+	// TLSPolicyDryRunCounter, if not nil, counts the handshakes that would
+	// have been rejected while TLSPolicyDryRun is set.
+	TLSPolicyDryRunCounter metrics.Counter
+	// ExpiredClientCertCounter, if not nil, counts the handshakes rejected
+	// because the client certificate expired. Such handshakes are logged
+	// with the expiry of the certificate and fail with an error wrapping
+	// ErrClientCertificateExpired, separately from untrusted certificates.
+	ExpiredClientCertCounter metrics.Counter
+	// TLSDowngradeDetector, if not nil, flags the clients negotiating a
+	// lower TLS version than they did before with the same certificate.
+	// Requires TLS to be enabled.
+	TLSDowngradeDetector *TLSDowngradeDetector
+	// MaxRecvMsgSizeUnary and MaxRecvMsgSizeStreaming limit the encoded size
+	// of the messages received by unary and streaming RPCs respectively.
+	// gRPC only enforces a single limit on every message regardless of the
+	// kind of RPC, so when either is set that limit is raised to the larger
+	// of the two, the server codec does not unmarshal the messages exceeding
+	// the smaller one, and interceptors reject those exceeding the limit of
+	// their RPC kind with ResourceExhausted before they are unmarshaled. An
+	// unset limit defaults to MaxRecvMsgSize.
+	MaxRecvMsgSizeUnary     int
+	MaxRecvMsgSizeStreaming int
+	// RecvMsgSizeHints, if not nil, lets the calls carrying a verified hint
+	// raise the limit on the size of the messages they receive above
+	// MaxRecvMsgSizeUnary or MaxRecvMsgSizeStreaming, up to its Max. Its
+	// Verify function must authenticate the hints, which are set by callers.
+	RecvMsgSizeHints *RecvMsgSizeHints
+	// SkipOversizedStreamMessages makes streams log and skip the messages
+	// exceeding MaxRecvMsgSizeStreaming instead of failing with
+	// ResourceExhausted. gRPC then accepts messages up to at least
+	// MaxRecvMsgSize; larger messages still fail the stream. Handlers never
+	// see the skipped messages, which breaks protocols where every message
+	// matters, such as those acknowledging messages by count or relying on
+	// their sequence, and clients are not told about them.
+	SkipOversizedStreamMessages bool
+	// StreamSendTimeout, if positive, bounds the time each send of a
+	// streaming handler waits for the client to accept the message. A send
+	// exceeding it fails with DeadlineExceeded, and so do the subsequent
+	// ones, so that the handler can abort instead of being blocked forever
+	// by a client that stopped reading. It complements flow control rather
+	// than replacing it: sends still block while the client is slow, just
+	// not for longer than the timeout. See PeerAwareServerStream.
+	StreamSendTimeout time.Duration
+	// FirstMessageTimeout, if positive, is the time streaming clients have to
+	// send their first message once they open a stream. Streams that receive
+	// nothing within it fail with DeadlineExceeded: their context is
+	// cancelled and receiving fails, so that clients opening streams and
+	// staying silent do not tie up handlers. Subsequent messages have no
+	// deadline.
+	FirstMessageTimeout time.Duration
+	// FaultInjector is meant for tests only, e.g. to exercise the retries
+	// and timeouts of clients against a real server; it must not be set in
+	// production. If not nil, it is called with the full method name of
+	// every call before the call reaches its handler and the user
+	// interceptors. The call is delayed by the returned delay, or until it
+	// is cancelled, then fails with the returned error if it is not nil.
+	FaultInjector func(method string) (delay time.Duration, err error)
+	// DrainProgressInterval, if positive, makes GracefulStop log the number
+	// of RPCs still in flight at this interval until they complete, e.g. to
+	// find the long-running streams holding up a drain.
+	DrainProgressInterval time.Duration
+	// SendDrainReason makes GracefulStop send its reason to the clients as
+	// the debug data of the GOAWAY frames, and lets SetServerCertificate
+	// recycle connections. The frames written to every connection are then
+	// inspected to rewrite the GOAWAY frames; by default the connections
+	// are passed to gRPC unchanged.
+	SendDrainReason bool
+	// VersionHeader holds metadata added to the response headers of every
+	// RPC, e.g. x-fabric-version: 2.5.1, so that clients can tell which
+	// server build handled a call. Keys are lowercased. The headers of
+	// unary RPCs are set before the handler runs, which may add headers of
+	// its own, and sent with the response. The headers of streams are sent
+	// before the handler runs, so that clients can read them before the
+	// first message; stream handlers can then no longer set headers.
+	VersionHeader map[string]string
+	// Compressor is the name of the compressor used for responses, such as
+	// GzipCompressor or ZstdCompressor. Clients must support it. If empty,
+	// responses are compressed with the compressor of the request, if any.
+	// Requests are decompressed with any registered compressor.
+	Compressor string
+	// TrackCompression records the compressor the clients of every
+	// connection use, as reported by GRPCServer.CompressionStats.
+	TrackCompression bool
+	// TrackConnectionRPCs counts the RPCs of every open connection, as
+	// reported by GRPCServer.RPCsByConnection.
+	TrackConnectionRPCs bool
+	// TrackOpenConnections tracks the connections accepted by the server
+	// until they are closed, as reported by GRPCServer.ConnectionLeakReport,
+	// to diagnose connections that are never closed.
+	TrackOpenConnections bool
+	// ConnectionLeakThreshold, if positive, is the number of open
+	// connections above which a warning is logged and
+	// GRPCServer.ConnectionLeakReport includes the stack traces of the
+	// goroutines of gRPC. It requires TrackOpenConnections.
+	ConnectionLeakThreshold int
+	// ConnValues maps keys to functions computing per connection values.
+	// Each function is called once per connection, before its first RPC is
+	// handled, and the result is available to all RPCs on the connection
+	// through ConnValue until the connection ends.
+	ConnValues map[string]ConnValueFunc
+}
+
+// Clone returns a copy of this ServerConfig that shares no slices or maps
+// with it, including the PEM-encoded certificates, keys and CRLs of SecOpts,
+// so that either can be modified without affecting the other. Interceptors,
+// handlers, loggers and other pointers are shared.
+func (sc ServerConfig) Clone() ServerConfig {
+	clone := sc
+	clone.SecOpts = sc.SecOpts.clone()
+	if sc.StreamInterceptors != nil {
+		clone.StreamInterceptors = append([]grpc.StreamServerInterceptor{}, sc.StreamInterceptors...)
+	}
+	if sc.UnaryInterceptors != nil {
+		clone.UnaryInterceptors = append([]grpc.UnaryServerInterceptor{}, sc.UnaryInterceptors...)
+	}
+	if sc.ClientRootCAFiles != nil {
+		clone.ClientRootCAFiles = append([]string{}, sc.ClientRootCAFiles...)
+	}
+	if sc.ListenerWrappers != nil {
+		clone.ListenerWrappers = append([]func(net.Listener) net.Listener{}, sc.ListenerWrappers...)
+	}
+	if sc.ExtraServerOptions != nil {
+		clone.ExtraServerOptions = append([]grpc.ServerOption{}, sc.ExtraServerOptions...)
+	}
+	if sc.MethodRateLimits != nil {
+		clone.MethodRateLimits = make(map[string]RateLimit, len(sc.MethodRateLimits))
+		for method, limit := range sc.MethodRateLimits {
+			clone.MethodRateLimits[method] = limit
+		}
+	}
+	if sc.MethodConcurrencyLimits != nil {
+		clone.MethodConcurrencyLimits = make(map[string]int, len(sc.MethodConcurrencyLimits))
+		for method, limit := range sc.MethodConcurrencyLimits {
+			clone.MethodConcurrencyLimits[method] = limit
+		}
+	}
+	if sc.VersionHeader != nil {
+		clone.VersionHeader = make(map[string]string, len(sc.VersionHeader))
+		for key, value := range sc.VersionHeader {
+			clone.VersionHeader[key] = value
+		}
+	}
+	if sc.ConnValues != nil {
+		clone.ConnValues = make(map[string]ConnValueFunc, len(sc.ConnValues))
+		for key, f := range sc.ConnValues {
+			clone.ConnValues[key] = f
+		}
+	}
+	return clone
 }
 
 // ClientConfig defines the parameters for configuring a GRPCClient instance
@@ -72,11 +346,56 @@ type ClientConfig struct {
 	SecOpts SecureOptions
 	// KaOpts defines the keepalive parameters
 	KaOpts KeepaliveOptions
+	// KeepaliveProfile, if not empty, is the name of a profile registered
+	// with RegisterKeepaliveProfile whose options are used instead of KaOpts
+	KeepaliveProfile string
 	// Timeout specifies how long the client will block when attempting to
 	// establish a connection
 	Timeout time.Duration
 	// AsyncConnect makes connection creation non blocking
 	AsyncConnect bool
+	// ExtraDialOptions are appended after the dial options derived from this
+	// configuration when creating a connection. Since gRPC applies dial
+	// options in order, an extra option that sets the same parameter as a
+	// derived option (e.g. transport credentials or default call options)
+	// takes precedence over it.
+	ExtraDialOptions []grpc.DialOption
+	// PerRPCCredentials, if not nil, attaches credentials such as a bearer
+	// token to every call made on the connections of the client
+	PerRPCCredentials credentials.PerRPCCredentials
+	// UserAgent identifies the client to servers. If empty,
+	// DefaultUserAgent is used.
+	UserAgent string
+	// DefaultWaitForReady makes calls wait for the connection to become
+	// ready instead of failing fast while it is in TransientFailure. It can
+	// be overridden per call with grpc.WaitForReady.
+	DefaultWaitForReady bool
+	// GoAwayHandler, if not nil, is called with the address of the
+	// connection and the debug data of every GOAWAY frame received from a
+	// server, e.g. to trigger rediscovery when a server goes down for
+	// maintenance. It is called from the goroutine reading from the
+	// connection and must not block.
+	GoAwayHandler func(address, reason string)
+	// Compressor is the name of the compressor used for requests, such as
+	// GzipCompressor or ZstdCompressor. Requests are not compressed if it
+	// is empty.
+	Compressor string
+	// DisableRetry turns off automatic retries of failed calls, including
+	// retries requested by a service config, for callers that must not
+	// repeat non-idempotent operations. Transparent retries of calls that
+	// never reached the server may still occur.
+	DisableRetry bool
+	// OnDial, if not nil, is called after every connection the client
+	// creates is dialed, with the address, the error the connection failed
+	// with, if any, and the time the dial took, e.g. to record dial
+	// latencies and failures. With AsyncConnect, dials return before the
+	// connection is established and never fail on connection errors.
+	OnDial func(address string, err error, d time.Duration)
+	// DisableNagle, if not nil, sets TCP_NODELAY on the connections of the
+	// client to its value: true disables Nagle's algorithm, as Go does by
+	// default, and false enables it, trading the latency of small messages
+	// for fewer packets. Nil keeps the default of Go.
+	DisableNagle *bool
 }
 
 // Clone clones this ClientConfig
@@ -99,17 +418,138 @@ type SecureOptions struct {
 	// Set of PEM-encoded X509 certificate authorities used by clients to
 	// verify server certificates
 	ServerRootCAs [][]byte
+	// StrictServerRootCAs makes clients reject ServerRootCAs containing any
+	// invalid certificate. By default, invalid certificates are logged and
+	// skipped as long as at least one valid certificate remains.
+	StrictServerRootCAs bool
 	// Set of PEM-encoded X509 certificate authorities used by servers to
 	// verify client certificates
 	ClientRootCAs [][]byte
-	// Whether or not to use TLS for communication
+	// Whether or not to use TLS for communication. Without TLS, clients and
+	// servers speak HTTP/2 over cleartext (h2c) and ALPN does not apply; a
+	// peer on the other side of a mismatch fails its handshake with
+	// ErrServerNotUsingTLS or ErrClientNotUsingTLS.
 	UseTLS bool
 	// Whether or not TLS client must present certificates for authentication
 	RequireClientCert bool
 	// CipherSuites is a list of supported cipher suites for TLS
 	CipherSuites []uint16
+	// CurvePreferences, if not nil, restricts the ECDHE curves clients and
+	// servers offer and accept to the listed ones, in order of preference,
+	// e.g. for peers or HSMs supporting only some curves. It must not be
+	// empty when set.
+	CurvePreferences []tls.CurveID
 	// TimeShift makes TLS handshakes time sampling shift to the past by a given duration
 	TimeShift time.Duration
+	// Renegotiation controls whether clients accept renegotiation requests
+	// from TLS 1.2 servers. It defaults to tls.RenegotiateNever, which should
+	// only be changed for interoperability with servers that require it:
+	// renegotiation has been the source of several attacks, and allowing it
+	// lets the server change the certificates of an established connection.
+	// It is ignored by servers, which never renegotiate.
+	Renegotiation tls.RenegotiationSupport
+	// KeyLogWriter, if not nil, receives the TLS master secrets of every
+	// connection in NSS key log format, e.g. for Wireshark to decrypt the
+	// captured traffic. WARNING: anyone with access to the key log can
+	// decrypt all the traffic of the logged connections, including the
+	// traffic captured before or after the debugging session. It must only
+	// be used to debug non-production systems, and the log must be deleted
+	// once the investigation is over. Servers also use it for the
+	// connections configured by GetConfigForClient with options that leave
+	// it nil. No key material is logged when it is nil anywhere.
+	KeyLogWriter io.Writer
+	// RequireSCT makes clients reject server certificates that do not embed
+	// signed certificate timestamps from certificate transparency logs.
+	// Only the presence of well formed timestamps is checked: their
+	// signatures are not validated, which requires the keys of the logs.
+	// It is ignored by servers.
+	RequireSCT bool
+	// RequiredCertHostname, if not empty, makes clients verify that server
+	// certificates are valid for this hostname instead of the address or
+	// server name they connect to, e.g. to dial a server by IP address and
+	// still check its logical hostname. The authority of the calls and the
+	// ServerName sent in the TLS handshake are left unchanged. It is
+	// ignored by servers.
+	RequiredCertHostname string
+	// CRLs are PEM-encoded certificate revocation lists. Clients reject
+	// server certificates, and servers reject client certificates, that
+	// are revoked by a list signed by their issuer. Only verified
+	// certificates are checked, so servers must also set RequireClientCert.
+	// Servers only log and count the revoked certificates when
+	// TLSPolicyDryRun is set.
+	CRLs [][]byte
+	// TLSConfigProvider, if not nil, is called once when a server is created
+	// to obtain its TLS configuration. It takes precedence over all the
+	// other fields, including UseTLS, which are then ignored by the server.
+	// The returned config must contain Certificates or GetCertificate. It
+	// is cloned, so later changes to it have no effect.
+	TLSConfigProvider func() (*tls.Config, error)
+	// GetConfigForClient, if not nil, is called by servers with the
+	// ClientHello of every TLS connection, before the handshake proceeds,
+	// to obtain the secure options of that connection, e.g. to select the
+	// certificate or the client root CAs based on the server name the
+	// client asks for. Returning an error aborts the handshake; returning
+	// nil options uses the options of the server. Only Certificate, Key,
+	// ClientRootCAs, RequireClientCert, CipherSuites, CurvePreferences,
+	// TimeShift, VerifyCertificate, CRLs and KeyLogWriter are taken from
+	// the returned options; CurvePreferences and KeyLogWriter default to
+	// the ones of the server. The CRLs of the server and TLSPolicyDryRun
+	// apply to every connection as well. The TLS
+	// configuration is built from them for every connection, which parses
+	// the key pair and the client root CAs on each handshake; callers
+	// accepting many connections should keep the returned options small.
+	// It is ignored by clients and when TLSConfigProvider is set.
+	GetConfigForClient func(hello *tls.ClientHelloInfo) (*SecureOptions, error)
+	// StrictUseTLS makes the creation of clients and servers fail when TLS
+	// fields are set while UseTLS is false. By default, the ignored fields
+	// are logged as a warning, since setting them almost always means that
+	// UseTLS was forgotten and the connections are unexpectedly plaintext.
+	StrictUseTLS bool
+}
+
+// clone returns a copy of these SecureOptions that shares no slices with
+// them
+func (so SecureOptions) clone() SecureOptions {
+	clone := so
+	clone.Certificate = cloneBytes(so.Certificate)
+	clone.Key = cloneBytes(so.Key)
+	clone.ServerRootCAs = cloneByteSlices(so.ServerRootCAs)
+	clone.ClientRootCAs = cloneByteSlices(so.ClientRootCAs)
+	clone.CRLs = cloneByteSlices(so.CRLs)
+	if so.CipherSuites != nil {
+		clone.CipherSuites = append([]uint16{}, so.CipherSuites...)
+	}
+	if so.CurvePreferences != nil {
+		clone.CurvePreferences = append([]tls.CurveID{}, so.CurvePreferences...)
+	}
+	return clone
+}
+
+// checkCurvePreferences returns an error if CurvePreferences is set but
+// empty, which would otherwise silently select the default curves
+func (so SecureOptions) checkCurvePreferences() error {
+	if so.CurvePreferences != nil && len(so.CurvePreferences) == 0 {
+		return errors.New("SecureOptions.CurvePreferences must not be empty when set")
+	}
+	return nil
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func cloneByteSlices(bs [][]byte) [][]byte {
+	if bs == nil {
+		return nil
+	}
+	clone := make([][]byte, len(bs))
+	for i, b := range bs {
+		clone[i] = cloneBytes(b)
+	}
+	return clone
 }
 
 // KeepaliveOptions is used to set the gRPC keepalive settings for both
@@ -132,6 +572,63 @@ type KeepaliveOptions struct {
 	ServerMinInterval time.Duration
 }
 
+// NewKeepalivePair returns the keepalive options of clients pinging servers
+// every clientPing and of servers pinging clients every serverPing, both
+// waiting timeout for ping responses. The server options only permit
+// clients to ping every clientPing/2, so network delays cannot make the
+// pings of the clients look too frequent and the server never closes their
+// connections with a GOAWAY for pinging too often. gRPC raises client ping
+// intervals below 10 seconds to 10 seconds, which only widens that margin.
+func NewKeepalivePair(clientPing, serverPing, timeout time.Duration) (clientKa, serverKa KeepaliveOptions) {
+	clientKa = KeepaliveOptions{
+		ClientInterval: clientPing,
+		ClientTimeout:  timeout,
+	}
+	serverKa = KeepaliveOptions{
+		ServerInterval:    serverPing,
+		ServerTimeout:     timeout,
+		ServerMinInterval: clientPing / 2,
+	}
+	return clientKa, serverKa
+}
+
+const (
+	// minClientPingInterval is the interval gRPC raises shorter client ping
+	// intervals to
+	minClientPingInterval = 10 * time.Second
+	// defaultServerMinPingInterval is the minimum interval between client
+	// pings gRPC servers permit when ServerMinInterval is not set
+	defaultServerMinPingInterval = 5 * time.Minute
+)
+
+// CheckKeepaliveCompatibility returns an error if clients configured with
+// the client options would ping servers configured with the server options
+// more often than the servers permit, which makes the servers close their
+// connections with a GOAWAY. It takes into account that gRPC raises client
+// intervals below 10 seconds to 10 seconds and that servers permit a ping
+// every 5 minutes when ServerMinInterval is not set. The client interval
+// only needs to reach the server minimum interval; NewKeepalivePair leaves
+// a margin for network delays.
+func CheckKeepaliveCompatibility(client, server KeepaliveOptions) error {
+	clientPing := client.ClientInterval
+	if clientPing < minClientPingInterval {
+		clientPing = minClientPingInterval
+	}
+	minInterval := server.ServerMinInterval
+	if minInterval == 0 {
+		minInterval = defaultServerMinPingInterval
+	}
+	if clientPing >= minInterval {
+		return nil
+	}
+
+	interval := clientPing.String()
+	if clientPing != client.ClientInterval {
+		interval = fmt.Sprintf("%s (ClientInterval %s raised by gRPC)", clientPing, client.ClientInterval)
+	}
+	return errors.Errorf("clients pinging every %s would be disconnected by servers permitting a ping every %s at most", interval, minInterval)
+}
+
 type Metrics struct {
 	// OpenConnCounter keeps track of number of open connections
 	OpenConnCounter metrics.Counter
@@ -142,28 +639,43 @@ type Metrics struct {
 // ServerKeepaliveOptions returns gRPC keepalive options for server.
 func ServerKeepaliveOptions(ka KeepaliveOptions) []grpc.ServerOption {
 	var serverOpts []grpc.ServerOption
-	kap := keepalive.ServerParameters{
+	serverOpts = append(serverOpts, grpc.KeepaliveParams(ka.EffectiveServerKeepaliveParams()))
+	serverOpts = append(serverOpts, grpc.KeepaliveEnforcementPolicy(ka.EffectiveServerKeepaliveEnforcementPolicy()))
+	return serverOpts
+}
+
+// ClientKeepaliveOptions returns gRPC keepalive options for clients.
+func ClientKeepaliveOptions(ka KeepaliveOptions) []grpc.DialOption {
+	var dialOpts []grpc.DialOption
+	dialOpts = append(dialOpts, grpc.WithKeepaliveParams(ka.EffectiveClientKeepaliveParams()))
+	return dialOpts
+}
+
+// EffectiveServerKeepaliveParams returns the keepalive parameters servers
+// are configured with
+func (ka KeepaliveOptions) EffectiveServerKeepaliveParams() keepalive.ServerParameters {
+	return keepalive.ServerParameters{
 		Time:    ka.ServerInterval,
 		Timeout: ka.ServerTimeout,
 	}
-	serverOpts = append(serverOpts, grpc.KeepaliveParams(kap))
-	kep := keepalive.EnforcementPolicy{
+}
+
+// EffectiveServerKeepaliveEnforcementPolicy returns the keepalive
+// enforcement policy servers are configured with
+func (ka KeepaliveOptions) EffectiveServerKeepaliveEnforcementPolicy() keepalive.EnforcementPolicy {
+	return keepalive.EnforcementPolicy{
 		MinTime: ka.ServerMinInterval,
 		// allow keepalive w/o rpc
 		PermitWithoutStream: true,
 	}
-	serverOpts = append(serverOpts, grpc.KeepaliveEnforcementPolicy(kep))
-	return serverOpts
 }
 
-// ClientKeepaliveOptions returns gRPC keepalive options for clients.
-func ClientKeepaliveOptions(ka KeepaliveOptions) []grpc.DialOption {
-	var dialOpts []grpc.DialOption
-	kap := keepalive.ClientParameters{
+// EffectiveClientKeepaliveParams returns the keepalive parameters clients
+// are configured with
+func (ka KeepaliveOptions) EffectiveClientKeepaliveParams() keepalive.ClientParameters {
+	return keepalive.ClientParameters{
 		Time:                ka.ClientInterval,
 		Timeout:             ka.ClientTimeout,
 		PermitWithoutStream: true,
 	}
-	dialOpts = append(dialOpts, grpc.WithKeepaliveParams(kap))
-	return dialOpts
 }
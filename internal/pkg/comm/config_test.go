@@ -63,6 +63,38 @@ func TestClientKeepaliveOptions(t *testing.T) {
 	}
 }
 
+func TestEffectiveKeepaliveParams(t *testing.T) {
+	t.Parallel()
+
+	ka := KeepaliveOptions{
+		ClientInterval:    10 * time.Second,
+		ClientTimeout:     3 * time.Second,
+		ServerInterval:    20 * time.Second,
+		ServerTimeout:     4 * time.Second,
+		ServerMinInterval: 5 * time.Second,
+	}
+
+	require.Equal(t, keepalive.ClientParameters{
+		Time:                10 * time.Second,
+		Timeout:             3 * time.Second,
+		PermitWithoutStream: true,
+	}, ka.EffectiveClientKeepaliveParams())
+	require.Equal(t, keepalive.ServerParameters{
+		Time:    20 * time.Second,
+		Timeout: 4 * time.Second,
+	}, ka.EffectiveServerKeepaliveParams())
+	require.Equal(t, keepalive.EnforcementPolicy{
+		MinTime:             5 * time.Second,
+		PermitWithoutStream: true,
+	}, ka.EffectiveServerKeepaliveEnforcementPolicy())
+
+	require.Equal(t, keepalive.ClientParameters{
+		Time:                DefaultKeepaliveOptions.ClientInterval,
+		Timeout:             DefaultKeepaliveOptions.ClientTimeout,
+		PermitWithoutStream: true,
+	}, DefaultKeepaliveOptions.EffectiveClientKeepaliveParams())
+}
+
 func TestClientConfigClone(t *testing.T) {
 	origin := ClientConfig{
 		KaOpts: KeepaliveOptions{
@@ -120,3 +152,64 @@ func TestClientConfigClone(t *testing.T) {
 	require.Equal(t, expectedOriginState, origin)
 	require.Equal(t, expectedCloneState, clone)
 }
+
+func TestServerConfigClone(t *testing.T) {
+	origin := ServerConfig{
+		KaOpts: KeepaliveOptions{
+			ServerInterval: time.Second,
+		},
+		SecOpts: SecureOptions{
+			UseTLS:        true,
+			Certificate:   []byte{1, 2, 3},
+			Key:           []byte{4, 5, 6},
+			ServerRootCAs: [][]byte{{7, 8}},
+			ClientRootCAs: [][]byte{{9, 10}, {11}},
+			CRLs:          [][]byte{{12}},
+			CipherSuites:  []uint16{13},
+		},
+		ClientRootCAFiles: []string{"ca.pem"},
+		VersionHeader:     map[string]string{"x-version": "1"},
+		MethodRateLimits:  map[string]RateLimit{"/svc/m": {Rate: 1, Burst: 1}},
+	}
+
+	clone := origin.Clone()
+
+	// Same content, different inner fields references.
+	require.Equal(t, origin, clone)
+
+	// We change the contents of the fields, including the elements of the
+	// CA slices, and ensure it doesn't propagate to the original.
+	clone.KaOpts.ServerInterval = time.Hour
+	clone.SecOpts.Certificate[0] = 0
+	clone.SecOpts.Key[0] = 0
+	clone.SecOpts.ServerRootCAs[0][0] = 0
+	clone.SecOpts.ClientRootCAs[1][0] = 0
+	clone.SecOpts.ClientRootCAs = append(clone.SecOpts.ClientRootCAs[:1], []byte{14})
+	clone.SecOpts.CRLs[0][0] = 0
+	clone.SecOpts.CipherSuites[0] = 0
+	clone.ClientRootCAFiles[0] = "other.pem"
+	clone.VersionHeader["x-version"] = "2"
+	clone.MethodRateLimits["/svc/m"] = RateLimit{Rate: 2}
+
+	require.Equal(t, ServerConfig{
+		KaOpts: KeepaliveOptions{
+			ServerInterval: time.Second,
+		},
+		SecOpts: SecureOptions{
+			UseTLS:        true,
+			Certificate:   []byte{1, 2, 3},
+			Key:           []byte{4, 5, 6},
+			ServerRootCAs: [][]byte{{7, 8}},
+			ClientRootCAs: [][]byte{{9, 10}, {11}},
+			CRLs:          [][]byte{{12}},
+			CipherSuites:  []uint16{13},
+		},
+		ClientRootCAFiles: []string{"ca.pem"},
+		VersionHeader:     map[string]string{"x-version": "1"},
+		MethodRateLimits:  map[string]RateLimit{"/svc/m": {Rate: 1, Burst: 1}},
+	}, origin)
+
+	// and the other way around
+	origin.SecOpts.ServerRootCAs[0][1] = 0
+	require.Equal(t, [][]byte{{0, 8}}, clone.SecOpts.ServerRootCAs)
+}
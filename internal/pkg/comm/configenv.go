@@ -0,0 +1,149 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigFromEnv returns the configuration of a server read from the
+// environment variables named after prefix, e.g. FABRIC_COMM_TLS_ENABLED for
+// the prefix FABRIC_COMM. The variables are:
+//
+//	<prefix>_TLS_ENABLED                    whether the server uses TLS
+//	<prefix>_TLS_CERT_FILE                  file of the PEM-encoded server certificate
+//	<prefix>_TLS_KEY_FILE                   file of the PEM-encoded server key
+//	<prefix>_TLS_CLIENT_AUTH_REQUIRED       whether clients must present certificates
+//	<prefix>_TLS_CLIENT_ROOT_CAS            comma separated files of client root CAs
+//	<prefix>_KEEPALIVE_SERVER_TIME          KaOpts.ServerInterval
+//	<prefix>_KEEPALIVE_SERVER_TIMEOUT       KaOpts.ServerTimeout
+//	<prefix>_KEEPALIVE_SERVER_MIN_INTERVAL  KaOpts.ServerMinInterval
+//	<prefix>_MAX_RECV_MSG_SIZE              limit in bytes on the received messages
+//	<prefix>_CONNECTION_TIMEOUT             ConnectionTimeout
+//
+// Booleans are parsed by strconv.ParseBool and durations by
+// time.ParseDuration. Unset or empty variables leave the defaults in place:
+// DefaultKeepaliveOptions, DefaultConnectionTimeout and MaxRecvMsgSize. The
+// client root CA files are watched by the server as ClientRootCAFiles.
+func ConfigFromEnv(prefix string) (ServerConfig, error) {
+	env := &envReader{prefix: prefix}
+	config := ServerConfig{
+		ConnectionTimeout: DefaultConnectionTimeout,
+		KaOpts:            DefaultKeepaliveOptions,
+	}
+
+	config.SecOpts.UseTLS = env.bool("TLS_ENABLED")
+	certFile := env.string("TLS_CERT_FILE")
+	keyFile := env.string("TLS_KEY_FILE")
+	config.SecOpts.RequireClientCert = env.bool("TLS_CLIENT_AUTH_REQUIRED")
+	if rootCAs := env.string("TLS_CLIENT_ROOT_CAS"); rootCAs != "" {
+		for _, file := range strings.Split(rootCAs, ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				config.ClientRootCAFiles = append(config.ClientRootCAFiles, file)
+			}
+		}
+	}
+
+	env.duration("KEEPALIVE_SERVER_TIME", &config.KaOpts.ServerInterval)
+	env.duration("KEEPALIVE_SERVER_TIMEOUT", &config.KaOpts.ServerTimeout)
+	env.duration("KEEPALIVE_SERVER_MIN_INTERVAL", &config.KaOpts.ServerMinInterval)
+	env.duration("CONNECTION_TIMEOUT", &config.ConnectionTimeout)
+	if size := env.size("MAX_RECV_MSG_SIZE"); size > 0 {
+		config.MaxRecvMsgSizeUnary = size
+		config.MaxRecvMsgSizeStreaming = size
+	}
+	if env.err != nil {
+		return ServerConfig{}, env.err
+	}
+
+	if !config.SecOpts.UseTLS {
+		if certFile != "" || keyFile != "" || config.SecOpts.RequireClientCert || len(config.ClientRootCAFiles) != 0 {
+			return ServerConfig{}, errors.Errorf("%s must be true when TLS settings are set", env.name("TLS_ENABLED"))
+		}
+		return config, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return ServerConfig{}, errors.Errorf("%s and %s must be set when TLS is enabled", env.name("TLS_CERT_FILE"), env.name("TLS_KEY_FILE"))
+	}
+	var err error
+	if config.SecOpts.Certificate, err = ioutil.ReadFile(certFile); err != nil {
+		return ServerConfig{}, errors.Wrapf(err, "failed to read %s", env.name("TLS_CERT_FILE"))
+	}
+	if config.SecOpts.Key, err = ioutil.ReadFile(keyFile); err != nil {
+		return ServerConfig{}, errors.Wrapf(err, "failed to read %s", env.name("TLS_KEY_FILE"))
+	}
+	if config.SecOpts.RequireClientCert && len(config.ClientRootCAFiles) == 0 {
+		return ServerConfig{}, errors.Errorf("%s must be set when client authentication is required", env.name("TLS_CLIENT_ROOT_CAS"))
+	}
+	return config, nil
+}
+
+// envReader reads the variables of ConfigFromEnv and keeps the first error
+type envReader struct {
+	prefix string
+	err    error
+}
+
+func (r *envReader) name(suffix string) string {
+	if r.prefix == "" {
+		return suffix
+	}
+	return r.prefix + "_" + suffix
+}
+
+func (r *envReader) string(suffix string) string {
+	return strings.TrimSpace(os.Getenv(r.name(suffix)))
+}
+
+func (r *envReader) bool(suffix string) bool {
+	value := r.string(suffix)
+	if value == "" || r.err != nil {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		r.err = errors.Errorf("invalid %s %q: it must be a boolean", r.name(suffix), value)
+	}
+	return b
+}
+
+func (r *envReader) duration(suffix string, d *time.Duration) {
+	value := r.string(suffix)
+	if value == "" || r.err != nil {
+		return
+	}
+	parsed, err := time.ParseDuration(value)
+	switch {
+	case err != nil:
+		r.err = errors.Errorf("invalid %s %q: it must be a duration such as 30s", r.name(suffix), value)
+	case parsed <= 0:
+		r.err = errors.Errorf("invalid %s %q: it must be positive", r.name(suffix), value)
+	default:
+		*d = parsed
+	}
+}
+
+func (r *envReader) size(suffix string) int {
+	value := r.string(suffix)
+	if value == "" || r.err != nil {
+		return 0
+	}
+	size, err := strconv.Atoi(value)
+	switch {
+	case err != nil:
+		r.err = errors.Errorf("invalid %s %q: it must be a number of bytes", r.name(suffix), value)
+	case size <= 0:
+		r.err = errors.Errorf("invalid %s %q: it must be positive", r.name(suffix), value)
+	}
+	return size
+}
@@ -0,0 +1,155 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/stretchr/testify/require"
+)
+
+// setEnv sets the variables named after prefix for the duration of the test
+func setEnv(t *testing.T, prefix string, vars map[string]string) {
+	for suffix, value := range vars {
+		name := prefix + "_" + suffix
+		require.NoError(t, os.Setenv(name, value))
+		t.Cleanup(func() { os.Unsetenv(name) })
+	}
+}
+
+func TestConfigFromEnvDefaults(t *testing.T) {
+	t.Parallel()
+
+	config, err := comm.ConfigFromEnv("TEST_CONFIG_FROM_ENV_DEFAULTS")
+	require.NoError(t, err)
+	require.Equal(t, comm.ServerConfig{
+		ConnectionTimeout: comm.DefaultConnectionTimeout,
+		KaOpts:            comm.DefaultKeepaliveOptions,
+	}, config)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "configenv")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, serverKeyPair.Cert, 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, serverKeyPair.Key, 0600))
+	require.NoError(t, ioutil.WriteFile(caFile, ca.CertBytes(), 0600))
+
+	const prefix = "TEST_CONFIG_FROM_ENV"
+	setEnv(t, prefix, map[string]string{
+		"TLS_ENABLED":                   "true",
+		"TLS_CERT_FILE":                 certFile,
+		"TLS_KEY_FILE":                  keyFile,
+		"TLS_CLIENT_AUTH_REQUIRED":      "true",
+		"TLS_CLIENT_ROOT_CAS":           caFile + ", " + caFile,
+		"KEEPALIVE_SERVER_TIME":         "30m",
+		"KEEPALIVE_SERVER_TIMEOUT":      "10s",
+		"KEEPALIVE_SERVER_MIN_INTERVAL": "15s",
+		"MAX_RECV_MSG_SIZE":             "1048576",
+		"CONNECTION_TIMEOUT":            "3s",
+	})
+
+	config, err := comm.ConfigFromEnv(prefix)
+	require.NoError(t, err)
+	require.True(t, config.SecOpts.UseTLS)
+	require.True(t, config.SecOpts.RequireClientCert)
+	require.Equal(t, serverKeyPair.Cert, config.SecOpts.Certificate)
+	require.Equal(t, serverKeyPair.Key, config.SecOpts.Key)
+	require.Equal(t, []string{caFile, caFile}, config.ClientRootCAFiles)
+	require.Equal(t, comm.KeepaliveOptions{
+		ClientInterval:    comm.DefaultKeepaliveOptions.ClientInterval,
+		ClientTimeout:     comm.DefaultKeepaliveOptions.ClientTimeout,
+		ServerInterval:    30 * time.Minute,
+		ServerTimeout:     10 * time.Second,
+		ServerMinInterval: 15 * time.Second,
+	}, config.KaOpts)
+	require.Equal(t, 1048576, config.MaxRecvMsgSizeUnary)
+	require.Equal(t, 1048576, config.MaxRecvMsgSizeStreaming)
+	require.Equal(t, 3*time.Second, config.ConnectionTimeout)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", config)
+	require.NoError(t, err)
+	srv.Stop()
+}
+
+func TestConfigFromEnvErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		vars        map[string]string
+		expectedErr string
+	}{
+		{
+			name:        "InvalidBool",
+			vars:        map[string]string{"TLS_ENABLED": "yes please"},
+			expectedErr: `invalid TEST_CONFIG_FROM_ENV_ERRORS_InvalidBool_TLS_ENABLED "yes please": it must be a boolean`,
+		},
+		{
+			name:        "InvalidDuration",
+			vars:        map[string]string{"KEEPALIVE_SERVER_TIME": "30"},
+			expectedErr: `invalid TEST_CONFIG_FROM_ENV_ERRORS_InvalidDuration_KEEPALIVE_SERVER_TIME "30": it must be a duration such as 30s`,
+		},
+		{
+			name:        "NegativeDuration",
+			vars:        map[string]string{"CONNECTION_TIMEOUT": "-1s"},
+			expectedErr: `invalid TEST_CONFIG_FROM_ENV_ERRORS_NegativeDuration_CONNECTION_TIMEOUT "-1s": it must be positive`,
+		},
+		{
+			name:        "InvalidSize",
+			vars:        map[string]string{"MAX_RECV_MSG_SIZE": "1MB"},
+			expectedErr: `invalid TEST_CONFIG_FROM_ENV_ERRORS_InvalidSize_MAX_RECV_MSG_SIZE "1MB": it must be a number of bytes`,
+		},
+		{
+			name:        "ZeroSize",
+			vars:        map[string]string{"MAX_RECV_MSG_SIZE": "0"},
+			expectedErr: `invalid TEST_CONFIG_FROM_ENV_ERRORS_ZeroSize_MAX_RECV_MSG_SIZE "0": it must be positive`,
+		},
+		{
+			name:        "TLSSettingsWithoutTLS",
+			vars:        map[string]string{"TLS_CERT_FILE": "cert.pem"},
+			expectedErr: "TEST_CONFIG_FROM_ENV_ERRORS_TLSSettingsWithoutTLS_TLS_ENABLED must be true when TLS settings are set",
+		},
+		{
+			name:        "MissingKey",
+			vars:        map[string]string{"TLS_ENABLED": "true", "TLS_CERT_FILE": "cert.pem"},
+			expectedErr: "TEST_CONFIG_FROM_ENV_ERRORS_MissingKey_TLS_CERT_FILE and TEST_CONFIG_FROM_ENV_ERRORS_MissingKey_TLS_KEY_FILE must be set when TLS is enabled",
+		},
+		{
+			name:        "UnreadableCertificate",
+			vars:        map[string]string{"TLS_ENABLED": "true", "TLS_CERT_FILE": "/does/not/exist", "TLS_KEY_FILE": "/does/not/exist"},
+			expectedErr: "failed to read TEST_CONFIG_FROM_ENV_ERRORS_UnreadableCertificate_TLS_CERT_FILE",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			prefix := "TEST_CONFIG_FROM_ENV_ERRORS_" + test.name
+			setEnv(t, prefix, test.vars)
+			_, err := comm.ConfigFromEnv(prefix)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), test.expectedErr)
+		})
+	}
+}
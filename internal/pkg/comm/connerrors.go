@@ -0,0 +1,163 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ConnError describes a connection of a GRPCServer that failed
+type ConnError struct {
+	// Time is when the error occurred
+	Time time.Time
+	// RemoteAddress is the address of the peer of the connection
+	RemoteAddress string
+	// Reason describes the error
+	Reason string
+}
+
+// connErrorLog keeps the most recent connection errors in a ring buffer
+type connErrorLog struct {
+	lock   sync.Mutex
+	errors []ConnError
+	// index of the oldest error once the buffer is full
+	next int
+	size int
+}
+
+func newConnErrorLog(size int) *connErrorLog {
+	return &connErrorLog{
+		errors: make([]ConnError, 0, size),
+		size:   size,
+	}
+}
+
+func (l *connErrorLog) record(remoteAddr net.Addr, reason string) {
+	connErr := ConnError{Time: time.Now(), Reason: reason}
+	if remoteAddr != nil {
+		connErr.RemoteAddress = remoteAddr.String()
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.errors) < l.size {
+		l.errors = append(l.errors, connErr)
+		return
+	}
+	l.errors[l.next] = connErr
+	l.next = (l.next + 1) % l.size
+}
+
+// snapshot returns the errors from the oldest to the most recent
+func (l *connErrorLog) snapshot() []ConnError {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	snapshot := make([]ConnError, 0, len(l.errors))
+	snapshot = append(snapshot, l.errors[l.next:]...)
+	return append(snapshot, l.errors[:l.next]...)
+}
+
+// connErrorListener records the network errors of the connections it
+// accepts
+type connErrorListener struct {
+	net.Listener
+	log *connErrorLog
+}
+
+func (l *connErrorListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &connErrorConn{Conn: conn, log: l.log}, nil
+}
+
+// wrapConnErrorListener wraps listener to record the network errors of the
+// connections it accepts
+func (gServer *GRPCServer) wrapConnErrorListener(listener net.Listener) net.Listener {
+	return &connErrorListener{Listener: listener, log: gServer.connErrors}
+}
+
+// connErrorConn records the first network error of the connection, such as
+// a reset by the peer. Errors after the connection is closed locally, the
+// end of the stream and timeouts, which only occur during handshakes that
+// are recorded separately, are not recorded.
+type connErrorConn struct {
+	net.Conn
+	log *connErrorLog
+	// set once the connection is closed or an error is recorded
+	done int32
+}
+
+func (c *connErrorConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err != nil {
+		c.observe(err)
+	}
+	return n, err
+}
+
+func (c *connErrorConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if err != nil {
+		c.observe(err)
+	}
+	return n, err
+}
+
+func (c *connErrorConn) Close() error {
+	atomic.StoreInt32(&c.done, 1)
+	return c.Conn.Close()
+}
+
+func (c *connErrorConn) observe(err error) {
+	if err == io.EOF {
+		return
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return
+	}
+	if c.claim() {
+		c.log.record(c.RemoteAddr(), "connection failed: "+err.Error())
+	}
+}
+
+// claim returns whether no error of the connection was recorded yet and
+// marks it as recorded
+func (c *connErrorConn) claim() bool {
+	return atomic.CompareAndSwapInt32(&c.done, 0, 1)
+}
+
+// connErrorCredentials records the failed handshakes of the
+// TransportCredentials
+type connErrorCredentials struct {
+	credentials.TransportCredentials
+	log *connErrorLog
+}
+
+func (cc *connErrorCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := cc.TransportCredentials.ServerHandshake(rawConn)
+	// a handshake failing because of a network error is only recorded once
+	if c, ok := rawConn.(*connErrorConn); err != nil && (!ok || c.claim()) {
+		cc.log.record(rawConn.RemoteAddr(), "TLS handshake failed: "+err.Error())
+	}
+	return conn, authInfo, err
+}
+
+func (cc *connErrorCredentials) Clone() credentials.TransportCredentials {
+	return &connErrorCredentials{
+		TransportCredentials: cc.TransportCredentials.Clone(),
+		log:                  cc.log,
+	}
+}
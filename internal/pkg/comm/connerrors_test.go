@@ -0,0 +1,144 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+)
+
+func TestRecentConnectionErrorsHandshakes(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	ca, err := tlsgen.NewCA()
+	gt.Expect(err).NotTo(HaveOccurred())
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	gt.Expect(err).NotTo(HaveOccurred())
+	clientKeyPair, err := ca.NewClientCertKeyPair()
+	gt.Expect(err).NotTo(HaveOccurred())
+	otherCA, err := tlsgen.NewCA()
+	gt.Expect(err).NotTo(HaveOccurred())
+	untrustedKeyPair, err := otherCA.NewClientCertKeyPair()
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:            true,
+			RequireClientCert: true,
+			Certificate:       serverKeyPair.Cert,
+			Key:               serverKeyPair.Key,
+			ClientRootCAs:     [][]byte{ca.CertBytes()},
+		},
+		ConnectionErrorHistory: 2,
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	go srv.Start()
+	defer srv.Stop()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(ca.CertBytes())
+	handshake := func(clientKeyPair *tlsgen.CertKeyPair) string {
+		tlsConfig := &tls.Config{RootCAs: rootCAs, MaxVersion: tls.VersionTLS12}
+		if clientKeyPair != nil {
+			cert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+			gt.Expect(err).NotTo(HaveOccurred())
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		conn, err := tls.Dial("tcp", srv.Address(), tlsConfig)
+		if err == nil {
+			localAddr := conn.LocalAddr().String()
+			conn.Close()
+			return localAddr
+		}
+		return ""
+	}
+
+	// successful handshakes and connections closed by clients are not errors
+	gt.Expect(handshake(clientKeyPair)).NotTo(BeEmpty())
+	gt.Consistently(srv.RecentConnectionErrors, 100*time.Millisecond).Should(BeEmpty())
+
+	// only the most recent errors are kept
+	handshake(untrustedKeyPair)
+	gt.Eventually(srv.RecentConnectionErrors, 5*time.Second).Should(HaveLen(1))
+	handshake(nil)
+	gt.Eventually(srv.RecentConnectionErrors, 5*time.Second).Should(HaveLen(2))
+	conn, err := net.Dial("tcp", srv.Address())
+	gt.Expect(err).NotTo(HaveOccurred())
+	plaintextAddr := conn.LocalAddr().String()
+	_, err = conn.Write([]byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"))
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer conn.Close()
+
+	gt.Eventually(func() string {
+		connErrors := srv.RecentConnectionErrors()
+		return connErrors[len(connErrors)-1].RemoteAddress
+	}, 5*time.Second).Should(Equal(plaintextAddr))
+	connErrors := srv.RecentConnectionErrors()
+	gt.Expect(connErrors).To(HaveLen(2))
+	gt.Expect(connErrors[0].Reason).To(HavePrefix("TLS handshake failed: "))
+	gt.Expect(connErrors[0].Reason).To(ContainSubstring("client didn't provide a certificate"))
+	gt.Expect(connErrors[1].Reason).To(HavePrefix("TLS handshake failed: "))
+	gt.Expect(connErrors[1].Reason).To(ContainSubstring("does not look like a TLS handshake"))
+	gt.Expect(connErrors[0].Time).To(BeTemporally("<=", connErrors[1].Time))
+	gt.Expect(connErrors[1].Time).To(BeTemporally("~", time.Now(), 5*time.Second))
+}
+
+func TestRecentConnectionErrorsReset(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{ConnectionErrorHistory: 10})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	// calls on connections closed normally are not errors
+	_, err = invokeEmptyCall(srv.Address(), grpc.WithBlock(), grpc.WithInsecure())
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	conn, err := net.Dial("tcp", srv.Address())
+	gt.Expect(err).NotTo(HaveOccurred())
+	localAddr := conn.LocalAddr().String()
+	_, err = conn.Write([]byte("PRI * HTTP/2.0\r\n"))
+	gt.Expect(err).NotTo(HaveOccurred())
+	// closing with a zero linger time resets the connection
+	gt.Expect(conn.(*net.TCPConn).SetLinger(0)).To(Succeed())
+	gt.Expect(conn.Close()).To(Succeed())
+
+	gt.Eventually(srv.RecentConnectionErrors, 5*time.Second).Should(HaveLen(1))
+	connErr := srv.RecentConnectionErrors()[0]
+	gt.Expect(connErr.RemoteAddress).To(Equal(localAddr))
+	gt.Expect(connErr.Reason).To(HavePrefix("connection failed: "))
+	gt.Expect(connErr.Reason).To(ContainSubstring("connection reset by peer"))
+}
+
+func TestRecentConnectionErrorsDisabled(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	gt.Expect(err).NotTo(HaveOccurred())
+	go srv.Start()
+	defer srv.Stop()
+
+	conn, err := net.Dial("tcp", srv.Address())
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(conn.(*net.TCPConn).SetLinger(0)).To(Succeed())
+	gt.Expect(conn.Close()).To(Succeed())
+	gt.Consistently(srv.RecentConnectionErrors, 100*time.Millisecond).Should(BeNil())
+}
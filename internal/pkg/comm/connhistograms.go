@@ -0,0 +1,102 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// DefaultHandshakeDurationBuckets are the bucket boundaries, in seconds,
+	// of the TLS handshake duration histogram
+	DefaultHandshakeDurationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+	// DefaultConnectionLifetimeBuckets are the bucket boundaries, in
+	// seconds, of the connection lifetime histogram; from one second to a
+	// day
+	DefaultConnectionLifetimeBuckets = []float64{1, 10, 30, 60, 300, 900, 1800, 3600, 7200, 21600, 86400}
+	// DefaultRPCDurationBuckets are the bucket boundaries, in seconds, of
+	// the RPC duration histogram
+	DefaultRPCDurationBuckets = prometheus.DefBuckets
+)
+
+// ConnectionHistogramBuckets overrides the bucket boundaries, in seconds, of
+// the connection histograms. The defaults are used for nil boundaries.
+type ConnectionHistogramBuckets struct {
+	HandshakeDuration  []float64
+	ConnectionLifetime []float64
+	RPCDuration        []float64
+}
+
+// ConnectionHistograms exports the TLS handshake duration, the connection
+// lifetime and the RPC duration observed by a ServerStatsHandler as
+// Prometheus histograms. The histograms follow the OpenMetrics conventions:
+// durations are in seconds and their names carry the unit.
+type ConnectionHistograms struct {
+	handshakeDuration  prometheus.Histogram
+	connectionLifetime prometheus.Histogram
+	rpcDuration        *prometheus.HistogramVec
+}
+
+// NewConnectionHistograms creates the connection histograms and registers
+// them with registerer. They record observations once set as the
+// Histograms of the ServerStatsHandler of a server.
+func NewConnectionHistograms(registerer prometheus.Registerer, buckets ConnectionHistogramBuckets) (*ConnectionHistograms, error) {
+	ch := &ConnectionHistograms{
+		handshakeDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "grpc",
+			Subsystem: "comm",
+			Name:      "handshake_duration_seconds",
+			Help:      "The duration of successful server TLS handshakes.",
+			Buckets:   bucketsOrDefault(buckets.HandshakeDuration, DefaultHandshakeDurationBuckets),
+		}),
+		connectionLifetime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "grpc",
+			Subsystem: "comm",
+			Name:      "connection_lifetime_seconds",
+			Help:      "The time from the establishment of a gRPC connection to its closure.",
+			Buckets:   bucketsOrDefault(buckets.ConnectionLifetime, DefaultConnectionLifetimeBuckets),
+		}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "grpc",
+			Subsystem: "comm",
+			Name:      "rpc_duration_seconds",
+			Help:      "The time taken to complete the RPCs of a gRPC method.",
+			Buckets:   bucketsOrDefault(buckets.RPCDuration, DefaultRPCDurationBuckets),
+		}, []string{"service", "method", "code"}),
+	}
+
+	for _, c := range []prometheus.Collector{ch.handshakeDuration, ch.connectionLifetime, ch.rpcDuration} {
+		if err := registerer.Register(c); err != nil {
+			return nil, errors.Wrap(err, "failed to register connection histograms")
+		}
+	}
+	return ch, nil
+}
+
+func bucketsOrDefault(buckets, defaults []float64) []float64 {
+	if buckets == nil {
+		return defaults
+	}
+	return buckets
+}
+
+func (ch *ConnectionHistograms) observeHandshake(duration time.Duration) {
+	ch.handshakeDuration.Observe(duration.Seconds())
+}
+
+func (ch *ConnectionHistograms) observeConnection(lifetime time.Duration) {
+	ch.connectionLifetime.Observe(lifetime.Seconds())
+}
+
+func (ch *ConnectionHistograms) observeRPC(fullMethod string, duration time.Duration, err error) {
+	service, method := serviceMethod(fullMethod)
+	ch.rpcDuration.WithLabelValues(service, method, status.Code(err).String()).Observe(duration.Seconds())
+}
@@ -0,0 +1,123 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func scrape(gt *GomegaWithT, url string) string {
+	resp, err := http.Get(url)
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+	gt.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	body, err := ioutil.ReadAll(resp.Body)
+	gt.Expect(err).NotTo(HaveOccurred())
+	return string(body)
+}
+
+func TestConnectionHistograms(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	registry := prometheus.NewRegistry()
+	histograms, err := comm.NewConnectionHistograms(registry, comm.ConnectionHistogramBuckets{
+		RPCDuration: []float64{0.5, 1},
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	metricsServer := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer metricsServer.Close()
+
+	ca, err := tlsgen.NewCA()
+	gt.Expect(err).NotTo(HaveOccurred())
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	statsHandler := comm.NewServerStatsHandler(&disabled.Provider{})
+	statsHandler.Histograms = histograms
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	gt.Expect(err).NotTo(HaveOccurred())
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:      true,
+			Certificate: serverKeyPair.Cert,
+			Key:         serverKeyPair.Key,
+		},
+		ServerStatsHandler: statsHandler,
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(ca.CertBytes())
+	conn, err := grpc.Dial(
+		lis.Addr().String(),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: rootCAs})),
+		grpc.WithBlock(),
+	)
+	gt.Expect(err).NotTo(HaveOccurred())
+	client := testpb.NewEmptyServiceClient(conn)
+	for i := 0; i < 3; i++ {
+		_, err = client.EmptyCall(context.Background(), &testpb.Empty{})
+		gt.Expect(err).NotTo(HaveOccurred())
+	}
+	conn.Close()
+
+	url := metricsServer.URL
+	gt.Eventually(func() string { return scrape(gt, url) }, 5*time.Second).Should(
+		ContainSubstring("grpc_comm_connection_lifetime_seconds_count 1\n"),
+	)
+
+	scraped := scrape(gt, url)
+	gt.Expect(scraped).To(ContainSubstring("# TYPE grpc_comm_handshake_duration_seconds histogram\n"))
+	gt.Expect(scraped).To(ContainSubstring("grpc_comm_handshake_duration_seconds_count 1\n"))
+	for _, bound := range []string{"0.001", "0.25", "5", "+Inf"} {
+		gt.Expect(scraped).To(ContainSubstring(`grpc_comm_handshake_duration_seconds_bucket{le="` + bound + `"}`))
+	}
+
+	gt.Expect(scraped).To(ContainSubstring("# TYPE grpc_comm_connection_lifetime_seconds histogram\n"))
+	for _, bound := range []string{"1", "3600", "86400", "+Inf"} {
+		gt.Expect(scraped).To(ContainSubstring(`grpc_comm_connection_lifetime_seconds_bucket{le="` + bound + `"}`))
+	}
+
+	// overridden boundaries replace the defaults
+	gt.Expect(scraped).To(ContainSubstring("# TYPE grpc_comm_rpc_duration_seconds histogram\n"))
+	gt.Expect(scraped).To(ContainSubstring(`grpc_comm_rpc_duration_seconds_count{code="OK",method="EmptyCall",service="EmptyService"} 3` + "\n"))
+	gt.Expect(scraped).To(ContainSubstring(`grpc_comm_rpc_duration_seconds_bucket{code="OK",method="EmptyCall",service="EmptyService",le="0.5"} 3` + "\n"))
+	gt.Expect(scraped).To(ContainSubstring(`grpc_comm_rpc_duration_seconds_bucket{code="OK",method="EmptyCall",service="EmptyService",le="1"} 3` + "\n"))
+	gt.Expect(scraped).NotTo(ContainSubstring(`grpc_comm_rpc_duration_seconds_bucket{code="OK",method="EmptyCall",service="EmptyService",le="0.005"}`))
+}
+
+func TestConnectionHistogramsAlreadyRegistered(t *testing.T) {
+	gt := NewGomegaWithT(t)
+
+	registry := prometheus.NewRegistry()
+	_, err := comm.NewConnectionHistograms(registry, comm.ConnectionHistogramBuckets{})
+	gt.Expect(err).NotTo(HaveOccurred())
+	_, err = comm.NewConnectionHistograms(registry, comm.ConnectionHistogramBuckets{})
+	gt.Expect(err).To(MatchError(ContainSubstring("failed to register connection histograms")))
+}
@@ -0,0 +1,162 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"net"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric/common/flogging"
+)
+
+// OpenConnection describes a connection accepted by a server that is not
+// closed yet
+type OpenConnection struct {
+	// RemoteAddress is the address of the peer of the connection
+	RemoteAddress string
+	// Accepted is when the server accepted the connection
+	Accepted time.Time
+}
+
+// ConnectionLeakReport describes the connections accepted by a server that
+// are not closed yet, as reported by GRPCServer.ConnectionLeakReport
+type ConnectionLeakReport struct {
+	// OpenConnections is the number of connections accepted and not closed
+	OpenConnections int
+	// Connections describes the open connections from the oldest to the
+	// most recent
+	Connections []OpenConnection
+	// ThresholdExceeded is set when OpenConnections exceeds
+	// ServerConfig.ConnectionLeakThreshold
+	ThresholdExceeded bool
+	// GoroutineStacks, only set when ThresholdExceeded is, holds the stack
+	// traces of the goroutines running gRPC code, which include the ones
+	// serving the connections and the handlers of their calls
+	GoroutineStacks string
+}
+
+// openConnTracker tracks the connections accepted by a server until they
+// are closed
+type openConnTracker struct {
+	threshold int
+	logger    *flogging.FabricLogger
+
+	lock  sync.Mutex
+	conns map[*trackedConn]time.Time
+	// set while the number of open connections exceeds the threshold, so
+	// that crossing it is only logged once
+	exceeded bool
+}
+
+func newOpenConnTracker(threshold int, logger *flogging.FabricLogger) *openConnTracker {
+	return &openConnTracker{
+		threshold: threshold,
+		logger:    logger,
+		conns:     map[*trackedConn]time.Time{},
+	}
+}
+
+// wrapListener wraps listener to track the connections it accepts
+func (t *openConnTracker) wrapListener(listener net.Listener) net.Listener {
+	return &trackedListener{Listener: listener, tracker: t}
+}
+
+func (t *openConnTracker) add(conn *trackedConn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.conns[conn] = time.Now()
+	if t.threshold > 0 && len(t.conns) > t.threshold && !t.exceeded {
+		t.exceeded = true
+		t.logger.Warningf("%d connections are open, more than the leak threshold of %d", len(t.conns), t.threshold)
+	}
+}
+
+func (t *openConnTracker) remove(conn *trackedConn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.conns, conn)
+	if len(t.conns) <= t.threshold {
+		t.exceeded = false
+	}
+}
+
+func (t *openConnTracker) report() *ConnectionLeakReport {
+	t.lock.Lock()
+	report := &ConnectionLeakReport{
+		OpenConnections: len(t.conns),
+		Connections:     make([]OpenConnection, 0, len(t.conns)),
+	}
+	for conn, accepted := range t.conns {
+		report.Connections = append(report.Connections, OpenConnection{
+			RemoteAddress: conn.RemoteAddr().String(),
+			Accepted:      accepted,
+		})
+	}
+	t.lock.Unlock()
+
+	sort.Slice(report.Connections, func(i, j int) bool {
+		return report.Connections[i].Accepted.Before(report.Connections[j].Accepted)
+	})
+	if t.threshold > 0 && report.OpenConnections > t.threshold {
+		report.ThresholdExceeded = true
+		report.GoroutineStacks = grpcGoroutineStacks()
+	}
+	return report
+}
+
+// grpcGoroutineStacks returns the stack traces of the goroutines running
+// gRPC code
+func grpcGoroutineStacks() string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var stacks []string
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(stack, "google.golang.org/grpc") {
+			stacks = append(stacks, stack)
+		}
+	}
+	return strings.Join(stacks, "\n\n")
+}
+
+type trackedListener struct {
+	net.Listener
+	tracker *openConnTracker
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tracked := &trackedConn{Conn: conn, tracker: l.tracker}
+	l.tracker.add(tracked)
+	return tracked, nil
+}
+
+// trackedConn stops being tracked when it is closed
+type trackedConn struct {
+	net.Conn
+	tracker *openConnTracker
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.tracker.remove(c) })
+	return c.Conn.Close()
+}
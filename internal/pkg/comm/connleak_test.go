@@ -0,0 +1,89 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestConnectionLeakReport(t *testing.T) {
+	t.Parallel()
+
+	warnings := &recordedWarnings{}
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		ConnectionTimeout:       time.Minute,
+		TrackOpenConnections:    true,
+		ConnectionLeakThreshold: 1,
+		Logger:                  warnings.logger(),
+	})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	report := srv.ConnectionLeakReport()
+	require.Equal(t, 0, report.OpenConnections)
+	require.False(t, report.ThresholdExceeded)
+
+	// a client that never speaks keeps its connection open until the
+	// connection timeout, much like a leaked connection
+	leaked, err := net.Dial("tcp", srv.Address())
+	require.NoError(t, err)
+	defer leaked.Close()
+	require.Eventually(t, func() bool { return srv.ConnectionLeakReport().OpenConnections == 1 }, 5*time.Second, 10*time.Millisecond)
+	report = srv.ConnectionLeakReport()
+	require.Equal(t, leaked.LocalAddr().String(), report.Connections[0].RemoteAddress)
+	require.False(t, report.ThresholdExceeded)
+	require.Empty(t, report.GoroutineStacks)
+	require.Empty(t, warnings.get())
+
+	conn, err := grpc.Dial(srv.Address(), grpc.WithInsecure(), grpc.WithBlock())
+	require.NoError(t, err)
+	defer conn.Close()
+	stream, err := testpb.NewEmptyServiceClient(conn).EmptyStream(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&testpb.Empty{}))
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	report = srv.ConnectionLeakReport()
+	require.Equal(t, 2, report.OpenConnections)
+	require.Equal(t, leaked.LocalAddr().String(), report.Connections[0].RemoteAddress, "connections are sorted from the oldest")
+	require.False(t, report.Connections[1].Accepted.Before(report.Connections[0].Accepted))
+	require.True(t, report.ThresholdExceeded)
+	require.Contains(t, report.GoroutineStacks, "google.golang.org/grpc")
+	require.Contains(t, report.GoroutineStacks, "processStreamingRPC", "the goroutine handling the stream is reported")
+	require.Equal(t, []string{"2 connections are open, more than the leak threshold of 1"}, warnings.get())
+
+	// closing the connections stops tracking them
+	leaked.Close()
+	conn.Close()
+	require.Eventually(t, func() bool { return srv.ConnectionLeakReport().OpenConnections == 0 }, 5*time.Second, 10*time.Millisecond)
+	report = srv.ConnectionLeakReport()
+	require.Empty(t, report.Connections)
+	require.False(t, report.ThresholdExceeded)
+}
+
+func TestConnectionLeakReportDisabled(t *testing.T) {
+	t.Parallel()
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	require.NoError(t, err)
+	defer srv.Stop()
+	require.Nil(t, srv.ConnectionLeakReport())
+
+	_, err = comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{ConnectionLeakThreshold: 1})
+	require.EqualError(t, err, "serverConfig.ConnectionLeakThreshold requires TrackOpenConnections to be true")
+}
@@ -0,0 +1,121 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/hyperledger/fabric/common/metrics"
+)
+
+// LimitConnectionsPerIP returns a listener wrapper, e.g. for
+// ServerConfig.ListenerWrappers, capping the number of concurrent
+// connections of every remote IP to max. It panics if max is not positive.
+// The connections beyond it are closed as soon as they are accepted and
+// counted with rejected, unless it is nil, without blocking the accept loop
+// on the metrics provider.
+//
+// The IP of a connection is the one of its RemoteAddr, so behind a proxy
+// using the PROXY protocol the wrapper must come after the PROXY protocol
+// decoder, which reports the address of the client rather than the one of
+// the proxy; otherwise all the clients of a proxy share a single limit.
+func LimitConnectionsPerIP(max int, rejected metrics.Counter) func(net.Listener) net.Listener {
+	if max <= 0 {
+		panic(fmt.Sprintf("invalid maximum number of connections per IP %d, it must be positive", max))
+	}
+	return func(listener net.Listener) net.Listener {
+		done := make(chan struct{})
+		return &perIPLimitListener{
+			Listener: listener,
+			max:      max,
+			rejected: rejected,
+			emitter:  newMetricsEmitter(commLogger, done),
+			done:     done,
+			conns:    map[string]int{},
+		}
+	}
+}
+
+type perIPLimitListener struct {
+	net.Listener
+	max      int
+	rejected metrics.Counter
+	// emits the metrics of the listener until done is closed, when the
+	// listener is
+	emitter   *metricsEmitter
+	done      chan struct{}
+	closeOnce sync.Once
+
+	lock  sync.Mutex
+	conns map[string]int
+}
+
+func (l *perIPLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := remoteIP(conn.RemoteAddr())
+		if l.acquire(ip) {
+			return &perIPLimitConn{Conn: conn, release: func() { l.release(ip) }}, nil
+		}
+		commLogger.Debugf("Closing connection from %s, which has reached the limit of %d concurrent connections", conn.RemoteAddr(), l.max)
+		conn.Close()
+		if l.rejected != nil {
+			l.emitter.emit(func() { l.rejected.Add(1) })
+		}
+	}
+}
+
+func (l *perIPLimitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+func (l *perIPLimitListener) acquire(ip string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.conns[ip] >= l.max {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *perIPLimitListener) release(ip string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.conns[ip]--; l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+// remoteIP returns the IP of addr, or addr itself if it has none
+func remoteIP(addr net.Addr) string {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+// perIPLimitConn releases its slot the first time it is closed
+type perIPLimitConn struct {
+	net.Conn
+	release   func()
+	closeOnce sync.Once
+}
+
+func (c *perIPLimitConn) Close() error {
+	c.closeOnce.Do(c.release)
+	return c.Conn.Close()
+}
@@ -0,0 +1,88 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+)
+
+// closedByServer returns whether the server closed conn, reading whatever it
+// sent until then
+func closedByServer(conn net.Conn) bool {
+	buf := make([]byte, 1024)
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		if _, err := conn.Read(buf); err != nil {
+			netErr, ok := err.(net.Error)
+			return !ok || !netErr.Timeout()
+		}
+	}
+}
+
+func TestLimitConnectionsPerIP(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	rejected := &metricsfakes.Counter{}
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		ListenerWrappers: []func(net.Listener) net.Listener{comm.LimitConnectionsPerIP(2, rejected)},
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	dial := func(ip string) net.Conn {
+		dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+		conn, err := dialer.Dial("tcp", srv.Address())
+		gt.Expect(err).NotTo(HaveOccurred())
+		return conn
+	}
+
+	first, second := dial("127.0.0.1"), dial("127.0.0.1")
+	defer first.Close()
+	defer second.Close()
+	gt.Expect(closedByServer(first)).To(BeFalse())
+	gt.Expect(closedByServer(second)).To(BeFalse())
+
+	// connections beyond the limit of an IP are closed at once
+	for i := 0; i < 3; i++ {
+		excess := dial("127.0.0.1")
+		gt.Expect(closedByServer(excess)).To(BeTrue())
+		excess.Close()
+	}
+	gt.Eventually(rejected.AddCallCount, time.Second).Should(Equal(3))
+	gt.Expect(rejected.AddArgsForCall(0)).To(Equal(float64(1)))
+
+	// other IPs have their own limit
+	other := dial("127.0.0.2")
+	defer other.Close()
+	gt.Expect(closedByServer(other)).To(BeFalse())
+
+	// closing a connection frees its slot once the server closes its side
+	first.Close()
+	gt.Eventually(func() error {
+		_, err := invokeEmptyCall(srv.Address(), grpc.WithBlock(), grpc.WithInsecure())
+		return err
+	}, 5*time.Second).Should(Succeed())
+}
+
+func TestLimitConnectionsPerIPInvalidMax(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	gt.Expect(func() { comm.LimitConnectionsPerIP(0, nil) }).To(Panic())
+	gt.Expect(func() { comm.LimitConnectionsPerIP(-1, nil) }).To(Panic())
+}
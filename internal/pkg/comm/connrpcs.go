@@ -0,0 +1,83 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/stats"
+)
+
+// connRPCsHandler counts the RPCs of every open connection by the remote
+// address of the connection. The count of a connection is dropped when it
+// ends.
+type connRPCsHandler struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+type connRPCsKey struct{}
+
+func newConnRPCsHandler() *connRPCsHandler {
+	return &connRPCsHandler{counts: map[string]int{}}
+}
+
+// snapshot returns the number of RPCs of every open connection
+func (h *connRPCsHandler) snapshot() map[string]int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	counts := make(map[string]int, len(h.counts))
+	for addr, count := range h.counts {
+		counts[addr] = count
+	}
+	return counts
+}
+
+func (h *connRPCsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	if info.RemoteAddr == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, connRPCsKey{}, info.RemoteAddr.String())
+}
+
+func (h *connRPCsHandler) HandleConn(ctx context.Context, s stats.ConnStats) {
+	addr, ok := ctx.Value(connRPCsKey{}).(string)
+	if !ok {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	switch s.(type) {
+	case *stats.ConnBegin:
+		h.counts[addr] = 0
+	case *stats.ConnEnd:
+		delete(h.counts, addr)
+	}
+}
+
+func (h *connRPCsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *connRPCsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	if begin, ok := s.(*stats.Begin); !ok || begin.Client {
+		return
+	}
+	addr, ok := ctx.Value(connRPCsKey{}).(string)
+	if !ok {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	// the connection may have ended while the RPC was starting
+	if _, open := h.counts[addr]; open {
+		h.counts[addr]++
+	}
+}
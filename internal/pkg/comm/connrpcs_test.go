@@ -0,0 +1,91 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+)
+
+func TestRPCsByConnection(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{TrackConnectionRPCs: true})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+	gt.Expect(srv.RPCsByConnection()).To(BeEmpty())
+
+	// connect reports the local address of the connections so that they
+	// can be matched with the remote addresses seen by the server
+	connect := func() (*grpc.ClientConn, string) {
+		addrs := make(chan string, 1)
+		conn, err := grpc.Dial(srv.Address(), grpc.WithInsecure(), grpc.WithBlock(),
+			grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+				conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+				if err == nil {
+					addrs <- conn.LocalAddr().String()
+				}
+				return conn, err
+			}),
+		)
+		gt.Expect(err).NotTo(HaveOccurred())
+		return conn, <-addrs
+	}
+	chatty, chattyAddr := connect()
+	defer chatty.Close()
+	quiet, quietAddr := connect()
+
+	// concurrent calls are all counted
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := testpb.NewEmptyServiceClient(chatty).EmptyCall(context.Background(), &testpb.Empty{}); err != nil {
+				t.Errorf("call failed: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	stream, err := testpb.NewEmptyServiceClient(chatty).EmptyStream(context.Background())
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(stream.Send(&testpb.Empty{})).To(Succeed())
+	_, err = stream.Recv()
+	gt.Expect(err).NotTo(HaveOccurred())
+	_, err = testpb.NewEmptyServiceClient(quiet).EmptyCall(context.Background(), &testpb.Empty{})
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	gt.Eventually(srv.RPCsByConnection).Should(Equal(map[string]int{
+		chattyAddr: 11,
+		quietAddr:  1,
+	}))
+
+	// the counts of closed connections are dropped
+	gt.Expect(quiet.Close()).To(Succeed())
+	gt.Eventually(srv.RPCsByConnection, 5*time.Second).Should(Equal(map[string]int{chattyAddr: 11}))
+}
+
+func TestRPCsByConnectionNotTracked(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer srv.Stop()
+	gt.Expect(srv.RPCsByConnection()).To(BeNil())
+}
@@ -0,0 +1,91 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/stats"
+)
+
+// ConnValueFunc computes a value associated with a connection from the
+// context of an RPC on that connection. The context carries the peer and,
+// for TLS connections, its certificates. Returning false leaves the value
+// unset.
+type ConnValueFunc func(ctx context.Context) (interface{}, bool)
+
+type connValuesKey struct{}
+
+// connValues holds the values of a connection. The TLS state of a connection
+// is not available when it begins, so the values are computed once from the
+// context of its first RPC.
+type connValues struct {
+	once   sync.Once
+	lock   sync.RWMutex
+	values map[string]interface{}
+}
+
+// connValueHandler is a stats.Handler that maintains the values of each
+// connection from the time it begins until it ends
+type connValueHandler struct {
+	funcs map[string]ConnValueFunc
+}
+
+func newConnValueHandler(funcs map[string]ConnValueFunc) *connValueHandler {
+	return &connValueHandler{funcs: funcs}
+}
+
+func (h *connValueHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connValuesKey{}, &connValues{})
+}
+
+func (h *connValueHandler) HandleConn(ctx context.Context, s stats.ConnStats) {
+	if _, ok := s.(*stats.ConnEnd); !ok {
+		return
+	}
+	if cv, ok := ctx.Value(connValuesKey{}).(*connValues); ok {
+		cv.lock.Lock()
+		cv.values = nil
+		cv.lock.Unlock()
+	}
+}
+
+func (h *connValueHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	cv, ok := ctx.Value(connValuesKey{}).(*connValues)
+	if !ok {
+		return ctx
+	}
+	cv.once.Do(func() {
+		values := map[string]interface{}{}
+		for key, f := range h.funcs {
+			if v, ok := f(ctx); ok {
+				values[key] = v
+			}
+		}
+		cv.lock.Lock()
+		cv.values = values
+		cv.lock.Unlock()
+	})
+	return ctx
+}
+
+func (h *connValueHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {}
+
+// ConnValue returns the value stored under key for the connection of the RPC
+// with the given context. Values are computed by the ServerConfig.ConnValues
+// functions and are released when the connection ends.
+func ConnValue(ctx context.Context, key string) (interface{}, bool) {
+	cv, ok := ctx.Value(connValuesKey{}).(*connValues)
+	if !ok {
+		return nil, false
+	}
+	cv.lock.RLock()
+	defer cv.lock.RUnlock()
+	v, ok := cv.values[key]
+	return v, ok
+}
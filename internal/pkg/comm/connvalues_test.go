@@ -0,0 +1,111 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+type connValueServer struct {
+	emptyServiceServer
+	contexts chan context.Context
+}
+
+func (cs *connValueServer) EmptyCall(ctx context.Context, _ *testpb.Empty) (*testpb.Empty, error) {
+	cs.contexts <- ctx
+	return new(testpb.Empty), nil
+}
+
+func TestConnValues(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	var computed int32
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	gt.Expect(err).NotTo(HaveOccurred())
+	srv, err := comm.NewGRPCServerFromListener(listener, comm.ServerConfig{
+		ConnValues: map[string]comm.ConnValueFunc{
+			"remote": func(ctx context.Context) (interface{}, bool) {
+				atomic.AddInt32(&computed, 1)
+				p, ok := peer.FromContext(ctx)
+				if !ok {
+					return nil, false
+				}
+				return p.Addr.String(), true
+			},
+			"unset": func(context.Context) (interface{}, bool) {
+				return nil, false
+			},
+		},
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	svc := &connValueServer{contexts: make(chan context.Context, 10)}
+	testpb.RegisterEmptyServiceServer(srv.Server(), svc)
+	go srv.Start()
+	defer srv.Stop()
+
+	dial := func() *grpc.ClientConn {
+		conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+		gt.Expect(err).NotTo(HaveOccurred())
+		return conn
+	}
+	call := func(conn *grpc.ClientConn) context.Context {
+		_, err := testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+		gt.Expect(err).NotTo(HaveOccurred())
+		return <-svc.contexts
+	}
+
+	conn1 := dial()
+	defer conn1.Close()
+	ctx1 := call(conn1)
+	remote1, ok := comm.ConnValue(ctx1, "remote")
+	gt.Expect(ok).To(BeTrue())
+	_, ok = comm.ConnValue(ctx1, "unset")
+	gt.Expect(ok).To(BeFalse())
+	_, ok = comm.ConnValue(ctx1, "missing")
+	gt.Expect(ok).To(BeFalse())
+
+	// the values are computed once per connection
+	for i := 0; i < 5; i++ {
+		remote, ok := comm.ConnValue(call(conn1), "remote")
+		gt.Expect(ok).To(BeTrue())
+		gt.Expect(remote).To(Equal(remote1))
+	}
+	gt.Expect(atomic.LoadInt32(&computed)).To(Equal(int32(1)))
+
+	conn2 := dial()
+	ctx2 := call(conn2)
+	remote2, ok := comm.ConnValue(ctx2, "remote")
+	gt.Expect(ok).To(BeTrue())
+	gt.Expect(remote2).NotTo(Equal(remote1))
+	gt.Expect(atomic.LoadInt32(&computed)).To(Equal(int32(2)))
+
+	// the values are released when the connection ends
+	conn2.Close()
+	gt.Eventually(func() bool {
+		_, ok := comm.ConnValue(ctx2, "remote")
+		return ok
+	}).Should(BeFalse())
+	_, ok = comm.ConnValue(ctx1, "remote")
+	gt.Expect(ok).To(BeTrue())
+}
+
+func TestConnValueWithoutStore(t *testing.T) {
+	gt := NewGomegaWithT(t)
+
+	_, ok := comm.ConnValue(context.Background(), "key")
+	gt.Expect(ok).To(BeFalse())
+}
@@ -11,11 +11,14 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/common/metrics"
 	"google.golang.org/grpc/credentials"
 )
 
@@ -23,6 +26,10 @@ var (
 	ErrClientHandshakeNotImplemented = errors.New("core/comm: client handshakes are not implemented with serverCreds")
 	ErrServerHandshakeNotImplemented = errors.New("core/comm: server handshakes are not implemented with clientCreds")
 	ErrOverrideHostnameNotSupported  = errors.New("core/comm: OverrideServerName is not supported")
+	// ErrClientCertificateExpired is wrapped by the errors of server
+	// handshakes rejecting a client certificate because it expired, as
+	// opposed to not being trusted
+	ErrClientCertificateExpired = errors.New("core/comm: client certificate expired")
 
 	// alpnProtoStr are the specified application level protocols for gRPC.
 	alpnProtoStr = []string{"h2"}
@@ -36,60 +43,178 @@ var (
 func NewServerTransportCredentials(
 	serverConfig *TLSConfig,
 	logger *flogging.FabricLogger) credentials.TransportCredentials {
+	return newServerCreds(serverConfig, logger, nil, nil, syncMetricsEmitter)
+}
+
+// newServerCreds returns server credentials reporting the duration of
+// successful handshakes to observeHandshake and counting the handshakes
+// rejecting expired client certificates with expiredClientCerts, unless
+// they are nil, through emitter
+func newServerCreds(
+	serverConfig *TLSConfig,
+	logger *flogging.FabricLogger,
+	observeHandshake func(time.Duration),
+	expiredClientCerts metrics.Counter,
+	emitter *metricsEmitter) *serverCreds {
 	// NOTE: unlike the default grpc/credentials implementation, we do not
 	// clone the tls.Config which allows us to update it dynamically
-	serverConfig.config.NextProtos = alpnProtoStr
-	serverConfig.config.MinVersion = tls.VersionTLS12
+	serverConfig.lock.Lock()
+	serverConfig.update(func(config *tls.Config) {
+		config.NextProtos = alpnProtoStr
+		config.MinVersion = tls.VersionTLS12
+	})
+	serverConfig.lock.Unlock()
 
 	if logger == nil {
 		logger = tlsClientLogger
 	}
 
 	return &serverCreds{
-		serverConfig: serverConfig,
-		logger:       logger}
+		serverConfig:       serverConfig,
+		logger:             logger,
+		observeHandshake:   observeHandshake,
+		expiredClientCerts: expiredClientCerts,
+		emitter:            emitter}
 }
 
 // serverCreds is an implementation of grpc/credentials.TransportCredentials.
 type serverCreds struct {
-	serverConfig *TLSConfig
-	logger       *flogging.FabricLogger
+	serverConfig       *TLSConfig
+	logger             *flogging.FabricLogger
+	observeHandshake   func(time.Duration)
+	expiredClientCerts metrics.Counter
+	emitter            *metricsEmitter
 }
 
+// TLSConfig holds a TLS configuration that can be updated while handshakes
+// are using it. Updates never modify the current configuration: they publish
+// a modified copy, so every handshake works on a consistent snapshot, either
+// the configuration before an update or the one after it.
 type TLSConfig struct {
-	config *tls.Config
-	lock   sync.RWMutex
+	// config holds a *tls.Config that is never modified once stored
+	config atomic.Value
+	// lock serializes updates
+	lock sync.Mutex
+	// clientRoots are the certificates of the ClientCAs pool when it is
+	// built by TLSConfig rather than supplied by the caller
+	clientRoots      []*x509.Certificate
+	clientRootsKnown bool
 }
 
+// NewTLSConfig creates a TLSConfig starting from config, which must not be
+// modified afterwards
 func NewTLSConfig(config *tls.Config) *TLSConfig {
-	return &TLSConfig{
-		config: config,
-	}
+	t := &TLSConfig{clientRootsKnown: config == nil || config.ClientCAs == nil}
+	t.config.Store(config)
+	return t
 }
 
-func (t *TLSConfig) Config() tls.Config {
-	t.lock.RLock()
-	defer t.lock.RUnlock()
+func (t *TLSConfig) load() *tls.Config {
+	return t.config.Load().(*tls.Config)
+}
 
-	if t.config != nil {
-		return *t.config.Clone()
+// Config returns a copy of the current configuration
+func (t *TLSConfig) Config() tls.Config {
+	if config := t.load(); config != nil {
+		return *config.Clone()
 	}
 
 	return tls.Config{}
 }
 
+// update publishes a copy of the current configuration modified by modify;
+// the lock must be held
+func (t *TLSConfig) update(modify func(config *tls.Config)) {
+	config := &tls.Config{}
+	if current := t.load(); current != nil {
+		config = current.Clone()
+	}
+	modify(config)
+	t.config.Store(config)
+}
+
+// AddClientRootCA adds cert to the authorities used to verify client
+// certificates. The contents of a pool supplied through NewTLSConfig or
+// SetClientCAs cannot be copied, so such a pool is extended in place, which
+// is only safe before handshakes use the configuration; other pools are
+// replaced by a new one.
 func (t *TLSConfig) AddClientRootCA(cert *x509.Certificate) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
-	t.config.ClientCAs.AddCert(cert)
+	if !t.clientRootsKnown {
+		t.load().ClientCAs.AddCert(cert)
+		return
+	}
+	t.setClientRoots(append(t.clientRoots[:len(t.clientRoots):len(t.clientRoots)], cert))
 }
 
+// SetClientCAs replaces the authorities used to verify client certificates
+// by certPool, which must not be modified afterwards
 func (t *TLSConfig) SetClientCAs(certPool *x509.CertPool) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
-	t.config.ClientCAs = certPool
+	t.clientRoots, t.clientRootsKnown = nil, certPool == nil
+	t.update(func(config *tls.Config) { config.ClientCAs = certPool })
+}
+
+// setCertificate publishes cert as the certificate presented to clients
+func (t *TLSConfig) setCertificate(cert tls.Certificate) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.update(func(config *tls.Config) { config.GetCertificate = certificateGetter(cert) })
+}
+
+// reload publishes cert, the authorities made of clientRoots and
+// clientAuth at once, so that every handshake uses either all of them or
+// none. No authorities are set if clientRoots is empty.
+func (t *TLSConfig) reload(cert tls.Certificate, clientRoots []*x509.Certificate, clientAuth tls.ClientAuthType) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var certPool *x509.CertPool
+	if len(clientRoots) > 0 {
+		certPool = x509.NewCertPool()
+		for _, root := range clientRoots {
+			certPool.AddCert(root)
+		}
+	}
+	t.clientRoots, t.clientRootsKnown = clientRoots, true
+	t.update(func(config *tls.Config) {
+		config.GetCertificate = certificateGetter(cert)
+		config.ClientCAs = certPool
+		config.ClientAuth = clientAuth
+	})
+}
+
+// certificateGetter returns a tls.Config.GetCertificate function always
+// returning cert. The certificate is part of the configuration handshakes
+// take a snapshot of rather than loaded separately.
+func certificateGetter(cert tls.Certificate) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &cert, nil
+	}
+}
+
+// setClientRootCerts replaces the authorities used to verify client
+// certificates by certs
+func (t *TLSConfig) setClientRootCerts(certs []*x509.Certificate) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.setClientRoots(certs)
+}
+
+// setClientRoots publishes a new pool made of certs; the lock must be held
+func (t *TLSConfig) setClientRoots(certs []*x509.Certificate) {
+	certPool := x509.NewCertPool()
+	for _, cert := range certs {
+		certPool.AddCert(cert)
+	}
+	t.clientRoots, t.clientRootsKnown = certs, true
+	t.update(func(config *tls.Config) { config.ClientCAs = certPool })
 }
 
 // ClientHandShake is not implemented for `serverCreds`.
@@ -100,19 +225,52 @@ func (sc *serverCreds) ClientHandshake(context.Context,
 
 // ServerHandshake does the authentication handshake for servers.
 func (sc *serverCreds) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	// the snapshot taken here is used for the whole handshake, so
+	// concurrent updates only apply to subsequent handshakes
 	serverConfig := sc.serverConfig.Config()
 
 	conn := tls.Server(rawConn, &serverConfig)
 	l := sc.logger.With("remote address", conn.RemoteAddr().String())
 	start := time.Now()
 	if err := conn.Handshake(); err != nil {
+		if cert := expiredClientCertificate(err, &serverConfig); cert != nil {
+			l.Errorf("Server TLS handshake failed in %s because client certificate %s expired at %s", time.Since(start), cert.Subject, cert.NotAfter)
+			if sc.expiredClientCerts != nil {
+				sc.emitter.emit(func() { sc.expiredClientCerts.Add(1) })
+			}
+			return nil, nil, fmt.Errorf("%w at %s: %s", ErrClientCertificateExpired, cert.NotAfter, err)
+		}
+		err = classifyServerHandshakeError(err, conn.RemoteAddr().String())
 		l.Errorf("Server TLS handshake failed in %s with error %s", time.Since(start), err)
 		return nil, nil, err
 	}
-	l.Debugf("Server TLS handshake completed in %s", time.Since(start))
+	duration := time.Since(start)
+	l.Debugf("Server TLS handshake completed in %s", duration)
+	if sc.observeHandshake != nil {
+		sc.observeHandshake(duration)
+	}
 	return conn, credentials.TLSInfo{State: conn.ConnectionState()}, nil
 }
 
+// expiredClientCertificate returns the client certificate that failed the
+// verification of a handshake of config with err because it expired, or
+// nil if the handshake failed for another reason. Certificates that are not
+// yet valid fail with the same verification error and are not reported.
+func expiredClientCertificate(err error, config *tls.Config) *x509.Certificate {
+	var certErr x509.CertificateInvalidError
+	if !errors.As(err, &certErr) || certErr.Reason != x509.Expired || certErr.Cert == nil {
+		return nil
+	}
+	now := time.Now()
+	if config.Time != nil {
+		now = config.Time()
+	}
+	if !now.After(certErr.Cert.NotAfter) {
+		return nil
+	}
+	return certErr.Cert
+}
+
 // Info provides the ProtocolInfo of this TransportCredentials.
 func (sc *serverCreds) Info() credentials.ProtocolInfo {
 	return credentials.ProtocolInfo{
@@ -125,7 +283,7 @@ func (sc *serverCreds) Info() credentials.ProtocolInfo {
 func (sc *serverCreds) Clone() credentials.TransportCredentials {
 	config := sc.serverConfig.Config()
 	serverConfig := NewTLSConfig(&config)
-	return NewServerTransportCredentials(serverConfig, sc.logger)
+	return newServerCreds(serverConfig, sc.logger, sc.observeHandshake, sc.expiredClientCerts, sc.emitter)
 }
 
 // OverrideServerName overrides the server name used to verify the hostname
@@ -137,6 +295,9 @@ func (sc *serverCreds) OverrideServerName(string) error {
 type DynamicClientCredentials struct {
 	TLSConfig  *tls.Config
 	TLSOptions []TLSOption
+	// Label, if not empty, is the logical name of the connection, added to
+	// the handshake logs
+	Label string
 }
 
 func (dtc *DynamicClientCredentials) latestConfig() *tls.Config {
@@ -149,10 +310,14 @@ func (dtc *DynamicClientCredentials) latestConfig() *tls.Config {
 
 func (dtc *DynamicClientCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
 	l := tlsClientLogger.With("remote address", rawConn.RemoteAddr().String())
+	if dtc.Label != "" {
+		l = l.With("connection", dtc.Label)
+	}
 	creds := credentials.NewTLS(dtc.latestConfig())
 	start := time.Now()
 	conn, auth, err := creds.ClientHandshake(ctx, authority, rawConn)
 	if err != nil {
+		err = classifyClientHandshakeError(err, rawConn.RemoteAddr().String())
 		l.Errorf("Client TLS handshake failed after %s with error: %s", time.Since(start), err)
 	} else {
 		l.Debugf("Client TLS handshake completed in %s", time.Since(start))
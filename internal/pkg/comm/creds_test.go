@@ -8,15 +8,25 @@ package comm_test
 
 import (
 	"context"
+	"crypto"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"io/ioutil"
+	"math/big"
 	"net"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
 	"github.com/hyperledger/fabric/common/flogging/floggingtest"
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
 	"github.com/hyperledger/fabric/internal/pkg/comm"
 	"github.com/stretchr/testify/require"
 )
@@ -173,3 +183,225 @@ func TestSetClientCAs(t *testing.T) {
 
 	require.NotNil(t, config.Config().ClientCAs, "The CertPools' should not be the same")
 }
+
+func TestTLSConfigAddClientRootCAConcurrentReads(t *testing.T) {
+	t.Parallel()
+
+	parse := func(certPEM []byte) *x509.Certificate {
+		block, _ := pem.Decode(certPEM)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		return cert
+	}
+	newCA := func() (*x509.Certificate, *x509.Certificate) {
+		ca, err := tlsgen.NewCA()
+		require.NoError(t, err)
+		clientKeyPair, err := ca.NewClientCertKeyPair()
+		require.NoError(t, err)
+		return parse(ca.CertBytes()), parse(clientKeyPair.Cert)
+	}
+	verifies := func(clientCAs *x509.CertPool, cert *x509.Certificate) bool {
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:     clientCAs,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		return err == nil
+	}
+
+	trustedCA, trustedClient := newCA()
+	var addedCAs, addedClients []*x509.Certificate
+	for i := 0; i < 20; i++ {
+		ca, client := newCA()
+		addedCAs, addedClients = append(addedCAs, ca), append(addedClients, client)
+	}
+
+	config := comm.NewTLSConfig(&tls.Config{})
+	config.AddClientRootCA(trustedCA)
+	before := config.Config().ClientCAs
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if !verifies(config.Config().ClientCAs, trustedClient) {
+					t.Error("snapshot does not trust the CA present in every pool")
+					return
+				}
+			}
+		}()
+	}
+	for _, ca := range addedCAs {
+		config.AddClientRootCA(ca)
+	}
+	close(stop)
+	wg.Wait()
+
+	after := config.Config().ClientCAs
+	for _, client := range addedClients {
+		require.True(t, verifies(after, client))
+		require.False(t, verifies(before, client), "published pools must not be modified")
+	}
+	require.True(t, verifies(after, trustedClient))
+}
+
+// expiredClientCert returns a client certificate issued by ca that expired
+// at notAfter
+func expiredClientCert(t *testing.T, ca tlsgen.CA, notAfter time.Time) tls.Certificate {
+	caBlock, _ := pem.Decode(ca.CertBytes())
+	caCert, err := x509.ParseCertificate(caBlock.Bytes)
+	require.NoError(t, err)
+	keyBlock, _ := pem.Decode(ca.KeyBytes())
+	caKey, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	require.NoError(t, err)
+
+	clientKeyPair, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "expired-client"},
+		NotBefore:    notAfter.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, clientKeyPair.Signer.Public(), caKey.(crypto.Signer))
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: clientKeyPair.Signer}
+}
+
+func TestServerHandshakeExpiredClientCert(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	serverCert, err := tls.X509KeyPair(serverKeyPair.Cert, serverKeyPair.Key)
+	require.NoError(t, err)
+	otherCA, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	untrustedKeyPair, err := otherCA.NewClientCertKeyPair()
+	require.NoError(t, err)
+	untrustedCert, err := tls.X509KeyPair(untrustedKeyPair.Cert, untrustedKeyPair.Key)
+	require.NoError(t, err)
+
+	notAfter := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+	expiredCert := expiredClientCert(t, ca, notAfter)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(ca.CertBytes())
+	logger, recorder := floggingtest.NewTestLogger(t)
+	creds := comm.NewServerTransportCredentials(comm.NewTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}), logger)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(ca.CertBytes())
+	handshake := func(clientCert tls.Certificate) error {
+		serverErr := make(chan error, 1)
+		go func() {
+			conn, err := lis.Accept()
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			defer conn.Close()
+			_, _, err = creds.ServerHandshake(conn)
+			serverErr <- err
+		}()
+		conn, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      rootCAs,
+			MaxVersion:   tls.VersionTLS12,
+		})
+		if err == nil {
+			conn.Close()
+		}
+		return <-serverErr
+	}
+
+	err = handshake(expiredCert)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, comm.ErrClientCertificateExpired), "unexpected error %v", err)
+	require.Contains(t, err.Error(), "core/comm: client certificate expired at "+notAfter.String())
+	require.NotEmpty(t, recorder.MessagesContaining("because client certificate CN=expired-client expired at "+notAfter.String()))
+
+	err = handshake(untrustedCert)
+	require.Error(t, err)
+	require.False(t, errors.Is(err, comm.ErrClientCertificateExpired), "unexpected error %v", err)
+	require.Len(t, recorder.MessagesContaining("because client certificate"), 1)
+}
+
+func TestExpiredClientCertCounter(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	validKeyPair, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+	validCert, err := tls.X509KeyPair(validKeyPair.Cert, validKeyPair.Key)
+	require.NoError(t, err)
+	expiredCert := expiredClientCert(t, ca, time.Now().Add(-time.Hour))
+
+	var broken int32
+	counter := &metricsfakes.Counter{}
+	counter.AddStub = func(float64) {
+		if atomic.LoadInt32(&broken) == 1 {
+			panic("registry is broken")
+		}
+	}
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:            true,
+			RequireClientCert: true,
+			Certificate:       serverKeyPair.Cert,
+			Key:               serverKeyPair.Key,
+			ClientRootCAs:     [][]byte{ca.CertBytes()},
+		},
+		ExpiredClientCertCounter: counter,
+	})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(ca.CertBytes())
+	handshake := func(clientCert tls.Certificate) error {
+		conn, err := tls.Dial("tcp", srv.Address(), &tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      rootCAs,
+			MaxVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	require.NoError(t, handshake(validCert))
+	require.Error(t, handshake(expiredCert))
+	require.Eventually(t, func() bool { return counter.AddCallCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, float64(1), counter.AddArgsForCall(0))
+
+	// a panicking counter does not take the server down
+	atomic.StoreInt32(&broken, 1)
+	require.Error(t, handshake(expiredCert))
+	require.Eventually(t, func() bool { return counter.AddCallCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, handshake(validCert))
+}
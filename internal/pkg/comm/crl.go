@@ -0,0 +1,73 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// parseCRLs parses PEM encoded certificate revocation lists
+func parseCRLs(crls [][]byte) ([]*pkix.CertificateList, error) {
+	var parsed []*pkix.CertificateList
+	for _, crl := range crls {
+		for {
+			var block *pem.Block
+			block, crl = pem.Decode(crl)
+			if block == nil {
+				break
+			}
+			list, err := x509.ParseCRL(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to parse certificate revocation list")
+			}
+			parsed = append(parsed, list)
+		}
+	}
+	if len(crls) > 0 && len(parsed) == 0 {
+		return nil, errors.New("no certificate revocation lists found")
+	}
+	return parsed, nil
+}
+
+// rejectRevoked returns a VerifyPeerCertificate function rejecting verified
+// chains containing a certificate revoked by one of crls before calling
+// verify, if not nil. A CRL only applies to a certificate if it is signed by
+// the issuer of the certificate found in the chain. Unverified certificates
+// are not checked.
+func rejectRevoked(crls []*pkix.CertificateList, verify func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, chain := range verifiedChains {
+			for i := 0; i+1 < len(chain); i++ {
+				if err := checkRevoked(crls, chain[i], chain[i+1]); err != nil {
+					return err
+				}
+			}
+		}
+		if verify != nil {
+			return verify(rawCerts, verifiedChains)
+		}
+		return nil
+	}
+}
+
+func checkRevoked(crls []*pkix.CertificateList, cert, issuer *x509.Certificate) error {
+	for _, crl := range crls {
+		if issuer.CheckCRLSignature(crl) != nil {
+			continue
+		}
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return errors.Errorf("certificate %s with serial number %s has been revoked", cert.Subject, cert.SerialNumber)
+			}
+		}
+	}
+	return nil
+}
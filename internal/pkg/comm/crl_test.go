@@ -0,0 +1,272 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerRejectsRevokedClientCertificates(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	revokedClient, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+	validClient, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+	// a CRL from another CA revoking the valid client does not apply
+	otherCA, err := tlsgen.NewCA()
+	require.NoError(t, err)
+
+	crl, err := tlsgen.GenerateCRL(ca.CertBytes(), ca.KeyBytes(), []*big.Int{revokedClient.TLSCert.SerialNumber})
+	require.NoError(t, err)
+	otherCRL, err := tlsgen.GenerateCRL(otherCA.CertBytes(), otherCA.KeyBytes(), []*big.Int{validClient.TLSCert.SerialNumber})
+	require.NoError(t, err)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:            true,
+			RequireClientCert: true,
+			Certificate:       serverKeyPair.Cert,
+			Key:               serverKeyPair.Key,
+			ClientRootCAs:     [][]byte{ca.CertBytes()},
+			CRLs:              [][]byte{crl, otherCRL},
+		},
+	})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	handshake := func(clientKeyPair *tlsgen.CertKeyPair) error {
+		cert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+		require.NoError(t, err)
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(ca.CertBytes())
+		conn, err := tls.Dial("tcp", srv.Address(), &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      rootCAs,
+			MaxVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	require.NoError(t, handshake(validClient))
+	require.Error(t, handshake(revokedClient))
+}
+
+func TestTLSPolicyDryRunRevokedClientCertificates(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	revokedClient, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+	crl, err := tlsgen.GenerateCRL(ca.CertBytes(), ca.KeyBytes(), []*big.Int{revokedClient.TLSCert.SerialNumber})
+	require.NoError(t, err)
+
+	warnings := &recordedWarnings{}
+	counter := &metricsfakes.Counter{}
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:            true,
+			RequireClientCert: true,
+			Certificate:       serverKeyPair.Cert,
+			Key:               serverKeyPair.Key,
+			ClientRootCAs:     [][]byte{ca.CertBytes()},
+			CRLs:              [][]byte{crl},
+		},
+		Logger:                 warnings.logger(),
+		TLSPolicyDryRun:        true,
+		TLSPolicyDryRunCounter: counter,
+	})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	cert, err := tls.X509KeyPair(revokedClient.Cert, revokedClient.Key)
+	require.NoError(t, err)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(ca.CertBytes())
+	conn, err := tls.Dial("tcp", srv.Address(), &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+		MaxVersion:   tls.VersionTLS12,
+	})
+	require.NoError(t, err)
+	conn.Close()
+
+	require.Eventually(t, func() bool { return counter.AddCallCount() == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{fmt.Sprintf(
+		"TLS policy dry run: would reject client certificate with subject %s: certificate %s with serial number %s has been revoked",
+		revokedClient.TLSCert.Subject, revokedClient.TLSCert.Subject, revokedClient.TLSCert.SerialNumber,
+	)}, warnings.get())
+}
+
+func TestServerRejectsRevokedClientCertificatesPerConnection(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	revokedByServer, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+	revokedByConnection, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+	validClient, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+
+	serverCRL, err := tlsgen.GenerateCRL(ca.CertBytes(), ca.KeyBytes(), []*big.Int{revokedByServer.TLSCert.SerialNumber})
+	require.NoError(t, err)
+	connCRL, err := tlsgen.GenerateCRL(ca.CertBytes(), ca.KeyBytes(), []*big.Int{revokedByConnection.TLSCert.SerialNumber})
+	require.NoError(t, err)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:      true,
+			Certificate: serverKeyPair.Cert,
+			Key:         serverKeyPair.Key,
+			CRLs:        [][]byte{serverCRL},
+			GetConfigForClient: func(*tls.ClientHelloInfo) (*comm.SecureOptions, error) {
+				return &comm.SecureOptions{
+					Certificate:       serverKeyPair.Cert,
+					Key:               serverKeyPair.Key,
+					RequireClientCert: true,
+					ClientRootCAs:     [][]byte{ca.CertBytes()},
+					CRLs:              [][]byte{connCRL},
+				}, nil
+			},
+		},
+	})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	handshake := func(clientKeyPair *tlsgen.CertKeyPair) error {
+		cert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+		require.NoError(t, err)
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(ca.CertBytes())
+		conn, err := tls.Dial("tcp", srv.Address(), &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      rootCAs,
+			MaxVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	require.NoError(t, handshake(validClient))
+	require.Error(t, handshake(revokedByServer), "the CRLs of the server apply to every connection")
+	require.Error(t, handshake(revokedByConnection))
+}
+
+func TestClientRejectsRevokedServerCertificates(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	revokedServer, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	validServer, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	crl, err := tlsgen.GenerateCRL(ca.CertBytes(), ca.KeyBytes(), []*big.Int{revokedServer.TLSCert.SerialNumber})
+	require.NoError(t, err)
+
+	serve := func(keyPair *tlsgen.CertKeyPair) string {
+		srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+			SecOpts: comm.SecureOptions{
+				UseTLS:      true,
+				Certificate: keyPair.Cert,
+				Key:         keyPair.Key,
+			},
+		})
+		require.NoError(t, err)
+		testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+		go srv.Start()
+		t.Cleanup(srv.Stop)
+		return srv.Address()
+	}
+
+	client, err := comm.NewGRPCClient(comm.ClientConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:        true,
+			ServerRootCAs: [][]byte{ca.CertBytes()},
+			CRLs:          [][]byte{crl},
+		},
+		Timeout: testTimeout,
+	})
+	require.NoError(t, err)
+
+	conn, err := client.NewConnection(serve(validServer))
+	require.NoError(t, err)
+	conn.Close()
+
+	// the handshake error is only logged, so the reason of the rejection
+	// is checked by calling the verification function
+	var verify func([][]byte, [][]*x509.Certificate) error
+	_, err = client.NewConnection(serve(revokedServer), func(tlsConfig *tls.Config) {
+		verify = tlsConfig.VerifyPeerCertificate
+	})
+	require.Error(t, err)
+	block, _ := pem.Decode(ca.CertBytes())
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	chain := []*x509.Certificate{revokedServer.TLSCert, caCert}
+	err = verify([][]byte{revokedServer.TLSCert.Raw}, [][]*x509.Certificate{chain})
+	require.EqualError(t, err, fmt.Sprintf("certificate %s with serial number %s has been revoked", revokedServer.TLSCert.Subject, revokedServer.TLSCert.SerialNumber))
+}
+
+func TestInvalidCRLs(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+
+	_, err = comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:      true,
+			Certificate: serverKeyPair.Cert,
+			Key:         serverKeyPair.Key,
+			CRLs:        [][]byte{[]byte("not a CRL")},
+		},
+	})
+	require.EqualError(t, err, "no certificate revocation lists found")
+
+	_, err = comm.NewGRPCClient(comm.ClientConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS: true,
+			CRLs:   [][]byte{[]byte("-----BEGIN X509 CRL-----\nAAAA\n-----END X509 CRL-----\n")},
+		},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to parse certificate revocation list")
+}
@@ -0,0 +1,26 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"time"
+)
+
+// PropagateDeadline returns a context for downstream calls made while
+// handling the call of ctx. The deadline of the returned context is the one
+// of ctx minus margin, so that downstream calls time out early enough for
+// the handler to respond before its own deadline. If ctx has no deadline,
+// neither does the returned context. The cancel function must be called
+// once the downstream calls complete.
+func PropagateDeadline(ctx context.Context, margin time.Duration) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-margin))
+}
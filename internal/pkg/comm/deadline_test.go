@@ -0,0 +1,127 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestPropagateDeadline(t *testing.T) {
+	t.Parallel()
+
+	deadline := time.Now().Add(time.Minute)
+	inbound, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	downstream, cancel := comm.PropagateDeadline(inbound, time.Second)
+	defer cancel()
+	downstreamDeadline, ok := downstream.Deadline()
+	require.True(t, ok)
+	require.Equal(t, deadline.Add(-time.Second), downstreamDeadline)
+
+	// the downstream context is cancelled with the inbound one
+	inbound, cancelInbound := context.WithDeadline(context.Background(), deadline)
+	downstream, cancel = comm.PropagateDeadline(inbound, time.Second)
+	defer cancel()
+	cancelInbound()
+	require.Equal(t, context.Canceled, downstream.Err())
+
+	// a remaining time shorter than the margin leaves no time downstream
+	inbound, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	downstream, cancel = comm.PropagateDeadline(inbound, time.Second)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, downstream.Err())
+
+	downstream, cancel = comm.PropagateDeadline(context.Background(), time.Second)
+	defer cancel()
+	_, ok = downstream.Deadline()
+	require.False(t, ok)
+	require.NoError(t, downstream.Err())
+}
+
+type deadlineRecorder struct {
+	deadlines chan time.Time
+}
+
+func (dr *deadlineRecorder) EchoCall(ctx context.Context, echo *testpb.Echo) (*testpb.Echo, error) {
+	deadline, _ := ctx.Deadline()
+	dr.deadlines <- deadline
+	return echo, nil
+}
+
+type chainingServer struct {
+	emptyServiceServer
+	downstream testpb.EchoServiceClient
+	margin     time.Duration
+	deadlines  chan time.Time
+}
+
+func (cs *chainingServer) EmptyCall(ctx context.Context, _ *testpb.Empty) (*testpb.Empty, error) {
+	deadline, _ := ctx.Deadline()
+	cs.deadlines <- deadline
+	ctx, cancel := comm.PropagateDeadline(ctx, cs.margin)
+	defer cancel()
+	if _, err := cs.downstream.EchoCall(ctx, &testpb.Echo{}); err != nil {
+		return nil, err
+	}
+	return &testpb.Empty{}, nil
+}
+
+func TestPropagateDeadlineChainedRPCs(t *testing.T) {
+	t.Parallel()
+
+	newServer := func(register func(*grpc.Server)) string {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{})
+		require.NoError(t, err)
+		register(srv.Server())
+		go srv.Start()
+		t.Cleanup(srv.Stop)
+		return lis.Addr().String()
+	}
+	dial := func(address string) *grpc.ClientConn {
+		conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	downstreamDeadlines := make(chan time.Time, 1)
+	downstreamAddress := newServer(func(s *grpc.Server) {
+		testpb.RegisterEchoServiceServer(s, &deadlineRecorder{deadlines: downstreamDeadlines})
+	})
+	const margin = 500 * time.Millisecond
+	inboundDeadlines := make(chan time.Time, 1)
+	chainingAddress := newServer(func(s *grpc.Server) {
+		testpb.RegisterEmptyServiceServer(s, &chainingServer{
+			downstream: testpb.NewEchoServiceClient(dial(downstreamAddress)),
+			margin:     margin,
+			deadlines:  inboundDeadlines,
+		})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := testpb.NewEmptyServiceClient(dial(chainingAddress)).EmptyCall(ctx, &testpb.Empty{})
+	require.NoError(t, err)
+
+	inbound, downstream := <-inboundDeadlines, <-downstreamDeadlines
+	require.False(t, inbound.IsZero())
+	require.False(t, downstream.IsZero())
+	// deadlines are sent as timeouts, so transit time shifts them slightly
+	require.InDelta(t, margin, inbound.Sub(downstream), float64(100*time.Millisecond))
+	require.True(t, downstream.Before(inbound))
+}
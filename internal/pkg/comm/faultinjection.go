@@ -0,0 +1,53 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// injectFault waits the delay inject returns for fullMethod, giving up if
+// ctx is done first, then returns the error inject returned
+func injectFault(ctx context.Context, inject func(method string) (time.Duration, error), fullMethod string) error {
+	delay, err := inject(fullMethod)
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return err
+}
+
+// faultInjectionUnaryInterceptor returns an interceptor delaying or failing
+// unary calls as inject decides before they reach their handler
+func faultInjectionUnaryInterceptor(inject func(method string) (time.Duration, error)) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := injectFault(ctx, inject, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// faultInjectionStreamInterceptor returns an interceptor delaying or failing
+// streams as inject decides before they reach their handler
+func faultInjectionStreamInterceptor(inject func(method string) (time.Duration, error)) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := injectFault(ss.Context(), inject, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
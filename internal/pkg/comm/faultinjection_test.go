@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFaultInjector(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	warnings := &recordedWarnings{}
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		FaultInjector: func(method string) (time.Duration, error) {
+			switch method {
+			case "/EmptyService/EmptyCall":
+				// every other call fails
+				if atomic.AddInt32(&calls, 1)%2 == 1 {
+					return 0, status.Error(codes.Unavailable, "injected fault")
+				}
+				return 0, nil
+			case "/EmptyService/EmptyStream":
+				return time.Hour, nil
+			default:
+				return 0, nil
+			}
+		},
+		Logger: warnings.logger(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"Fault injection is enabled for the server, calls may be delayed or failed on purpose; it must not be used in production",
+	}, warnings.get())
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(srv.Address(), grpc.WithInsecure(), grpc.WithBlock())
+	require.NoError(t, err)
+	defer conn.Close()
+	client := testpb.NewEmptyServiceClient(conn)
+
+	_, err = client.EmptyCall(context.Background(), &testpb.Empty{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, "injected fault", status.Convert(err).Message())
+	_, err = client.EmptyCall(context.Background(), &testpb.Empty{})
+	require.NoError(t, err)
+
+	// delayed calls give up when their deadline expires
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	stream, err := client.EmptyStream(ctx)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// other methods are not affected
+	_, err = testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{})
+	require.NoError(t, err)
+}
+
+func TestFaultInjectorDelay(t *testing.T) {
+	t.Parallel()
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		FaultInjector: func(string) (time.Duration, error) {
+			return 200 * time.Millisecond, nil
+		},
+	})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	start := time.Now()
+	_, err = invokeEmptyCall(srv.Address(), grpc.WithBlock(), grpc.WithInsecure())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(200*time.Millisecond))
+}
@@ -0,0 +1,121 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// firstMessageTimeoutStream fails a stream whose first message is not
+// received within the timeout
+type firstMessageTimeoutStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	err error
+
+	lock sync.Mutex
+	// closed once the first message is received
+	received chan struct{}
+	// closed when the timeout expires before the first message
+	expired chan struct{}
+}
+
+func (s *firstMessageTimeoutStream) Context() context.Context {
+	return s.ctx
+}
+
+// RecvMsg receives the first message in a separate goroutine so that it can
+// give up when the timeout expires. That goroutine keeps waiting for the
+// message until the stream ends, so m must not be used once RecvMsg failed.
+func (s *firstMessageTimeoutStream) RecvMsg(m interface{}) error {
+	select {
+	case <-s.received:
+		return s.ServerStream.RecvMsg(m)
+	case <-s.expired:
+		return s.err
+	default:
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.ServerStream.RecvMsg(m) }()
+	select {
+	case err := <-done:
+		if !s.markReceived() {
+			return s.err
+		}
+		return err
+	case <-s.expired:
+		return s.err
+	}
+}
+
+// markReceived returns whether the first message was received before the
+// timeout expired
+func (s *firstMessageTimeoutStream) markReceived() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.expired:
+		return false
+	default:
+		close(s.received)
+		return true
+	}
+}
+
+// expire returns whether the timeout expired before the first message
+func (s *firstMessageTimeoutStream) expire() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.received:
+		return false
+	default:
+		close(s.expired)
+		return true
+	}
+}
+
+// firstMessageTimeoutInterceptor returns an interceptor failing the streams
+// that do not receive a message within timeout of being opened with
+// DeadlineExceeded. The context of the stream is then cancelled, and its
+// pending and subsequent receives fail, so handlers stop whether they are
+// waiting for the message or not. Receiving the end of the stream counts as
+// a first message.
+func firstMessageTimeoutInterceptor(timeout time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := context.WithCancel(ss.Context())
+		defer cancel()
+		stream := &firstMessageTimeoutStream{
+			ServerStream: ss,
+			ctx:          ctx,
+			err:          status.Errorf(codes.DeadlineExceeded, "no message received on the stream within %s", timeout),
+			received:     make(chan struct{}),
+			expired:      make(chan struct{}),
+		}
+		timer := time.AfterFunc(timeout, func() {
+			if stream.expire() {
+				cancel()
+			}
+		})
+		defer timer.Stop()
+
+		err := handler(srv, stream)
+		select {
+		case <-stream.expired:
+			return stream.err
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// silentStreamServer reports the outcome of its streams, which never send
+type silentStreamServer struct {
+	emptyServiceServer
+	result chan error
+}
+
+func (ss *silentStreamServer) EmptyStream(stream testpb.EmptyService_EmptyStreamServer) error {
+	<-stream.Context().Done()
+	ss.result <- stream.Context().Err()
+	return stream.Context().Err()
+}
+
+func TestFirstMessageTimeout(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		FirstMessageTimeout: 200 * time.Millisecond,
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(srv.Address(), grpc.WithInsecure(), grpc.WithBlock())
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer conn.Close()
+	client := testpb.NewEmptyServiceClient(conn)
+
+	// a stream on which nothing is sent fails
+	start := time.Now()
+	stream, err := client.EmptyStream(context.Background())
+	gt.Expect(err).NotTo(HaveOccurred())
+	_, err = stream.Recv()
+	gt.Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+	gt.Expect(status.Convert(err).Message()).To(Equal("no message received on the stream within 200ms"))
+	gt.Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+
+	// once the first message is received, later ones have no deadline
+	stream, err = client.EmptyStream(context.Background())
+	gt.Expect(err).NotTo(HaveOccurred())
+	for i := 0; i < 2; i++ {
+		gt.Expect(stream.Send(&testpb.Empty{})).To(Succeed())
+		_, err = stream.Recv()
+		gt.Expect(err).NotTo(HaveOccurred())
+		time.Sleep(400 * time.Millisecond)
+	}
+	gt.Expect(stream.CloseSend()).To(Succeed())
+	_, err = stream.Recv()
+	gt.Expect(err).To(Equal(io.EOF))
+
+	// so does closing the stream without sending
+	stream, err = client.EmptyStream(context.Background())
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(stream.CloseSend()).To(Succeed())
+	_, err = stream.Recv()
+	gt.Expect(err).To(Equal(io.EOF))
+
+	// unary calls are not affected
+	_, err = client.EmptyCall(context.Background(), &testpb.Empty{})
+	gt.Expect(err).NotTo(HaveOccurred())
+}
+
+func TestFirstMessageTimeoutHandlerNotReceiving(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		FirstMessageTimeout: 100 * time.Millisecond,
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	ss := &silentStreamServer{result: make(chan error, 1)}
+	testpb.RegisterEmptyServiceServer(srv.Server(), ss)
+	go srv.Start()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(srv.Address(), grpc.WithInsecure(), grpc.WithBlock())
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer conn.Close()
+
+	// the context of the stream is cancelled even though the handler never
+	// receives, and the client is told about the timeout
+	stream, err := testpb.NewEmptyServiceClient(conn).EmptyStream(context.Background())
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Eventually(ss.result, 5*time.Second).Should(Receive(Equal(context.Canceled)))
+	_, err = stream.Recv()
+	gt.Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+}
@@ -0,0 +1,64 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type freshnessCheck struct {
+	maxSkew time.Duration
+	verify  func(ctx context.Context) (time.Time, error)
+}
+
+func (f *freshnessCheck) check(ctx context.Context) error {
+	timestamp, err := f.verify(ctx)
+	if err != nil {
+		return status.Errorf(codes.Unauthenticated, "request timestamp could not be verified: %s", err)
+	}
+	now := time.Now()
+	if skew := now.Sub(timestamp); skew > f.maxSkew || skew < -f.maxSkew {
+		return status.Errorf(codes.FailedPrecondition, "request timestamp %s is not within %s of the server time %s",
+			timestamp.UTC().Format(time.RFC3339Nano), f.maxSkew, now.UTC().Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// NewFreshnessInterceptor returns a unary server interceptor that mitigates
+// replayed requests by rejecting the calls whose timestamp is not within
+// maxSkew of the server time with FailedPrecondition. The timestamp of a
+// call is returned by verify, typically from signed metadata; calls for
+// which verify fails are rejected with Unauthenticated. maxSkew should
+// tolerate the clock skew between clients and servers plus the latency of
+// the calls, and replays within the window must be detected by other means.
+func NewFreshnessInterceptor(maxSkew time.Duration, verify func(ctx context.Context) (time.Time, error)) grpc.UnaryServerInterceptor {
+	f := &freshnessCheck{maxSkew: maxSkew, verify: verify}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := f.check(ctx); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewFreshnessStreamInterceptor is the stream server interceptor
+// counterpart of NewFreshnessInterceptor. The timestamp is checked once,
+// when the stream is opened.
+func NewFreshnessStreamInterceptor(maxSkew time.Duration, verify func(ctx context.Context) (time.Time, error)) grpc.StreamServerInterceptor {
+	f := &freshnessCheck{maxSkew: maxSkew, verify: verify}
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := f.check(ss.Context()); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	requestTimeHeader          = "x-request-time"
+	requestTimeSignatureHeader = "x-request-time-signature"
+)
+
+func signRequestTime(timestamp string) string {
+	mac := hmac.New(sha256.New, hintKey)
+	mac.Write([]byte(timestamp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyRequestTime returns the request time signed with hintKey
+func verifyRequestTime(ctx context.Context) (time.Time, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	timestamps, signatures := md.Get(requestTimeHeader), md.Get(requestTimeSignatureHeader)
+	if len(timestamps) == 0 || len(signatures) == 0 {
+		return time.Time{}, errors.New("no signed request time")
+	}
+	if !hmac.Equal([]byte(signatures[0]), []byte(signRequestTime(timestamps[0]))) {
+		return time.Time{}, errors.New("invalid signature")
+	}
+	return time.Parse(time.RFC3339Nano, timestamps[0])
+}
+
+func TestFreshnessInterceptor(t *testing.T) {
+	t.Parallel()
+
+	const maxSkew = time.Minute
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		UnaryInterceptors:  []grpc.UnaryServerInterceptor{comm.NewFreshnessInterceptor(maxSkew, verifyRequestTime)},
+		StreamInterceptors: []grpc.StreamServerInterceptor{comm.NewFreshnessStreamInterceptor(maxSkew, verifyRequestTime)},
+	})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(srv.Address(), grpc.WithInsecure(), grpc.WithBlock())
+	require.NoError(t, err)
+	defer conn.Close()
+	client := testpb.NewEmptyServiceClient(conn)
+
+	sentAt := func(skew time.Duration) context.Context {
+		timestamp := time.Now().Add(skew).Format(time.RFC3339Nano)
+		return metadata.AppendToOutgoingContext(context.Background(),
+			requestTimeHeader, timestamp,
+			requestTimeSignatureHeader, signRequestTime(timestamp),
+		)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		code    codes.Code
+		message string
+	}{
+		{name: "fresh", ctx: sentAt(0), code: codes.OK},
+		{name: "skewed within the window", ctx: sentAt(-30 * time.Second), code: codes.OK},
+		{name: "future within the window", ctx: sentAt(30 * time.Second), code: codes.OK},
+		{name: "future", ctx: sentAt(2 * time.Minute), code: codes.FailedPrecondition, message: "is not within 1m0s of the server time"},
+		{name: "stale", ctx: sentAt(-2 * time.Minute), code: codes.FailedPrecondition, message: "is not within 1m0s of the server time"},
+		{name: "unsigned", ctx: context.Background(), code: codes.Unauthenticated, message: "request timestamp could not be verified: no signed request time"},
+		{
+			name: "forged",
+			ctx: metadata.AppendToOutgoingContext(context.Background(),
+				requestTimeHeader, time.Now().Format(time.RFC3339Nano),
+				requestTimeSignatureHeader, signRequestTime("2006-01-02T15:04:05Z"),
+			),
+			code:    codes.Unauthenticated,
+			message: "request timestamp could not be verified: invalid signature",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.EmptyCall(tt.ctx, &testpb.Empty{})
+			require.Equal(t, tt.code, status.Code(err))
+			require.Contains(t, status.Convert(err).Message(), tt.message)
+
+			stream, err := client.EmptyStream(tt.ctx)
+			require.NoError(t, err)
+			// the stream may already be rejected, in which case Send fails
+			// with io.EOF and Recv returns the status
+			if err := stream.Send(&testpb.Empty{}); err != nil {
+				require.Equal(t, io.EOF, err)
+			}
+			_, err = stream.Recv()
+			require.Equal(t, tt.code, status.Code(err))
+			require.Contains(t, status.Convert(err).Message(), tt.message)
+		})
+	}
+}
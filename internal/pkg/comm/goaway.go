@@ -0,0 +1,396 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	http2FrameHeaderLen = 9
+	http2GoAwayFrame    = 0x7
+	// maxDrainReasonLen bounds the debug data added to GOAWAY frames so
+	// that they stay within the minimum HTTP/2 frame size clients accept
+	maxDrainReasonLen = 1024
+	// maxGoAwayPayloadLen bounds the GOAWAY payloads kept by clients: the
+	// last stream ID, the error code and up to maxDrainReasonLen bytes of
+	// debug data
+	maxGoAwayPayloadLen = 8 + maxDrainReasonLen
+)
+
+// goAwayScanner follows the HTTP/2 frames read from a server and reports the
+// debug data of every GOAWAY frame, truncated to maxDrainReasonLen bytes
+type goAwayScanner struct {
+	onGoAway func(reason string)
+
+	header    [http2FrameHeaderLen]byte
+	headerLen int
+	remaining int
+	// payload of the current frame if it is a GOAWAY frame
+	goAway []byte
+}
+
+func (s *goAwayScanner) scan(p []byte) {
+	for len(p) > 0 {
+		if s.headerLen < http2FrameHeaderLen {
+			n := copy(s.header[s.headerLen:], p)
+			s.headerLen += n
+			p = p[n:]
+			if s.headerLen < http2FrameHeaderLen {
+				return
+			}
+			s.remaining = int(s.header[0])<<16 | int(s.header[1])<<8 | int(s.header[2])
+			s.goAway = nil
+			if s.header[3] == http2GoAwayFrame {
+				size := s.remaining
+				if size > maxGoAwayPayloadLen {
+					size = maxGoAwayPayloadLen
+				}
+				s.goAway = make([]byte, 0, size)
+			}
+		}
+
+		n := len(p)
+		if n > s.remaining {
+			n = s.remaining
+		}
+		if s.goAway != nil {
+			// the debug data past maxDrainReasonLen is discarded
+			kept := n
+			if room := cap(s.goAway) - len(s.goAway); kept > room {
+				kept = room
+			}
+			s.goAway = append(s.goAway, p[:kept]...)
+		}
+		s.remaining -= n
+		p = p[n:]
+		if s.remaining == 0 {
+			s.endFrame()
+		}
+	}
+}
+
+func (s *goAwayScanner) endFrame() {
+	// the payload starts with the last stream ID and the error code
+	if len(s.goAway) >= 8 {
+		s.onGoAway(string(s.goAway[8:]))
+	}
+	s.headerLen = 0
+	s.goAway = nil
+}
+
+// goAwayConn reports the GOAWAY frames read from the connection
+type goAwayConn struct {
+	net.Conn
+	scanner *goAwayScanner
+}
+
+func newGoAwayConn(conn net.Conn, onGoAway func(reason string)) net.Conn {
+	return &goAwayConn{
+		Conn:    conn,
+		scanner: &goAwayScanner{onGoAway: onGoAway},
+	}
+}
+
+func (c *goAwayConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.scanner.scan(p[:n])
+	return n, err
+}
+
+// goAwayCredentials reports the GOAWAY frames received over connections
+// secured by the TransportCredentials
+type goAwayCredentials struct {
+	credentials.TransportCredentials
+	onGoAway func(reason string)
+}
+
+func (gc *goAwayCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := gc.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newGoAwayConn(conn, gc.onGoAway), authInfo, nil
+}
+
+func (gc *goAwayCredentials) Clone() credentials.TransportCredentials {
+	return &goAwayCredentials{
+		TransportCredentials: gc.TransportCredentials.Clone(),
+		onGoAway:             gc.onGoAway,
+	}
+}
+
+// goAwayDialer returns a dialer for plaintext connections reporting the
+// GOAWAY frames received. The connections are dialed with dial, or with a
+// default net.Dialer if it is nil.
+func goAwayDialer(dial func(context.Context, string) (net.Conn, error), onGoAway func(reason string)) func(context.Context, string) (net.Conn, error) {
+	if dial == nil {
+		dial = func(ctx context.Context, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		}
+	}
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		conn, err := dial(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		return newGoAwayConn(conn, onGoAway), nil
+	}
+}
+
+// goAwayReasonWriter follows the HTTP/2 frames written by a server and adds
+// the drain reason as debug data to the GOAWAY frames that have none. Other
+// frames are passed through unchanged.
+type goAwayReasonWriter struct {
+	reason func() string
+
+	header    [http2FrameHeaderLen]byte
+	headerLen int
+	remaining int
+	// payload of the current frame if it is a GOAWAY frame being held back
+	goAway []byte
+	// reason to add to the held back GOAWAY frame
+	goAwayReason string
+}
+
+// rewrite returns the bytes to write in place of p. The bytes of a GOAWAY
+// frame, and of frame headers that are not complete yet, are held back.
+func (w *goAwayReasonWriter) rewrite(p []byte) []byte {
+	// out is nil as long as p is written unchanged; kept is the start of the
+	// bytes of p that still have to be copied to out, or -1 while they are
+	// held back
+	var out []byte
+	kept := 0
+	if w.goAway != nil || (w.headerLen > 0 && w.headerLen < http2FrameHeaderLen) {
+		out, kept = []byte{}, -1
+	}
+	holdFrom := func(start int) {
+		if out == nil {
+			out = make([]byte, 0, len(p)+maxDrainReasonLen)
+		}
+		if kept >= 0 {
+			out = append(out, p[kept:start]...)
+		}
+		kept = -1
+	}
+
+	for i := 0; i < len(p); {
+		if w.headerLen < http2FrameHeaderLen {
+			headerStart := i
+			continued := w.headerLen > 0
+			n := copy(w.header[w.headerLen:], p[i:])
+			w.headerLen += n
+			i += n
+			if w.headerLen < http2FrameHeaderLen {
+				if !continued {
+					holdFrom(headerStart)
+				}
+				break
+			}
+			w.remaining = int(w.header[0])<<16 | int(w.header[1])<<8 | int(w.header[2])
+			if reason := w.reason(); w.header[3] == http2GoAwayFrame && reason != "" {
+				if !continued {
+					holdFrom(headerStart)
+				}
+				w.goAway = make([]byte, 0, w.remaining)
+				w.goAwayReason = reason
+			} else if continued {
+				out = append(out, w.header[:]...)
+				kept = i
+			}
+		}
+
+		n := len(p) - i
+		if n > w.remaining {
+			n = w.remaining
+		}
+		if w.goAway != nil {
+			w.goAway = append(w.goAway, p[i:i+n]...)
+		}
+		w.remaining -= n
+		i += n
+		if w.remaining == 0 {
+			if w.goAway != nil {
+				out = append(out, w.goAwayFrame()...)
+				kept = i
+				w.goAway = nil
+			}
+			w.headerLen = 0
+		}
+	}
+
+	if out == nil {
+		return p
+	}
+	if kept >= 0 {
+		out = append(out, p[kept:]...)
+	}
+	return out
+}
+
+// goAwayFrame returns the held back GOAWAY frame, with the drain reason as
+// debug data if it is a graceful GOAWAY without any
+func (w *goAwayReasonWriter) goAwayFrame() []byte {
+	payload := w.goAway
+	if len(payload) == 8 && http2.ErrCode(binary.BigEndian.Uint32(payload[4:])) == http2.ErrCodeNo {
+		reason := w.goAwayReason
+		if len(reason) > maxDrainReasonLen {
+			reason = reason[:maxDrainReasonLen]
+		}
+		payload = append(payload, reason...)
+	}
+
+	frame := make([]byte, http2FrameHeaderLen, http2FrameHeaderLen+len(payload))
+	copy(frame, w.header[:])
+	frame[0], frame[1], frame[2] = byte(len(payload)>>16), byte(len(payload)>>8), byte(len(payload))
+	return append(frame, payload...)
+}
+
+// atFrameBoundary returns whether the bytes written so far end with a
+// complete frame
+func (w *goAwayReasonWriter) atFrameBoundary() bool {
+	return w.headerLen == 0 && w.goAway == nil
+}
+
+// gracefulGoAwayFrame returns a GOAWAY frame with reason as debug data that
+// lets the streams already open complete
+func gracefulGoAwayFrame(reason string) []byte {
+	if len(reason) > maxDrainReasonLen {
+		reason = reason[:maxDrainReasonLen]
+	}
+	payloadLen := 8 + len(reason)
+	frame := make([]byte, http2FrameHeaderLen+8, http2FrameHeaderLen+payloadLen)
+	frame[0], frame[1], frame[2] = byte(payloadLen>>16), byte(payloadLen>>8), byte(payloadLen)
+	frame[3] = http2GoAwayFrame
+	binary.BigEndian.PutUint32(frame[http2FrameHeaderLen:], math.MaxInt32)
+	binary.BigEndian.PutUint32(frame[http2FrameHeaderLen+4:], uint32(http2.ErrCodeNo))
+	return append(frame, reason...)
+}
+
+// drainReasonConn adds the drain reason to the GOAWAY frames written to the
+// connection
+type drainReasonConn struct {
+	net.Conn
+
+	lock   sync.Mutex
+	writer *goAwayReasonWriter
+	// whether the server wrote its first frame
+	written bool
+	// GOAWAY frame to write once the frames written so far are complete
+	pendingGoAway []byte
+	// called when the connection is closed
+	onClose func()
+}
+
+func newDrainReasonConn(conn net.Conn, reason func() string) *drainReasonConn {
+	return &drainReasonConn{
+		Conn:   conn,
+		writer: &goAwayReasonWriter{reason: reason},
+	}
+}
+
+func (c *drainReasonConn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	out := c.writer.rewrite(p)
+	if len(out) > 0 {
+		if _, err := c.Conn.Write(out); err != nil {
+			return 0, err
+		}
+		c.written = true
+	}
+	if c.pendingGoAway != nil && c.writer.atFrameBoundary() {
+		goAway := c.pendingGoAway
+		c.pendingGoAway = nil
+		if _, err := c.Conn.Write(goAway); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// goAway asks the client to open a new connection for its next calls by
+// sending it a graceful GOAWAY frame with reason as debug data. The frame is
+// written once the server has written a complete frame.
+func (c *drainReasonConn) goAway(reason string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	frame := gracefulGoAwayFrame(reason)
+	if !c.written || !c.writer.atFrameBoundary() {
+		c.pendingGoAway = frame
+		return nil
+	}
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+func (c *drainReasonConn) Close() error {
+	if c.onClose != nil {
+		c.onClose()
+	}
+	return c.Conn.Close()
+}
+
+// drainReasonListener adds the drain reason to the GOAWAY frames written to
+// the plaintext connections it accepts
+type drainReasonListener struct {
+	net.Listener
+	reason func() string
+}
+
+func (l *drainReasonListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newDrainReasonConn(conn, l.reason), nil
+}
+
+// wrapDrainReasonListener wraps listener to add the drain reason of the
+// server to the GOAWAY frames of the plaintext connections it accepts
+func (gServer *GRPCServer) wrapDrainReasonListener(listener net.Listener) net.Listener {
+	return &drainReasonListener{Listener: listener, reason: gServer.currentDrainReason}
+}
+
+// drainReasonCredentials adds the drain reason to the GOAWAY frames written
+// to the connections secured by the TransportCredentials
+type drainReasonCredentials struct {
+	credentials.TransportCredentials
+	reason func() string
+	// conns, if not nil, tracks the open connections
+	conns *connSet
+}
+
+func (dc *drainReasonCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := dc.TransportCredentials.ServerHandshake(rawConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	drc := newDrainReasonConn(conn, dc.reason)
+	if dc.conns != nil {
+		dc.conns.add(drc)
+		drc.onClose = func() { dc.conns.remove(drc) }
+	}
+	return drc, authInfo, nil
+}
+
+func (dc *drainReasonCredentials) Clone() credentials.TransportCredentials {
+	return &drainReasonCredentials{
+		TransportCredentials: dc.TransportCredentials.Clone(),
+		reason:               dc.reason,
+		conns:                dc.conns,
+	}
+}
@@ -0,0 +1,233 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+// goAwayServer accepts a single HTTP/2 connection and sends a GOAWAY frame
+// with reason as debug data right after the connection preface
+func goAwayServer(t *testing.T, lis net.Listener, reason string) {
+	conn, err := lis.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil {
+		t.Errorf("failed reading client preface: %s", err)
+		return
+	}
+	framer := http2.NewFramer(conn, conn)
+	if err := framer.WriteSettings(); err != nil {
+		t.Errorf("failed writing settings: %s", err)
+		return
+	}
+	// another frame precedes the GOAWAY frame
+	if err := framer.WritePing(false, [8]byte{1, 2, 3, 4, 5, 6, 7, 8}); err != nil {
+		t.Errorf("failed writing ping: %s", err)
+		return
+	}
+	if err := framer.WriteGoAway(0, http2.ErrCodeNo, []byte(reason)); err != nil {
+		t.Errorf("failed writing goaway: %s", err)
+		return
+	}
+	// wait for the client to close the connection
+	io.Copy(ioutil.Discard, conn)
+}
+
+func TestGoAwayHandler(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	serverCert, err := tls.X509KeyPair(serverKeyPair.Cert, serverKeyPair.Key)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		listen  func() (net.Listener, error)
+		secOpts comm.SecureOptions
+	}{
+		{
+			name:   "plaintext",
+			listen: func() (net.Listener, error) { return net.Listen("tcp", "127.0.0.1:0") },
+		},
+		{
+			name: "TLS",
+			listen: func() (net.Listener, error) {
+				return tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+					Certificates: []tls.Certificate{serverCert},
+					NextProtos:   []string{"h2"},
+				})
+			},
+			secOpts: comm.SecureOptions{
+				UseTLS:        true,
+				ServerRootCAs: [][]byte{ca.CertBytes()},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			lis, err := tt.listen()
+			require.NoError(t, err)
+			defer lis.Close()
+			go goAwayServer(t, lis, "maintenance")
+
+			type goAway struct{ address, reason string }
+			received := make(chan goAway, 1)
+			client, err := comm.NewGRPCClient(comm.ClientConfig{
+				SecOpts:      tt.secOpts,
+				Timeout:      testTimeout,
+				AsyncConnect: true,
+				GoAwayHandler: func(address, reason string) {
+					select {
+					case received <- goAway{address: address, reason: reason}:
+					default:
+					}
+				},
+			})
+			require.NoError(t, err)
+			conn, err := client.NewConnection(lis.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			select {
+			case g := <-received:
+				require.Equal(t, goAway{address: lis.Addr().String(), reason: "maintenance"}, g)
+			case <-time.After(5 * time.Second):
+				t.Fatal("GOAWAY was not reported")
+			}
+		})
+	}
+}
+
+func TestGracefulStopDrainReason(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+
+	serverSecOpts := comm.SecureOptions{
+		UseTLS:      true,
+		Certificate: serverKeyPair.Cert,
+		Key:         serverKeyPair.Key,
+	}
+	clientSecOpts := comm.SecureOptions{
+		UseTLS:        true,
+		ServerRootCAs: [][]byte{ca.CertBytes()},
+	}
+
+	tests := []struct {
+		name            string
+		serverSecOpts   comm.SecureOptions
+		clientSecOpts   comm.SecureOptions
+		sendDrainReason bool
+		expectedReason  string
+	}{
+		{
+			name:            "plaintext",
+			sendDrainReason: true,
+			expectedReason:  "server is shutting down for maintenance",
+		},
+		{
+			name:            "TLS",
+			serverSecOpts:   serverSecOpts,
+			clientSecOpts:   clientSecOpts,
+			sendDrainReason: true,
+			expectedReason:  "server is shutting down for maintenance",
+		},
+		{name: "plaintext without drain reason"},
+		{
+			name:          "TLS without drain reason",
+			serverSecOpts: serverSecOpts,
+			clientSecOpts: clientSecOpts,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{SecOpts: tt.serverSecOpts, SendDrainReason: tt.sendDrainReason})
+			require.NoError(t, err)
+			testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+			go srv.Start()
+			defer srv.Stop()
+
+			reasons := make(chan string, 10)
+			client, err := comm.NewGRPCClient(comm.ClientConfig{
+				SecOpts: tt.clientSecOpts,
+				Timeout: testTimeout,
+				GoAwayHandler: func(address, reason string) {
+					reasons <- reason
+				},
+			})
+			require.NoError(t, err)
+			conn, err := client.NewConnection(srv.Address())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			// a pending call keeps the connection open while draining
+			stream, err := testpb.NewEmptyServiceClient(conn).EmptyStream(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, stream.Send(&testpb.Empty{}))
+			_, err = stream.Recv()
+			require.NoError(t, err)
+
+			stopped := make(chan struct{})
+			go func() {
+				srv.GracefulStop("server is shutting down for maintenance")
+				close(stopped)
+			}()
+
+			select {
+			case reason := <-reasons:
+				require.Equal(t, tt.expectedReason, reason)
+			case <-time.After(5 * time.Second):
+				t.Fatal("GOAWAY was not reported")
+			}
+
+			// the pending call completes normally
+			require.NoError(t, stream.Send(&testpb.Empty{}))
+			_, err = stream.Recv()
+			require.NoError(t, err)
+			require.NoError(t, stream.CloseSend())
+			_, err = stream.Recv()
+			require.Equal(t, io.EOF, err)
+
+			select {
+			case <-stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatal("GracefulStop did not return")
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func TestGoAwayReasonWriter(t *testing.T) {
+	t.Parallel()
+
+	frames := func(goAwayReason, errorReason string) []byte {
+		buf := &bytes.Buffer{}
+		framer := http2.NewFramer(buf, nil)
+		require.NoError(t, framer.WriteSettings())
+		require.NoError(t, framer.WriteGoAway(1<<31-1, http2.ErrCodeNo, []byte(goAwayReason)))
+		require.NoError(t, framer.WritePing(false, [8]byte{1}))
+		require.NoError(t, framer.WriteGoAway(5, http2.ErrCodeNo, []byte(goAwayReason)))
+		require.NoError(t, framer.WriteGoAway(5, http2.ErrCodeEnhanceYourCalm, []byte(errorReason)))
+		require.NoError(t, framer.WriteData(3, false, []byte("data")))
+		return buf.Bytes()
+	}
+	input := frames("", "too_many_pings")
+
+	tests := []struct {
+		name     string
+		reason   string
+		expected []byte
+	}{
+		{name: "without reason", expected: input},
+		{name: "with reason", reason: "maintenance", expected: frames("maintenance", "too_many_pings")},
+		{
+			name:     "with long reason",
+			reason:   strings.Repeat("x", 2*maxDrainReasonLen),
+			expected: frames(strings.Repeat("x", maxDrainReasonLen), "too_many_pings"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// every split of the frames into two writes gives the same output
+			for split := 0; split <= len(input); split++ {
+				w := &goAwayReasonWriter{reason: func() string { return tt.reason }}
+				var out []byte
+				out = append(out, w.rewrite(input[:split])...)
+				out = append(out, w.rewrite(input[split:])...)
+				require.Equal(t, tt.expected, out, "split at %d", split)
+			}
+
+			// as does writing one byte at a time
+			w := &goAwayReasonWriter{reason: func() string { return tt.reason }}
+			var out []byte
+			for i := range input {
+				out = append(out, w.rewrite(input[i:i+1])...)
+			}
+			require.Equal(t, tt.expected, out)
+		})
+	}
+}
+
+func TestGoAwayScannerLongDebugData(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	framer := http2.NewFramer(buf, nil)
+	require.NoError(t, framer.WriteGoAway(5, http2.ErrCodeNo, []byte(strings.Repeat("x", 10*maxDrainReasonLen))))
+	require.NoError(t, framer.WritePing(false, [8]byte{1}))
+	require.NoError(t, framer.WriteGoAway(5, http2.ErrCodeNo, []byte("maintenance")))
+	input := buf.Bytes()
+
+	var reasons []string
+	s := &goAwayScanner{onGoAway: func(reason string) { reasons = append(reasons, reason) }}
+	for len(input) > 0 {
+		n := 100
+		if n > len(input) {
+			n = len(input)
+		}
+		s.scan(input[:n])
+		input = input[n:]
+		// the debug data past maxDrainReasonLen is not buffered
+		require.True(t, cap(s.goAway) <= maxGoAwayPayloadLen, "buffered %d bytes", cap(s.goAway))
+	}
+	require.Equal(t, []string{strings.Repeat("x", maxDrainReasonLen), "maintenance"}, reasons)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+var (
+	// ErrServerNotUsingTLS is wrapped by the errors of client handshakes
+	// failing because the server answered in plaintext
+	ErrServerNotUsingTLS = errors.New("core/comm: the server does not use TLS, the client must not use TLS either")
+	// ErrClientNotUsingTLS is wrapped by the errors of server handshakes
+	// failing because the client sent a plaintext HTTP/2 request
+	ErrClientNotUsingTLS = errors.New("core/comm: the client does not use TLS, but the server requires it")
+	// ErrClientUsingTLS is the error of the connections rejected because
+	// the client attempted a TLS handshake with a server that does not use
+	// TLS
+	ErrClientUsingTLS = errors.New("core/comm: the client uses TLS, but the server does not")
+)
+
+// tlsRecordTypeHandshake is the first byte of a TLS ClientHello. Clients
+// speaking HTTP/2 without TLS (h2c) start with the "PRI * HTTP/2.0" preface.
+const tlsRecordTypeHandshake = 0x16
+
+// transportMismatchError is a handshake error that retrying cannot fix. It
+// is not temporary so that gRPC fails the dial instead of retrying until
+// the dial timeout.
+type transportMismatchError struct {
+	err error
+}
+
+func (e *transportMismatchError) Error() string   { return e.err.Error() }
+func (e *transportMismatchError) Unwrap() error   { return e.err }
+func (e *transportMismatchError) Temporary() bool { return false }
+
+// classifyClientHandshakeError returns the error of a client handshake that
+// failed because the server at address does not use TLS
+func classifyClientHandshakeError(err error, address string) error {
+	var recordErr tls.RecordHeaderError
+	if !errors.As(err, &recordErr) {
+		return err
+	}
+	return &transportMismatchError{err: fmt.Errorf("%w: %s answered in plaintext: %s", ErrServerNotUsingTLS, address, err)}
+}
+
+// classifyServerHandshakeError returns the error of a server handshake that
+// failed because the client at address does not use TLS
+func classifyServerHandshakeError(err error, address string) error {
+	var recordErr tls.RecordHeaderError
+	if !errors.As(err, &recordErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %s sent a plaintext request: %s", ErrClientNotUsingTLS, address, err)
+}
+
+// plaintextListener rejects the connections of clients attempting a TLS
+// handshake with a server that does not use TLS
+type plaintextListener struct {
+	net.Listener
+	gServer *GRPCServer
+}
+
+func (l *plaintextListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &plaintextConn{Conn: conn, gServer: l.gServer}, nil
+}
+
+// wrapPlaintextListener wraps the listener of a server that does not use
+// TLS to reject the clients that do with a clear error
+func (gServer *GRPCServer) wrapPlaintextListener(listener net.Listener) net.Listener {
+	return &plaintextListener{Listener: listener, gServer: gServer}
+}
+
+// plaintextConn fails the first read if it starts a TLS handshake. The
+// server writes its HTTP/2 settings before reading the client preface, so
+// such clients fail their handshake with ErrServerNotUsingTLS.
+type plaintextConn struct {
+	net.Conn
+	gServer *GRPCServer
+	once    sync.Once
+	err     error
+}
+
+func (c *plaintextConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.once.Do(func() {
+		if n > 0 && p[0] == tlsRecordTypeHandshake {
+			c.gServer.logger.Warningf("Rejecting connection from %s: it attempted a TLS handshake but the server does not use TLS (UseTLS is false)", c.RemoteAddr())
+			c.err = fmt.Errorf("%w: %s attempted a TLS handshake", ErrClientUsingTLS, c.RemoteAddr())
+		}
+	})
+	if c.err != nil {
+		return 0, c.err
+	}
+	return n, err
+}
@@ -0,0 +1,116 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestTLSClientPlaintextServer(t *testing.T) {
+	t.Parallel()
+
+	warnings := &recordedWarnings{}
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		ConnectionErrorHistory: 1,
+		Logger:                 warnings.logger(),
+	})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	client, err := comm.NewGRPCClient(comm.ClientConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:        true,
+			ServerRootCAs: [][]byte{ca.CertBytes()},
+		},
+		Timeout: 10 * time.Second,
+	})
+	require.NoError(t, err)
+
+	// the dial fails right away instead of retrying until the timeout
+	start := time.Now()
+	_, err = client.NewConnection(srv.Address())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "core/comm: the server does not use TLS, the client must not use TLS either: "+srv.Address()+" answered in plaintext")
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+	require.Eventually(t, func() bool { return len(srv.RecentConnectionErrors()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.Contains(t, srv.RecentConnectionErrors()[0].Reason, "core/comm: the client uses TLS, but the server does not")
+	require.Len(t, warnings.get(), 1)
+	require.Contains(t, warnings.get()[0], "it attempted a TLS handshake but the server does not use TLS (UseTLS is false)")
+
+	// plaintext clients are served over h2c
+	_, err = invokeEmptyCall(srv.Address(), grpc.WithBlock(), grpc.WithInsecure())
+	require.NoError(t, err)
+}
+
+func TestPlaintextClientTLSServer(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:      true,
+			Certificate: serverKeyPair.Cert,
+			Key:         serverKeyPair.Key,
+		},
+		ConnectionErrorHistory: 1,
+	})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, srv.Address(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(ctx, &testpb.Empty{})
+	require.Error(t, err)
+
+	require.Eventually(t, func() bool { return len(srv.RecentConnectionErrors()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	reason := srv.RecentConnectionErrors()[0].Reason
+	require.Contains(t, reason, "core/comm: the client does not use TLS, but the server requires it")
+	require.Contains(t, reason, "sent a plaintext request")
+}
+
+func TestClientHandshakeWithPlaintextServer(t *testing.T) {
+	t.Parallel()
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	rawConn, err := net.Dial("tcp", srv.Address())
+	require.NoError(t, err)
+	defer rawConn.Close()
+	creds := &comm.DynamicClientCredentials{TLSConfig: &tls.Config{}}
+	_, _, err = creds.ClientHandshake(context.Background(), "127.0.0.1", rawConn)
+	require.True(t, errors.Is(err, comm.ErrServerNotUsingTLS))
+	temporary, ok := err.(interface{ Temporary() bool })
+	require.True(t, ok)
+	require.False(t, temporary.Temporary())
+}
@@ -0,0 +1,73 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// IdempotencyKeyHeader is the metadata key carrying the idempotency key of
+// a call
+const IdempotencyKeyHeader = "x-idempotency-key"
+
+// IdempotencyKeyUnaryClientInterceptor returns a unary client interceptor
+// attaching an idempotency key to the calls to the listed full method names.
+// A new key is generated for every logical call unless the outgoing context
+// already carries one. Interceptors chained after this one, such as retry
+// interceptors, see the key in the outgoing context, so every attempt of a
+// call carries the same key; the interceptor must therefore be chained
+// before the retry interceptor.
+//
+// Servers deduplicate calls by recording the response of the first call
+// with a given key, obtained with IdempotencyKeyFromContext, and returning
+// it for the calls repeating the key instead of applying the mutation
+// again. Keys should be scoped to the identity of the client and retained
+// for at least as long as clients retry.
+func IdempotencyKeyUnaryClientInterceptor(methods []string) grpc.UnaryClientInterceptor {
+	mutations := map[string]struct{}{}
+	for _, method := range methods {
+		mutations[method] = struct{}{}
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := mutations[method]; !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(IdempotencyKeyHeader)) == 0 {
+			key, err := newIdempotencyKey()
+			if err != nil {
+				return err
+			}
+			ctx = metadata.AppendToOutgoingContext(ctx, IdempotencyKeyHeader, key)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// IdempotencyKeyFromContext returns the idempotency key of the call of the
+// incoming context ctx, if any
+func IdempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get(IdempotencyKeyHeader)
+	if len(keys) == 0 {
+		return "", false
+	}
+	return keys[0], true
+}
+
+func newIdempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", errors.Wrap(err, "failed generating idempotency key")
+	}
+	return hex.EncodeToString(key), nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestIdempotencyKeyUnaryClientInterceptor(t *testing.T) {
+	t.Parallel()
+
+	var lock sync.Mutex
+	var keys []string
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+		UnaryInterceptors: []grpc.UnaryServerInterceptor{
+			func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				key, _ := comm.IdempotencyKeyFromContext(ctx)
+				lock.Lock()
+				keys = append(keys, key)
+				lock.Unlock()
+				return handler(ctx, req)
+			},
+		},
+	})
+	require.NoError(t, err)
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	// makes every call twice, like a retry interceptor after a failure
+	retry := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	conn, err := grpc.Dial(
+		lis.Addr().String(),
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithChainUnaryInterceptor(
+			comm.IdempotencyKeyUnaryClientInterceptor([]string{"/EchoService/EchoCall"}),
+			retry,
+		),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	echo := testpb.NewEchoServiceClient(conn)
+	received := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		defer func() { keys = nil }()
+		return keys
+	}
+
+	_, err = echo.EchoCall(context.Background(), &testpb.Echo{})
+	require.NoError(t, err)
+	first := received()
+	require.Len(t, first, 2)
+	require.Len(t, first[0], 32)
+	require.Equal(t, first[0], first[1], "retried attempts must carry the same key")
+
+	_, err = echo.EchoCall(context.Background(), &testpb.Echo{})
+	require.NoError(t, err)
+	second := received()
+	require.Len(t, second, 2)
+	require.Equal(t, second[0], second[1])
+	require.NotEqual(t, first[0], second[0], "logical calls must carry different keys")
+
+	// keys set by the caller are kept
+	ctx := metadata.AppendToOutgoingContext(context.Background(), comm.IdempotencyKeyHeader, "caller-key")
+	_, err = echo.EchoCall(ctx, &testpb.Echo{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"caller-key", "caller-key"}, received())
+
+	// methods that are not listed carry no key
+	_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"", ""}, received())
+}
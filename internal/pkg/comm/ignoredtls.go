@@ -0,0 +1,58 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/pkg/errors"
+)
+
+// ignoredTLSFields returns the names of the TLS fields that are set while
+// TLS is disabled
+func (so SecureOptions) ignoredTLSFields() []string {
+	if so.UseTLS {
+		return nil
+	}
+	var fields []string
+	set := func(name string, isSet bool) {
+		if isSet {
+			fields = append(fields, name)
+		}
+	}
+	set("Certificate", len(so.Certificate) > 0)
+	set("Key", len(so.Key) > 0)
+	set("ServerRootCAs", len(so.ServerRootCAs) > 0)
+	set("StrictServerRootCAs", so.StrictServerRootCAs)
+	set("ClientRootCAs", len(so.ClientRootCAs) > 0)
+	set("RequireClientCert", so.RequireClientCert)
+	set("CipherSuites", len(so.CipherSuites) > 0)
+	set("CurvePreferences", so.CurvePreferences != nil)
+	set("TimeShift", so.TimeShift != 0)
+	set("VerifyCertificate", so.VerifyCertificate != nil)
+	set("KeyLogWriter", so.KeyLogWriter != nil)
+	set("RequireSCT", so.RequireSCT)
+	set("RequiredCertHostname", so.RequiredCertHostname != "")
+	set("CRLs", len(so.CRLs) > 0)
+	set("GetConfigForClient", so.GetConfigForClient != nil)
+	return fields
+}
+
+// checkIgnoredTLSFields warns about the TLS fields set while TLS is
+// disabled, or returns an error naming them if StrictUseTLS is set
+func (so SecureOptions) checkIgnoredTLSFields(logger *flogging.FabricLogger) error {
+	fields := so.ignoredTLSFields()
+	if len(fields) == 0 {
+		return nil
+	}
+	if so.StrictUseTLS {
+		return errors.Errorf("UseTLS is false but TLS fields are set: %s", strings.Join(fields, ", "))
+	}
+	logger.Warningf("TLS is disabled because UseTLS is false, ignoring the TLS fields that are set: %s", strings.Join(fields, ", "))
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnoredTLSFields(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+
+	// TLS material without UseTLS
+	secOpts := comm.SecureOptions{
+		Certificate:       serverKeyPair.Cert,
+		Key:               serverKeyPair.Key,
+		ClientRootCAs:     [][]byte{ca.CertBytes()},
+		RequireClientCert: true,
+	}
+
+	t.Run("server warning", func(t *testing.T) {
+		warnings := &recordedWarnings{}
+		srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+			SecOpts: secOpts,
+			Logger:  warnings.logger(),
+		})
+		require.NoError(t, err)
+		defer srv.Stop()
+		require.False(t, srv.TLSEnabled())
+		require.Equal(t, []string{
+			"TLS is disabled because UseTLS is false, ignoring the TLS fields that are set: Certificate, Key, ClientRootCAs, RequireClientCert",
+		}, warnings.get())
+	})
+
+	t.Run("server strict", func(t *testing.T) {
+		strictOpts := secOpts
+		strictOpts.StrictUseTLS = true
+		_, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{SecOpts: strictOpts})
+		require.EqualError(t, err, "UseTLS is false but TLS fields are set: Certificate, Key, ClientRootCAs, RequireClientCert")
+	})
+
+	t.Run("client", func(t *testing.T) {
+		clientOpts := comm.SecureOptions{
+			ServerRootCAs:        [][]byte{ca.CertBytes()},
+			RequiredCertHostname: "orderer.example.com",
+		}
+		_, err := comm.NewGRPCClient(comm.ClientConfig{SecOpts: clientOpts})
+		require.NoError(t, err)
+
+		clientOpts.StrictUseTLS = true
+		_, err = comm.NewGRPCClient(comm.ClientConfig{SecOpts: clientOpts})
+		require.EqualError(t, err, "UseTLS is false but TLS fields are set: ServerRootCAs, RequiredCertHostname")
+	})
+
+	t.Run("no TLS fields", func(t *testing.T) {
+		warnings := &recordedWarnings{}
+		srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+			SecOpts: comm.SecureOptions{StrictUseTLS: true},
+			Logger:  warnings.logger(),
+		})
+		require.NoError(t, err)
+		defer srv.Stop()
+		require.Empty(t, warnings.get())
+	})
+}
@@ -0,0 +1,39 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+)
+
+// inFlightCounter counts the calls being handled by a server
+type inFlightCounter struct {
+	count int64
+}
+
+func (c *inFlightCounter) get() int {
+	return int(atomic.LoadInt64(&c.count))
+}
+
+func (c *inFlightCounter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		atomic.AddInt64(&c.count, 1)
+		defer atomic.AddInt64(&c.count, -1)
+		return handler(ctx, req)
+	}
+}
+
+func (c *inFlightCounter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		atomic.AddInt64(&c.count, 1)
+		defer atomic.AddInt64(&c.count, -1)
+		return handler(srv, ss)
+	}
+}
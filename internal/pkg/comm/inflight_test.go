@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type blockingStreamServer struct {
+	emptyServiceServer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (bs *blockingStreamServer) EmptyStream(stream testpb.EmptyService_EmptyStreamServer) error {
+	bs.started <- struct{}{}
+	<-bs.release
+	return nil
+}
+
+func TestInFlightRPCsDrainProgress(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	var lock sync.Mutex
+	var infos []string
+	logger := flogging.MustGetLogger("test").WithOptions(zap.Hooks(func(entry zapcore.Entry) error {
+		if entry.Level == zapcore.InfoLevel {
+			lock.Lock()
+			infos = append(infos, entry.Message)
+			lock.Unlock()
+		}
+		return nil
+	}))
+	loggedInfos := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), infos...)
+	}
+
+	bs := &blockingStreamServer{started: make(chan struct{}, 2), release: make(chan struct{})}
+	srv, conn := newTestServer(t, comm.ServerConfig{
+		Logger:                logger,
+		DrainProgressInterval: 50 * time.Millisecond,
+	}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEmptyServiceServer(srv.Server(), bs)
+	})
+	client := testpb.NewEmptyServiceClient(conn)
+
+	gt.Expect(srv.InFlightRPCs()).To(Equal(0))
+	_, err := client.EmptyCall(context.Background(), &testpb.Empty{})
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(srv.InFlightRPCs()).To(Equal(0))
+
+	for i := 0; i < 2; i++ {
+		stream, err := client.EmptyStream(context.Background())
+		gt.Expect(err).NotTo(HaveOccurred())
+		defer stream.CloseSend()
+		<-bs.started
+	}
+	gt.Expect(srv.InFlightRPCs()).To(Equal(2))
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop("maintenance")
+		close(stopped)
+	}()
+
+	expected := fmt.Sprintf("Draining server on %s, 2 RPCs in flight", srv.Address())
+	gt.Eventually(loggedInfos, 5*time.Second).Should(ContainElement(expected))
+	gt.Consistently(stopped, 100*time.Millisecond).ShouldNot(BeClosed())
+
+	close(bs.release)
+	gt.Eventually(stopped, 5*time.Second).Should(BeClosed())
+	gt.Expect(srv.InFlightRPCs()).To(Equal(0))
+
+	// no progress is logged once the drain completes
+	logged := len(loggedInfos())
+	gt.Consistently(func() int { return len(loggedInfos()) }, 200*time.Millisecond).Should(Equal(logged))
+}
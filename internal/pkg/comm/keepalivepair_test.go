@@ -0,0 +1,151 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+// pingServer opens an HTTP/2 connection to address, sends count pings
+// every interval and returns whether the server sent a GOAWAY frame
+func pingServer(t *testing.T, address string, interval time.Duration, count int) bool {
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(http2.ClientPreface))
+	require.NoError(t, err)
+	framer := http2.NewFramer(conn, conn)
+	require.NoError(t, framer.WriteSettings())
+
+	goAway := make(chan struct{})
+	go func() {
+		for {
+			frame, err := framer.ReadFrame()
+			if err != nil {
+				return
+			}
+			if _, ok := frame.(*http2.GoAwayFrame); ok {
+				close(goAway)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < count; i++ {
+		time.Sleep(interval)
+		// the server may already have closed the connection
+		framer.WritePing(false, [8]byte{byte(i)})
+	}
+	select {
+	case <-goAway:
+		return true
+	case <-time.After(500 * time.Millisecond):
+		return false
+	}
+}
+
+func TestNewKeepalivePair(t *testing.T) {
+	t.Parallel()
+
+	clientKa, serverKa := comm.NewKeepalivePair(200*time.Millisecond, time.Hour, 5*time.Second)
+	require.Equal(t, comm.KeepaliveOptions{
+		ClientInterval: 200 * time.Millisecond,
+		ClientTimeout:  5 * time.Second,
+	}, clientKa)
+	require.Equal(t, comm.KeepaliveOptions{
+		ServerInterval:    time.Hour,
+		ServerTimeout:     5 * time.Second,
+		ServerMinInterval: 100 * time.Millisecond,
+	}, serverKa)
+
+	serve := func(ka comm.KeepaliveOptions) string {
+		srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{KaOpts: ka})
+		require.NoError(t, err)
+		go srv.Start()
+		t.Cleanup(srv.Stop)
+		return srv.Address()
+	}
+
+	// a client pinging at the interval of the pair is never sent a GOAWAY
+	require.False(t, pingServer(t, serve(serverKa), clientKa.ClientInterval, 6))
+
+	// a server permitting less frequent pings closes the connection
+	strictKa := serverKa
+	strictKa.ServerMinInterval = 2 * clientKa.ClientInterval
+	require.True(t, pingServer(t, serve(strictKa), clientKa.ClientInterval, 6))
+}
+
+func TestCheckKeepaliveCompatibility(t *testing.T) {
+	t.Parallel()
+
+	clientKa, serverKa := comm.NewKeepalivePair(time.Minute, time.Hour, 20*time.Second)
+	tests := []struct {
+		name   string
+		client comm.KeepaliveOptions
+		server comm.KeepaliveOptions
+		errMsg string
+	}{
+		{
+			name:   "pair",
+			client: clientKa,
+			server: serverKa,
+		},
+		{
+			name:   "defaults",
+			client: comm.DefaultKeepaliveOptions,
+			server: comm.DefaultKeepaliveOptions,
+		},
+		{
+			name:   "client interval equal to server minimum",
+			client: comm.KeepaliveOptions{ClientInterval: time.Minute},
+			server: comm.KeepaliveOptions{ServerMinInterval: time.Minute},
+		},
+		{
+			name:   "client interval raised to server minimum",
+			client: comm.KeepaliveOptions{ClientInterval: time.Second},
+			server: comm.KeepaliveOptions{ServerMinInterval: 10 * time.Second},
+		},
+		{
+			name:   "client pinging too often",
+			client: comm.KeepaliveOptions{ClientInterval: 30 * time.Second},
+			server: comm.KeepaliveOptions{ServerMinInterval: time.Minute},
+			errMsg: "clients pinging every 30s would be disconnected by servers permitting a ping every 1m0s at most",
+		},
+		{
+			name:   "client interval raised but still too short",
+			client: comm.KeepaliveOptions{ClientInterval: time.Second},
+			server: comm.KeepaliveOptions{ServerMinInterval: 15 * time.Second},
+			errMsg: "clients pinging every 10s (ClientInterval 1s raised by gRPC) would be disconnected by servers permitting a ping every 15s at most",
+		},
+		{
+			name:   "server default minimum",
+			client: comm.KeepaliveOptions{ClientInterval: time.Minute},
+			server: comm.KeepaliveOptions{},
+			errMsg: "clients pinging every 1m0s would be disconnected by servers permitting a ping every 5m0s at most",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := comm.CheckKeepaliveCompatibility(tt.client, tt.server)
+			if tt.errMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.errMsg)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var keepaliveProfiles = struct {
+	lock     sync.RWMutex
+	profiles map[string]KeepaliveOptions
+}{profiles: map[string]KeepaliveOptions{}}
+
+// RegisterKeepaliveProfile registers keepalive options under name so that
+// servers and clients can select them with the KeepaliveProfile field of
+// their configuration, e.g. to give long lived deliver streams and chatty
+// gossip connections different keepalive settings. Registering a name again
+// replaces its options for the servers and clients created afterwards.
+func RegisterKeepaliveProfile(name string, ka KeepaliveOptions) {
+	keepaliveProfiles.lock.Lock()
+	defer keepaliveProfiles.lock.Unlock()
+	keepaliveProfiles.profiles[name] = ka
+}
+
+// LookupKeepaliveProfile returns the keepalive options registered under name
+func LookupKeepaliveProfile(name string) (KeepaliveOptions, bool) {
+	keepaliveProfiles.lock.RLock()
+	defer keepaliveProfiles.lock.RUnlock()
+	ka, ok := keepaliveProfiles.profiles[name]
+	return ka, ok
+}
+
+// resolveKeepalive returns the options of the profile if it is not empty,
+// or ka otherwise
+func resolveKeepalive(profile string, ka KeepaliveOptions) (KeepaliveOptions, error) {
+	if profile == "" {
+		return ka, nil
+	}
+	profileKa, ok := LookupKeepaliveProfile(profile)
+	if !ok {
+		return KeepaliveOptions{}, errors.Errorf("keepalive profile %q is not registered", profile)
+	}
+	return profileKa, nil
+}
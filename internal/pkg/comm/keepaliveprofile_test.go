@@ -0,0 +1,80 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/flogging/floggingtest"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepaliveProfiles(t *testing.T) {
+	t.Parallel()
+
+	deliver := comm.KeepaliveOptions{
+		ClientInterval:    5 * time.Minute,
+		ClientTimeout:     time.Minute,
+		ServerInterval:    10 * time.Minute,
+		ServerTimeout:     time.Minute,
+		ServerMinInterval: 2 * time.Minute,
+	}
+	gossip := comm.KeepaliveOptions{
+		ClientInterval:    20 * time.Second,
+		ClientTimeout:     5 * time.Second,
+		ServerInterval:    30 * time.Second,
+		ServerTimeout:     5 * time.Second,
+		ServerMinInterval: 10 * time.Second,
+	}
+	comm.RegisterKeepaliveProfile("test-deliver", deliver)
+	comm.RegisterKeepaliveProfile("test-gossip", gossip)
+
+	ka, ok := comm.LookupKeepaliveProfile("test-deliver")
+	require.True(t, ok)
+	require.Equal(t, deliver, ka)
+	ka, ok = comm.LookupKeepaliveProfile("test-gossip")
+	require.True(t, ok)
+	require.Equal(t, gossip, ka)
+	_, ok = comm.LookupKeepaliveProfile("test-missing")
+	require.False(t, ok)
+
+	// servers apply the options of the profile they select
+	effectiveKeepalive := func(profile string) string {
+		logger, recorder := floggingtest.NewTestLogger(t)
+		srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+			Logger:           logger,
+			KaOpts:           comm.DefaultKeepaliveOptions,
+			KeepaliveProfile: profile,
+		})
+		require.NoError(t, err)
+		go srv.Start()
+		defer srv.Stop()
+
+		require.Eventually(t, func() bool {
+			return len(recorder.EntriesContaining("effective keepalive settings")) == 1
+		}, testTimeout, 10*time.Millisecond)
+		return recorder.EntriesContaining("effective keepalive settings")[0]
+	}
+	require.Contains(t, effectiveKeepalive("test-deliver"), "time=10m0s timeout=1m0s minTime=2m0s")
+	require.Contains(t, effectiveKeepalive("test-gossip"), "time=30s timeout=5s minTime=10s")
+	require.Contains(t, effectiveKeepalive(""), "time=2h0m0s timeout=20s minTime=1m0s")
+
+	_, err := comm.NewGRPCClient(comm.ClientConfig{KeepaliveProfile: "test-gossip"})
+	require.NoError(t, err)
+}
+
+func TestKeepaliveProfileNotRegistered(t *testing.T) {
+	t.Parallel()
+
+	_, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{KeepaliveProfile: "test-unregistered"})
+	require.EqualError(t, err, `keepalive profile "test-unregistered" is not registered`)
+
+	_, err = comm.NewGRPCClient(comm.ClientConfig{KeepaliveProfile: "test-unregistered"})
+	require.EqualError(t, err, `keepalive profile "test-unregistered" is not registered`)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/stretchr/testify/require"
+)
+
+type keyLog struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (kl *keyLog) Write(p []byte) (int, error) {
+	kl.lock.Lock()
+	defer kl.lock.Unlock()
+	return kl.buf.Write(p)
+}
+
+func (kl *keyLog) String() string {
+	kl.lock.Lock()
+	defer kl.lock.Unlock()
+	return kl.buf.String()
+}
+
+func TestKeyLogWriter(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+
+	serve := func(keyLogWriter io.Writer) *comm.GRPCServer {
+		srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+			SecOpts: comm.SecureOptions{
+				UseTLS:       true,
+				Certificate:  serverKeyPair.Cert,
+				Key:          serverKeyPair.Key,
+				KeyLogWriter: keyLogWriter,
+			},
+		})
+		require.NoError(t, err)
+		go srv.Start()
+		t.Cleanup(srv.Stop)
+		return srv
+	}
+
+	t.Run("server", func(t *testing.T) {
+		serverKeyLog := &keyLog{}
+		srv := serve(serverKeyLog)
+
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(ca.CertBytes())
+		conn, err := tls.Dial("tcp", srv.Address(), &tls.Config{
+			RootCAs:    rootCAs,
+			MaxVersion: tls.VersionTLS12,
+		})
+		require.NoError(t, err)
+		conn.Close()
+
+		require.Regexp(t, `^CLIENT_RANDOM [0-9a-f]{64} [0-9a-f]{96}\n$`, serverKeyLog.String())
+	})
+
+	t.Run("client", func(t *testing.T) {
+		srv := serve(nil)
+
+		clientKeyLog := &keyLog{}
+		client, err := comm.NewGRPCClient(comm.ClientConfig{
+			SecOpts: comm.SecureOptions{
+				UseTLS:        true,
+				ServerRootCAs: [][]byte{ca.CertBytes()},
+				KeyLogWriter:  clientKeyLog,
+			},
+			Timeout: testTimeout,
+		})
+		require.NoError(t, err)
+		conn, err := client.NewConnection(srv.Address())
+		require.NoError(t, err)
+		conn.Close()
+
+		require.Contains(t, clientKeyLog.String(), "CLIENT_TRAFFIC_SECRET_0 ")
+		require.Contains(t, clientKeyLog.String(), "SERVER_TRAFFIC_SECRET_0 ")
+	})
+}
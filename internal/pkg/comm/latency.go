@@ -0,0 +1,31 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// MeasureLatency returns the round trip time of a health check made over
+// conn. Servers without health checking respond with Unimplemented, which
+// still measures a round trip. The call fails fast if conn is not ready.
+func MeasureLatency(ctx context.Context, conn *grpc.ClientConn) (time.Duration, error) {
+	start := time.Now()
+	_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	rtt := time.Since(start)
+	if err != nil && status.Code(err) != codes.Unimplemented {
+		return 0, errors.WithMessagef(err, "failed measuring latency to %s", conn.Target())
+	}
+	return rtt, nil
+}
@@ -0,0 +1,51 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestMeasureLatency(t *testing.T) {
+	t.Parallel()
+
+	for _, healthCheckEnabled := range []bool{true, false} {
+		_, conn := newTestServer(t, comm.ServerConfig{HealthCheckEnabled: healthCheckEnabled}, nil)
+
+		rtt, err := comm.MeasureLatency(context.Background(), conn)
+		require.NoError(t, err)
+		require.True(t, rtt > 0)
+		require.True(t, rtt < testTimeout)
+	}
+}
+
+func TestMeasureLatencyDeadServer(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := lis.Addr().String()
+	lis.Close()
+
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rtt, err := comm.MeasureLatency(ctx, conn)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed measuring latency to "+address+": rpc error: code = Unavailable")
+	require.Zero(t, rtt)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingListener records its name every time it returns a connection
+type recordingListener struct {
+	net.Listener
+	name   string
+	record func(string)
+}
+
+func (rl *recordingListener) Accept() (net.Conn, error) {
+	conn, err := rl.Listener.Accept()
+	if err == nil {
+		rl.record(rl.name)
+	}
+	return conn, err
+}
+
+// countingConn counts the bytes read from the connection
+type countingConn struct {
+	net.Conn
+	read *int64
+}
+
+func (cc *countingConn) Read(b []byte) (int, error) {
+	n, err := cc.Conn.Read(b)
+	atomic.AddInt64(cc.read, int64(n))
+	return n, err
+}
+
+type countingListener struct {
+	net.Listener
+	read *int64
+}
+
+func (cl *countingListener) Accept() (net.Conn, error) {
+	conn, err := cl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, read: cl.read}, nil
+}
+
+func TestListenerWrappers(t *testing.T) {
+	t.Parallel()
+
+	var lock sync.Mutex
+	var accepted []string
+	record := func(name string) {
+		lock.Lock()
+		accepted = append(accepted, name)
+		lock.Unlock()
+	}
+	recording := func(name string) func(net.Listener) net.Listener {
+		return func(l net.Listener) net.Listener {
+			return &recordingListener{Listener: l, name: name, record: record}
+		}
+	}
+	var read int64
+
+	srv, conn := newTestServer(t, comm.ServerConfig{
+		ListenerWrappers: []func(net.Listener) net.Listener{
+			recording("first"),
+			func(l net.Listener) net.Listener { return &countingListener{Listener: l, read: &read} },
+			recording("last"),
+		},
+	}, registerEmptyService)
+	// the listener of the server is the unwrapped one
+	require.IsType(t, &net.TCPListener{}, srv.Listener())
+
+	_, err := testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	require.NoError(t, err)
+
+	// connections are returned through the first wrapper first
+	lock.Lock()
+	require.Equal(t, []string{"first", "last"}, accepted)
+	lock.Unlock()
+	// and the connections of the wrappers are used by the server
+	require.NotZero(t, atomic.LoadInt64(&read))
+}
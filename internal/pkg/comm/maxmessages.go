@@ -0,0 +1,52 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NewMaxStreamMessagesInterceptor returns a stream server interceptor
+// capping the number of messages sent on each stream to maxMessages, e.g.
+// to bound the results of methods that fan out. Sends beyond the cap fail
+// with ResourceExhausted, and so does the stream, even if the handler
+// ignores the failed sends. A non-positive maxMessages disables the cap.
+func NewMaxStreamMessagesInterceptor(maxMessages int) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if maxMessages <= 0 {
+			return handler(srv, ss)
+		}
+		ms := &maxMessagesServerStream{ServerStream: ss, maxMessages: maxMessages}
+		err := handler(srv, ms)
+		if ms.exceeded {
+			return ms.exceededErr()
+		}
+		return err
+	}
+}
+
+type maxMessagesServerStream struct {
+	grpc.ServerStream
+	maxMessages int
+	sent        int
+	exceeded    bool
+}
+
+func (ms *maxMessagesServerStream) SendMsg(m interface{}) error {
+	if ms.sent >= ms.maxMessages {
+		ms.exceeded = true
+		return ms.exceededErr()
+	}
+	ms.sent++
+	return ms.ServerStream.SendMsg(m)
+}
+
+func (ms *maxMessagesServerStream) exceededErr() error {
+	return status.Errorf(codes.ResourceExhausted, "stream exceeded the maximum of %d messages sent", ms.maxMessages)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fanOutServer sends count messages on every stream, ignoring send errors
+type fanOutServer struct {
+	emptyServiceServer
+	count int
+}
+
+func (fs *fanOutServer) EmptyStream(stream testpb.EmptyService_EmptyStreamServer) error {
+	for i := 0; i < fs.count; i++ {
+		stream.Send(&testpb.Empty{})
+	}
+	return nil
+}
+
+// receiveAll returns the number of messages received on the stream and the
+// error it ended with
+func receiveAll(t *testing.T, client testpb.EmptyServiceClient) (int, error) {
+	stream, err := client.EmptyStream(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+	for received := 0; ; received++ {
+		if _, err := stream.Recv(); err != nil {
+			return received, err
+		}
+	}
+}
+
+func TestMaxStreamMessagesInterceptor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		maxMessages int
+		svc         testpb.EmptyServiceServer
+		received    int
+		code        codes.Code
+	}{
+		{name: "handler stopping on error", maxMessages: 5, svc: &sendingServer{result: make(chan error, 1)}, received: 5, code: codes.ResourceExhausted},
+		{name: "handler ignoring errors", maxMessages: 5, svc: &fanOutServer{count: 20}, received: 5, code: codes.ResourceExhausted},
+		{name: "under the cap", maxMessages: 5, svc: &fanOutServer{count: 5}, received: 5, code: codes.OK},
+		{name: "unlimited", maxMessages: 0, svc: &fanOutServer{count: 20}, received: 20, code: codes.OK},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, conn := newTestServer(t, comm.ServerConfig{
+				StreamInterceptors: []grpc.StreamServerInterceptor{comm.NewMaxStreamMessagesInterceptor(tt.maxMessages)},
+			}, func(srv *comm.GRPCServer) {
+				testpb.RegisterEmptyServiceServer(srv.Server(), tt.svc)
+			})
+			received, err := receiveAll(t, testpb.NewEmptyServiceClient(conn))
+			require.Equal(t, tt.received, received)
+			if tt.code == codes.OK {
+				require.Equal(t, io.EOF, err)
+				return
+			}
+			require.Equal(t, tt.code, status.Code(err))
+			require.Equal(t, "stream exceeded the maximum of 5 messages sent", status.Convert(err).Message())
+		})
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// methodConcurrencyRetryDelay is the delay suggested to the callers of a
+// method at capacity. How long the calls in progress last is unknown, so
+// it is a short fixed delay.
+const methodConcurrencyRetryDelay = 100 * time.Millisecond
+
+// methodConcurrencyLimiter bounds the number of concurrent calls per method,
+// shared by all callers of the method
+type methodConcurrencyLimiter struct {
+	semaphores map[string]chan struct{}
+}
+
+func newMethodConcurrencyLimiter(limits map[string]int) *methodConcurrencyLimiter {
+	mcl := &methodConcurrencyLimiter{semaphores: map[string]chan struct{}{}}
+	for method, limit := range limits {
+		if limit > 0 {
+			mcl.semaphores[method] = make(chan struct{}, limit)
+		}
+	}
+	return mcl
+}
+
+// acquire takes a slot of the semaphore of the method, if any, and returns
+// the function releasing it, or a ResourceExhausted error carrying
+// RetryInfo when the method is at capacity
+func (mcl *methodConcurrencyLimiter) acquire(fullMethod string) (func(), error) {
+	sem, ok := mcl.semaphores[fullMethod]
+	if !ok {
+		return func() {}, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	default:
+	}
+
+	st := status.Newf(codes.ResourceExhausted, "concurrency limit of %d reached for method %s", cap(sem), fullMethod)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(methodConcurrencyRetryDelay)}); err == nil {
+		st = detailed
+	}
+	return nil, st.Err()
+}
+
+func (mcl *methodConcurrencyLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		release, err := mcl.acquire(info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+func (mcl *methodConcurrencyLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		release, err := mcl.acquire(info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// concurrencyTrackingServer records the highest number of calls it
+// handles at once
+type concurrencyTrackingServer struct {
+	emptyServiceServer
+	current int32
+	max     int32
+}
+
+func (cs *concurrencyTrackingServer) EmptyCall(context.Context, *testpb.Empty) (*testpb.Empty, error) {
+	current := atomic.AddInt32(&cs.current, 1)
+	defer atomic.AddInt32(&cs.current, -1)
+	for {
+		max := atomic.LoadInt32(&cs.max)
+		if current <= max || atomic.CompareAndSwapInt32(&cs.max, max, current) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return &testpb.Empty{}, nil
+}
+
+func TestMethodConcurrencyLimits(t *testing.T) {
+	t.Parallel()
+
+	cs := &concurrencyTrackingServer{}
+	_, conn := newTestServer(t, comm.ServerConfig{
+		MethodConcurrencyLimits: map[string]int{
+			"/EmptyService/EmptyCall": 2,
+			"/EchoService/EchoCall":   0,
+		},
+	}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEmptyServiceServer(srv.Server(), cs)
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	})
+	emptyClient := testpb.NewEmptyServiceClient(conn)
+	echoClient := testpb.NewEchoServiceClient(conn)
+
+	const callers = 10
+	var allowed, rejected uint32
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				// methods without a limit are not affected
+				_, err := echoClient.EchoCall(context.Background(), &testpb.Echo{})
+				assert.NoError(t, err)
+
+				_, err = emptyClient.EmptyCall(context.Background(), &testpb.Empty{})
+				if err == nil {
+					atomic.AddUint32(&allowed, 1)
+					continue
+				}
+				atomic.AddUint32(&rejected, 1)
+				st := status.Convert(err)
+				assert.Equal(t, codes.ResourceExhausted, st.Code())
+				assert.Equal(t, "concurrency limit of 2 reached for method /EmptyService/EmptyCall", st.Message())
+				if assert.Len(t, st.Details(), 1) {
+					retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+					if assert.True(t, ok) {
+						delay, err := ptypes.Duration(retryInfo.RetryDelay)
+						assert.NoError(t, err)
+						assert.True(t, delay > 0, "unexpected retry delay %s", delay)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(2), atomic.LoadInt32(&cs.max))
+	require.NotZero(t, allowed)
+	require.NotZero(t, rejected)
+	require.Equal(t, uint32(callers*10), allowed+rejected)
+
+	// the slots are released once the calls complete
+	_, err := emptyClient.EmptyCall(context.Background(), &testpb.Empty{})
+	require.NoError(t, err)
+}
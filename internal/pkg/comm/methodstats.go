@@ -0,0 +1,157 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger/fabric/common/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// MethodStats holds the call statistics of a single gRPC method
+type MethodStats struct {
+	// Calls is the total number of calls received
+	Calls uint64
+	// InFlight is the number of calls currently being handled
+	InFlight int64
+}
+
+type methodCounters struct {
+	calls    uint64
+	inFlight int64
+}
+
+// MethodStatsRecorder records per method call counts and in-flight calls
+// through interceptors. It should be set in the ServerConfig in order for the
+// statistics to be available from GRPCServer.MethodStats. Metrics that are
+// nil are not reported; the statistics are kept regardless.
+type MethodStatsRecorder struct {
+	CallsCounter  metrics.Counter
+	InFlightGauge metrics.Gauge
+	// CompletedCounter and DurationHistogram record the completed calls and
+	// their duration by status code
+	CompletedCounter  metrics.Counter
+	DurationHistogram metrics.Histogram
+
+	lock     sync.RWMutex
+	counters map[string]*methodCounters
+}
+
+func (r *MethodStatsRecorder) countersFor(fullMethod string) *methodCounters {
+	r.lock.RLock()
+	c, ok := r.counters[fullMethod]
+	r.lock.RUnlock()
+	if ok {
+		return c
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.counters == nil {
+		r.counters = map[string]*methodCounters{}
+	}
+	if c, ok = r.counters[fullMethod]; !ok {
+		c = &methodCounters{}
+		r.counters[fullMethod] = c
+	}
+	return c
+}
+
+// begin records the start of a call and returns the function that records
+// its completion with the error it returned, emitting the metrics with
+// emitter
+func (r *MethodStatsRecorder) begin(fullMethod string, emitter *metricsEmitter) func(error) {
+	c := r.countersFor(fullMethod)
+	service, method := serviceMethod(fullMethod)
+	start := time.Now()
+
+	atomic.AddUint64(&c.calls, 1)
+	atomic.AddInt64(&c.inFlight, 1)
+	emitter.emit(func() {
+		if r.CallsCounter != nil {
+			r.CallsCounter.With("service", service, "method", method).Add(1)
+		}
+		if r.InFlightGauge != nil {
+			r.InFlightGauge.With("service", service, "method", method).Add(1)
+		}
+	})
+
+	return func(err error) {
+		duration := time.Since(start)
+		code := status.Code(err).String()
+		atomic.AddInt64(&c.inFlight, -1)
+		emitter.emit(func() {
+			if r.InFlightGauge != nil {
+				r.InFlightGauge.With("service", service, "method", method).Add(-1)
+			}
+			if r.CompletedCounter != nil {
+				r.CompletedCounter.With("service", service, "method", method, "code", code).Add(1)
+			}
+			if r.DurationHistogram != nil {
+				r.DurationHistogram.With("service", service, "method", method, "code", code).Observe(duration.Seconds())
+			}
+		})
+	}
+}
+
+// UnaryServerInterceptor returns an interceptor that records unary calls
+func (r *MethodStatsRecorder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return r.unaryServerInterceptor(syncMetricsEmitter)
+}
+
+func (r *MethodStatsRecorder) unaryServerInterceptor(emitter *metricsEmitter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		end := r.begin(info.FullMethod, emitter)
+		defer func() { end(err) }()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that records streaming calls
+func (r *MethodStatsRecorder) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return r.streamServerInterceptor(syncMetricsEmitter)
+}
+
+func (r *MethodStatsRecorder) streamServerInterceptor(emitter *metricsEmitter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		end := r.begin(info.FullMethod, emitter)
+		defer func() { end(err) }()
+		return handler(srv, ss)
+	}
+}
+
+// Stats returns a snapshot of the statistics keyed by full method name
+func (r *MethodStatsRecorder) Stats() map[string]MethodStats {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	stats := make(map[string]MethodStats, len(r.counters))
+	for fullMethod, c := range r.counters {
+		stats[fullMethod] = MethodStats{
+			Calls:    atomic.LoadUint64(&c.calls),
+			InFlight: atomic.LoadInt64(&c.inFlight),
+		}
+	}
+	return stats
+}
+
+// serviceMethod splits a full method name into its service and method
+// components
+func serviceMethod(fullMethod string) (service, method string) {
+	normalizedMethod := strings.Replace(fullMethod, ".", "_", -1)
+	parts := strings.SplitN(normalizedMethod, "/", -1)
+	if len(parts) != 3 {
+		return "unknown", "unknown"
+	}
+	return parts[1], parts[2]
+}
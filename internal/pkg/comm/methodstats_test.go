@@ -0,0 +1,188 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type blockingEmptyServiceServer struct {
+	emptyServiceServer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (bs *blockingEmptyServiceServer) EmptyCall(context.Context, *testpb.Empty) (*testpb.Empty, error) {
+	bs.entered <- struct{}{}
+	<-bs.release
+	return new(testpb.Empty), nil
+}
+
+func TestMethodStatsRecorderGRPCServer(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	callsCounter := &metricsfakes.Counter{}
+	callsCounter.WithReturns(callsCounter)
+	inFlightGauge := &metricsfakes.Gauge{}
+	inFlightGauge.WithReturns(inFlightGauge)
+	completedCounter := &metricsfakes.Counter{}
+	completedCounter.WithReturns(completedCounter)
+	durationHistogram := &metricsfakes.Histogram{}
+	durationHistogram.WithReturns(durationHistogram)
+	fakeProvider := &metricsfakes.Provider{}
+	fakeProvider.NewCounterReturnsOnCall(0, callsCounter)
+	fakeProvider.NewCounterReturnsOnCall(1, completedCounter)
+	fakeProvider.NewGaugeReturns(inFlightGauge)
+	fakeProvider.NewHistogramReturns(durationHistogram)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	gt.Expect(err).NotTo(HaveOccurred())
+	srv, err := comm.NewGRPCServerFromListener(listener, comm.ServerConfig{
+		MethodStatsRecorder: comm.NewMethodStatsRecorder(fakeProvider),
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(srv.MethodStats()).To(BeEmpty())
+
+	svc := &blockingEmptyServiceServer{
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	testpb.RegisterEmptyServiceServer(srv.Server(), svc)
+	go srv.Start()
+	defer srv.Stop()
+
+	const concurrency = 10
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := invokeEmptyCall(listener.Addr().String(), grpc.WithBlock(), grpc.WithInsecure())
+			gt.Expect(err).NotTo(HaveOccurred())
+		}()
+	}
+	for i := 0; i < concurrency; i++ {
+		<-svc.entered
+	}
+
+	const fullMethod = "/EmptyService/EmptyCall"
+	gt.Expect(srv.MethodStats()).To(Equal(map[string]comm.MethodStats{
+		fullMethod: {Calls: concurrency, InFlight: concurrency},
+	}))
+
+	close(svc.release)
+	wg.Wait()
+
+	gt.Expect(srv.MethodStats()).To(Equal(map[string]comm.MethodStats{
+		fullMethod: {Calls: concurrency, InFlight: 0},
+	}))
+	gt.Eventually(callsCounter.AddCallCount, time.Second).Should(Equal(concurrency))
+	gt.Expect(callsCounter.WithArgsForCall(0)).To(Equal([]string{"service", "EmptyService", "method", "EmptyCall"}))
+	gt.Eventually(inFlightGauge.AddCallCount, time.Second).Should(Equal(2 * concurrency))
+	var inFlight float64
+	for i := 0; i < inFlightGauge.AddCallCount(); i++ {
+		inFlight += inFlightGauge.AddArgsForCall(i)
+	}
+	gt.Expect(inFlight).To(BeZero())
+	gt.Eventually(completedCounter.AddCallCount, time.Second).Should(Equal(concurrency))
+	gt.Expect(completedCounter.WithArgsForCall(0)).To(Equal([]string{"service", "EmptyService", "method", "EmptyCall", "code", "OK"}))
+	gt.Eventually(durationHistogram.ObserveCallCount, time.Second).Should(Equal(concurrency))
+	gt.Expect(durationHistogram.WithArgsForCall(0)).To(Equal([]string{"service", "EmptyService", "method", "EmptyCall", "code", "OK"}))
+	gt.Expect(durationHistogram.ObserveArgsForCall(0)).To(BeNumerically(">", 0))
+}
+
+func TestMethodStatsRecorderPanic(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	recorder := comm.NewMethodStatsRecorder(&disabled.Provider{})
+	unary := recorder.UnaryServerInterceptor()
+	stream := recorder.StreamServerInterceptor()
+
+	gt.Expect(func() {
+		unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/unary"}, func(context.Context, interface{}) (interface{}, error) {
+			panic("handler panic")
+		})
+	}).To(Panic())
+	gt.Expect(func() {
+		stream(nil, nil, &grpc.StreamServerInfo{FullMethod: "/svc/stream"}, func(interface{}, grpc.ServerStream) error {
+			panic("handler panic")
+		})
+	}).To(Panic())
+
+	gt.Expect(recorder.Stats()).To(Equal(map[string]comm.MethodStats{
+		"/svc/unary":  {Calls: 1, InFlight: 0},
+		"/svc/stream": {Calls: 1, InFlight: 0},
+	}))
+}
+
+func TestNewMethodStatsRecorderMetrics(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	fakeProvider := &metricsfakes.Provider{}
+	comm.NewMethodStatsRecorder(fakeProvider)
+
+	gt.Expect(fakeProvider.NewCounterCallCount()).To(Equal(2))
+	calls := fakeProvider.NewCounterArgsForCall(0)
+	gt.Expect(calls.Namespace + "_" + calls.Subsystem + "_" + calls.Name).To(Equal("grpc_comm_method_calls"))
+	gt.Expect(calls.LabelNames).To(Equal([]string{"service", "method"}))
+	completed := fakeProvider.NewCounterArgsForCall(1)
+	gt.Expect(completed.Namespace + "_" + completed.Subsystem + "_" + completed.Name).To(Equal("grpc_comm_method_calls_completed"))
+	gt.Expect(completed.LabelNames).To(Equal([]string{"service", "method", "code"}))
+	gt.Expect(completed.StatsdFormat).To(Equal("%{#fqname}.%{service}.%{method}.%{code}"))
+
+	gt.Expect(fakeProvider.NewGaugeCallCount()).To(Equal(1))
+	gt.Expect(fakeProvider.NewGaugeArgsForCall(0).Name).To(Equal("method_in_flight"))
+
+	gt.Expect(fakeProvider.NewHistogramCallCount()).To(Equal(1))
+	duration := fakeProvider.NewHistogramArgsForCall(0)
+	gt.Expect(duration.Namespace + "_" + duration.Subsystem + "_" + duration.Name).To(Equal("grpc_comm_method_call_duration"))
+	gt.Expect(duration.LabelNames).To(Equal([]string{"service", "method", "code"}))
+	gt.Expect(duration.StatsdFormat).To(Equal("%{#fqname}.%{service}.%{method}.%{code}"))
+}
+
+func TestMethodStatsRecorderCodes(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	completedCounter := &metricsfakes.Counter{}
+	completedCounter.WithReturns(completedCounter)
+	recorder := comm.NewMethodStatsRecorder(&disabled.Provider{})
+	recorder.CompletedCounter = completedCounter
+	recorder.DurationHistogram = nil
+
+	unary := recorder.UnaryServerInterceptor()
+	_, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/unary"}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "missing")
+	})
+	gt.Expect(err).To(HaveOccurred())
+	stream := recorder.StreamServerInterceptor()
+	err = stream(nil, nil, &grpc.StreamServerInfo{FullMethod: "/svc/stream"}, func(interface{}, grpc.ServerStream) error {
+		return errors.New("not a status")
+	})
+	gt.Expect(err).To(HaveOccurred())
+
+	gt.Eventually(completedCounter.AddCallCount, time.Second).Should(Equal(2))
+	gt.Expect(completedCounter.WithArgsForCall(0)).To(Equal([]string{"service", "svc", "method", "unary", "code", "NotFound"}))
+	gt.Expect(completedCounter.WithArgsForCall(1)).To(Equal([]string{"service", "svc", "method", "stream", "code", "Unknown"}))
+}
@@ -6,7 +6,23 @@ SPDX-License-Identifier: Apache-2.0
 
 package comm
 
-import "github.com/hyperledger/fabric/common/metrics"
+import (
+	"github.com/hyperledger/fabric/common/metrics"
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+)
+
+// NoopMetricProvider is a metrics.Provider whose metrics discard all
+// updates. The constructors below use it in place of a nil provider, so
+// that metrics can be turned off without changing the server configuration.
+var NoopMetricProvider metrics.Provider = &disabled.Provider{}
+
+// providerOrNoop returns p, or NoopMetricProvider if p is nil
+func providerOrNoop(p metrics.Provider) metrics.Provider {
+	if p == nil {
+		return NoopMetricProvider
+	}
+	return p
+}
 
 var (
 	openConnCounterOpts = metrics.CounterOpts{
@@ -22,11 +38,182 @@ var (
 		Name:      "conn_closed",
 		Help:      "gRPC connections closed. Open minus closed is the active number of connections.",
 	}
+
+	methodCallsCounterOpts = metrics.CounterOpts{
+		Namespace:    "grpc",
+		Subsystem:    "comm",
+		Name:         "method_calls",
+		Help:         "The number of calls received by a gRPC method.",
+		LabelNames:   []string{"service", "method"},
+		StatsdFormat: "%{#fqname}.%{service}.%{method}",
+	}
+
+	methodInFlightGaugeOpts = metrics.GaugeOpts{
+		Namespace:    "grpc",
+		Subsystem:    "comm",
+		Name:         "method_in_flight",
+		Help:         "The number of calls currently being handled by a gRPC method.",
+		LabelNames:   []string{"service", "method"},
+		StatsdFormat: "%{#fqname}.%{service}.%{method}",
+	}
+
+	methodCallsCompletedCounterOpts = metrics.CounterOpts{
+		Namespace:    "grpc",
+		Subsystem:    "comm",
+		Name:         "method_calls_completed",
+		Help:         "The number of calls completed by a gRPC method.",
+		LabelNames:   []string{"service", "method", "code"},
+		StatsdFormat: "%{#fqname}.%{service}.%{method}.%{code}",
+	}
+
+	methodCallDurationHistogramOpts = metrics.HistogramOpts{
+		Namespace:    "grpc",
+		Subsystem:    "comm",
+		Name:         "method_call_duration",
+		Help:         "The time in seconds to complete a call to a gRPC method.",
+		LabelNames:   []string{"service", "method", "code"},
+		StatsdFormat: "%{#fqname}.%{service}.%{method}.%{code}",
+	}
+
+	orgRPCsCounterOpts = metrics.CounterOpts{
+		Namespace:    "grpc",
+		Subsystem:    "comm",
+		Name:         "org_rpcs",
+		Help:         "The number of RPCs received from clients of an org.",
+		LabelNames:   []string{"org"},
+		StatsdFormat: "%{#fqname}.%{org}",
+	}
+
+	orgBytesReceivedCounterOpts = metrics.CounterOpts{
+		Namespace:    "grpc",
+		Subsystem:    "comm",
+		Name:         "org_bytes_received",
+		Help:         "The number of bytes received from clients of an org.",
+		LabelNames:   []string{"org"},
+		StatsdFormat: "%{#fqname}.%{org}",
+	}
+
+	orgBytesSentCounterOpts = metrics.CounterOpts{
+		Namespace:    "grpc",
+		Subsystem:    "comm",
+		Name:         "org_bytes_sent",
+		Help:         "The number of bytes sent to clients of an org.",
+		LabelNames:   []string{"org"},
+		StatsdFormat: "%{#fqname}.%{org}",
+	}
+
+	tlsPolicyDryRunRejectionsCounterOpts = metrics.CounterOpts{
+		Namespace: "grpc",
+		Subsystem: "comm",
+		Name:      "tls_policy_dry_run_rejections",
+		Help:      "The number of TLS handshakes that would have been rejected by the certificate policy.",
+	}
+
+	expiredClientCertCounterOpts = metrics.CounterOpts{
+		Namespace: "grpc",
+		Subsystem: "comm",
+		Name:      "tls_expired_client_certs",
+		Help:      "The number of TLS handshakes rejected because the client certificate expired.",
+	}
+
+	tlsDowngradesCounterOpts = metrics.CounterOpts{
+		Namespace: "grpc",
+		Subsystem: "comm",
+		Name:      "tls_downgrades",
+		Help:      "The number of TLS connections flagged because the client negotiated a lower TLS version than before.",
+	}
+
+	perIPConnRejectedCounterOpts = metrics.CounterOpts{
+		Namespace: "grpc",
+		Subsystem: "comm",
+		Name:      "conn_per_ip_rejected",
+		Help:      "The number of connections closed because their client IP reached the limit of concurrent connections.",
+	}
+
+	responseTooLargeCounterOpts = metrics.CounterOpts{
+		Namespace:    "grpc",
+		Subsystem:    "comm",
+		Name:         "client_responses_too_large",
+		Help:         "The number of responses to a gRPC method rejected by clients for exceeding the maximum size.",
+		LabelNames:   []string{"service", "method", "conn"},
+		StatsdFormat: "%{#fqname}.%{service}.%{method}.%{conn}",
+	}
+
+	receivedMessageSizeHistogramOpts = metrics.HistogramOpts{
+		Namespace:    "grpc",
+		Subsystem:    "comm",
+		Name:         "received_message_size",
+		Help:         "The size in bytes of the messages received by a gRPC method.",
+		Buckets:      messageSizeBuckets,
+		LabelNames:   []string{"service", "method"},
+		StatsdFormat: "%{#fqname}.%{service}.%{method}",
+	}
+
+	sentMessageSizeHistogramOpts = metrics.HistogramOpts{
+		Namespace:    "grpc",
+		Subsystem:    "comm",
+		Name:         "sent_message_size",
+		Help:         "The size in bytes of the messages sent by a gRPC method.",
+		Buckets:      messageSizeBuckets,
+		LabelNames:   []string{"service", "method"},
+		StatsdFormat: "%{#fqname}.%{service}.%{method}",
+	}
+
+	// 256B to 64MiB in powers of 4, and the default maximum message size
+	messageSizeBuckets = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216, 67108864, 104857600}
 )
 
 func NewServerStatsHandler(p metrics.Provider) *ServerStatsHandler {
+	p = providerOrNoop(p)
 	return &ServerStatsHandler{
 		OpenConnCounter:   p.NewCounter(openConnCounterOpts),
 		ClosedConnCounter: p.NewCounter(closedConnCounterOpts),
 	}
 }
+
+func NewMethodStatsRecorder(p metrics.Provider) *MethodStatsRecorder {
+	p = providerOrNoop(p)
+	return &MethodStatsRecorder{
+		CallsCounter:      p.NewCounter(methodCallsCounterOpts),
+		InFlightGauge:     p.NewGauge(methodInFlightGaugeOpts),
+		CompletedCounter:  p.NewCounter(methodCallsCompletedCounterOpts),
+		DurationHistogram: p.NewHistogram(methodCallDurationHistogramOpts),
+	}
+}
+
+func NewOrgStatsHandler(p metrics.Provider) *OrgStatsHandler {
+	p = providerOrNoop(p)
+	return &OrgStatsHandler{
+		RPCsCounter:          p.NewCounter(orgRPCsCounterOpts),
+		BytesReceivedCounter: p.NewCounter(orgBytesReceivedCounterOpts),
+		BytesSentCounter:     p.NewCounter(orgBytesSentCounterOpts),
+	}
+}
+
+func NewTLSPolicyDryRunCounter(p metrics.Provider) metrics.Counter {
+	return providerOrNoop(p).NewCounter(tlsPolicyDryRunRejectionsCounterOpts)
+}
+
+func NewExpiredClientCertCounter(p metrics.Provider) metrics.Counter {
+	return providerOrNoop(p).NewCounter(expiredClientCertCounterOpts)
+}
+
+func NewTLSDowngradeCounter(p metrics.Provider) metrics.Counter {
+	return providerOrNoop(p).NewCounter(tlsDowngradesCounterOpts)
+}
+
+func NewPerIPConnRejectedCounter(p metrics.Provider) metrics.Counter {
+	return providerOrNoop(p).NewCounter(perIPConnRejectedCounterOpts)
+}
+
+func NewResponseTooLargeCounter(p metrics.Provider) metrics.Counter {
+	return providerOrNoop(p).NewCounter(responseTooLargeCounterOpts)
+}
+
+func NewMessageSizeStatsHandler(p metrics.Provider) *MessageSizeStatsHandler {
+	p = providerOrNoop(p)
+	return &MessageSizeStatsHandler{
+		ReceivedSizeHistogram: p.NewHistogram(receivedMessageSizeHistogramOpts),
+		SentSizeHistogram:     p.NewHistogram(sentMessageSizeHistogramOpts),
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestNilMetricProvider(t *testing.T) {
+	t.Parallel()
+
+	require.NotNil(t, comm.NewTLSPolicyDryRunCounter(nil))
+	require.NotNil(t, comm.NewExpiredClientCertCounter(nil))
+	require.NotNil(t, comm.NewPerIPConnRejectedCounter(nil))
+	require.NotNil(t, comm.NewResponseTooLargeCounter(nil))
+
+	testMetricsDisabled(t, comm.ServerConfig{
+		ServerStatsHandler:       comm.NewServerStatsHandler(nil),
+		MethodStatsRecorder:      comm.NewMethodStatsRecorder(nil),
+		OrgStatsHandler:          comm.NewOrgStatsHandler(nil),
+		MessageSizeStatsHandler:  comm.NewMessageSizeStatsHandler(nil),
+		TLSPolicyDryRunCounter:   comm.NewTLSPolicyDryRunCounter(nil),
+		ExpiredClientCertCounter: comm.NewExpiredClientCertCounter(nil),
+	})
+}
+
+func TestNilMetrics(t *testing.T) {
+	t.Parallel()
+
+	testMetricsDisabled(t, comm.ServerConfig{
+		ServerStatsHandler:      &comm.ServerStatsHandler{},
+		MethodStatsRecorder:     &comm.MethodStatsRecorder{},
+		OrgStatsHandler:         &comm.OrgStatsHandler{},
+		MessageSizeStatsHandler: &comm.MessageSizeStatsHandler{},
+	})
+}
+
+// testMetricsDisabled checks that a server with the metrics of config
+// serves unary and streaming calls and keeps its method statistics
+func testMetricsDisabled(t *testing.T, config comm.ServerConfig) {
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", config)
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(srv.Address(), grpc.WithInsecure(), grpc.WithBlock())
+	require.NoError(t, err)
+	defer conn.Close()
+	client := testpb.NewEmptyServiceClient(conn)
+
+	_, err = client.EmptyCall(context.Background(), &testpb.Empty{})
+	require.NoError(t, err)
+	stream, err := client.EmptyStream(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&testpb.Empty{}))
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+
+	require.Equal(t, uint64(1), srv.MethodStats()["/EmptyService/EmptyCall"].Calls)
+}
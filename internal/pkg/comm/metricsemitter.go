@@ -0,0 +1,130 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"google.golang.org/grpc/stats"
+)
+
+// metricsQueueSize is the number of metric updates an emitter buffers while
+// the metrics provider is busy
+const metricsQueueSize = 1024
+
+// metricsEmitter applies metric updates, recovering from the panics of a
+// misbehaving metrics provider so that they cannot crash the RPC path. The
+// panicking update is skipped and the first panic is logged.
+//
+// Emitters created by newMetricsEmitter queue the updates and apply them on
+// a single goroutine, started with the first update and stopped when done
+// is closed, so that a slow or blocked provider cannot block the RPC path
+// either. The updates emitted while the queue is full, or once done is
+// closed, are dropped and counted. The zero value applies the updates
+// synchronously and logs to the comm logger; it is only used by the
+// components emitting metrics outside of a server.
+type metricsEmitter struct {
+	logger *flogging.FabricLogger
+	done   <-chan struct{}
+
+	startOnce sync.Once
+	queue     chan func()
+	dropped   uint64
+	dropOnce  sync.Once
+	panicOnce sync.Once
+}
+
+// newMetricsEmitter returns an emitter applying the updates on a goroutine
+// until done is closed
+func newMetricsEmitter(logger *flogging.FabricLogger, done <-chan struct{}) *metricsEmitter {
+	return &metricsEmitter{
+		logger: logger,
+		done:   done,
+		queue:  make(chan func(), metricsQueueSize),
+	}
+}
+
+// emit applies update, without blocking if the emitter has a queue
+func (e *metricsEmitter) emit(update func()) {
+	if e.queue == nil {
+		e.apply(update)
+		return
+	}
+	e.startOnce.Do(func() { go e.run() })
+
+	select {
+	case <-e.done:
+		atomic.AddUint64(&e.dropped, 1)
+	case e.queue <- update:
+	default:
+		atomic.AddUint64(&e.dropped, 1)
+		e.dropOnce.Do(func() {
+			e.log().Warning("Metrics provider is not keeping up, dropping metric updates")
+		})
+	}
+}
+
+func (e *metricsEmitter) run() {
+	for {
+		select {
+		case update := <-e.queue:
+			e.apply(update)
+		case <-e.done:
+			if dropped := atomic.LoadUint64(&e.dropped); dropped > 0 {
+				e.log().Warningf("Dropped %d metric updates the metrics provider did not keep up with", dropped)
+			}
+			return
+		}
+	}
+}
+
+func (e *metricsEmitter) apply(update func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.panicOnce.Do(func() {
+				e.log().Errorf("Metrics provider panicked, skipping the metric update; further panics are not logged: %v", r)
+			})
+		}
+	}()
+	update()
+}
+
+func (e *metricsEmitter) log() *flogging.FabricLogger {
+	if e.logger == nil {
+		return commLogger
+	}
+	return e.logger
+}
+
+type metricsEmitterKey struct{}
+
+// syncMetricsEmitter applies the updates of the stats handlers used outside
+// of a server
+var syncMetricsEmitter = &metricsEmitter{}
+
+// emitterFromContext returns the emitter of the server the context of a
+// connection or an RPC belongs to
+func emitterFromContext(ctx context.Context) *metricsEmitter {
+	if e, ok := ctx.Value(metricsEmitterKey{}).(*metricsEmitter); ok {
+		return e
+	}
+	return syncMetricsEmitter
+}
+
+// emittingStatsHandler adds the emitter of a server to the contexts of its
+// connections, for its stats handlers to emit their metrics with
+type emittingStatsHandler struct {
+	stats.Handler
+	emitter *metricsEmitter
+}
+
+func (h *emittingStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return h.Handler.TagConn(context.WithValue(ctx, metricsEmitterKey{}, h.emitter), info)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+)
+
+func TestMetricsProviderPanics(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	counter := &metricsfakes.Counter{}
+	counter.WithReturns(counter)
+	counter.AddStub = func(float64) { panic("registry is broken") }
+	gauge := &metricsfakes.Gauge{}
+	gauge.WithReturns(gauge)
+	gauge.AddStub = func(float64) { panic("registry is broken") }
+	provider := &metricsfakes.Provider{}
+	provider.NewCounterReturns(counter)
+	provider.NewGaugeReturns(gauge)
+
+	_, conn := newTestServer(t, comm.ServerConfig{
+		ServerStatsHandler:  comm.NewServerStatsHandler(provider),
+		OrgStatsHandler:     comm.NewOrgStatsHandler(provider),
+		MethodStatsRecorder: comm.NewMethodStatsRecorder(provider),
+	}, registerEmptyService)
+	client := testpb.NewEmptyServiceClient(conn)
+	for i := 0; i < 10; i++ {
+		_, err := client.EmptyCall(context.Background(), &testpb.Empty{})
+		gt.Expect(err).NotTo(HaveOccurred())
+	}
+
+	// the panicking updates are skipped while the next ones are still
+	// applied: every call is counted by the method stats recorder
+	gt.Eventually(counter.AddCallCount, time.Second).Should(BeNumerically(">=", 10))
+	gt.Eventually(gauge.AddCallCount, time.Second).Should(BeNumerically(">=", 10))
+}
+
+func TestMetricsProviderBlocks(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	counter := &metricsfakes.Counter{}
+	counter.WithReturns(counter)
+	counter.AddStub = func(float64) { <-release }
+	gauge := &metricsfakes.Gauge{}
+	gauge.WithReturns(gauge)
+	provider := &metricsfakes.Provider{}
+	provider.NewCounterReturns(counter)
+	provider.NewGaugeReturns(gauge)
+
+	warnings := &recordedWarnings{}
+	_, conn := newTestServer(t, comm.ServerConfig{
+		ServerStatsHandler:  comm.NewServerStatsHandler(provider),
+		OrgStatsHandler:     comm.NewOrgStatsHandler(provider),
+		MethodStatsRecorder: comm.NewMethodStatsRecorder(provider),
+		Logger:              warnings.logger(),
+	}, registerEmptyService)
+	client := testpb.NewEmptyServiceClient(conn)
+
+	// the calls complete while the provider is blocked, until well after
+	// the queue of the updates is full
+	for i := 0; i < 1000; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := client.EmptyCall(ctx, &testpb.Empty{})
+		cancel()
+		gt.Expect(err).NotTo(HaveOccurred())
+	}
+	gt.Expect(warnings.get()).To(ContainElement("Metrics provider is not keeping up, dropping metric updates"))
+}
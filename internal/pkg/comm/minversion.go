@@ -0,0 +1,73 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MinClientVersionUnaryInterceptor returns a unary server interceptor
+// rejecting the calls of clients older than minVersion with
+// FailedPrecondition. Clients send their version in the metadataKey
+// metadata; calls without a valid version are rejected as well, since they
+// come from clients predating the header. Versions are compared following
+// semantic versioning, so 2.10.0 is newer than 2.9.0 and pre-releases such
+// as 2.0.0-rc1 are older than 2.0.0. It panics if minVersion is not a valid
+// version.
+func MinClientVersionUnaryInterceptor(minVersion string, metadataKey string) grpc.UnaryServerInterceptor {
+	check := newClientVersionCheck(minVersion, metadataKey)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := check(ctx); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// MinClientVersionStreamInterceptor is the streaming counterpart of
+// MinClientVersionUnaryInterceptor
+func MinClientVersionStreamInterceptor(minVersion string, metadataKey string) grpc.StreamServerInterceptor {
+	check := newClientVersionCheck(minVersion, metadataKey)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := check(ss.Context()); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func newClientVersionCheck(minVersion string, metadataKey string) func(ctx context.Context) error {
+	min, err := version.NewSemver(minVersion)
+	if err != nil {
+		panic(fmt.Sprintf("invalid minimum client version %q: %s", minVersion, err))
+	}
+	metadataKey = strings.ToLower(metadataKey)
+
+	return func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(metadataKey)
+		if len(values) == 0 {
+			return status.Errorf(codes.FailedPrecondition, "client version is missing from metadata %s, the minimum supported version is %s", metadataKey, minVersion)
+		}
+		v, err := version.NewSemver(values[0])
+		if err != nil {
+			return status.Errorf(codes.FailedPrecondition, "invalid client version %q in metadata %s", values[0], metadataKey)
+		}
+		if v.LessThan(min) {
+			return status.Errorf(codes.FailedPrecondition, "client version %s is older than the minimum supported version %s", values[0], minVersion)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (cs *contextServerStream) Context() context.Context {
+	return cs.ctx
+}
+
+func TestMinClientVersionInterceptor(t *testing.T) {
+	t.Parallel()
+
+	unary := comm.MinClientVersionUnaryInterceptor("2.3.0", "X-Client-Version")
+	stream := comm.MinClientVersionStreamInterceptor("2.3.0", "X-Client-Version")
+
+	tests := []struct {
+		name    string
+		md      metadata.MD
+		errMsg  string
+		allowed bool
+	}{
+		{name: "same version", md: metadata.Pairs("x-client-version", "2.3.0"), allowed: true},
+		{name: "newer patch", md: metadata.Pairs("x-client-version", "2.3.1"), allowed: true},
+		{name: "newer minor compared numerically", md: metadata.Pairs("x-client-version", "2.10.0"), allowed: true},
+		{name: "newer major with prefix", md: metadata.Pairs("x-client-version", "v3.0.0"), allowed: true},
+		{
+			name:   "older minor",
+			md:     metadata.Pairs("x-client-version", "2.2.9"),
+			errMsg: "client version 2.2.9 is older than the minimum supported version 2.3.0",
+		},
+		{
+			name:   "pre-release of the minimum",
+			md:     metadata.Pairs("x-client-version", "2.3.0-rc1"),
+			errMsg: "client version 2.3.0-rc1 is older than the minimum supported version 2.3.0",
+		},
+		{
+			name:   "missing",
+			md:     metadata.Pairs("other", "value"),
+			errMsg: "client version is missing from metadata x-client-version, the minimum supported version is 2.3.0",
+		},
+		{
+			name:   "invalid",
+			md:     metadata.Pairs("x-client-version", "latest"),
+			errMsg: `invalid client version "latest" in metadata x-client-version`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			called := false
+			_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/method"}, func(context.Context, interface{}) (interface{}, error) {
+				called = true
+				return nil, nil
+			})
+			streamErr := stream(nil, &contextServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/svc/stream"}, func(interface{}, grpc.ServerStream) error {
+				return nil
+			})
+
+			if tt.allowed {
+				require.NoError(t, err)
+				require.NoError(t, streamErr)
+				require.True(t, called)
+				return
+			}
+			require.False(t, called)
+			for _, err := range []error{err, streamErr} {
+				require.Equal(t, codes.FailedPrecondition, status.Code(err))
+				require.Equal(t, tt.errMsg, status.Convert(err).Message())
+			}
+		})
+	}
+}
+
+func TestMinClientVersionInterceptorInvalidMinimum(t *testing.T) {
+	t.Parallel()
+
+	require.PanicsWithValue(t, `invalid minimum client version "two": Malformed version: two`, func() {
+		comm.MinClientVersionUnaryInterceptor("two", "x-client-version")
+	})
+}
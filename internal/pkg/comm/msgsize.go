@@ -0,0 +1,153 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recvMsgSizeLimiter enforces separate limits on the encoded size of the
+// messages received by unary and streaming RPCs. The limit gRPC enforces on
+// every message is set to the larger of the two, so the limiter only has to
+// reject the messages exceeding the smaller one.
+//
+// The limit of a message depends on its call, which codecs do not know, so
+// the limiter is also a codec deferring the unmarshaling of the messages
+// larger than the smaller limit. Its interceptors, which run before any
+// other, check the encoded size of the deferred messages against the limit
+// of their call and only unmarshal the ones within it. The codec must
+// therefore never be used without the interceptors.
+type recvMsgSizeLimiter struct {
+	codec interface {
+		Marshal(v interface{}) ([]byte, error)
+		Unmarshal(data []byte, v interface{}) error
+	}
+	unary     int
+	streaming int
+	// skipOversized makes streams skip the messages exceeding the streaming
+	// limit instead of failing
+	skipOversized bool
+	// hints, if not nil, let verified calls raise their limit
+	hints  *RecvMsgSizeHints
+	logger *flogging.FabricLogger
+
+	// deferred maps the messages that were not unmarshaled to their
+	// encoded data
+	deferred sync.Map
+}
+
+func newRecvMsgSizeLimiter(unary, streaming int) *recvMsgSizeLimiter {
+	if unary <= 0 {
+		unary = MaxRecvMsgSize
+	}
+	if streaming <= 0 {
+		streaming = MaxRecvMsgSize
+	}
+	return &recvMsgSizeLimiter{unary: unary, streaming: streaming}
+}
+
+// grpcLimit returns the limit gRPC must enforce on all messages. Messages
+// to be skipped must get through gRPC, so when skipping the limit is at
+// least MaxRecvMsgSize, and so must the messages of calls raising their
+// limit with a hint.
+func (l *recvMsgSizeLimiter) grpcLimit() int {
+	limit := l.streaming
+	if l.unary > limit {
+		limit = l.unary
+	}
+	if l.hints != nil && l.hints.Max > limit {
+		limit = l.hints.Max
+	}
+	if l.skipOversized && MaxRecvMsgSize > limit {
+		limit = MaxRecvMsgSize
+	}
+	return limit
+}
+
+func (l *recvMsgSizeLimiter) Marshal(v interface{}) ([]byte, error) {
+	return l.codec.Marshal(v)
+}
+
+func (l *recvMsgSizeLimiter) Unmarshal(data []byte, v interface{}) error {
+	if len(data) > l.unary || len(data) > l.streaming {
+		l.deferred.Store(v, data)
+		return nil
+	}
+	return l.codec.Unmarshal(data, v)
+}
+
+func (l *recvMsgSizeLimiter) String() string {
+	return "proto"
+}
+
+// unmarshalDeferred unmarshals msg if its unmarshaling was deferred and its
+// encoded size is within limit, and returns a ResourceExhausted error if it
+// is not
+func (l *recvMsgSizeLimiter) unmarshalDeferred(msg interface{}, limit int) error {
+	data, ok := l.deferred.Load(msg)
+	if !ok {
+		return nil
+	}
+	l.deferred.Delete(msg)
+	if size := len(data.([]byte)); size > limit {
+		return status.Errorf(codes.ResourceExhausted, "received message larger than max (%d vs. %d)", size, limit)
+	}
+	if err := l.codec.Unmarshal(data.([]byte), msg); err != nil {
+		return status.Errorf(codes.Internal, "grpc: failed to unmarshal the received message %v", err)
+	}
+	// the payload checker records the rejections instead of failing
+	if checker, ok := l.codec.(*payloadChecker); ok {
+		return checker.takeRejection(msg)
+	}
+	return nil
+}
+
+func (l *recvMsgSizeLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.unmarshalDeferred(req, l.hintedLimit(ctx, info.FullMethod, l.unary)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (l *recvMsgSizeLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &sizeLimitedServerStream{
+			ServerStream: ss,
+			limiter:      l,
+			fullMethod:   info.FullMethod,
+			limit:        l.hintedLimit(ss.Context(), info.FullMethod, l.streaming),
+		})
+	}
+}
+
+type sizeLimitedServerStream struct {
+	grpc.ServerStream
+	limiter    *recvMsgSizeLimiter
+	fullMethod string
+	limit      int
+}
+
+func (ss *sizeLimitedServerStream) RecvMsg(m interface{}) error {
+	for {
+		if err := ss.ServerStream.RecvMsg(m); err != nil {
+			return err
+		}
+		err := ss.limiter.unmarshalDeferred(m, ss.limit)
+		if err == nil || !ss.limiter.skipOversized || status.Code(err) != codes.ResourceExhausted {
+			return err
+		}
+		ss.limiter.logger.Warningf("Skipping message on stream %s: %s", ss.fullMethod, status.Convert(err).Message())
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// echoStreamDesc describes a bidi streaming service echoing testpb.Echo
+// messages, which testpb does not provide
+var echoStreamDesc = grpc.ServiceDesc{
+	ServiceName: "EchoStreamService",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "EchoStream",
+		ServerStreams: true,
+		ClientStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			for {
+				msg := &testpb.Echo{}
+				err := stream.RecvMsg(msg)
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := stream.SendMsg(msg); err != nil {
+					return err
+				}
+			}
+		},
+	}},
+}
+
+func echoStream(conn *grpc.ClientConn, payload []byte) error {
+	stream, err := conn.NewStream(context.Background(), &echoStreamDesc.Streams[0], "/EchoStreamService/EchoStream")
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(&testpb.Echo{Payload: payload}); err != nil {
+		return err
+	}
+	return stream.RecvMsg(&testpb.Echo{})
+}
+
+func TestRecvMsgSizeLimits(t *testing.T) {
+	t.Parallel()
+
+	_, conn := newTestServer(t, comm.ServerConfig{
+		MaxRecvMsgSizeUnary:     1024,
+		MaxRecvMsgSizeStreaming: 200 * 1024,
+	}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+		srv.Server().RegisterService(&echoStreamDesc, struct{}{})
+	})
+	client := testpb.NewEchoServiceClient(conn)
+
+	t.Run("unary within limit", func(t *testing.T) {
+		_, err := client.EchoCall(context.Background(), &testpb.Echo{Payload: make([]byte, 512)})
+		require.NoError(t, err)
+	})
+
+	t.Run("unary over limit", func(t *testing.T) {
+		_, err := client.EchoCall(context.Background(), &testpb.Echo{Payload: make([]byte, 100*1024)})
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.Equal(t, "received message larger than max (102404 vs. 1024)", status.Convert(err).Message())
+	})
+
+	t.Run("streaming within limit", func(t *testing.T) {
+		err := echoStream(conn, make([]byte, 100*1024))
+		require.NoError(t, err)
+	})
+
+	t.Run("streaming over limit", func(t *testing.T) {
+		err := echoStream(conn, make([]byte, 300*1024))
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.Contains(t, status.Convert(err).Message(), "received message larger than max (307204 vs. 204800)")
+	})
+}
+
+// sizeRecordingCodec records the size of the largest message it unmarshals
+type sizeRecordingCodec struct {
+	largest int64
+}
+
+func (c *sizeRecordingCodec) Marshal(v interface{}) ([]byte, error) {
+	return proto.Marshal(v.(proto.Message))
+}
+
+func (c *sizeRecordingCodec) Unmarshal(data []byte, v interface{}) error {
+	for {
+		largest := atomic.LoadInt64(&c.largest)
+		if int64(len(data)) <= largest || atomic.CompareAndSwapInt64(&c.largest, largest, int64(len(data))) {
+			break
+		}
+	}
+	return proto.Unmarshal(data, v.(proto.Message))
+}
+
+func (c *sizeRecordingCodec) String() string {
+	return "proto"
+}
+
+func TestRecvMsgSizeLimitsBeforeUnmarshaling(t *testing.T) {
+	t.Parallel()
+
+	codec := &sizeRecordingCodec{}
+	_, conn := newTestServer(t, comm.ServerConfig{
+		MaxRecvMsgSizeUnary:     200 * 1024,
+		MaxRecvMsgSizeStreaming: 1024,
+		Codec:                   codec,
+		PrecheckPayloads:        true,
+	}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+		srv.Server().RegisterService(&echoStreamDesc, struct{}{})
+	})
+	client := testpb.NewEchoServiceClient(conn)
+
+	err := echoStream(conn, make([]byte, 100*1024))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = client.EchoCall(context.Background(), &testpb.Echo{Payload: make([]byte, 300*1024)})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	// the messages over the limit of their call are never unmarshaled
+	require.Zero(t, atomic.LoadInt64(&codec.largest))
+
+	// the messages over the smaller limit are unmarshaled, and checked,
+	// once their call is known to accept them
+	_, err = client.EchoCall(context.Background(), &testpb.Echo{Payload: make([]byte, 100*1024)})
+	require.NoError(t, err)
+	require.Equal(t, int64(102404), atomic.LoadInt64(&codec.largest))
+	malformed := append([]byte{0x0a, 0xff, 0xff, 0x0f}, make([]byte, 2048)...)
+	err = conn.Invoke(context.Background(), "/EchoService/EchoCall", malformed, &testpb.Echo{}, grpc.ForceCodec(rawCodec{}))
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRecvMsgSizeLimitsStreamingSmaller(t *testing.T) {
+	t.Parallel()
+
+	_, conn := newTestServer(t, comm.ServerConfig{
+		MaxRecvMsgSizeStreaming: 1024,
+	}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+		srv.Server().RegisterService(&echoStreamDesc, struct{}{})
+	})
+
+	// unary calls keep the default limit
+	_, err := testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{Payload: make([]byte, 100*1024)})
+	require.NoError(t, err)
+
+	err = echoStream(conn, make([]byte, 2048))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, "received message larger than max (2051 vs. 1024)", status.Convert(err).Message())
+}
+
+func TestSkipOversizedStreamMessages(t *testing.T) {
+	t.Parallel()
+
+	warnings := &recordedWarnings{}
+	_, conn := newTestServer(t, comm.ServerConfig{
+		MaxRecvMsgSizeUnary:         1024,
+		MaxRecvMsgSizeStreaming:     1024,
+		SkipOversizedStreamMessages: true,
+		Logger:                      warnings.logger(),
+	}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+		srv.Server().RegisterService(&echoStreamDesc, struct{}{})
+	})
+
+	// unary calls are not affected
+	_, err := testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{Payload: make([]byte, 2048)})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	stream, err := conn.NewStream(context.Background(), &echoStreamDesc.Streams[0], "/EchoStreamService/EchoStream")
+	require.NoError(t, err)
+	for _, payload := range [][]byte{[]byte("first"), make([]byte, 2048), []byte("second"), []byte("third")} {
+		require.NoError(t, stream.SendMsg(&testpb.Echo{Payload: payload}))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	var echoed []string
+	for {
+		msg := &testpb.Echo{}
+		if err := stream.RecvMsg(msg); err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+		echoed = append(echoed, string(msg.Payload))
+	}
+	require.Equal(t, []string{"first", "second", "third"}, echoed)
+	require.Equal(t, []string{
+		"Skipping message on stream /EchoStreamService/EchoStream: received message larger than max (2051 vs. 1024)",
+	}, warnings.get())
+}
@@ -0,0 +1,70 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// RecvMsgSizeHintHeader is the metadata key of the hints raising the limit
+// on the size of the messages received by a call
+const RecvMsgSizeHintHeader = "x-max-recv-msg-size"
+
+// RecvMsgSizeHints lets trusted callers raise the limit on the size of the
+// messages the server receives for a call above MaxRecvMsgSizeUnary or
+// MaxRecvMsgSizeStreaming, by sending the limit in bytes as the
+// RecvMsgSizeHintHeader metadata of the call.
+//
+// The metadata of a call is chosen by the caller, so hints are only applied
+// once Verify accepts them. Verify must authenticate the caller or a
+// signature of the hint: a Verify accepting any hint lets every client lift
+// the limits of the server. Hints that are not verified, malformed, or
+// larger than Max are logged and ignored, and the call keeps the default
+// limit.
+type RecvMsgSizeHints struct {
+	// Verify returns an error unless the hint of the call with ctx to
+	// fullMethod, raising its limit to limit, is trusted, for instance
+	// because the metadata of the call carries a valid signature of the
+	// hint or the client certificate of the caller is a trusted one.
+	Verify func(ctx context.Context, fullMethod string, limit int) error
+	// Max is the largest limit a hint can set. gRPC enforces a single limit
+	// on all messages, which is raised to Max.
+	Max int
+}
+
+// hintedLimit returns the limit of the call with ctx to fullMethod, which is
+// the verified hint of the call if it is larger than defaultLimit
+func (l *recvMsgSizeLimiter) hintedLimit(ctx context.Context, fullMethod string, defaultLimit int) int {
+	if l.hints == nil {
+		return defaultLimit
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(RecvMsgSizeHintHeader)
+	if len(values) == 0 {
+		return defaultLimit
+	}
+
+	hint, err := strconv.Atoi(values[0])
+	switch {
+	case err != nil || hint <= 0:
+		l.logger.Warningf("Ignoring message size hint %q of call to %s: it is not a positive number of bytes", values[0], fullMethod)
+		return defaultLimit
+	case hint <= defaultLimit:
+		return defaultLimit
+	case hint > l.hints.Max:
+		l.logger.Warningf("Ignoring message size hint %d of call to %s: it exceeds the maximum of %d", hint, fullMethod, l.hints.Max)
+		return defaultLimit
+	}
+	if err := l.hints.Verify(ctx, fullMethod, hint); err != nil {
+		l.logger.Warningf("Ignoring message size hint %d of call to %s: it is not verified: %s", hint, fullMethod, err)
+		return defaultLimit
+	}
+	return hint
+}
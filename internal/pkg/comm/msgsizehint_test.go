@@ -0,0 +1,137 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const hintSignatureHeader = "x-max-recv-msg-size-signature"
+
+var hintKey = []byte("shared secret of trusted callers")
+
+func signHint(fullMethod string, limit int) string {
+	mac := hmac.New(sha256.New, hintKey)
+	fmt.Fprintf(mac, "%s:%d", fullMethod, limit)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyHintSignature accepts the hints signed with hintKey
+func verifyHintSignature(ctx context.Context, fullMethod string, limit int) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	signatures := md.Get(hintSignatureHeader)
+	if len(signatures) == 0 {
+		return errors.New("no signature")
+	}
+	signature, err := hex.DecodeString(signatures[0])
+	if err != nil {
+		return errors.Wrap(err, "malformed signature")
+	}
+	expected, _ := hex.DecodeString(signHint(fullMethod, limit))
+	if !hmac.Equal(signature, expected) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func TestRecvMsgSizeHints(t *testing.T) {
+	t.Parallel()
+
+	warnings := &recordedWarnings{}
+	_, conn := newTestServer(t, comm.ServerConfig{
+		MaxRecvMsgSizeUnary:     1024,
+		MaxRecvMsgSizeStreaming: 1024,
+		RecvMsgSizeHints: &comm.RecvMsgSizeHints{
+			Verify: verifyHintSignature,
+			Max:    64 * 1024,
+		},
+		Logger: warnings.logger(),
+	}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+		srv.Server().RegisterService(&echoStreamDesc, struct{}{})
+	})
+	client := testpb.NewEchoServiceClient(conn)
+
+	const echoCall = "/EchoService/EchoCall"
+	hinted := func(limit int, signature string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(),
+			comm.RecvMsgSizeHintHeader, strconv.Itoa(limit),
+			hintSignatureHeader, signature,
+		)
+	}
+	echo := func(ctx context.Context, size int) error {
+		_, err := client.EchoCall(ctx, &testpb.Echo{Payload: make([]byte, size)})
+		return err
+	}
+
+	// without a hint the default limit applies
+	err := echo(context.Background(), 2048)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// a verified hint raises the limit of the call, and only of that call
+	require.NoError(t, echo(hinted(4096, signHint(echoCall, 4096)), 2048))
+	err = echo(hinted(4096, signHint(echoCall, 4096)), 8192)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Contains(t, status.Convert(err).Message(), "vs. 4096")
+	err = echo(context.Background(), 2048)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Empty(t, warnings.get())
+
+	// hints that are not verified are ignored
+	err = echo(hinted(4096, "not a signature"), 2048)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Contains(t, status.Convert(err).Message(), "vs. 1024")
+	err = echo(hinted(4096, signHint("/EchoService/OtherCall", 4096)), 2048)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	// and so are the ones exceeding the maximum, even if they are verified
+	err = echo(hinted(128*1024, signHint(echoCall, 128*1024)), 2048)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, []string{
+		"Ignoring message size hint 4096 of call to /EchoService/EchoCall: it is not verified: malformed signature: encoding/hex: invalid byte: U+006E 'n'",
+		"Ignoring message size hint 4096 of call to /EchoService/EchoCall: it is not verified: invalid signature",
+		"Ignoring message size hint 131072 of call to /EchoService/EchoCall: it exceeds the maximum of 65536",
+	}, warnings.get())
+
+	// the hint of a stream applies to all of its messages
+	const echoStreamMethod = "/EchoStreamService/EchoStream"
+	stream, err := conn.NewStream(hinted(4096, signHint(echoStreamMethod, 4096)), &echoStreamDesc.Streams[0], echoStreamMethod)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, stream.SendMsg(&testpb.Echo{Payload: make([]byte, 2048)}))
+		require.NoError(t, stream.RecvMsg(&testpb.Echo{}))
+	}
+	err = echoStream(conn, make([]byte, 2048))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestRecvMsgSizeHintsInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	_, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		RecvMsgSizeHints: &comm.RecvMsgSizeHints{Max: 1024},
+	})
+	require.EqualError(t, err, "serverConfig.RecvMsgSizeHints.Verify must be set")
+
+	_, err = comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		RecvMsgSizeHints: &comm.RecvMsgSizeHints{Verify: verifyHintSignature},
+	})
+	require.EqualError(t, err, "serverConfig.RecvMsgSizeHints.Max must be positive")
+}
@@ -0,0 +1,56 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+
+	"github.com/hyperledger/fabric/common/metrics"
+	"google.golang.org/grpc/stats"
+)
+
+// MessageSizeStatsHandler is a stats.Handler that observes the size of every
+// message received and sent by a gRPC method. A streaming RPC contributes
+// one observation per message. Sizes are those of the serialized messages
+// before compression, which is what MaxRecvMsgSize and MaxSendMsgSize
+// limit. Histograms that are nil are not reported.
+type MessageSizeStatsHandler struct {
+	ReceivedSizeHistogram metrics.Histogram
+	SentSizeHistogram     metrics.Histogram
+}
+
+type msgSizeMethodKey struct{}
+
+func (h *MessageSizeStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, msgSizeMethodKey{}, info.FullMethodName)
+}
+
+func (h *MessageSizeStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	fullMethod, _ := ctx.Value(msgSizeMethodKey{}).(string)
+
+	switch s := s.(type) {
+	case *stats.InPayload:
+		h.observe(ctx, h.ReceivedSizeHistogram, fullMethod, s.Length)
+	case *stats.OutPayload:
+		h.observe(ctx, h.SentSizeHistogram, fullMethod, s.Length)
+	}
+}
+
+func (h *MessageSizeStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *MessageSizeStatsHandler) HandleConn(ctx context.Context, s stats.ConnStats) {}
+
+func (h *MessageSizeStatsHandler) observe(ctx context.Context, histogram metrics.Histogram, fullMethod string, length int) {
+	if histogram == nil {
+		return
+	}
+	service, method := serviceMethod(fullMethod)
+	size := float64(length)
+	emitterFromContext(ctx).emit(func() { histogram.With("service", service, "method", method).Observe(size) })
+}
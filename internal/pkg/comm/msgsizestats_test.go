@@ -0,0 +1,87 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/metrics"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+)
+
+// methodSizes is a histogram that records the values observed per
+// service and method labels
+type methodSizes struct {
+	lock     *sync.Mutex
+	method   string
+	observed map[string][]float64
+}
+
+func newMethodSizes() *methodSizes {
+	return &methodSizes{lock: &sync.Mutex{}, observed: map[string][]float64{}}
+}
+
+func (m *methodSizes) With(labelValues ...string) metrics.Histogram {
+	return &methodSizes{lock: m.lock, method: labelValues[1] + "/" + labelValues[3], observed: m.observed}
+}
+
+func (m *methodSizes) Observe(value float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.observed[m.method] = append(m.observed[m.method], value)
+}
+
+func (m *methodSizes) get(method string) []float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]float64(nil), m.observed[method]...)
+}
+
+func TestMessageSizeStatsHandler(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	received, sent := newMethodSizes(), newMethodSizes()
+	_, conn := newTestServer(t, comm.ServerConfig{
+		MessageSizeStatsHandler: &comm.MessageSizeStatsHandler{
+			ReceivedSizeHistogram: received,
+			SentSizeHistogram:     sent,
+		},
+	}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+		srv.Server().RegisterService(&echoStreamDesc, struct{}{})
+	})
+
+	unaryMsg := &testpb.Echo{Payload: make([]byte, 1000)}
+	_, err := testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), unaryMsg)
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	stream, err := conn.NewStream(context.Background(), &echoStreamDesc.Streams[0], "/EchoStreamService/EchoStream")
+	gt.Expect(err).NotTo(HaveOccurred())
+	var streamSizes []float64
+	for _, size := range []int{10, 5000, 70000} {
+		msg := &testpb.Echo{Payload: make([]byte, size)}
+		streamSizes = append(streamSizes, float64(proto.Size(msg)))
+		gt.Expect(stream.SendMsg(msg)).To(Succeed())
+		gt.Expect(stream.RecvMsg(&testpb.Echo{})).To(Succeed())
+	}
+	gt.Expect(stream.CloseSend()).To(Succeed())
+	gt.Expect(stream.RecvMsg(&testpb.Echo{})).To(Equal(io.EOF))
+
+	unarySizes := []float64{float64(proto.Size(unaryMsg))}
+	gt.Eventually(func() []float64 { return received.get("EchoService/EchoCall") }, 5*time.Second).Should(Equal(unarySizes))
+	gt.Eventually(func() []float64 { return sent.get("EchoService/EchoCall") }, 5*time.Second).Should(Equal(unarySizes))
+	gt.Eventually(func() []float64 { return received.get("EchoStreamService/EchoStream") }, 5*time.Second).Should(Equal(streamSizes))
+	gt.Eventually(func() []float64 { return sent.get("EchoStreamService/EchoStream") }, 5*time.Second).Should(Equal(streamSizes))
+}
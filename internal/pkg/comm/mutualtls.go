@@ -0,0 +1,59 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type mutualTLSRequired map[string]struct{}
+
+func newMutualTLSRequired(methods []string) mutualTLSRequired {
+	required := mutualTLSRequired{}
+	for _, method := range methods {
+		required[method] = struct{}{}
+	}
+	return required
+}
+
+func (m mutualTLSRequired) check(ctx context.Context, method string) error {
+	if _, ok := m[method]; ok && !IsMutuallyAuthenticated(ctx) {
+		return status.Errorf(codes.Unauthenticated, "method %s requires a verified TLS client certificate", method)
+	}
+	return nil
+}
+
+// NewMutualTLSRequiredInterceptor returns a unary server interceptor that
+// rejects calls to the listed full method names (e.g.
+// /package.Service/Method) with Unauthenticated unless the client presented
+// a verified TLS certificate. This protects sensitive methods on servers
+// that do not require client certificates for every call.
+func NewMutualTLSRequiredInterceptor(methods []string) grpc.UnaryServerInterceptor {
+	required := newMutualTLSRequired(methods)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := required.check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewMutualTLSRequiredStreamInterceptor is the stream server interceptor
+// counterpart of NewMutualTLSRequiredInterceptor.
+func NewMutualTLSRequiredStreamInterceptor(methods []string) grpc.StreamServerInterceptor {
+	required := newMutualTLSRequired(methods)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := required.check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
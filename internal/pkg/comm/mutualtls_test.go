@@ -0,0 +1,115 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMutualTLSRequiredInterceptor(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	clientKeyPair, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+
+	sensitive := []string{"/EchoService/EchoCall", "/EmptyService/EmptyStream"}
+	newServer := func(requireClientCert bool) string {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+			SecOpts: comm.SecureOptions{
+				UseTLS:            true,
+				RequireClientCert: requireClientCert,
+				Certificate:       serverKeyPair.Cert,
+				Key:               serverKeyPair.Key,
+				ClientRootCAs:     [][]byte{ca.CertBytes()},
+			},
+			UnaryInterceptors:  []grpc.UnaryServerInterceptor{comm.NewMutualTLSRequiredInterceptor(sensitive)},
+			StreamInterceptors: []grpc.StreamServerInterceptor{comm.NewMutualTLSRequiredStreamInterceptor(sensitive)},
+		})
+		require.NoError(t, err)
+		testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+		go srv.Start()
+		t.Cleanup(srv.Stop)
+		return lis.Addr().String()
+	}
+	oneWayAddress := newServer(false)
+	mutualAddress := newServer(true)
+
+	connect := func(address string, withClientCert bool) *grpc.ClientConn {
+		secOpts := comm.SecureOptions{
+			UseTLS:        true,
+			ServerRootCAs: [][]byte{ca.CertBytes()},
+		}
+		if withClientCert {
+			secOpts.RequireClientCert = true
+			secOpts.Certificate = clientKeyPair.Cert
+			secOpts.Key = clientKeyPair.Key
+		}
+		client, err := comm.NewGRPCClient(comm.ClientConfig{SecOpts: secOpts, Timeout: testTimeout})
+		require.NoError(t, err)
+		conn, err := client.NewConnection(address)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	requireUnauthenticated := func(err error, method string) {
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.Equal(t, "method "+method+" requires a verified TLS client certificate", status.Convert(err).Message())
+	}
+	stream := func(conn *grpc.ClientConn) error {
+		s, err := testpb.NewEmptyServiceClient(conn).EmptyStream(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, s.CloseSend())
+		for {
+			if _, err := s.Recv(); err != nil {
+				return err
+			}
+		}
+	}
+
+	t.Run("one-way TLS", func(t *testing.T) {
+		conn := connect(oneWayAddress, false)
+		_, err := testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+		require.NoError(t, err)
+		_, err = testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{})
+		requireUnauthenticated(err, "/EchoService/EchoCall")
+		requireUnauthenticated(stream(conn), "/EmptyService/EmptyStream")
+	})
+
+	t.Run("unverified client certificate", func(t *testing.T) {
+		// servers not requiring client certificates do not verify them
+		conn := connect(oneWayAddress, true)
+		_, err := testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{})
+		requireUnauthenticated(err, "/EchoService/EchoCall")
+	})
+
+	t.Run("mutual TLS", func(t *testing.T) {
+		conn := connect(mutualAddress, true)
+		_, err := testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+		require.NoError(t, err)
+		_, err = testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{})
+		require.NoError(t, err)
+		require.Equal(t, io.EOF, stream(conn))
+	})
+}
@@ -0,0 +1,68 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"net"
+)
+
+// Go sets TCP_NODELAY on every TCP connection it dials or accepts, after
+// running the Control function of the dialer or listener, so the option is
+// set on the connection itself.
+
+// setNoDelay sets TCP_NODELAY on conn to noDelay if it is a TCP connection,
+// disabling Nagle's algorithm if noDelay is true and enabling it otherwise
+func setNoDelay(conn net.Conn, noDelay bool) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	return tcpConn.SetNoDelay(noDelay)
+}
+
+// noDelayDialer returns a dialer of TCP connections with TCP_NODELAY set to
+// noDelay
+func noDelayDialer(noDelay bool) func(context.Context, string) (net.Conn, error) {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		if err := setNoDelay(conn, noDelay); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// noDelayListener sets TCP_NODELAY on the connections it accepts
+type noDelayListener struct {
+	net.Listener
+	noDelay bool
+	gServer *GRPCServer
+}
+
+func (l *noDelayListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if err := setNoDelay(conn, l.noDelay); err != nil {
+		l.gServer.logger.Warningf("Failed setting TCP_NODELAY to %t on the connection from %s: %s", l.noDelay, conn.RemoteAddr(), err)
+	}
+	return conn, nil
+}
+
+// noDelayListenerWrapper returns a listener wrapper setting TCP_NODELAY to
+// noDelay on the connections it accepts
+func (gServer *GRPCServer) noDelayListenerWrapper(noDelay bool) func(net.Listener) net.Listener {
+	return func(listener net.Listener) net.Listener {
+		return &noDelayListener{Listener: listener, noDelay: noDelay, gServer: gServer}
+	}
+}
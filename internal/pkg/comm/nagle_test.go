@@ -0,0 +1,117 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+)
+
+// noDelay returns the TCP_NODELAY option of the socket of conn
+func noDelay(t *testing.T, conn net.Conn) int {
+	rawConn, err := conn.(*net.TCPConn).SyscallConn()
+	require.NoError(t, err)
+	var value int
+	var sockErr error
+	require.NoError(t, rawConn.Control(func(fd uintptr) {
+		value, sockErr = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_NODELAY)
+	}))
+	require.NoError(t, sockErr)
+	return value
+}
+
+func TestDisableNagleServer(t *testing.T) {
+	t.Parallel()
+
+	disabled, enabled := true, false
+	tests := []struct {
+		name         string
+		disableNagle *bool
+		noDelay      int
+	}{
+		{name: "default", noDelay: 1},
+		{name: "disabled", disableNagle: &disabled, noDelay: 1},
+		{name: "enabled", disableNagle: &enabled, noDelay: 0},
+	}
+
+	for _, tt := range tests {
+		accepted := make(chan net.Conn, 1)
+		srv, err := NewGRPCServer("127.0.0.1:0", ServerConfig{
+			DisableNagle: tt.disableNagle,
+			ListenerWrappers: []func(net.Listener) net.Listener{
+				func(l net.Listener) net.Listener { return &acceptRecorder{Listener: l, accepted: accepted} },
+			},
+		})
+		require.NoError(t, err)
+		go srv.Start()
+
+		conn, err := grpc.Dial(srv.Address(), grpc.WithInsecure(), grpc.WithBlock())
+		require.NoError(t, err)
+		require.Equal(t, tt.noDelay, noDelay(t, <-accepted), tt.name)
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+func TestDisableNagleClient(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	conn, err := noDelayDialer(false)(context.Background(), lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, 0, noDelay(t, conn))
+
+	conn, err = noDelayDialer(true)(context.Background(), lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, 1, noDelay(t, conn))
+
+	conn, err = goAwayDialer(noDelayDialer(false), func(string) {})(context.Background(), lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, 0, noDelay(t, conn.(*goAwayConn).Conn))
+
+	conn, err = goAwayDialer(nil, func(string) {})(context.Background(), lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, 1, noDelay(t, conn.(*goAwayConn).Conn))
+}
+
+// acceptRecorder reports the connections accepted by the server, as they
+// are seen by the listener wrappers
+type acceptRecorder struct {
+	net.Listener
+	accepted chan net.Conn
+}
+
+func (l *acceptRecorder) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted <- conn
+	}
+	return conn, err
+}
@@ -0,0 +1,107 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"crypto/x509"
+	"sync"
+
+	"github.com/hyperledger/fabric/common/metrics"
+	"google.golang.org/grpc/stats"
+)
+
+// UnknownOrg is the org reported for clients that do not present a TLS
+// certificate, such as plaintext or server-only TLS connections
+const UnknownOrg = "unknown"
+
+// OrgFromOU returns the first organizational unit of the certificate
+func OrgFromOU(cert *x509.Certificate) string {
+	if len(cert.Subject.OrganizationalUnit) == 0 {
+		return ""
+	}
+	return cert.Subject.OrganizationalUnit[0]
+}
+
+// OrgStatsHandler is a stats.Handler that records the RPCs and bytes
+// exchanged with clients grouped by the org of their TLS client certificate.
+// Counters that are nil are not reported.
+type OrgStatsHandler struct {
+	RPCsCounter          metrics.Counter
+	BytesReceivedCounter metrics.Counter
+	BytesSentCounter     metrics.Counter
+	// OrgExtractor derives the org from the client certificate. If nil,
+	// OrgFromOU is used. An empty result is reported as UnknownOrg.
+	OrgExtractor func(cert *x509.Certificate) string
+}
+
+type orgConnKey struct{}
+
+// connOrg caches the org of a connection. The TLS state of a connection is
+// not available when it is tagged, so the org is resolved once from the
+// context of its first RPC.
+type connOrg struct {
+	once sync.Once
+	org  string
+}
+
+type orgRPCKey struct{}
+
+func (h *OrgStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, orgConnKey{}, &connOrg{})
+}
+
+func (h *OrgStatsHandler) HandleConn(ctx context.Context, s stats.ConnStats) {}
+
+func (h *OrgStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	co, ok := ctx.Value(orgConnKey{}).(*connOrg)
+	if !ok {
+		return context.WithValue(ctx, orgRPCKey{}, h.orgFromContext(ctx))
+	}
+	co.once.Do(func() { co.org = h.orgFromContext(ctx) })
+	return context.WithValue(ctx, orgRPCKey{}, co.org)
+}
+
+func (h *OrgStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	org, ok := ctx.Value(orgRPCKey{}).(string)
+	if !ok {
+		org = UnknownOrg
+	}
+
+	switch s := s.(type) {
+	case *stats.Begin:
+		h.add(ctx, h.RPCsCounter, org, 1)
+	case *stats.InPayload:
+		h.add(ctx, h.BytesReceivedCounter, org, float64(s.WireLength))
+	case *stats.OutPayload:
+		h.add(ctx, h.BytesSentCounter, org, float64(s.WireLength))
+	}
+}
+
+// add adds delta to the counter of org unless counter is nil
+func (h *OrgStatsHandler) add(ctx context.Context, counter metrics.Counter, org string, delta float64) {
+	if counter == nil {
+		return
+	}
+	emitterFromContext(ctx).emit(func() { counter.With("org", org).Add(delta) })
+}
+
+func (h *OrgStatsHandler) orgFromContext(ctx context.Context) string {
+	cert := ExtractCertificateFromContext(ctx)
+	if cert == nil {
+		return UnknownOrg
+	}
+
+	extract := h.OrgExtractor
+	if extract == nil {
+		extract = OrgFromOU
+	}
+	if org := extract(cert); org != "" {
+		return org
+	}
+	return UnknownOrg
+}
@@ -0,0 +1,179 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/common/metrics"
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// orgTotals is a counter that accumulates the values added per org label
+type orgTotals struct {
+	lock   *sync.Mutex
+	org    string
+	totals map[string]float64
+}
+
+func newOrgTotals() *orgTotals {
+	return &orgTotals{lock: &sync.Mutex{}, totals: map[string]float64{}}
+}
+
+func (o *orgTotals) With(labelValues ...string) metrics.Counter {
+	return &orgTotals{lock: o.lock, org: labelValues[1], totals: o.totals}
+}
+
+func (o *orgTotals) Add(delta float64) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.totals[o.org] += delta
+}
+
+func (o *orgTotals) get(org string) float64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.totals[org]
+}
+
+func TestOrgFromOU(t *testing.T) {
+	gt := NewGomegaWithT(t)
+
+	cert := &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{"Org1", "peer"}}}
+	gt.Expect(comm.OrgFromOU(cert)).To(Equal("Org1"))
+	gt.Expect(comm.OrgFromOU(&x509.Certificate{})).To(BeEmpty())
+}
+
+func TestOrgStatsHandlerGRPCServer(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	ca, err := tlsgen.NewCA()
+	gt.Expect(err).NotTo(HaveOccurred())
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	gt.Expect(err).NotTo(HaveOccurred())
+	org1KeyPair, err := ca.NewClientCertKeyPair()
+	gt.Expect(err).NotTo(HaveOccurred())
+	org2KeyPair, err := ca.NewClientCertKeyPair()
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	rpcs, received, sent := newOrgTotals(), newOrgTotals(), newOrgTotals()
+	openConn := &metricsfakes.Counter{}
+	orgStatsHandler := &comm.OrgStatsHandler{
+		RPCsCounter:          rpcs,
+		BytesReceivedCounter: received,
+		BytesSentCounter:     sent,
+		OrgExtractor: func(cert *x509.Certificate) string {
+			switch cert.Subject.SerialNumber {
+			case org1KeyPair.TLSCert.Subject.SerialNumber:
+				return "Org1"
+			case org2KeyPair.TLSCert.Subject.SerialNumber:
+				return "Org2"
+			default:
+				return ""
+			}
+		},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	gt.Expect(err).NotTo(HaveOccurred())
+	srv, err := comm.NewGRPCServerFromListener(listener, comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:            true,
+			RequireClientCert: true,
+			Certificate:       serverKeyPair.Cert,
+			Key:               serverKeyPair.Key,
+			ClientRootCAs:     [][]byte{ca.CertBytes()},
+		},
+		ServerStatsHandler: &comm.ServerStatsHandler{
+			OpenConnCounter:   openConn,
+			ClosedConnCounter: &metricsfakes.Counter{},
+		},
+		OrgStatsHandler: orgStatsHandler,
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	echo := func(keyPair *tlsgen.CertKeyPair, calls int, payload []byte) {
+		cert, err := tls.X509KeyPair(keyPair.Cert, keyPair.Key)
+		gt.Expect(err).NotTo(HaveOccurred())
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(ca.CertBytes())
+		creds := credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: rootCAs})
+
+		conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(creds), grpc.WithBlock())
+		gt.Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		client := testpb.NewEchoServiceClient(conn)
+		for i := 0; i < calls; i++ {
+			_, err := client.EchoCall(context.Background(), &testpb.Echo{Payload: payload})
+			gt.Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
+	echo(org1KeyPair, 3, make([]byte, 100))
+	echo(org2KeyPair, 1, make([]byte, 1000))
+
+	gt.Eventually(func() float64 { return rpcs.get("Org1") }).Should(Equal(3.0))
+	gt.Eventually(func() float64 { return rpcs.get("Org2") }).Should(Equal(1.0))
+	gt.Expect(rpcs.get(comm.UnknownOrg)).To(BeZero())
+
+	// each echo is a 100 or 1000 byte payload prefixed by the field tag and
+	// the varint encoded length; the wire length of sent messages also
+	// includes the 5 byte gRPC message header
+	gt.Eventually(func() float64 { return received.get("Org1") }).Should(Equal(3.0 * (100 + 1 + 1)))
+	gt.Eventually(func() float64 { return sent.get("Org1") }).Should(Equal(3.0 * (100 + 1 + 1 + 5)))
+	gt.Eventually(func() float64 { return received.get("Org2") }).Should(Equal(1000.0 + 1 + 2))
+	gt.Eventually(func() float64 { return sent.get("Org2") }).Should(Equal(1000.0 + 1 + 2 + 5))
+
+	// the server stats handler still observes connections
+	gt.Eventually(openConn.AddCallCount).Should(Equal(2))
+}
+
+func TestOrgStatsHandlerPlaintext(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	rpcs, received, sent := newOrgTotals(), newOrgTotals(), newOrgTotals()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	gt.Expect(err).NotTo(HaveOccurred())
+	srv, err := comm.NewGRPCServerFromListener(listener, comm.ServerConfig{
+		OrgStatsHandler: &comm.OrgStatsHandler{
+			RPCsCounter:          rpcs,
+			BytesReceivedCounter: received,
+			BytesSentCounter:     sent,
+		},
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer conn.Close()
+	_, err = testpb.NewEchoServiceClient(conn).EchoCall(context.Background(), &testpb.Echo{Payload: make([]byte, 10)})
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	gt.Eventually(func() float64 { return rpcs.get(comm.UnknownOrg) }).Should(Equal(1.0))
+	gt.Eventually(func() float64 { return received.get(comm.UnknownOrg) }).Should(Equal(12.0))
+	gt.Eventually(func() float64 { return sent.get(comm.UnknownOrg) }).Should(Equal(17.0))
+}
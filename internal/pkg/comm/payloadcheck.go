@@ -0,0 +1,142 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// payloadChecker is a codec inspecting the wire format of requests before
+// they are unmarshaled. Requests that are too large or not framed as
+// protobuf messages are not unmarshaled.
+//
+// gRPC reports unmarshaling failures with codes.Internal, so the codec
+// records rejected messages instead of failing, and its interceptors, which
+// run before any other, fail the calls receiving them with InvalidArgument.
+// The codec must therefore never be used without the interceptors.
+type payloadChecker struct {
+	codec interface {
+		Marshal(v interface{}) ([]byte, error)
+		Unmarshal(data []byte, v interface{}) error
+	}
+	maxSize int
+
+	// rejected maps the messages that were not unmarshaled to the reason
+	rejected sync.Map
+}
+
+func (pc *payloadChecker) Marshal(v interface{}) ([]byte, error) {
+	return pc.codec.Marshal(v)
+}
+
+func (pc *payloadChecker) Unmarshal(data []byte, v interface{}) error {
+	if err := pc.check(data); err != nil {
+		pc.rejected.Store(v, err)
+		return nil
+	}
+	return pc.codec.Unmarshal(data, v)
+}
+
+func (pc *payloadChecker) String() string {
+	return "proto"
+}
+
+func (pc *payloadChecker) check(data []byte) error {
+	if pc.maxSize > 0 && len(data) > pc.maxSize {
+		return errors.Errorf("payload of %d bytes exceeds the maximum of %d", len(data), pc.maxSize)
+	}
+	return checkProtoFraming(data)
+}
+
+// takeRejection returns an InvalidArgument error if msg was rejected
+func (pc *payloadChecker) takeRejection(msg interface{}) error {
+	err, ok := pc.rejected.Load(msg)
+	if !ok {
+		return nil
+	}
+	pc.rejected.Delete(msg)
+	return status.Errorf(codes.InvalidArgument, "malformed request: %s", err)
+}
+
+func (pc *payloadChecker) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := pc.takeRejection(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (pc *payloadChecker) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &payloadCheckingServerStream{ServerStream: ss, checker: pc})
+	}
+}
+
+type payloadCheckingServerStream struct {
+	grpc.ServerStream
+	checker *payloadChecker
+}
+
+func (ss *payloadCheckingServerStream) RecvMsg(m interface{}) error {
+	if err := ss.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return ss.checker.takeRejection(m)
+}
+
+// checkProtoFraming walks the top level fields of the protobuf encoded data
+// and returns an error if a tag or a length is invalid or runs past the end
+// of data. Nested messages are not inspected.
+func checkProtoFraming(data []byte) error {
+	for offset := 0; offset < len(data); {
+		tag, n := binary.Uvarint(data[offset:])
+		if n <= 0 {
+			return errors.Errorf("truncated or invalid field tag at offset %d", offset)
+		}
+		if tag>>3 == 0 {
+			return errors.Errorf("invalid field number 0 at offset %d", offset)
+		}
+		offset += n
+
+		switch wireType := tag & 7; wireType {
+		case 0: // varint
+			if _, n := binary.Uvarint(data[offset:]); n <= 0 {
+				return errors.Errorf("truncated or invalid varint at offset %d", offset)
+			}
+			offset += n
+		case 1: // 64-bit
+			offset += 8
+		case 2: // length-delimited
+			length, n := binary.Uvarint(data[offset:])
+			if n <= 0 {
+				return errors.Errorf("truncated or invalid length at offset %d", offset)
+			}
+			offset += n
+			if length > uint64(len(data)-offset) {
+				return errors.Errorf("field of %d bytes at offset %d runs past the end of the payload", length, offset)
+			}
+			offset += int(length)
+		case 3, 4: // group delimiters carry no data
+		case 5: // 32-bit
+			offset += 4
+		default:
+			return errors.Errorf("invalid wire type %d at offset %d", wireType, offset-n)
+		}
+		if offset > len(data) {
+			return errors.New("truncated payload")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rawCodec sends []byte requests as they are and decodes responses as
+// protobuf messages
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	if b, ok := v.([]byte); ok {
+		return b, nil
+	}
+	return proto.Marshal(v.(proto.Message))
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	return proto.Unmarshal(data, v.(proto.Message))
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+type countingEchoServer struct {
+	calls int32
+}
+
+func (ces *countingEchoServer) EchoCall(ctx context.Context, echo *testpb.Echo) (*testpb.Echo, error) {
+	atomic.AddInt32(&ces.calls, 1)
+	return echo, nil
+}
+
+func TestPrecheckPayloads(t *testing.T) {
+	t.Parallel()
+
+	for _, codec := range []grpc.Codec{nil, comm.NewPooledCodec()} {
+		var intercepted int32
+		echoServer := &countingEchoServer{}
+		_, conn := newTestServer(t, comm.ServerConfig{
+			PrecheckPayloads:       true,
+			PrecheckMaxPayloadSize: 1024,
+			Codec:                  codec,
+			UnaryInterceptors: []grpc.UnaryServerInterceptor{
+				func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+					atomic.AddInt32(&intercepted, 1)
+					return handler(ctx, req)
+				},
+			},
+		}, func(srv *comm.GRPCServer) {
+			testpb.RegisterEchoServiceServer(srv.Server(), echoServer)
+			srv.Server().RegisterService(&echoStreamDesc, struct{}{})
+		}, grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})))
+
+		valid, err := proto.Marshal(&testpb.Echo{Payload: []byte("hello")})
+		require.NoError(t, err)
+		reply := &testpb.Echo{}
+		require.NoError(t, conn.Invoke(context.Background(), "/EchoService/EchoCall", valid, reply))
+		require.Equal(t, []byte("hello"), reply.Payload)
+
+		tests := []struct {
+			name    string
+			payload []byte
+			errMsg  string
+		}{
+			{name: "truncated", payload: valid[:len(valid)-2], errMsg: "field of 5 bytes at offset 2 runs past the end of the payload"},
+			{name: "garbage", payload: []byte{0xff, 0xff, 0xff}, errMsg: "truncated or invalid field tag at offset 0"},
+			{name: "invalid wire type", payload: []byte{0x0f, 0x01}, errMsg: "invalid wire type 7 at offset 0"},
+			{name: "field number 0", payload: []byte{0x02, 0x00}, errMsg: "invalid field number 0 at offset 0"},
+			{name: "truncated fixed64", payload: []byte{0x09, 0x01, 0x02}, errMsg: "truncated payload"},
+			{name: "too large", payload: append([]byte{0x0a, 0x81, 0x08}, make([]byte, 1025)...), errMsg: "payload of 1028 bytes exceeds the maximum of 1024"},
+		}
+		for _, tt := range tests {
+			err := conn.Invoke(context.Background(), "/EchoService/EchoCall", tt.payload, &testpb.Echo{})
+			require.Equal(t, codes.InvalidArgument, status.Code(err), tt.name)
+			require.Equal(t, "malformed request: "+tt.errMsg, status.Convert(err).Message(), tt.name)
+		}
+		require.Equal(t, int32(1), atomic.LoadInt32(&echoServer.calls), "handlers must not see rejected requests")
+		require.Equal(t, int32(1), atomic.LoadInt32(&intercepted), "interceptors must not see rejected requests")
+
+		stream, err := conn.NewStream(context.Background(), &echoStreamDesc.Streams[0], "/EchoStreamService/EchoStream")
+		require.NoError(t, err)
+		require.NoError(t, stream.SendMsg(valid))
+		require.NoError(t, stream.RecvMsg(&testpb.Echo{}))
+		require.NoError(t, stream.SendMsg([]byte{0xff}))
+		err = stream.RecvMsg(&testpb.Echo{})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.Equal(t, "malformed request: truncated or invalid field tag at offset 0", status.Convert(err).Message())
+	}
+}
+
+func TestPrecheckPayloadsDisabled(t *testing.T) {
+	t.Parallel()
+
+	_, conn := newTestServer(t, comm.ServerConfig{}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	}, grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})))
+
+	// without prechecks, malformed requests fail to unmarshal
+	err := conn.Invoke(context.Background(), "/EchoService/EchoCall", []byte{0xff, 0xff, 0xff}, &testpb.Echo{})
+	require.Equal(t, codes.Internal, status.Code(err))
+}
@@ -0,0 +1,173 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PeerAwareServerStream wraps a grpc.ServerStream to let streaming handlers
+// detect that the peer is gone, or has stopped reading, and stop producing
+// messages.
+//
+// A peer that half-closes the stream with CloseSend is not gone: RecvMsg
+// returns io.EOF but the peer may still read the messages it is sent, so
+// Done does not fire. Done fires when the stream cannot make progress: the
+// peer cancelled the call, the transport closed, the deadline expired, or
+// a SendMsgTimeout call timed out because the peer stopped reading.
+type PeerAwareServerStream struct {
+	grpc.ServerStream
+
+	done     chan struct{}
+	doneOnce sync.Once
+
+	lock sync.Mutex
+	// closed when the last send returns; nil if nothing was sent
+	sending chan struct{}
+}
+
+// NewPeerAwareServerStream wraps ss. The returned stream must be used in
+// place of ss for sending messages.
+func NewPeerAwareServerStream(ss grpc.ServerStream) *PeerAwareServerStream {
+	ps := &PeerAwareServerStream{
+		ServerStream: ss,
+		done:         make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-ss.Context().Done():
+			ps.markDone()
+		case <-ps.done:
+		}
+	}()
+	return ps
+}
+
+// Done returns a channel that is closed when the peer is gone or has
+// stopped reading from the stream
+func (ps *PeerAwareServerStream) Done() <-chan struct{} {
+	return ps.done
+}
+
+// Writable returns whether a message can be sent without blocking on a
+// previous send. It returns false once Done has fired or while a send that
+// timed out is still waiting for the peer to read.
+func (ps *PeerAwareServerStream) Writable() bool {
+	select {
+	case <-ps.done:
+		return false
+	default:
+	}
+
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	return ps.idle()
+}
+
+// SendMsg sends m, blocking until the transport accepts it
+func (ps *PeerAwareServerStream) SendMsg(m interface{}) error {
+	sent, err := ps.beginSend()
+	if err != nil {
+		return err
+	}
+	err = ps.ServerStream.SendMsg(m)
+	close(sent)
+	return err
+}
+
+// SendMsgTimeout sends m, waiting at most timeout for the transport to
+// accept it. When the peer stops reading, flow control prevents sends from
+// completing; such a send times out with DeadlineExceeded, Done fires, and
+// all subsequent sends fail. Returning from the handler releases the
+// pending send.
+func (ps *PeerAwareServerStream) SendMsgTimeout(m interface{}, timeout time.Duration) error {
+	sent, err := ps.beginSend()
+	if err != nil {
+		return err
+	}
+
+	var sendErr error
+	go func() {
+		sendErr = ps.ServerStream.SendMsg(m)
+		close(sent)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-sent:
+		return sendErr
+	case <-timer.C:
+		ps.markDone()
+		return status.Error(codes.DeadlineExceeded, "timed out sending message, peer is not reading from the stream")
+	}
+}
+
+// beginSend returns the channel to close when the send completes or an
+// error if the stream cannot be written to
+func (ps *PeerAwareServerStream) beginSend() (chan struct{}, error) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	select {
+	case <-ps.done:
+		if err := ps.Context().Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		return nil, status.Error(codes.DeadlineExceeded, "peer is not reading from the stream")
+	default:
+	}
+	if !ps.idle() {
+		return nil, status.Error(codes.FailedPrecondition, "a previous send on the stream is still in progress")
+	}
+
+	ps.sending = make(chan struct{})
+	return ps.sending, nil
+}
+
+// idle returns whether no send is in progress; the lock must be held
+func (ps *PeerAwareServerStream) idle() bool {
+	if ps.sending == nil {
+		return true
+	}
+	select {
+	case <-ps.sending:
+		return true
+	default:
+		return false
+	}
+}
+
+func (ps *PeerAwareServerStream) markDone() {
+	ps.doneOnce.Do(func() { close(ps.done) })
+}
+
+// sendTimeoutServerStream bounds the time every send waits for the peer
+type sendTimeoutServerStream struct {
+	*PeerAwareServerStream
+	timeout time.Duration
+}
+
+func (ss *sendTimeoutServerStream) SendMsg(m interface{}) error {
+	return ss.SendMsgTimeout(m, ss.timeout)
+}
+
+// streamSendTimeoutInterceptor returns an interceptor making the sends of
+// streaming handlers fail once they wait longer than timeout for the peer
+func streamSendTimeoutInterceptor(timeout time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &sendTimeoutServerStream{
+			PeerAwareServerStream: NewPeerAwareServerStream(ss),
+			timeout:               timeout,
+		})
+	}
+}
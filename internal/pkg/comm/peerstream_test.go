@@ -0,0 +1,176 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type peerAwareServer struct {
+	emptyServiceServer
+	handle func(*comm.PeerAwareServerStream) error
+}
+
+func (ps *peerAwareServer) EmptyStream(stream testpb.EmptyService_EmptyStreamServer) error {
+	return ps.handle(comm.NewPeerAwareServerStream(stream))
+}
+
+func newPeerAwareServer(t *testing.T, handle func(*comm.PeerAwareServerStream) error) *grpc.ClientConn {
+	// a fixed window disables dynamic window sizing so that a client
+	// that stops reading blocks the server quickly
+	_, conn := newTestServer(t, comm.ServerConfig{}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEmptyServiceServer(srv.Server(), &peerAwareServer{handle: handle})
+	},
+		grpc.WithInitialWindowSize(64*1024),
+		grpc.WithInitialConnWindowSize(64*1024),
+	)
+	return conn
+}
+
+func TestPeerAwareServerStreamPeerNotReading(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	result := make(chan error, 1)
+	conn := newPeerAwareServer(t, func(ps *comm.PeerAwareServerStream) error {
+		for {
+			if err := ps.SendMsgTimeout(&testpb.Empty{}, 200*time.Millisecond); err != nil {
+				select {
+				case <-ps.Done():
+				default:
+					t.Error("expected Done to fire")
+				}
+				if ps.Writable() {
+					t.Error("expected stream not to be writable")
+				}
+				if err := ps.SendMsg(&testpb.Empty{}); status.Code(err) != codes.DeadlineExceeded {
+					t.Errorf("expected subsequent send to fail, got %v", err)
+				}
+				result <- err
+				return err
+			}
+		}
+	})
+
+	stream, err := testpb.NewEmptyServiceClient(conn).EmptyStream(context.Background())
+	gt.Expect(err).NotTo(HaveOccurred())
+	// never read from the stream
+
+	var sendErr error
+	gt.Eventually(result, 10*time.Second).Should(Receive(&sendErr))
+	gt.Expect(status.Code(sendErr)).To(Equal(codes.DeadlineExceeded))
+	gt.Expect(status.Convert(sendErr).Message()).To(Equal("timed out sending message, peer is not reading from the stream"))
+	stream.CloseSend()
+}
+
+func TestPeerAwareServerStreamPeerGone(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	started := make(chan struct{})
+	result := make(chan error, 1)
+	conn := newPeerAwareServer(t, func(ps *comm.PeerAwareServerStream) error {
+		close(started)
+		<-ps.Done()
+		err := ps.SendMsg(&testpb.Empty{})
+		result <- err
+		return err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := testpb.NewEmptyServiceClient(conn).EmptyStream(ctx)
+	gt.Expect(err).NotTo(HaveOccurred())
+	<-started
+	cancel()
+
+	var sendErr error
+	gt.Eventually(result, 5*time.Second).Should(Receive(&sendErr))
+	gt.Expect(status.Code(sendErr)).To(Equal(codes.Canceled))
+}
+
+func TestPeerAwareServerStreamHalfClosed(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	conn := newPeerAwareServer(t, func(ps *comm.PeerAwareServerStream) error {
+		if err := ps.RecvMsg(&testpb.Empty{}); err != io.EOF {
+			t.Errorf("expected io.EOF, got %v", err)
+		}
+		select {
+		case <-ps.Done():
+			t.Error("Done fired on a half-closed stream")
+		default:
+		}
+		if !ps.Writable() {
+			t.Error("expected half-closed stream to be writable")
+		}
+		return ps.SendMsgTimeout(&testpb.Empty{}, 5*time.Second)
+	})
+
+	stream, err := testpb.NewEmptyServiceClient(conn).EmptyStream(context.Background())
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(stream.CloseSend()).To(Succeed())
+
+	_, err = stream.Recv()
+	gt.Expect(err).NotTo(HaveOccurred())
+	_, err = stream.Recv()
+	gt.Expect(err).To(Equal(io.EOF))
+}
+
+type sendingServer struct {
+	emptyServiceServer
+	result chan error
+}
+
+func (ss *sendingServer) EmptyStream(stream testpb.EmptyService_EmptyStreamServer) error {
+	for {
+		if err := stream.Send(&testpb.Empty{}); err != nil {
+			ss.result <- err
+			return err
+		}
+	}
+}
+
+func TestStreamSendTimeout(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	ss := &sendingServer{result: make(chan error, 1)}
+	_, conn := newTestServer(t, comm.ServerConfig{
+		StreamSendTimeout: 200 * time.Millisecond,
+	}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEmptyServiceServer(srv.Server(), ss)
+	},
+		grpc.WithInitialWindowSize(64*1024),
+		grpc.WithInitialConnWindowSize(64*1024),
+	)
+
+	// the client never reads, so the handler blocks once flow control
+	// windows are exhausted
+	stream, err := testpb.NewEmptyServiceClient(conn).EmptyStream(context.Background())
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer stream.CloseSend()
+
+	var sendErr error
+	gt.Eventually(ss.result, 10*time.Second).Should(Receive(&sendErr))
+	gt.Expect(status.Code(sendErr)).To(Equal(codes.DeadlineExceeded))
+	gt.Expect(status.Convert(sendErr).Message()).To(Equal("timed out sending message, peer is not reading from the stream"))
+
+	// unary calls are not affected
+	_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	gt.Expect(err).NotTo(HaveOccurred())
+}
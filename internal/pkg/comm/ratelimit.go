@@ -0,0 +1,212 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// tokenBucket is a token bucket rate limiter. Tokens are added at rate per
+// second up to a maximum of burst tokens.
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// reserve takes a token from the bucket and returns how long the caller has
+// to wait before the token may be used. If the wait would exceed maxWait,
+// no token is taken, ok is false, and wait is the time until a token would
+// become available.
+func (tb *tokenBucket) reserve(maxWait time.Duration) (wait time.Duration, ok bool) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	now := tb.now()
+	if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens += elapsed.Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+	}
+	tb.last = now
+
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return 0, true
+	}
+
+	wait = time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+	if wait > maxWait {
+		return wait, false
+	}
+	tb.tokens--
+	return wait, true
+}
+
+// MessageRateLimit defines a token bucket limit on the number of messages
+// sent or received on a stream
+type MessageRateLimit struct {
+	// Rate is the sustained number of messages per second. A Rate of zero
+	// disables the limit.
+	Rate float64
+	// Burst is the number of messages that may be handled at once
+	// before the rate applies
+	Burst int
+	// MaxDelay is the longest a message is delayed waiting for the rate
+	// to allow it. A stream that would be delayed longer is considered to
+	// persistently exceed the limit and is aborted with ResourceExhausted.
+	MaxDelay time.Duration
+}
+
+// NewStreamMessageRateInterceptor returns a stream server interceptor that
+// throttles the messages received and sent on each stream according to the
+// recv and send limits. Each stream has its own buckets.
+func NewStreamMessageRateInterceptor(recv, send MessageRateLimit) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		rs := &rateLimitedServerStream{ServerStream: ss}
+		if recv.Rate > 0 {
+			rs.recvBucket = newTokenBucket(recv.Rate, recv.Burst)
+			rs.recvMaxDelay = recv.MaxDelay
+		}
+		if send.Rate > 0 {
+			rs.sendBucket = newTokenBucket(send.Rate, send.Burst)
+			rs.sendMaxDelay = send.MaxDelay
+		}
+		return handler(srv, rs)
+	}
+}
+
+type rateLimitedServerStream struct {
+	grpc.ServerStream
+	recvBucket   *tokenBucket
+	recvMaxDelay time.Duration
+	sendBucket   *tokenBucket
+	sendMaxDelay time.Duration
+}
+
+func (rs *rateLimitedServerStream) throttle(tb *tokenBucket, maxDelay time.Duration, direction string) error {
+	wait, ok := tb.reserve(maxDelay)
+	if !ok {
+		return status.Errorf(codes.ResourceExhausted, "stream %s message rate exceeded", direction)
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-rs.Context().Done():
+		return status.FromContextError(rs.Context().Err()).Err()
+	}
+}
+
+func (rs *rateLimitedServerStream) SendMsg(m interface{}) error {
+	if rs.sendBucket != nil {
+		if err := rs.throttle(rs.sendBucket, rs.sendMaxDelay, "send"); err != nil {
+			return err
+		}
+	}
+	return rs.ServerStream.SendMsg(m)
+}
+
+func (rs *rateLimitedServerStream) RecvMsg(m interface{}) error {
+	err := rs.ServerStream.RecvMsg(m)
+	if err != nil || rs.recvBucket == nil {
+		return err
+	}
+	return rs.throttle(rs.recvBucket, rs.recvMaxDelay, "receive")
+}
+
+// RateLimit defines a token bucket limit on the number of calls per second
+type RateLimit struct {
+	// Rate is the sustained number of calls per second
+	Rate float64
+	// Burst is the number of calls that may be made at once before the
+	// rate applies
+	Burst int
+}
+
+// methodRateLimiter enforces a global rate limit per method, shared by all
+// callers of the method
+type methodRateLimiter struct {
+	buckets map[string]*tokenBucket
+}
+
+func newMethodRateLimiter(limits map[string]RateLimit) *methodRateLimiter {
+	mrl := &methodRateLimiter{buckets: map[string]*tokenBucket{}}
+	for method, limit := range limits {
+		if limit.Rate > 0 {
+			mrl.buckets[method] = newTokenBucket(limit.Rate, limit.Burst)
+		}
+	}
+	return mrl
+}
+
+// allow takes a token from the bucket of the method, if any, and returns a
+// ResourceExhausted error carrying RetryInfo when the bucket is empty
+func (mrl *methodRateLimiter) allow(fullMethod string) error {
+	tb, ok := mrl.buckets[fullMethod]
+	if !ok {
+		return nil
+	}
+	wait, ok := tb.reserve(0)
+	if ok {
+		return nil
+	}
+
+	st := status.Newf(codes.ResourceExhausted, "rate limit exceeded for method %s", fullMethod)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(wait)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+func (mrl *methodRateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := mrl.allow(info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (mrl *methodRateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := mrl.allow(info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
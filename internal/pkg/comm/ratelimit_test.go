@@ -0,0 +1,198 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pingPong sends count messages on the stream and waits for each response
+func pingPong(stream testpb.EmptyService_EmptyStreamClient, count int) error {
+	for i := 0; i < count; i++ {
+		if err := stream.Send(&testpb.Empty{}); err != nil && err != io.EOF {
+			return err
+		}
+		if _, err := stream.Recv(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStreamMessageRateInterceptorThrottles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		recv, send comm.MessageRateLimit
+	}{
+		{
+			name: "recv",
+			recv: comm.MessageRateLimit{Rate: 20, Burst: 1, MaxDelay: time.Second},
+		},
+		{
+			name: "send",
+			send: comm.MessageRateLimit{Rate: 20, Burst: 1, MaxDelay: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, conn := newTestServer(t, comm.ServerConfig{
+				StreamInterceptors: []grpc.StreamServerInterceptor{comm.NewStreamMessageRateInterceptor(tt.recv, tt.send)},
+			}, registerEmptyService)
+			client := testpb.NewEmptyServiceClient(conn)
+			stream, err := client.EmptyStream(context.Background())
+			require.NoError(t, err)
+
+			// one message is allowed by the burst, the next five are
+			// throttled to 20 per second
+			start := time.Now()
+			err = pingPong(stream, 6)
+			require.NoError(t, err)
+			require.True(t, time.Since(start) >= 240*time.Millisecond, "expected stream to be throttled, took %s", time.Since(start))
+			require.NoError(t, stream.CloseSend())
+		})
+	}
+}
+
+func TestStreamMessageRateInterceptorExceeded(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		recv, send comm.MessageRateLimit
+		message    string
+	}{
+		{
+			name:    "recv",
+			recv:    comm.MessageRateLimit{Rate: 1, Burst: 2, MaxDelay: 10 * time.Millisecond},
+			message: "stream receive message rate exceeded",
+		},
+		{
+			name:    "send",
+			send:    comm.MessageRateLimit{Rate: 1, Burst: 2, MaxDelay: 10 * time.Millisecond},
+			message: "stream send message rate exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, conn := newTestServer(t, comm.ServerConfig{
+				StreamInterceptors: []grpc.StreamServerInterceptor{comm.NewStreamMessageRateInterceptor(tt.recv, tt.send)},
+			}, registerEmptyService)
+			client := testpb.NewEmptyServiceClient(conn)
+			stream, err := client.EmptyStream(context.Background())
+			require.NoError(t, err)
+
+			err = pingPong(stream, 2)
+			require.NoError(t, err)
+
+			err = pingPong(stream, 1)
+			require.Error(t, err)
+			require.Equal(t, codes.ResourceExhausted, status.Code(err))
+			require.Equal(t, tt.message, status.Convert(err).Message())
+		})
+	}
+}
+
+func TestStreamMessageRateInterceptorUnlimited(t *testing.T) {
+	t.Parallel()
+
+	_, conn := newTestServer(t, comm.ServerConfig{
+		StreamInterceptors: []grpc.StreamServerInterceptor{comm.NewStreamMessageRateInterceptor(comm.MessageRateLimit{}, comm.MessageRateLimit{})},
+	}, registerEmptyService)
+	client := testpb.NewEmptyServiceClient(conn)
+	stream, err := client.EmptyStream(context.Background())
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = pingPong(stream, 100)
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < 5*time.Second)
+	require.NoError(t, stream.CloseSend())
+}
+
+func TestMethodRateLimits(t *testing.T) {
+	t.Parallel()
+
+	_, conn := newTestServer(t, comm.ServerConfig{
+		MethodRateLimits: map[string]comm.RateLimit{
+			"/EmptyService/EmptyCall": {Rate: 20, Burst: 5},
+		},
+	}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	})
+	emptyClient := testpb.NewEmptyServiceClient(conn)
+
+	const callers = 8
+	const duration = 500 * time.Millisecond
+	var allowed, rejected uint32
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Since(start) < duration {
+				_, err := emptyClient.EmptyCall(context.Background(), &testpb.Empty{})
+				if err == nil {
+					atomic.AddUint32(&allowed, 1)
+					continue
+				}
+				atomic.AddUint32(&rejected, 1)
+				st := status.Convert(err)
+				assert.Equal(t, codes.ResourceExhausted, st.Code())
+				assert.Equal(t, "rate limit exceeded for method /EmptyService/EmptyCall", st.Message())
+				if assert.Len(t, st.Details(), 1) {
+					retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+					if assert.True(t, ok) {
+						delay, err := ptypes.Duration(retryInfo.RetryDelay)
+						assert.NoError(t, err)
+						assert.True(t, delay > 0 && delay <= 50*time.Millisecond, "unexpected retry delay %s", delay)
+					}
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// the burst plus the rate over the elapsed time bounds the aggregate
+	maxAllowed := 5 + uint32(elapsed.Seconds()*20) + 1
+	require.True(t, allowed <= maxAllowed, "allowed %d calls, expected at most %d", allowed, maxAllowed)
+	require.True(t, allowed >= 5, "allowed %d calls, expected at least the burst", allowed)
+	require.NotZero(t, rejected)
+
+	// methods without a limit are not affected
+	echoClient := testpb.NewEchoServiceClient(conn)
+	for i := 0; i < 50; i++ {
+		_, err := echoClient.EchoCall(context.Background(), &testpb.Echo{})
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/common/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ResponseTooLargeError is returned by calls whose response exceeded the
+// limit of a ResponseSizeGuardUnaryClientInterceptor. Its gRPC status is the
+// ResourceExhausted status reported by gRPC.
+type ResponseTooLargeError struct {
+	// Method is the full method name of the call
+	Method string
+	// Max is the maximum response size in bytes
+	Max int
+
+	err error
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response to %s exceeds the maximum size of %d bytes: %s", e.Method, e.Max, e.err)
+}
+
+func (e *ResponseTooLargeError) Cause() error {
+	return e.err
+}
+
+func (e *ResponseTooLargeError) Unwrap() error {
+	return e.err
+}
+
+func (e *ResponseTooLargeError) GRPCStatus() *status.Status {
+	return status.Convert(e.err)
+}
+
+var recvSizeExceeded = regexp.MustCompile(`^grpc: received message larger than max \(\d+ vs\. (\d+)\)$`)
+
+// ResponseSizeGuardUnaryClientInterceptor returns a unary client interceptor
+// limiting the size of responses to max bytes, overriding the limit of the
+// connection and of the call. Calls whose response exceeds the limit fail
+// with a *ResponseTooLargeError, and are logged and counted by counter, if
+// not nil, with the label of their connection. The label is empty unless the
+// connection was created by NewLabeledConnection and the interceptor is
+// chained after the label interceptors with grpc.WithChainUnaryInterceptor.
+func ResponseSizeGuardUnaryClientInterceptor(max int, counter metrics.Counter) grpc.UnaryClientInterceptor {
+	emitter := &metricsEmitter{}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.MaxCallRecvMsgSize(max))...)
+		if !exceedsRecvSize(err, max) {
+			return err
+		}
+		label := ConnectionLabelFromContext(ctx)
+		commLogger.Warningf("Response to %s on connection %q exceeds the maximum size of %d bytes", method, label, max)
+		if counter != nil {
+			service, m := serviceMethod(method)
+			emitter.emit(func() { counter.With("service", service, "method", m, "conn", label).Add(1) })
+		}
+		return &ResponseTooLargeError{Method: method, Max: max, err: err}
+	}
+}
+
+// exceedsRecvSize returns whether err reports a received message larger
+// than max. Comparing the limit in the message tells the local rejection of
+// a response apart from the rejection of the request by the server.
+func exceedsRecvSize(err error, max int) bool {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return false
+	}
+	match := recvSizeExceeded.FindStringSubmatch(strings.TrimSpace(st.Message()))
+	if match == nil {
+		return false
+	}
+	limit, err := strconv.Atoi(match[1])
+	return err == nil && limit == max
+}
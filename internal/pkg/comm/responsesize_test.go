@@ -0,0 +1,86 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestResponseSizeGuardUnaryClientInterceptor(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{MaxRecvMsgSizeUnary: 2000})
+	require.NoError(t, err)
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	defer srv.Stop()
+	go srv.Start()
+
+	counter := &metricsfakes.Counter{}
+	counter.WithReturns(counter)
+	client, err := comm.NewGRPCClient(comm.ClientConfig{
+		Timeout: testTimeout,
+		ExtraDialOptions: []grpc.DialOption{
+			grpc.WithChainUnaryInterceptor(comm.ResponseSizeGuardUnaryClientInterceptor(100, counter)),
+		},
+	})
+	require.NoError(t, err)
+	conn, err := client.NewLabeledConnection("echo-1", lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	echo := testpb.NewEchoServiceClient(conn)
+
+	_, err = echo.EchoCall(context.Background(), &testpb.Echo{Payload: make([]byte, 50)})
+	require.NoError(t, err)
+
+	// the guard takes precedence over the limit of the call
+	_, err = echo.EchoCall(context.Background(), &testpb.Echo{Payload: make([]byte, 1000)}, grpc.MaxCallRecvMsgSize(10000))
+	var tooLarge *comm.ResponseTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	require.Equal(t, "/EchoService/EchoCall", tooLarge.Method)
+	require.Equal(t, 100, tooLarge.Max)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.EqualError(t, err, "response to /EchoService/EchoCall exceeds the maximum size of 100 bytes: rpc error: code = ResourceExhausted desc = grpc: received message larger than max (1003 vs. 100)")
+	require.Equal(t, 1, counter.AddCallCount())
+	require.Equal(t, []string{"service", "EchoService", "method", "EchoCall", "conn", "echo-1"}, counter.WithArgsForCall(0))
+
+	// requests rejected by the server are not reported as large responses
+	_, err = echo.EchoCall(context.Background(), &testpb.Echo{Payload: make([]byte, 3000)})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.False(t, errors.As(err, &tooLarge))
+	require.Equal(t, 1, counter.AddCallCount())
+}
+
+func TestResponseSizeGuardWithoutCounter(t *testing.T) {
+	t.Parallel()
+
+	guard := comm.ResponseSizeGuardUnaryClientInterceptor(10, nil)
+	invoker := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+		return status.Error(codes.ResourceExhausted, "grpc: received message larger than max (20 vs. 10)")
+	}
+	err := guard(context.Background(), "/svc/method", nil, nil, nil, invoker)
+	var tooLarge *comm.ResponseTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+
+	invoker = func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	err = guard(context.Background(), "/svc/method", nil, nil, nil, invoker)
+	require.EqualError(t, err, "rpc error: code = ResourceExhausted desc = rate limit exceeded")
+}
@@ -0,0 +1,66 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type countingEmptyServiceServer struct {
+	emptyServiceServer
+	calls uint32
+}
+
+func (cs *countingEmptyServiceServer) EmptyCall(ctx context.Context, empty *testpb.Empty) (*testpb.Empty, error) {
+	atomic.AddUint32(&cs.calls, 1)
+	return cs.emptyServiceServer.EmptyCall(ctx, empty)
+}
+
+func TestReusePort(t *testing.T) {
+	t.Parallel()
+
+	srv1, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{ReusePort: true})
+	require.NoError(t, err)
+	address := srv1.Address()
+
+	// binding the same port without SO_REUSEPORT fails
+	_, err = comm.NewGRPCServer(address, comm.ServerConfig{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "address already in use")
+
+	srv2, err := comm.NewGRPCServer(address, comm.ServerConfig{ReusePort: true})
+	require.NoError(t, err)
+	require.Equal(t, address, srv2.Address())
+
+	svc1 := &countingEmptyServiceServer{}
+	svc2 := &countingEmptyServiceServer{}
+	testpb.RegisterEmptyServiceServer(srv1.Server(), svc1)
+	testpb.RegisterEmptyServiceServer(srv2.Server(), svc2)
+	go srv1.Start()
+	defer srv1.Stop()
+	go srv2.Start()
+	defer srv2.Stop()
+
+	// the kernel distributes new connections between both listeners
+	for i := 0; i < 200; i++ {
+		_, err := invokeEmptyCall(address, grpc.WithBlock(), grpc.WithInsecure())
+		require.NoError(t, err)
+		if atomic.LoadUint32(&svc1.calls) > 0 && atomic.LoadUint32(&svc2.calls) > 0 {
+			return
+		}
+	}
+	t.Fatalf("expected both servers to accept connections, got %d and %d calls", svc1.calls, svc2.calls)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// rootCAFileWatcher reloads the client root CAs of a server when the files
+// they are read from change. The directories containing the files are
+// watched so that files replaced by a rename are also picked up.
+type rootCAFileWatcher struct {
+	files   map[string]struct{}
+	watcher *fsnotify.Watcher
+}
+
+func newRootCAFileWatcher(files []string) (*rootCAFileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create root CA file watcher")
+	}
+
+	rw := &rootCAFileWatcher{files: map[string]struct{}{}, watcher: watcher}
+	dirs := map[string]struct{}{}
+	for _, file := range files {
+		file = filepath.Clean(file)
+		rw.files[file] = struct{}{}
+		dirs[filepath.Dir(file)] = struct{}{}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, errors.Wrapf(err, "failed to watch %s", dir)
+		}
+	}
+	return rw, nil
+}
+
+// load reads and validates the PEM-encoded root CAs of every watched file
+func (rw *rootCAFileWatcher) load() ([][]byte, error) {
+	var roots [][]byte
+	for file := range rw.files {
+		pemCerts, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read root CA file")
+		}
+		certs, err := pemToX509Certs(pemCerts)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to parse root CA file %s", file)
+		}
+		if len(certs) == 0 {
+			return nil, errors.Errorf("no root certificates found in %s", file)
+		}
+		roots = append(roots, pemCerts)
+	}
+	return roots, nil
+}
+
+// watch calls reload with the root CAs every time a watched file changes
+// until the watcher is closed. Files that fail to load are reported to
+// onError instead.
+func (rw *rootCAFileWatcher) watch(reload func([][]byte) error, onError func(error)) {
+	for {
+		select {
+		case event, ok := <-rw.watcher.Events:
+			if !ok {
+				return
+			}
+			if _, watched := rw.files[filepath.Clean(event.Name)]; !watched {
+				continue
+			}
+			roots, err := rw.load()
+			if err == nil {
+				err = reload(roots)
+			}
+			if err != nil {
+				onError(err)
+			}
+		case err, ok := <-rw.watcher.Errors:
+			if !ok {
+				return
+			}
+			onError(err)
+		}
+	}
+}
+
+func (rw *rootCAFileWatcher) close() {
+	rw.watcher.Close()
+}
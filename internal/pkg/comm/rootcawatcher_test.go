@@ -0,0 +1,178 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestClientRootCAFiles(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "rootcawatcher")
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+
+	serverCA, err := tlsgen.NewCA()
+	gt.Expect(err).NotTo(HaveOccurred())
+	serverKeyPair, err := serverCA.NewServerCertKeyPair("127.0.0.1")
+	gt.Expect(err).NotTo(HaveOccurred())
+	ca1, err := tlsgen.NewCA()
+	gt.Expect(err).NotTo(HaveOccurred())
+	client1, err := ca1.NewClientCertKeyPair()
+	gt.Expect(err).NotTo(HaveOccurred())
+	ca2, err := tlsgen.NewCA()
+	gt.Expect(err).NotTo(HaveOccurred())
+	client2, err := ca2.NewClientCertKeyPair()
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	err = ioutil.WriteFile(caFile, ca1.CertBytes(), 0644)
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	var lock sync.Mutex
+	var warnings []string
+	logger := flogging.MustGetLogger("test").WithOptions(zap.Hooks(func(entry zapcore.Entry) error {
+		if entry.Level == zapcore.WarnLevel {
+			lock.Lock()
+			warnings = append(warnings, entry.Message)
+			lock.Unlock()
+		}
+		return nil
+	}))
+	loggedWarning := func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		return strings.Join(warnings, "\n")
+	}
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:            true,
+			RequireClientCert: true,
+			Certificate:       serverKeyPair.Cert,
+			Key:               serverKeyPair.Key,
+		},
+		ClientRootCAFiles: []string{caFile},
+		Logger:            logger,
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	go srv.Start()
+	defer srv.Stop()
+
+	handshake := func(clientKeyPair *tlsgen.CertKeyPair) error {
+		cert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+		gt.Expect(err).NotTo(HaveOccurred())
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(serverCA.CertBytes())
+		conn, err := tls.Dial("tcp", srv.Address(), &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      rootCAs,
+			MaxVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	gt.Expect(handshake(client1)).To(Succeed())
+	gt.Expect(handshake(client2)).NotTo(Succeed())
+
+	// replacing the file contents swaps the pool
+	err = ioutil.WriteFile(caFile, ca2.CertBytes(), 0644)
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Eventually(func() error { return handshake(client2) }, 5*time.Second).Should(Succeed())
+	gt.Expect(handshake(client1)).NotTo(Succeed())
+
+	// replacing the file by a rename is observed through its directory
+	tmpFile := filepath.Join(dir, "ca.pem.tmp")
+	err = ioutil.WriteFile(tmpFile, append(ca1.CertBytes(), ca2.CertBytes()...), 0644)
+	gt.Expect(err).NotTo(HaveOccurred())
+	err = os.Rename(tmpFile, caFile)
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Eventually(func() error { return handshake(client1) }, 5*time.Second).Should(Succeed())
+	gt.Expect(handshake(client2)).To(Succeed())
+
+	// invalid contents are rejected and the current pool is retained
+	err = ioutil.WriteFile(caFile, []byte("not a certificate"), 0644)
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Eventually(loggedWarning, 5*time.Second).Should(ContainSubstring(
+		"Failed reloading client root CAs from file, retaining current ones: no root certificates found in " + caFile,
+	))
+	gt.Expect(handshake(client1)).To(Succeed())
+	gt.Expect(handshake(client2)).To(Succeed())
+}
+
+func TestClientRootCAFilesInvalid(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "rootcawatcher")
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	err = ioutil.WriteFile(invalidFile, []byte("not a certificate"), 0644)
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	ca, err := tlsgen.NewCA()
+	gt.Expect(err).NotTo(HaveOccurred())
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	gt.Expect(err).NotTo(HaveOccurred())
+	secOpts := comm.SecureOptions{
+		UseTLS:      true,
+		Certificate: serverKeyPair.Cert,
+		Key:         serverKeyPair.Key,
+	}
+
+	tests := []struct {
+		name   string
+		config comm.ServerConfig
+		errMsg string
+	}{
+		{
+			name:   "without TLS",
+			config: comm.ServerConfig{ClientRootCAFiles: []string{invalidFile}},
+			errMsg: "serverConfig.ClientRootCAFiles requires UseTLS to be true",
+		},
+		{
+			name:   "invalid file",
+			config: comm.ServerConfig{SecOpts: secOpts, ClientRootCAFiles: []string{invalidFile}},
+			errMsg: "no root certificates found in " + invalidFile,
+		},
+		{
+			name:   "missing directory",
+			config: comm.ServerConfig{SecOpts: secOpts, ClientRootCAFiles: []string{filepath.Join(dir, "missing", "ca.pem")}},
+			errMsg: "failed to watch " + filepath.Join(dir, "missing") + ": no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			gt := NewGomegaWithT(t)
+			_, err := comm.NewGRPCServer("127.0.0.1:0", tt.config)
+			gt.Expect(err).To(MatchError(tt.errMsg))
+		})
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// oidSignedCertificateTimestampList identifies the certificate extension
+// embedding signed certificate timestamps (RFC 6962, section 3.3)
+var oidSignedCertificateTimestampList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// requireEmbeddedSCTs returns a VerifyPeerCertificate function rejecting
+// leaf certificates that do not embed signed certificate timestamps before
+// calling verify, if not nil
+func requireEmbeddedSCTs(verify func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no server certificate to check for signed certificate timestamps")
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return errors.Wrap(err, "failed to parse server certificate")
+		}
+		if err := checkEmbeddedSCTs(cert); err != nil {
+			return errors.WithMessagef(err, "server certificate %s rejected", cert.Subject)
+		}
+		if verify != nil {
+			return verify(rawCerts, verifiedChains)
+		}
+		return nil
+	}
+}
+
+// checkEmbeddedSCTs checks that cert embeds a well formed, non-empty list
+// of signed certificate timestamps. The timestamps are not validated.
+func checkEmbeddedSCTs(cert *x509.Certificate) error {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSignedCertificateTimestampList) {
+			continue
+		}
+		var list []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &list); err != nil || len(rest) != 0 {
+			return errors.New("malformed signed certificate timestamp list")
+		}
+		if len(list) < 2 || int(binary.BigEndian.Uint16(list)) != len(list)-2 {
+			return errors.New("malformed signed certificate timestamp list")
+		}
+		scts := list[2:]
+		if len(scts) == 0 {
+			return errors.New("empty signed certificate timestamp list")
+		}
+		for len(scts) > 0 {
+			if len(scts) < 2 {
+				return errors.New("malformed signed certificate timestamp list")
+			}
+			n := int(binary.BigEndian.Uint16(scts))
+			if n == 0 || len(scts)-2 < n {
+				return errors.New("malformed signed certificate timestamp list")
+			}
+			scts = scts[2+n:]
+		}
+		return nil
+	}
+	return errors.New("no embedded signed certificate timestamps")
+}
@@ -0,0 +1,161 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// sctList encodes SCTs as the value of the embedded SCT list extension;
+// the SCTs themselves are opaque
+func sctList(t *testing.T, scts ...[]byte) []byte {
+	var list []byte
+	for _, sct := range scts {
+		list = append(list, byte(len(sct)>>8), byte(len(sct)))
+		list = append(list, sct...)
+	}
+	list = append([]byte{byte(len(list) >> 8), byte(len(list))}, list...)
+	value, err := asn1.Marshal(list)
+	require.NoError(t, err)
+	return value
+}
+
+// sctTestCerts returns a PEM-encoded CA and a server certificate issued by
+// it for each of the SCT list extension values; nil values omit the
+// extension
+func sctTestCerts(t *testing.T, sctListValues ...[]byte) ([]byte, []tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sct-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	var certs []tls.Certificate
+	for i, value := range sctListValues {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: "sct-server"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		if value != nil {
+			template.ExtraExtensions = []pkix.Extension{{
+				Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2},
+				Value: value,
+			}}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		certs = append(certs, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key})
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), certs
+}
+
+func TestRequireSCT(t *testing.T) {
+	t.Parallel()
+
+	caPEM, certs := sctTestCerts(t,
+		sctList(t, []byte("first sct"), []byte("second sct")),
+		nil,
+		sctList(t),
+		[]byte{0x04, 0x03, 0x00, 0x05, 0x01},
+	)
+
+	serve := func(cert tls.Certificate) string {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})))
+		go srv.Serve(lis)
+		t.Cleanup(srv.Stop)
+		return lis.Addr().String()
+	}
+
+	tests := []struct {
+		name       string
+		cert       tls.Certificate
+		requireSCT bool
+		verify     func([][]byte, [][]*x509.Certificate) error
+		errMsg     string
+	}{
+		{name: "with SCTs", cert: certs[0], requireSCT: true},
+		{name: "without SCTs", cert: certs[1], requireSCT: true, errMsg: "server certificate CN=sct-server rejected: no embedded signed certificate timestamps"},
+		{name: "empty SCT list", cert: certs[2], requireSCT: true, errMsg: "rejected: empty signed certificate timestamp list"},
+		{name: "malformed SCT list", cert: certs[3], requireSCT: true, errMsg: "rejected: malformed signed certificate timestamp list"},
+		{name: "without SCTs not required", cert: certs[1]},
+		{
+			name:       "with SCTs and custom verification",
+			cert:       certs[0],
+			requireSCT: true,
+			verify: func([][]byte, [][]*x509.Certificate) error {
+				return errors.New("custom verification failed")
+			},
+			errMsg: "custom verification failed",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := comm.NewGRPCClient(comm.ClientConfig{
+				SecOpts: comm.SecureOptions{
+					UseTLS:            true,
+					ServerRootCAs:     [][]byte{caPEM},
+					RequireSCT:        tt.requireSCT,
+					VerifyCertificate: tt.verify,
+				},
+				Timeout: testTimeout,
+			})
+			require.NoError(t, err)
+
+			// the handshake error is only logged, so the reason of the
+			// rejection is checked by calling the verification function
+			var verify func([][]byte, [][]*x509.Certificate) error
+			conn, err := client.NewConnection(serve(tt.cert), func(tlsConfig *tls.Config) {
+				verify = tlsConfig.VerifyPeerCertificate
+			})
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				require.Contains(t, verify(tt.cert.Certificate, nil).Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			conn.Close()
+		})
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// DiffSecureOptions returns a human-readable description of every
+// difference between the secure options a and b, e.g. to log what a
+// configuration change modifies. Certificates are described by their
+// subject, serial number and SHA-256 fingerprint; private keys are only
+// reported as changed. A nil argument is treated as empty options.
+func DiffSecureOptions(a, b *SecureOptions) []string {
+	if a == nil {
+		a = &SecureOptions{}
+	}
+	if b == nil {
+		b = &SecureOptions{}
+	}
+
+	var diffs []string
+	diffBool := func(name string, before, after bool) {
+		if before != after {
+			diffs = append(diffs, fmt.Sprintf("%s changed from %t to %t", name, before, after))
+		}
+	}
+	diffSet := func(name string, before, after bool) {
+		switch {
+		case !before && after:
+			diffs = append(diffs, name+" set")
+		case before && !after:
+			diffs = append(diffs, name+" unset")
+		}
+	}
+
+	diffBool("UseTLS", a.UseTLS, b.UseTLS)
+	diffBool("RequireClientCert", a.RequireClientCert, b.RequireClientCert)
+	if !bytes.Equal(a.Certificate, b.Certificate) {
+		diffs = append(diffs, fmt.Sprintf("certificate changed from %s to %s", describeCerts(a.Certificate), describeCerts(b.Certificate)))
+	}
+	if !bytes.Equal(a.Key, b.Key) {
+		diffs = append(diffs, "private key changed")
+	}
+	diffs = append(diffs, diffCertSets("server root CA", a.ServerRootCAs, b.ServerRootCAs)...)
+	diffs = append(diffs, diffCertSets("client root CA", a.ClientRootCAs, b.ClientRootCAs)...)
+	diffBool("StrictServerRootCAs", a.StrictServerRootCAs, b.StrictServerRootCAs)
+	if !equalPEMSets(a.CRLs, b.CRLs) {
+		diffs = append(diffs, fmt.Sprintf("CRLs changed from %d to %d revocation lists", len(a.CRLs), len(b.CRLs)))
+	}
+	if !equalCipherSuites(a.CipherSuites, b.CipherSuites) {
+		diffs = append(diffs, fmt.Sprintf("cipher suites changed from %s to %s", cipherSuiteNames(a.CipherSuites), cipherSuiteNames(b.CipherSuites)))
+	}
+	if !equalCurves(a.CurvePreferences, b.CurvePreferences) {
+		diffs = append(diffs, fmt.Sprintf("curve preferences changed from %s to %s", curveNames(a.CurvePreferences), curveNames(b.CurvePreferences)))
+	}
+	if a.TimeShift != b.TimeShift {
+		diffs = append(diffs, fmt.Sprintf("TimeShift changed from %s to %s", a.TimeShift, b.TimeShift))
+	}
+	if a.Renegotiation != b.Renegotiation {
+		diffs = append(diffs, fmt.Sprintf("Renegotiation changed from %d to %d", a.Renegotiation, b.Renegotiation))
+	}
+	diffBool("RequireSCT", a.RequireSCT, b.RequireSCT)
+	if a.RequiredCertHostname != b.RequiredCertHostname {
+		diffs = append(diffs, fmt.Sprintf("RequiredCertHostname changed from %q to %q", a.RequiredCertHostname, b.RequiredCertHostname))
+	}
+	diffSet("VerifyCertificate", a.VerifyCertificate != nil, b.VerifyCertificate != nil)
+	diffSet("TLSConfigProvider", a.TLSConfigProvider != nil, b.TLSConfigProvider != nil)
+	diffSet("GetConfigForClient", a.GetConfigForClient != nil, b.GetConfigForClient != nil)
+	diffSet("KeyLogWriter", a.KeyLogWriter != nil, b.KeyLogWriter != nil)
+	diffBool("StrictUseTLS", a.StrictUseTLS, b.StrictUseTLS)
+	return diffs
+}
+
+// diffCertSets describes the certificates added to and removed from the
+// PEM-encoded sets before and after
+func diffCertSets(name string, before, after [][]byte) []string {
+	beforeCerts := certsByFingerprint(before)
+	afterCerts := certsByFingerprint(after)
+
+	var diffs []string
+	for _, c := range afterCerts {
+		if !containsFingerprint(beforeCerts, c.fingerprint) {
+			diffs = append(diffs, fmt.Sprintf("%s added: %s", name, c.description))
+		}
+	}
+	for _, c := range beforeCerts {
+		if !containsFingerprint(afterCerts, c.fingerprint) {
+			diffs = append(diffs, fmt.Sprintf("%s removed: %s", name, c.description))
+		}
+	}
+	return diffs
+}
+
+type describedCert struct {
+	fingerprint string
+	description string
+}
+
+// certsByFingerprint returns the certificates of the PEM-encoded set in
+// order; entries that cannot be parsed are described by the fingerprint of
+// their encoding
+func certsByFingerprint(pemSet [][]byte) []describedCert {
+	var certs []describedCert
+	for _, pemCerts := range pemSet {
+		parsed, err := pemToX509Certs(pemCerts)
+		if err != nil || len(parsed) == 0 {
+			fingerprint := sha256Hex(pemCerts)
+			certs = append(certs, describedCert{
+				fingerprint: fingerprint,
+				description: "unparsable entry (sha256 " + fingerprint + ")",
+			})
+			continue
+		}
+		for _, cert := range parsed {
+			fingerprint := sha256Hex(cert.Raw)
+			certs = append(certs, describedCert{
+				fingerprint: fingerprint,
+				description: fmt.Sprintf("%s (serial %s, sha256 %s)", cert.Subject, cert.SerialNumber, fingerprint),
+			})
+		}
+	}
+	return certs
+}
+
+func containsFingerprint(certs []describedCert, fingerprint string) bool {
+	for _, c := range certs {
+		if c.fingerprint == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// describeCerts describes the certificates of a PEM-encoded entry
+func describeCerts(pemCerts []byte) string {
+	if len(pemCerts) == 0 {
+		return "none"
+	}
+	var descriptions []string
+	for _, c := range certsByFingerprint([][]byte{pemCerts}) {
+		descriptions = append(descriptions, c.description)
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func equalPEMSets(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalCipherSuites(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func cipherSuiteNames(suites []uint16) string {
+	if len(suites) == 0 {
+		return "[default]"
+	}
+	names := make([]string, len(suites))
+	for i, suite := range suites {
+		names[i] = tls.CipherSuiteName(suite)
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+func equalCurves(a, b []tls.CurveID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func curveNames(curves []tls.CurveID) string {
+	if len(curves) == 0 {
+		return "[default]"
+	}
+	return fmt.Sprint(curves)
+}
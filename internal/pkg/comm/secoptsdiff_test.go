@@ -0,0 +1,161 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/stretchr/testify/require"
+)
+
+func describeTestCert(t *testing.T, pemCert []byte) string {
+	block, _ := pem.Decode(pemCert)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	sum := sha256.Sum256(cert.Raw)
+	return fmt.Sprintf("%s (serial %s, sha256 %s)", cert.Subject, cert.SerialNumber, hex.EncodeToString(sum[:]))
+}
+
+func TestDiffSecureOptions(t *testing.T) {
+	t.Parallel()
+
+	ca1, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	ca2, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	ca3, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	oldKeyPair, err := ca1.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	newKeyPair, err := ca1.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+
+	garbageSum := sha256.Sum256([]byte("garbage"))
+
+	base := comm.SecureOptions{
+		UseTLS:        true,
+		Certificate:   oldKeyPair.Cert,
+		Key:           oldKeyPair.Key,
+		ServerRootCAs: [][]byte{ca1.CertBytes(), ca2.CertBytes()},
+		ClientRootCAs: [][]byte{ca1.CertBytes()},
+	}
+
+	tests := []struct {
+		name     string
+		before   *comm.SecureOptions
+		after    func(comm.SecureOptions) *comm.SecureOptions
+		expected []string
+	}{
+		{
+			name:   "unchanged",
+			before: &base,
+			after: func(so comm.SecureOptions) *comm.SecureOptions {
+				// the same certificates in a different order
+				so.ServerRootCAs = [][]byte{ca2.CertBytes(), ca1.CertBytes()}
+				return &so
+			},
+		},
+		{
+			name:   "certificate renewed",
+			before: &base,
+			after: func(so comm.SecureOptions) *comm.SecureOptions {
+				so.Certificate = newKeyPair.Cert
+				so.Key = newKeyPair.Key
+				return &so
+			},
+			expected: []string{
+				"certificate changed from " + describeTestCert(t, oldKeyPair.Cert) + " to " + describeTestCert(t, newKeyPair.Cert),
+				"private key changed",
+			},
+		},
+		{
+			name:   "root CAs rotated",
+			before: &base,
+			after: func(so comm.SecureOptions) *comm.SecureOptions {
+				so.ServerRootCAs = [][]byte{ca1.CertBytes(), ca3.CertBytes()}
+				so.ClientRootCAs = [][]byte{append(append([]byte{}, ca1.CertBytes()...), ca2.CertBytes()...)}
+				return &so
+			},
+			expected: []string{
+				"server root CA added: " + describeTestCert(t, ca3.CertBytes()),
+				"server root CA removed: " + describeTestCert(t, ca2.CertBytes()),
+				"client root CA added: " + describeTestCert(t, ca2.CertBytes()),
+			},
+		},
+		{
+			name:   "mutual TLS enabled",
+			before: &base,
+			after: func(so comm.SecureOptions) *comm.SecureOptions {
+				so.RequireClientCert = true
+				so.CipherSuites = []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}
+				so.TimeShift = time.Minute
+				so.VerifyCertificate = func([][]byte, [][]*x509.Certificate) error { return nil }
+				return &so
+			},
+			expected: []string{
+				"RequireClientCert changed from false to true",
+				"cipher suites changed from [default] to [TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256]",
+				"TimeShift changed from 0s to 1m0s",
+				"VerifyCertificate set",
+			},
+		},
+		{
+			name:   "curves restricted",
+			before: &base,
+			after: func(so comm.SecureOptions) *comm.SecureOptions {
+				so.CurvePreferences = []tls.CurveID{tls.CurveP384, tls.CurveP256}
+				return &so
+			},
+			expected: []string{
+				"curve preferences changed from [default] to [CurveP384 CurveP256]",
+			},
+		},
+		{
+			name:   "TLS enabled",
+			before: nil,
+			after: func(comm.SecureOptions) *comm.SecureOptions {
+				return &comm.SecureOptions{UseTLS: true, Certificate: oldKeyPair.Cert, Key: oldKeyPair.Key}
+			},
+			expected: []string{
+				"UseTLS changed from false to true",
+				"certificate changed from none to " + describeTestCert(t, oldKeyPair.Cert),
+				"private key changed",
+			},
+		},
+		{
+			name:   "unparsable root CA",
+			before: &comm.SecureOptions{},
+			after: func(comm.SecureOptions) *comm.SecureOptions {
+				return &comm.SecureOptions{ClientRootCAs: [][]byte{[]byte("garbage")}}
+			},
+			expected: []string{
+				"client root CA added: unparsable entry (sha256 " + hex.EncodeToString(garbageSum[:]) + ")",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			diffs := comm.DiffSecureOptions(tt.before, tt.after(base))
+			require.Equal(t, tt.expected, diffs)
+			for _, diff := range diffs {
+				require.NotContains(t, diff, "PRIVATE KEY")
+			}
+		})
+	}
+}
@@ -9,16 +9,26 @@ package comm
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/common/metrics"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/stats"
 )
 
 type GRPCServer struct {
@@ -26,6 +36,8 @@ type GRPCServer struct {
 	address string
 	// Listener for handling network requests
 	listener net.Listener
+	// Wrappers applied in order to the listener when the server starts
+	listenerWrappers []func(net.Listener) net.Listener
 	// GRPC server
 	server *grpc.Server
 	// Certificate presented by the server for TLS communication
@@ -35,39 +47,179 @@ type GRPCServer struct {
 	lock *sync.Mutex
 	// TLS configuration used by the grpc server
 	tls *TLSConfig
+	// whether the TLS configuration is built from the secure options, as
+	// opposed to returned by a TLSConfigProvider
+	reloadableTLS bool
 	// Server for gRPC Health Check Protocol.
 	healthServer *health.Server
+	// Logger used by the server
+	logger *flogging.FabricLogger
+	// Source of client root CAs and the interval at which it is polled
+	clientRootCAProvider func() ([][]byte, error)
+	refreshInterval      time.Duration
+	// Watcher of the files client root CAs are loaded from
+	rootCAFileWatcher *rootCAFileWatcher
+	// Per method call statistics
+	methodStatsRecorder *MethodStatsRecorder
+	// Rejects the calls to services that are not serving
+	serviceDrainer *serviceDrainer
+	// Keepalive options the server was created with
+	keepaliveOptions KeepaliveOptions
+	// Reason sent to clients in the GOAWAY frames of a graceful stop, if
+	// it is sent
+	drainReason     atomic.Value
+	sendDrainReason bool
+	// Calls being handled and the interval at which their number is
+	// logged during a graceful stop
+	inFlight              *inFlightCounter
+	drainProgressInterval time.Duration
+	// Compressors used by the clients of every connection
+	compressionStats *compressionStatsHandler
+	// Window before the expiry of the server certificate in which the
+	// server reports NOT_SERVING, and the channel notified of new server
+	// certificates
+	certExpiryWindow time.Duration
+	certChanged      chan struct{}
+	// RPCs of every open connection, if they are counted
+	connRPCs *connRPCsHandler
+	// Connections accepted and not closed yet, if they are tracked
+	openConns *openConnTracker
+	// Open TLS connections, recycled after certificate rotations
+	tlsConns *connSet
+	// Flags the clients negotiating lower TLS versions, if not nil
+	tlsDowngrades *TLSDowngradeDetector
+	// Most recent connection errors, if they are kept
+	connErrors *connErrorLog
+	// closed when the server is stopped
+	stopChan chan struct{}
+	stopOnce sync.Once
+	// Applies the metric updates of the server until metricsDone is closed,
+	// once the server stopped
+	metrics     *metricsEmitter
+	metricsDone chan struct{}
+	metricsOnce sync.Once
 }
 
 // NewGRPCServer creates a new implementation of a GRPCServer given a
 // listen address
 func NewGRPCServer(address string, serverConfig ServerConfig) (*GRPCServer, error) {
-	if address == "" {
-		return nil, errors.New("missing address parameter")
+	if err := ValidateListenAddress(address); err != nil {
+		return nil, err
 	}
 	//create our listener
-	lis, err := net.Listen("tcp", address)
-
+	var lis net.Listener
+	var err error
+	if serverConfig.ReusePort {
+		lis, err = listenReusePort(address)
+	} else {
+		lis, err = net.Listen("tcp", address)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if serverConfig.ListenBacklog > 0 {
+		if err := setListenBacklog(lis, serverConfig.ListenBacklog); err != nil {
+			logger := serverConfig.Logger
+			if logger == nil {
+				logger = commLogger
+			}
+			logger.Warningf("Keeping the default listen backlog for %s: %s", lis.Addr(), err)
+		}
+	}
 	return NewGRPCServerFromListener(lis, serverConfig)
 }
 
+// ValidateListenAddress checks that address is a valid TCP listen address of
+// the form host:port. The host may be empty, an IP address, or a name; IPv6
+// addresses must be enclosed in square brackets. The port may be empty or
+// zero to listen on an ephemeral port, or a service name such as http.
+//
+// Only the syntax of the address and the port are validated; the host is
+// not resolved. Resolving it would make validation depend on the DNS being
+// reachable, and possibly block, and its result could differ from the one
+// at listen time anyway. net.Listen resolves the host and reports the names
+// that do not resolve.
+func ValidateListenAddress(address string) error {
+	if address == "" {
+		return errors.New("missing address parameter")
+	}
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		if strings.Count(address, ":") > 1 && !strings.HasPrefix(address, "[") {
+			return errors.WithMessagef(err, "invalid listen address %s, IPv6 addresses must be enclosed in square brackets", address)
+		}
+		return errors.WithMessagef(err, "invalid listen address %s", address)
+	}
+
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			// service names such as http are resolved by net.Listen
+			if _, lookupErr := net.LookupPort("tcp", port); lookupErr != nil {
+				return errors.Errorf("invalid port %q in listen address %s", port, address)
+			}
+		} else if n < 0 || n > 65535 {
+			return errors.Errorf("port %d in listen address %s is out of range [0, 65535]", n, address)
+		}
+	}
+
+	return nil
+}
+
 // NewGRPCServerFromListener creates a new implementation of a GRPCServer given
 // an existing net.Listener instance using default keepalive
 func NewGRPCServerFromListener(listener net.Listener, serverConfig ServerConfig) (*GRPCServer, error) {
 	grpcServer := &GRPCServer{
-		address:  listener.Addr().String(),
-		listener: listener,
-		lock:     &sync.Mutex{},
+		address:               listener.Addr().String(),
+		listener:              listener,
+		lock:                  &sync.Mutex{},
+		logger:                serverConfig.Logger,
+		serviceDrainer:        newServiceDrainer(),
+		tlsConns:              newConnSet(),
+		inFlight:              &inFlightCounter{},
+		stopChan:              make(chan struct{}),
+		drainProgressInterval: serverConfig.DrainProgressInterval,
+		tlsDowngrades:         serverConfig.TLSDowngradeDetector,
+		sendDrainReason:       serverConfig.SendDrainReason,
+	}
+	if serverConfig.ConnectionErrorHistory > 0 {
+		grpcServer.connErrors = newConnErrorLog(serverConfig.ConnectionErrorHistory)
 	}
+	if grpcServer.logger == nil {
+		grpcServer.logger = commLogger
+	}
+	grpcServer.metricsDone = make(chan struct{})
+	grpcServer.metrics = newMetricsEmitter(grpcServer.logger, grpcServer.metricsDone)
 
 	//set up our server options
 	var serverOpts []grpc.ServerOption
 
 	secureConfig := serverConfig.SecOpts
-	if secureConfig.UseTLS {
+	var observeHandshake func(time.Duration)
+	if serverConfig.ServerStatsHandler != nil {
+		observeHandshake = serverConfig.ServerStatsHandler.observeHandshake
+	}
+	if secureConfig.TLSConfigProvider != nil {
+		tlsConfig, err := secureConfig.TLSConfigProvider()
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to get TLS config from serverConfig.SecOpts.TLSConfigProvider")
+		}
+		if tlsConfig == nil {
+			return nil, errors.New("serverConfig.SecOpts.TLSConfigProvider returned a nil TLS config")
+		}
+		if len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil {
+			return nil, errors.New("TLS config from serverConfig.SecOpts.TLSConfigProvider must contain Certificates or GetCertificate")
+		}
+		if len(tlsConfig.Certificates) > 0 {
+			grpcServer.serverCertificate.Store(tlsConfig.Certificates[0])
+		}
+
+		// the provided config is cloned so that it is never modified
+		grpcServer.tls = NewTLSConfig(tlsConfig.Clone())
+		creds := newServerCreds(grpcServer.tls, serverConfig.Logger, observeHandshake, serverConfig.ExpiredClientCertCounter, grpcServer.metrics)
+		serverOpts = append(serverOpts, grpc.Creds(grpcServer.wrapCredentials(creds)))
+	} else if secureConfig.UseTLS {
 		//both key and cert are required
 		if secureConfig.Key != nil && secureConfig.Certificate != nil {
 			//load server public and private keys
@@ -78,57 +230,192 @@ func NewGRPCServerFromListener(listener net.Listener, serverConfig ServerConfig)
 
 			grpcServer.serverCertificate.Store(cert)
 
+			if err := secureConfig.checkCurvePreferences(); err != nil {
+				return nil, err
+			}
+
 			//set up our TLS config
 			if len(secureConfig.CipherSuites) == 0 {
 				secureConfig.CipherSuites = DefaultTLSCipherSuites
 			}
-			getCert := func(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
-				cert := grpcServer.serverCertificate.Load().(tls.Certificate)
-				return &cert, nil
+			crls, err := parseCRLs(secureConfig.CRLs)
+			if err != nil {
+				return nil, err
+			}
+			policy := &clientCertPolicy{
+				crls:    crls,
+				dryRun:  serverConfig.TLSPolicyDryRun,
+				logger:  grpcServer.logger,
+				counter: serverConfig.TLSPolicyDryRunCounter,
+				emitter: grpcServer.metrics,
 			}
 
-			grpcServer.tls = NewTLSConfig(&tls.Config{
-				VerifyPeerCertificate:  secureConfig.VerifyCertificate,
-				GetCertificate:         getCert,
+			tlsConfig := &tls.Config{
+				VerifyPeerCertificate:  policy.verifier(secureConfig.VerifyCertificate),
+				GetCertificate:         certificateGetter(cert),
 				SessionTicketsDisabled: true,
 				CipherSuites:           secureConfig.CipherSuites,
-			})
+				CurvePreferences:       secureConfig.CurvePreferences,
+				KeyLogWriter:           secureConfig.KeyLogWriter,
+			}
+			if secureConfig.KeyLogWriter != nil {
+				grpcServer.logger.Warning("TLS key logging is enabled for the server, the traffic of its connections can be decrypted; it must not be used in production")
+			}
 
 			if serverConfig.SecOpts.TimeShift > 0 {
 				timeShift := serverConfig.SecOpts.TimeShift
-				grpcServer.tls.config.Time = func() time.Time {
+				tlsConfig.Time = func() time.Time {
 					return time.Now().Add((-1) * timeShift)
 				}
 			}
-			grpcServer.tls.config.ClientAuth = tls.RequestClientCert
+			tlsConfig.ClientAuth = tls.RequestClientCert
 			//check if client authentication is required
 			if secureConfig.RequireClientCert {
 				//require TLS client auth
-				grpcServer.tls.config.ClientAuth = tls.RequireAndVerifyClientCert
-				//if we have client root CAs, create a certPool
-				if len(secureConfig.ClientRootCAs) > 0 {
-					grpcServer.tls.config.ClientCAs = x509.NewCertPool()
-					for _, clientRootCA := range secureConfig.ClientRootCAs {
-						err = grpcServer.appendClientRootCA(clientRootCA)
-						if err != nil {
-							return nil, err
-						}
+				tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			if getConfigForClient := secureConfig.GetConfigForClient; getConfigForClient != nil {
+				tlsConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+					opts, err := getConfigForClient(hello)
+					if err != nil || opts == nil {
+						return nil, err
+					}
+					connOpts := *opts
+					if connOpts.KeyLogWriter == nil {
+						connOpts.KeyLogWriter = secureConfig.KeyLogWriter
+					}
+					if connOpts.CurvePreferences == nil {
+						connOpts.CurvePreferences = secureConfig.CurvePreferences
+					}
+					return newClientHelloTLSConfig(connOpts, policy)
+				}
+			}
+			grpcServer.tls = NewTLSConfig(tlsConfig)
+			grpcServer.reloadableTLS = true
+			//if client authentication is required and we have client root
+			//CAs, create a certPool
+			if secureConfig.RequireClientCert && len(secureConfig.ClientRootCAs) > 0 {
+				for _, clientRootCA := range secureConfig.ClientRootCAs {
+					err = grpcServer.appendClientRootCA(clientRootCA)
+					if err != nil {
+						return nil, err
 					}
 				}
 			}
 
 			// create credentials and add to server options
-			creds := NewServerTransportCredentials(grpcServer.tls, serverConfig.Logger)
-			serverOpts = append(serverOpts, grpc.Creds(creds))
+			creds := newServerCreds(grpcServer.tls, serverConfig.Logger, observeHandshake, serverConfig.ExpiredClientCertCounter, grpcServer.metrics)
+			serverOpts = append(serverOpts, grpc.Creds(grpcServer.wrapCredentials(creds)))
 		} else {
 			return nil, errors.New("serverConfig.SecOpts must contain both Key and Certificate when UseTLS is true")
 		}
+	} else if err := secureConfig.checkIgnoredTLSFields(grpcServer.logger); err != nil {
+		return nil, err
+	}
+	if serverConfig.TLSDowngradeDetector != nil && !grpcServer.TLSEnabled() {
+		return nil, errors.New("serverConfig.TLSDowngradeDetector requires UseTLS to be true")
+	}
+	if serverConfig.ClientRootCAProvider != nil {
+		if !grpcServer.TLSEnabled() {
+			return nil, errors.New("serverConfig.ClientRootCAProvider requires UseTLS to be true")
+		}
+		grpcServer.clientRootCAProvider = serverConfig.ClientRootCAProvider
+		grpcServer.refreshInterval = serverConfig.RefreshInterval
+		if grpcServer.refreshInterval <= 0 {
+			grpcServer.refreshInterval = DefaultClientRootCARefreshInterval
+		}
+	}
+	if len(serverConfig.ClientRootCAFiles) > 0 {
+		if !grpcServer.TLSEnabled() {
+			return nil, errors.New("serverConfig.ClientRootCAFiles requires UseTLS to be true")
+		}
+		watcher, err := newRootCAFileWatcher(serverConfig.ClientRootCAFiles)
+		if err != nil {
+			return nil, err
+		}
+		clientRoots, err := watcher.load()
+		if err == nil {
+			err = grpcServer.SetClientRootCAs(clientRoots)
+		}
+		if err != nil {
+			watcher.close()
+			return nil, err
+		}
+		grpcServer.rootCAFileWatcher = watcher
+	}
+	if serverConfig.ConnectionLeakThreshold > 0 && !serverConfig.TrackOpenConnections {
+		return nil, errors.New("serverConfig.ConnectionLeakThreshold requires TrackOpenConnections to be true")
+	}
+	if serverConfig.TrackOpenConnections {
+		grpcServer.openConns = newOpenConnTracker(serverConfig.ConnectionLeakThreshold, grpcServer.logger)
+	}
+	// The listener wrappers are applied in this order, the first one
+	// wrapping the listener: Nagle's algorithm, which needs the TCP
+	// connections, the ListenerWrappers of the configuration, the tracking
+	// of open connections, plaintext detection, connection error
+	// classification and the drain reason, which is only added without TLS.
+	// Connection error classification is thus the outermost wrapper of TLS
+	// servers, as the transport credentials look for its connections.
+	if serverConfig.DisableNagle != nil {
+		grpcServer.listenerWrappers = append(grpcServer.listenerWrappers, grpcServer.noDelayListenerWrapper(*serverConfig.DisableNagle))
+	}
+	grpcServer.listenerWrappers = append(grpcServer.listenerWrappers, serverConfig.ListenerWrappers...)
+	if grpcServer.openConns != nil {
+		grpcServer.listenerWrappers = append(grpcServer.listenerWrappers, grpcServer.openConns.wrapListener)
+	}
+	if !grpcServer.TLSEnabled() {
+		grpcServer.listenerWrappers = append(grpcServer.listenerWrappers, grpcServer.wrapPlaintextListener)
+	}
+	if grpcServer.connErrors != nil {
+		grpcServer.listenerWrappers = append(grpcServer.listenerWrappers, grpcServer.wrapConnErrorListener)
+	}
+	if grpcServer.sendDrainReason && !grpcServer.TLSEnabled() {
+		grpcServer.listenerWrappers = append(grpcServer.listenerWrappers, grpcServer.wrapDrainReasonListener)
+	}
+	if serverConfig.HealthCertExpiryWindow > 0 {
+		if !serverConfig.HealthCheckEnabled {
+			return nil, errors.New("serverConfig.HealthCertExpiryWindow requires HealthCheckEnabled to be true")
+		}
+		if !grpcServer.TLSEnabled() {
+			return nil, errors.New("serverConfig.HealthCertExpiryWindow requires UseTLS to be true")
+		}
+		grpcServer.certExpiryWindow = serverConfig.HealthCertExpiryWindow
+		grpcServer.certChanged = make(chan struct{}, 1)
 	}
 	// set max send and recv msg sizes
+	compressor, err := lookupCompressor(serverConfig.Compressor)
+	if err != nil {
+		return nil, err
+	}
+	if compressor != nil {
+		serverOpts = append(serverOpts, grpc.RPCCompressor(legacyCompressor{compressor}))
+	}
 	serverOpts = append(serverOpts, grpc.MaxSendMsgSize(MaxSendMsgSize))
-	serverOpts = append(serverOpts, grpc.MaxRecvMsgSize(MaxRecvMsgSize))
+	var recvMsgSizeLimiter *recvMsgSizeLimiter
+	if hints := serverConfig.RecvMsgSizeHints; hints != nil {
+		if hints.Verify == nil {
+			return nil, errors.New("serverConfig.RecvMsgSizeHints.Verify must be set")
+		}
+		if hints.Max <= 0 {
+			return nil, errors.New("serverConfig.RecvMsgSizeHints.Max must be positive")
+		}
+	}
+	if serverConfig.MaxRecvMsgSizeUnary > 0 || serverConfig.MaxRecvMsgSizeStreaming > 0 || serverConfig.RecvMsgSizeHints != nil {
+		recvMsgSizeLimiter = newRecvMsgSizeLimiter(serverConfig.MaxRecvMsgSizeUnary, serverConfig.MaxRecvMsgSizeStreaming)
+		recvMsgSizeLimiter.skipOversized = serverConfig.SkipOversizedStreamMessages
+		recvMsgSizeLimiter.hints = serverConfig.RecvMsgSizeHints
+		recvMsgSizeLimiter.logger = grpcServer.logger
+		serverOpts = append(serverOpts, grpc.MaxRecvMsgSize(recvMsgSizeLimiter.grpcLimit()))
+	} else {
+		serverOpts = append(serverOpts, grpc.MaxRecvMsgSize(MaxRecvMsgSize))
+	}
 	// set the keepalive options
-	serverOpts = append(serverOpts, ServerKeepaliveOptions(serverConfig.KaOpts)...)
+	kaOpts, err := resolveKeepalive(serverConfig.KeepaliveProfile, serverConfig.KaOpts)
+	if err != nil {
+		return nil, err
+	}
+	serverOpts = append(serverOpts, ServerKeepaliveOptions(kaOpts)...)
+	grpcServer.keepaliveOptions = kaOpts
 	// set connection timeout
 	if serverConfig.ConnectionTimeout <= 0 {
 		serverConfig.ConnectionTimeout = DefaultConnectionTimeout
@@ -136,25 +423,123 @@ func NewGRPCServerFromListener(listener net.Listener, serverConfig ServerConfig)
 	serverOpts = append(
 		serverOpts,
 		grpc.ConnectionTimeout(serverConfig.ConnectionTimeout))
-	// set the interceptors
-	if len(serverConfig.StreamInterceptors) > 0 {
+	// set the interceptors, the ones derived from the configuration run
+	// before StreamInterceptors and UnaryInterceptors
+	streamInterceptors := []grpc.StreamServerInterceptor{grpcServer.inFlight.StreamServerInterceptor()}
+	unaryInterceptors := []grpc.UnaryServerInterceptor{grpcServer.inFlight.UnaryServerInterceptor()}
+	var checker *payloadChecker
+	if serverConfig.PrecheckPayloads {
+		checker = &payloadChecker{codec: serverConfig.Codec, maxSize: serverConfig.PrecheckMaxPayloadSize}
+		if checker.codec == nil {
+			checker.codec = encoding.GetCodec("proto")
+		}
+		// the interceptors must run first so that nothing sees the
+		// rejected requests
+		streamInterceptors = append(streamInterceptors, checker.StreamServerInterceptor())
+		unaryInterceptors = append(unaryInterceptors, checker.UnaryServerInterceptor())
+	}
+	if recvMsgSizeLimiter != nil {
+		// the interceptors must run before any that can fail the call, for
+		// the deferred messages to be released
+		streamInterceptors = append(streamInterceptors, recvMsgSizeLimiter.StreamServerInterceptor())
+		unaryInterceptors = append(unaryInterceptors, recvMsgSizeLimiter.UnaryServerInterceptor())
+	}
+	if len(serverConfig.VersionHeader) > 0 {
+		headerSetter := newHeaderSetter(serverConfig.VersionHeader)
+		streamInterceptors = append(streamInterceptors, headerSetter.StreamServerInterceptor())
+		unaryInterceptors = append(unaryInterceptors, headerSetter.UnaryServerInterceptor())
+	}
+	if serverConfig.MethodStatsRecorder != nil {
+		grpcServer.methodStatsRecorder = serverConfig.MethodStatsRecorder
+		streamInterceptors = append(streamInterceptors, serverConfig.MethodStatsRecorder.streamServerInterceptor(grpcServer.metrics))
+		unaryInterceptors = append(unaryInterceptors, serverConfig.MethodStatsRecorder.unaryServerInterceptor(grpcServer.metrics))
+	}
+	streamInterceptors = append(streamInterceptors, grpcServer.serviceDrainer.StreamServerInterceptor())
+	unaryInterceptors = append(unaryInterceptors, grpcServer.serviceDrainer.UnaryServerInterceptor())
+	if len(serverConfig.MethodRateLimits) > 0 {
+		rateLimiter := newMethodRateLimiter(serverConfig.MethodRateLimits)
+		streamInterceptors = append(streamInterceptors, rateLimiter.StreamServerInterceptor())
+		unaryInterceptors = append(unaryInterceptors, rateLimiter.UnaryServerInterceptor())
+	}
+	if len(serverConfig.MethodConcurrencyLimits) > 0 {
+		concurrencyLimiter := newMethodConcurrencyLimiter(serverConfig.MethodConcurrencyLimits)
+		streamInterceptors = append(streamInterceptors, concurrencyLimiter.StreamServerInterceptor())
+		unaryInterceptors = append(unaryInterceptors, concurrencyLimiter.UnaryServerInterceptor())
+	}
+	if serverConfig.StreamSendTimeout > 0 {
+		streamInterceptors = append(streamInterceptors, streamSendTimeoutInterceptor(serverConfig.StreamSendTimeout))
+	}
+	if serverConfig.FirstMessageTimeout > 0 {
+		streamInterceptors = append(streamInterceptors, firstMessageTimeoutInterceptor(serverConfig.FirstMessageTimeout))
+	}
+	if serverConfig.FaultInjector != nil {
+		grpcServer.logger.Warning("Fault injection is enabled for the server, calls may be delayed or failed on purpose; it must not be used in production")
+		streamInterceptors = append(streamInterceptors, faultInjectionStreamInterceptor(serverConfig.FaultInjector))
+		unaryInterceptors = append(unaryInterceptors, faultInjectionUnaryInterceptor(serverConfig.FaultInjector))
+	}
+	streamInterceptors = append(streamInterceptors, serverConfig.StreamInterceptors...)
+	unaryInterceptors = append(unaryInterceptors, serverConfig.UnaryInterceptors...)
+
+	if len(streamInterceptors) > 0 {
 		serverOpts = append(
 			serverOpts,
-			grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(serverConfig.StreamInterceptors...)),
+			grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(streamInterceptors...)),
 		)
 	}
 
-	if len(serverConfig.UnaryInterceptors) > 0 {
+	if len(unaryInterceptors) > 0 {
 		serverOpts = append(
 			serverOpts,
-			grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(serverConfig.UnaryInterceptors...)),
+			grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unaryInterceptors...)),
 		)
 	}
 
+	var statsHandlers []stats.Handler
 	if serverConfig.ServerStatsHandler != nil {
-		serverOpts = append(serverOpts, grpc.StatsHandler(serverConfig.ServerStatsHandler))
+		statsHandlers = append(statsHandlers, serverConfig.ServerStatsHandler)
+	}
+	if serverConfig.OrgStatsHandler != nil {
+		statsHandlers = append(statsHandlers, serverConfig.OrgStatsHandler)
+	}
+	if serverConfig.MessageSizeStatsHandler != nil {
+		statsHandlers = append(statsHandlers, serverConfig.MessageSizeStatsHandler)
+	}
+	if serverConfig.StreamCountStatsHandler != nil {
+		statsHandlers = append(statsHandlers, serverConfig.StreamCountStatsHandler)
+	}
+	if serverConfig.TrackCompression {
+		grpcServer.compressionStats = newCompressionStatsHandler()
+		statsHandlers = append(statsHandlers, grpcServer.compressionStats)
+	}
+	if serverConfig.TrackConnectionRPCs {
+		grpcServer.connRPCs = newConnRPCsHandler()
+		statsHandlers = append(statsHandlers, grpcServer.connRPCs)
+	}
+	if len(serverConfig.ConnValues) > 0 {
+		statsHandlers = append(statsHandlers, newConnValueHandler(serverConfig.ConnValues))
+	}
+	if statsHandler := newStatsHandler(statsHandlers...); statsHandler != nil {
+		serverOpts = append(serverOpts, grpc.StatsHandler(&emittingStatsHandler{Handler: statsHandler, emitter: grpcServer.metrics}))
 	}
 
+	codec := serverConfig.Codec
+	if checker != nil {
+		codec = checker
+	}
+	if recvMsgSizeLimiter != nil {
+		recvMsgSizeLimiter.codec = encoding.GetCodec("proto")
+		if codec != nil {
+			recvMsgSizeLimiter.codec = codec
+		}
+		codec = recvMsgSizeLimiter
+	}
+	if codec != nil {
+		serverOpts = append(serverOpts, grpc.CustomCodec(codec))
+	}
+
+	// extra server options come last so they can override the ones above
+	serverOpts = append(serverOpts, serverConfig.ExtraServerOptions...)
+
 	grpcServer.server = grpc.NewServer(serverOpts...)
 
 	if serverConfig.HealthCheckEnabled {
@@ -165,9 +550,119 @@ func NewGRPCServerFromListener(listener net.Listener, serverConfig ServerConfig)
 	return grpcServer, nil
 }
 
-// SetServerCertificate assigns the current TLS certificate to be the peer's server certificate
-func (gServer *GRPCServer) SetServerCertificate(cert tls.Certificate) {
+// NewGRPCServerFromFd creates a GRPCServer serving on the listening socket
+// of f, such as a file returned by ListenerFile and inherited from the
+// process being replaced. The socket is duplicated, so f can be closed once
+// NewGRPCServerFromFd returns. The socket is already bound, so
+// ServerConfig.ReusePort and ServerConfig.ListenBacklog do not apply.
+func NewGRPCServerFromFd(f *os.File, serverConfig ServerConfig) (*GRPCServer, error) {
+	lis, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create a listener from file %s", f.Name())
+	}
+	grpcServer, err := NewGRPCServerFromListener(lis, serverConfig)
+	if err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return grpcServer, nil
+}
+
+// SetServerCertificate assigns the current TLS certificate to be the peer's server certificate.
+// Existing connections keep the previous certificate until they close, unless
+// RecycleConnections is given.
+func (gServer *GRPCServer) SetServerCertificate(cert tls.Certificate, opts ...CertificateOption) {
+	update := &certificateUpdate{}
+	for _, opt := range opts {
+		opt(update)
+	}
+
+	gServer.serverCertificate.Store(cert)
+	if gServer.reloadableTLS {
+		gServer.tls.setCertificate(cert)
+	}
+	gServer.notifyCertChanged()
+	if update.recycle {
+		gServer.recycleConnections(update.recycleGrace)
+	}
+}
+
+// ReloadSecureOptions replaces the certificate, the client root CAs and
+// whether client certificates are required by the ones of newOpts. The new
+// options are validated first, and installed at once if they are valid:
+// every handshake uses either the previous certificate and CAs or the new
+// ones. The other fields of newOpts are ignored. Existing connections are
+// not affected, and a ClientRootCAProvider keeps refreshing the client root
+// CAs.
+func (gServer *GRPCServer) ReloadSecureOptions(newOpts *SecureOptions) error {
+	if !gServer.reloadableTLS {
+		return errors.New("secure options can only be reloaded on servers using TLS configured by SecOpts")
+	}
+	if newOpts == nil || !newOpts.UseTLS {
+		return errors.New("the new secure options must use TLS")
+	}
+	if newOpts.Key == nil || newOpts.Certificate == nil {
+		return errors.New("the new secure options must contain both Key and Certificate")
+	}
+	cert, err := tls.X509KeyPair(newOpts.Certificate, newOpts.Key)
+	if err != nil {
+		return errors.WithMessage(err, "failed to load the new certificate")
+	}
+	for _, serverRoot := range newOpts.ServerRootCAs {
+		if _, err := pemToX509Certs(serverRoot); err != nil {
+			return errors.WithMessage(err, "failed to load the new server root certificate(s)")
+		}
+	}
+	clientAuth := tls.RequestClientCert
+	var clientRoots []*x509.Certificate
+	if newOpts.RequireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+		for _, clientRoot := range newOpts.ClientRootCAs {
+			certs, err := pemToX509Certs(clientRoot)
+			if err != nil {
+				return errors.WithMessage(err, "failed to load the new client root certificate(s)")
+			}
+			if len(certs) < 1 {
+				return errors.New("no client root certificates found")
+			}
+			clientRoots = append(clientRoots, certs...)
+		}
+	}
+
+	// serialized with SetClientRootCAs
+	gServer.lock.Lock()
+	defer gServer.lock.Unlock()
+	gServer.tls.reload(cert, clientRoots, clientAuth)
 	gServer.serverCertificate.Store(cert)
+	gServer.notifyCertChanged()
+	return nil
+}
+
+// notifyCertChanged signals the change of the server certificate to the
+// certificate expiry checker, if any
+func (gServer *GRPCServer) notifyCertChanged() {
+	if gServer.certChanged != nil {
+		select {
+		case gServer.certChanged <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wrapCredentials wraps the transport credentials of the server to flag TLS
+// downgrades, record failed handshakes and add the drain reason to GOAWAY
+// frames
+func (gServer *GRPCServer) wrapCredentials(creds credentials.TransportCredentials) credentials.TransportCredentials {
+	if gServer.tlsDowngrades != nil {
+		creds = &downgradeCredentials{TransportCredentials: creds, detector: gServer.tlsDowngrades, logger: gServer.logger, emitter: gServer.metrics}
+	}
+	if gServer.connErrors != nil {
+		creds = &connErrorCredentials{TransportCredentials: creds, log: gServer.connErrors}
+	}
+	if gServer.sendDrainReason {
+		creds = &drainReasonCredentials{TransportCredentials: creds, reason: gServer.currentDrainReason, conns: gServer.tlsConns}
+	}
+	return creds
 }
 
 // Address returns the listen address for this GRPCServer instance
@@ -180,6 +675,72 @@ func (gServer *GRPCServer) Listener() net.Listener {
 	return gServer.listener
 }
 
+// ListenerFile returns a duplicate of the file descriptor of the server's TCP
+// listener so that it can be inherited by another process, e.g. through
+// exec.Cmd.ExtraFiles, for a zero downtime restart. The old process passes
+// the file to the new process, which serves on it with NewGRPCServerFromFd.
+// Once the new process is serving, the old process calls GracefulStop to
+// stop accepting and drain its existing connections, then exits. Closing the
+// old server's listener leaves the socket open in the new process.
+// The returned file is owned by the caller and should be closed once it has
+// been handed off. Closing it does not affect the server's listener.
+func (gServer *GRPCServer) ListenerFile() (*os.File, error) {
+	tcpListener, ok := gServer.listener.(*net.TCPListener)
+	if !ok {
+		return nil, errors.Errorf("listener of type %T is not a TCP listener", gServer.listener)
+	}
+	return tcpListener.File()
+}
+
+// RecentConnectionErrors returns the most recent connection errors of the
+// server, from the oldest to the most recent: failed TLS handshakes,
+// including rejected client certificates, and connections that failed with
+// a network error, such as a reset by the peer. At most
+// ServerConfig.ConnectionErrorHistory errors are kept; RecentConnectionErrors
+// returns nil if it is not positive.
+func (gServer *GRPCServer) RecentConnectionErrors() []ConnError {
+	if gServer.connErrors == nil {
+		return nil
+	}
+	return gServer.connErrors.snapshot()
+}
+
+// CompressionStats returns the number of connections accepted by the server
+// by the compressor their clients use, such as GzipCompressor or
+// ZstdCompressor, or NoCompression for clients that do not compress their
+// requests. The compressor of a connection is the one of its first call.
+// It returns nil unless ServerConfig.TrackCompression is set.
+func (gServer *GRPCServer) CompressionStats() map[string]int {
+	if gServer.compressionStats == nil {
+		return nil
+	}
+	return gServer.compressionStats.snapshot()
+}
+
+// RPCsByConnection returns the number of RPCs received on every open
+// connection keyed by the remote address of the connection, e.g. to spot
+// clients sending an excessive number of calls. The count of a connection
+// is dropped when it closes. It returns nil unless
+// ServerConfig.TrackConnectionRPCs is set.
+func (gServer *GRPCServer) RPCsByConnection() map[string]int {
+	if gServer.connRPCs == nil {
+		return nil
+	}
+	return gServer.connRPCs.snapshot()
+}
+
+// ConnectionLeakReport returns the connections accepted by the server that
+// are not closed yet, including the stack traces of the goroutines of gRPC
+// when their number exceeds ServerConfig.ConnectionLeakThreshold. It is a
+// debugging aid for connections that are never closed. It returns nil
+// unless ServerConfig.TrackOpenConnections is set.
+func (gServer *GRPCServer) ConnectionLeakReport() *ConnectionLeakReport {
+	if gServer.openConns == nil {
+		return nil
+	}
+	return gServer.openConns.report()
+}
+
 // Server returns the grpc.Server for the GRPCServer instance
 func (gServer *GRPCServer) Server() *grpc.Server {
 	return gServer.server
@@ -203,28 +764,178 @@ func (gServer *GRPCServer) MutualTLSRequired() bool {
 		gServer.tls.Config().ClientAuth == tls.RequireAndVerifyClientCert
 }
 
-// Start starts the underlying grpc.Server
+// MethodStats returns a snapshot of the per method call statistics keyed by
+// full method name, or nil if no MethodStatsRecorder was configured
+func (gServer *GRPCServer) MethodStats() map[string]MethodStats {
+	if gServer.methodStatsRecorder == nil {
+		return nil
+	}
+	return gServer.methodStatsRecorder.Stats()
+}
+
+// RegisteredServices returns the names of the methods of every service
+// registered with the underlying grpc.Server keyed by service name. Services
+// registered after the call are not included.
+func (gServer *GRPCServer) RegisteredServices() map[string][]string {
+	serviceInfo := gServer.server.GetServiceInfo()
+	services := make(map[string][]string, len(serviceInfo))
+	for name, info := range serviceInfo {
+		methods := make([]string, 0, len(info.Methods))
+		for _, method := range info.Methods {
+			methods = append(methods, method.Name)
+		}
+		sort.Strings(methods)
+		services[name] = methods
+	}
+	return services
+}
+
+// SetServiceServingStatus sets whether the service with the given full name
+// (e.g. package.Service) is serving. Calls to a service that is not serving
+// fail with Unavailable while other services keep serving, and its status
+// in the health service, if enabled, is NOT_SERVING. Services are serving
+// by default.
+func (gServer *GRPCServer) SetServiceServingStatus(service string, serving bool) {
+	gServer.serviceDrainer.setServing(service, serving)
+	if gServer.healthServer != nil {
+		gServer.healthServer.SetServingStatus(service, gServer.serviceDrainer.healthStatus(service))
+	}
+}
+
+// Start starts the underlying grpc.Server. The effective keepalive settings
+// are logged at debug level.
 func (gServer *GRPCServer) Start() error {
 	// if health check is enabled, set the health status for all registered services
 	if gServer.healthServer != nil {
 		for name := range gServer.server.GetServiceInfo() {
 			gServer.healthServer.SetServingStatus(
 				name,
-				healthpb.HealthCheckResponse_SERVING,
+				gServer.serviceDrainer.healthStatus(name),
 			)
 		}
 
-		gServer.healthServer.SetServingStatus(
-			"",
-			healthpb.HealthCheckResponse_SERVING,
-		)
+		if gServer.certExpiryWindow > 0 {
+			go gServer.monitorCertExpiry(gServer.updateCertExpiryStatus())
+		} else {
+			gServer.healthServer.SetServingStatus(
+				"",
+				healthpb.HealthCheckResponse_SERVING,
+			)
+		}
+	}
+	params := gServer.keepaliveOptions.EffectiveServerKeepaliveParams()
+	policy := gServer.keepaliveOptions.EffectiveServerKeepaliveEnforcementPolicy()
+	gServer.logger.Debugw("Starting server with effective keepalive settings",
+		"address", gServer.address,
+		"time", params.Time,
+		"timeout", params.Timeout,
+		"minTime", policy.MinTime,
+		"permitWithoutStream", policy.PermitWithoutStream,
+	)
+	if gServer.clientRootCAProvider != nil {
+		go gServer.refreshClientRootCAs()
+	}
+	if gServer.rootCAFileWatcher != nil {
+		go gServer.rootCAFileWatcher.watch(gServer.SetClientRootCAs, func(err error) {
+			gServer.logger.Warningf("Failed reloading client root CAs from file, retaining current ones: %s", err)
+		})
+	}
+	listener := gServer.listener
+	for _, wrap := range gServer.listenerWrappers {
+		listener = wrap(listener)
 	}
-	return gServer.server.Serve(gServer.listener)
+	return gServer.server.Serve(listener)
 }
 
 // Stop stops the underlying grpc.Server
 func (gServer *GRPCServer) Stop() {
+	gServer.stopRefreshing()
 	gServer.server.Stop()
+	gServer.stopMetrics()
+}
+
+// GracefulStop stops the server from accepting new connections and calls,
+// and blocks until the pending calls complete. Clients are sent reason as
+// the debug data of the GOAWAY frames closing their connections, e.g. for
+// their GoAwayHandler to log it. Reasons longer than 1024 bytes are
+// truncated. The reason is only sent when ServerConfig.SendDrainReason is
+// set, and not when the server uses transport credentials passed through
+// ExtraServerOptions. The number of calls still
+// in flight is logged every DrainProgressInterval while they complete.
+func (gServer *GRPCServer) GracefulStop(reason string) {
+	gServer.drainReason.Store(reason)
+	gServer.stopRefreshing()
+	if gServer.drainProgressInterval > 0 {
+		drained := make(chan struct{})
+		defer close(drained)
+		go gServer.logDrainProgress(drained)
+	}
+	gServer.server.GracefulStop()
+	gServer.stopMetrics()
+}
+
+// InFlightRPCs returns the number of calls currently being handled,
+// including the streams a graceful stop is waiting for
+func (gServer *GRPCServer) InFlightRPCs() int {
+	return gServer.inFlight.get()
+}
+
+// logDrainProgress logs the number of calls in flight every drain progress
+// interval until drained is closed
+func (gServer *GRPCServer) logDrainProgress(drained <-chan struct{}) {
+	ticker := time.NewTicker(gServer.drainProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			gServer.logger.Infof("Draining server on %s, %d RPCs in flight", gServer.address, gServer.InFlightRPCs())
+		case <-drained:
+			return
+		}
+	}
+}
+
+// stopRefreshing stops refreshing the client root CAs
+func (gServer *GRPCServer) stopRefreshing() {
+	gServer.stopOnce.Do(func() {
+		close(gServer.stopChan)
+		if gServer.rootCAFileWatcher != nil {
+			gServer.rootCAFileWatcher.close()
+		}
+	})
+}
+
+// stopMetrics stops the goroutine applying the metric updates of the server
+func (gServer *GRPCServer) stopMetrics() {
+	gServer.metricsOnce.Do(func() { close(gServer.metricsDone) })
+}
+
+func (gServer *GRPCServer) currentDrainReason() string {
+	reason, _ := gServer.drainReason.Load().(string)
+	return reason
+}
+
+// refreshClientRootCAs periodically replaces the client root CAs with the
+// ones returned by the client root CA provider until the server is stopped
+func (gServer *GRPCServer) refreshClientRootCAs() {
+	ticker := time.NewTicker(gServer.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		clientRoots, err := gServer.clientRootCAProvider()
+		if err != nil {
+			gServer.logger.Warningf("Failed fetching client root CAs, retaining current ones: %s", err)
+		} else if err := gServer.SetClientRootCAs(clientRoots); err != nil {
+			gServer.logger.Warningf("Failed refreshing client root CAs, retaining current ones: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-gServer.stopChan:
+			return
+		}
+	}
 }
 
 // internal function to add a PEM-encoded clientRootCA
@@ -251,18 +962,125 @@ func (gServer *GRPCServer) SetClientRootCAs(clientRoots [][]byte) error {
 	gServer.lock.Lock()
 	defer gServer.lock.Unlock()
 
-	certPool := x509.NewCertPool()
-
+	var certs []*x509.Certificate
 	for _, clientRoot := range clientRoots {
-		certs, err := pemToX509Certs(clientRoot)
+		clientRootCerts, err := pemToX509Certs(clientRoot)
 		if err != nil {
 			return errors.WithMessage(err, "failed to set client root certificate(s)")
 		}
+		certs = append(certs, clientRootCerts...)
+	}
+	// the new pool is published at once: handshakes in progress keep
+	// verifying with the previous one
+	gServer.tls.setClientRootCerts(certs)
+	return nil
+}
 
-		for _, cert := range certs {
-			certPool.AddCert(cert)
+// clientCertPolicy holds the checks of client certificates configured on a
+// server, which apply to the TLS configurations of all its connections
+type clientCertPolicy struct {
+	crls    []*pkix.CertificateList
+	dryRun  bool
+	logger  *flogging.FabricLogger
+	counter metrics.Counter
+	emitter *metricsEmitter
+}
+
+// verifier returns verify extended with the revocation checks and the dry
+// run of the policy
+func (p *clientCertPolicy) verifier(verify func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if len(p.crls) > 0 {
+		verify = rejectRevoked(p.crls, verify)
+	}
+	// the dry run covers the revocation checks as well
+	if p.dryRun && verify != nil {
+		verify = dryRunVerifier(verify, p.logger, p.counter, p.emitter)
+	}
+	return verify
+}
+
+// newClientHelloTLSConfig builds the TLS configuration of a connection from
+// the secure options returned by SecureOptions.GetConfigForClient. The CRLs
+// of the options are checked in addition to the ones of the policy of the
+// server.
+func newClientHelloTLSConfig(opts SecureOptions, policy *clientCertPolicy) (*tls.Config, error) {
+	if opts.Key == nil || opts.Certificate == nil {
+		return nil, errors.New("secure options for the connection must contain both Key and Certificate")
+	}
+	cert, err := tls.X509KeyPair(opts.Certificate, opts.Key)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to load the certificate for the connection")
+	}
+	if err := opts.checkCurvePreferences(); err != nil {
+		return nil, err
+	}
+	crls, err := parseCRLs(opts.CRLs)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to load the certificate revocation lists for the connection")
+	}
+	connPolicy := *policy
+	connPolicy.crls = append(crls, policy.crls...)
+
+	tlsConfig := &tls.Config{
+		Certificates:           []tls.Certificate{cert},
+		VerifyPeerCertificate:  connPolicy.verifier(opts.VerifyCertificate),
+		SessionTicketsDisabled: true,
+		CipherSuites:           opts.CipherSuites,
+		CurvePreferences:       opts.CurvePreferences,
+		ClientAuth:             tls.RequestClientCert,
+		NextProtos:             alpnProtoStr,
+		MinVersion:             tls.VersionTLS12,
+		KeyLogWriter:           opts.KeyLogWriter,
+	}
+	if len(tlsConfig.CipherSuites) == 0 {
+		tlsConfig.CipherSuites = DefaultTLSCipherSuites
+	}
+	if opts.TimeShift > 0 {
+		timeShift := opts.TimeShift
+		tlsConfig.Time = func() time.Time {
+			return time.Now().Add((-1) * timeShift)
 		}
 	}
-	gServer.tls.SetClientCAs(certPool)
-	return nil
+	if opts.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		for _, clientRootCA := range opts.ClientRootCAs {
+			certs, err := pemToX509Certs(clientRootCA)
+			if err != nil {
+				return nil, errors.WithMessage(err, "failed to load the client root certificate(s) for the connection")
+			}
+			for _, cert := range certs {
+				tlsConfig.ClientCAs.AddCert(cert)
+			}
+		}
+	}
+	return tlsConfig, nil
+}
+
+// dryRunVerifier wraps verify so that its failures are logged and counted
+// instead of rejecting the peer, counting them with emitter
+func dryRunVerifier(
+	verify func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error,
+	logger *flogging.FabricLogger,
+	counter metrics.Counter,
+	emitter *metricsEmitter,
+) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		err := verify(rawCerts, verifiedChains)
+		if err == nil {
+			return nil
+		}
+
+		subject := "<no certificate>"
+		if len(rawCerts) > 0 {
+			if cert, parseErr := x509.ParseCertificate(rawCerts[0]); parseErr == nil {
+				subject = cert.Subject.String()
+			}
+		}
+		logger.Warningf("TLS policy dry run: would reject client certificate with subject %s: %s", subject, err)
+		if counter != nil {
+			emitter.emit(func() { counter.Add(1) })
+		}
+		return nil
+	}
 }
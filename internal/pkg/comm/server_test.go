@@ -16,16 +16,23 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"os"
 	"path/filepath"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/common/flogging/floggingtest"
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
 	"github.com/hyperledger/fabric/internal/pkg/comm"
 	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
@@ -172,6 +179,31 @@ func invokeEmptyStream(address string, dialOptions ...grpc.DialOption) (*testpb.
 	return msg, streamErr
 }
 
+func registerEmptyService(srv *comm.GRPCServer) {
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+}
+
+// newTestServer starts a server with config on a local port, once register,
+// if not nil, has added its services, and returns it with an insecure
+// connection to it dialed with dialOptions. Both are closed when the test
+// ends.
+func newTestServer(t *testing.T, config comm.ServerConfig, register func(*comm.GRPCServer), dialOptions ...grpc.DialOption) (*comm.GRPCServer, *grpc.ClientConn) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, config)
+	require.NoError(t, err)
+	if register != nil {
+		register(srv)
+	}
+	go srv.Start()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), append([]grpc.DialOption{grpc.WithInsecure(), grpc.WithBlock()}, dialOptions...)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return srv, conn
+}
+
 const (
 	numOrgs        = 2
 	numChildOrgs   = 2
@@ -398,15 +430,7 @@ func TestNewGRPCServerInvalidParameters(t *testing.T) {
 		"127.0.0.1:1BBB",
 		comm.ServerConfig{SecOpts: comm.SecureOptions{UseTLS: false}},
 	)
-	//check for possible errors based on platform and Go release
-	msgs := []string{
-		"listen tcp: lookup tcp/1BBB: nodename nor servname provided, or not known",
-		"listen tcp: unknown port tcp/1BBB",
-		"listen tcp: address tcp/1BBB: unknown port",
-		"listen tcp: lookup tcp/1BBB: Servname not supported for ai_socktype",
-	}
-	require.Error(t, err, fmt.Sprintf("[%s], [%s] [%s] or [%s] expected", msgs[0], msgs[1], msgs[2], msgs[3]))
-	require.Contains(t, msgs, err.Error())
+	require.EqualError(t, err, `invalid port "1BBB" in listen address 127.0.0.1:1BBB`)
 
 	// bad hostname
 	_, err = comm.NewGRPCServer(
@@ -498,6 +522,45 @@ func TestNewGRPCServerInvalidParameters(t *testing.T) {
 	require.EqualError(t, err, "failed to set client root certificate(s): asn1: syntax error: data truncated")
 }
 
+func TestValidateListenAddress(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		address string
+		errMsg  string
+	}{
+		{address: "127.0.0.1:7051"},
+		{address: "127.0.0.1:"},
+		{address: ":7051"},
+		{address: "localhost:0"},
+		{address: "[::1]:7051"},
+		{address: "[fe80::1%lo]:7051"},
+		{address: "0.0.0.0:http"},
+		{address: "", errMsg: "missing address parameter"},
+		{address: "localhost", errMsg: "invalid listen address localhost: address localhost: missing port in address"},
+		{address: ":::7051", errMsg: "invalid listen address :::7051, IPv6 addresses must be enclosed in square brackets: address :::7051: too many colons in address"},
+		{address: "127.0.0.1:65536", errMsg: "port 65536 in listen address 127.0.0.1:65536 is out of range [0, 65535]"},
+		{address: "127.0.0.1:-1", errMsg: "port -1 in listen address 127.0.0.1:-1 is out of range [0, 65535]"},
+		{address: "127.0.0.1:70a", errMsg: `invalid port "70a" in listen address 127.0.0.1:70a`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.address, func(t *testing.T) {
+			t.Parallel()
+			err := comm.ValidateListenAddress(tt.address)
+			if tt.errMsg == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.errMsg)
+			}
+		})
+	}
+
+	// names are resolved by net.Listen
+	require.NoError(t, comm.ValidateListenAddress("hostdoesnotexist.invalid:7051"))
+}
+
 func TestNewGRPCServer(t *testing.T) {
 	t.Parallel()
 
@@ -567,6 +630,33 @@ func TestNewGRPCServerFromListener(t *testing.T) {
 	require.NoError(t, err, "client failed to invoke the EmptyCall service")
 }
 
+func TestRegisteredServices(t *testing.T) {
+	t.Parallel()
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	require.NoError(t, err)
+	defer srv.Stop()
+	require.Empty(t, srv.RegisteredServices())
+
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	require.Equal(t, map[string][]string{
+		"EmptyService": {"EmptyCall", "EmptyStream"},
+	}, srv.RegisteredServices())
+
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	require.Equal(t, map[string][]string{
+		"EmptyService": {"EmptyCall", "EmptyStream"},
+		"EchoService":  {"EchoCall"},
+	}, srv.RegisteredServices())
+
+	healthSrv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{HealthCheckEnabled: true})
+	require.NoError(t, err)
+	defer healthSrv.Stop()
+	require.Equal(t, map[string][]string{
+		"grpc.health.v1.Health": {"Check", "Watch"},
+	}, healthSrv.RegisteredServices())
+}
+
 func TestNewSecureGRPCServer(t *testing.T) {
 	t.Parallel()
 
@@ -719,6 +809,208 @@ func TestVerifyCertificateCallback(t *testing.T) {
 
 // prior tests used self-signed certficates loaded by the GRPCServer and the test client
 // here we'll use certificates signed by certificate authorities
+func TestTLSPolicyDryRun(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	authorizedClientKeyPair, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+	notAuthorizedClientKeyPair, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+
+	verifyFunc := func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if bytes.Equal(rawCerts[0], authorizedClientKeyPair.TLSCert.Raw) {
+			return nil
+		}
+		return errors.New("certificate mismatch")
+	}
+
+	var lock sync.Mutex
+	var warnings []string
+	logger := flogging.MustGetLogger("test").WithOptions(zap.Hooks(func(entry zapcore.Entry) error {
+		if entry.Level == zapcore.WarnLevel {
+			lock.Lock()
+			warnings = append(warnings, entry.Message)
+			lock.Unlock()
+		}
+		return nil
+	}))
+	counter := &metricsfakes.Counter{}
+
+	gRPCServer, err := comm.NewGRPCServer("127.0.0.1:", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			ClientRootCAs:     [][]byte{ca.CertBytes()},
+			Key:               serverKeyPair.Key,
+			Certificate:       serverKeyPair.Cert,
+			UseTLS:            true,
+			RequireClientCert: true,
+			VerifyCertificate: verifyFunc,
+		},
+		Logger:                 logger,
+		TLSPolicyDryRun:        true,
+		TLSPolicyDryRunCounter: counter,
+	})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(gRPCServer.Server(), &emptyServiceServer{})
+	go gRPCServer.Start()
+	defer gRPCServer.Stop()
+
+	invoke := func(clientKeyPair *tlsgen.CertKeyPair) error {
+		cert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+		require.NoError(t, err)
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(ca.CertBytes())
+		creds := credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: rootCAs})
+		_, err = invokeEmptyCall(gRPCServer.Address(), grpc.WithTransportCredentials(creds), grpc.WithBlock())
+		return err
+	}
+
+	t.Run("policy satisfied", func(t *testing.T) {
+		err := invoke(authorizedClientKeyPair)
+		require.NoError(t, err)
+		require.Zero(t, counter.AddCallCount())
+	})
+
+	t.Run("policy violated", func(t *testing.T) {
+		err := invoke(notAuthorizedClientKeyPair)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return counter.AddCallCount() == 1 }, time.Second, 10*time.Millisecond)
+		require.Equal(t, float64(1), counter.AddArgsForCall(0))
+
+		lock.Lock()
+		defer lock.Unlock()
+		require.Len(t, warnings, 1)
+		require.Equal(t, fmt.Sprintf(
+			"TLS policy dry run: would reject client certificate with subject %s: certificate mismatch",
+			notAuthorizedClientKeyPair.TLSCert.Subject,
+		), warnings[0])
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		otherCA, err := tlsgen.NewCA()
+		require.NoError(t, err)
+		untrustedClientKeyPair, err := otherCA.NewClientCertKeyPair()
+		require.NoError(t, err)
+
+		cert, err := tls.X509KeyPair(untrustedClientKeyPair.Cert, untrustedClientKeyPair.Key)
+		require.NoError(t, err)
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(ca.CertBytes())
+		conn, err := tls.Dial("tcp", gRPCServer.Address(), &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      rootCAs,
+			MaxVersion:   tls.VersionTLS12,
+		})
+		if err == nil {
+			conn.Close()
+		}
+		require.Error(t, err)
+		require.Never(t, func() bool { return counter.AddCallCount() != 1 }, 100*time.Millisecond, 10*time.Millisecond)
+	})
+}
+
+func TestTLSConfigProvider(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	clientKeyPair, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+
+	serverCert, err := tls.X509KeyPair(serverKeyPair.Cert, serverKeyPair.Key)
+	require.NoError(t, err)
+
+	var handshakes int32
+	providedConfig := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    x509.NewCertPool(),
+		VerifyPeerCertificate: func([][]byte, [][]*x509.Certificate) error {
+			atomic.AddInt32(&handshakes, 1)
+			return nil
+		},
+	}
+	providedConfig.ClientCAs.AppendCertsFromPEM(ca.CertBytes())
+
+	gRPCServer, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			// ignored in favor of the provided config
+			UseTLS:      false,
+			Certificate: []byte("ignored"),
+			TLSConfigProvider: func() (*tls.Config, error) {
+				return providedConfig, nil
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, gRPCServer.TLSEnabled())
+	require.True(t, gRPCServer.MutualTLSRequired())
+	require.Equal(t, serverCert.Certificate, gRPCServer.ServerCertificate().Certificate)
+	testpb.RegisterEmptyServiceServer(gRPCServer.Server(), &emptyServiceServer{})
+	go gRPCServer.Start()
+	defer gRPCServer.Stop()
+
+	cert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+	require.NoError(t, err)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(ca.CertBytes())
+	creds := credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: rootCAs})
+	_, err = invokeEmptyCall(gRPCServer.Address(), grpc.WithTransportCredentials(creds), grpc.WithBlock())
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&handshakes))
+
+	// the provided config is not modified by the server
+	pool := providedConfig.ClientCAs
+	err = gRPCServer.SetClientRootCAs([][]byte{ca.CertBytes()})
+	require.NoError(t, err)
+	require.True(t, pool == providedConfig.ClientCAs, "provided config was modified")
+}
+
+func TestTLSConfigProviderInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		provider func() (*tls.Config, error)
+		errMsg   string
+	}{
+		{
+			name:     "provider error",
+			provider: func() (*tls.Config, error) { return nil, errors.New("boom") },
+			errMsg:   "failed to get TLS config from serverConfig.SecOpts.TLSConfigProvider: boom",
+		},
+		{
+			name:     "nil config",
+			provider: func() (*tls.Config, error) { return nil, nil },
+			errMsg:   "serverConfig.SecOpts.TLSConfigProvider returned a nil TLS config",
+		},
+		{
+			name:     "no certificate",
+			provider: func() (*tls.Config, error) { return &tls.Config{}, nil },
+			errMsg:   "TLS config from serverConfig.SecOpts.TLSConfigProvider must contain Certificates or GetCertificate",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer lis.Close()
+			_, err = comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+				SecOpts: comm.SecureOptions{TLSConfigProvider: tt.provider},
+			})
+			require.EqualError(t, err, tt.errMsg)
+		})
+	}
+}
+
 func TestWithSignedRootCertificates(t *testing.T) {
 	t.Parallel()
 
@@ -1035,6 +1327,80 @@ func TestSetClientRootCAs(t *testing.T) {
 	}
 }
 
+func TestClientRootCAProvider(t *testing.T) {
+	t.Parallel()
+
+	org1ChildRootCAs := [][]byte{testOrgs[0].childOrgs[0].rootCA}
+	org2ChildRootCAs := [][]byte{testOrgs[1].childOrgs[0].rootCA}
+	clientConfigOrg1Child := testOrgs[0].childOrgs[0].trustedClients([][]byte{testOrgs[0].rootCA})[0]
+	clientConfigOrg2Child := testOrgs[1].childOrgs[0].trustedClients([][]byte{testOrgs[0].rootCA})[0]
+
+	var providerRoots atomic.Value
+	providerRoots.Store(org1ChildRootCAs)
+	var providerErr atomic.Value
+	providerErr.Store("")
+	var calls uint32
+	provider := func() ([][]byte, error) {
+		atomic.AddUint32(&calls, 1)
+		if msg := providerErr.Load().(string); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return providerRoots.Load().([][]byte), nil
+	}
+
+	serverConfig := testOrgs[0].testServers([][]byte{})[0].config
+	serverConfig.ClientRootCAProvider = provider
+	serverConfig.RefreshInterval = 10 * time.Millisecond
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "listen failed")
+	defer lis.Close()
+	address := lis.Addr().String()
+
+	srv, err := comm.NewGRPCServerFromListener(lis, serverConfig)
+	require.NoError(t, err, "failed to create GRPCServer")
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	connects := func(clientConfig *tls.Config) func() error {
+		return func() error {
+			_, err := invokeEmptyCall(address, grpc.WithTransportCredentials(credentials.NewTLS(clientConfig)))
+			return err
+		}
+	}
+
+	// the initial refresh trusts the Org1 child
+	require.Eventually(t, func() bool { return connects(clientConfigOrg1Child)() == nil }, 5*time.Second, 10*time.Millisecond)
+	require.Error(t, connects(clientConfigOrg2Child)())
+
+	// the provider rotates the roots to the Org2 child
+	providerRoots.Store(org2ChildRootCAs)
+	require.Eventually(t, func() bool { return connects(clientConfigOrg2Child)() == nil }, 5*time.Second, 10*time.Millisecond)
+	require.Error(t, connects(clientConfigOrg1Child)())
+
+	// provider failures retain the current pool
+	providerErr.Store("store unavailable")
+	failedCalls := atomic.LoadUint32(&calls)
+	require.Eventually(t, func() bool { return atomic.LoadUint32(&calls) > failedCalls+2 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, connects(clientConfigOrg2Child)())
+	require.Error(t, connects(clientConfigOrg1Child)())
+
+	// the refresh stops when the server is stopped
+	srv.Stop()
+	stoppedCalls := atomic.LoadUint32(&calls)
+	time.Sleep(50 * time.Millisecond)
+	require.InDelta(t, stoppedCalls, atomic.LoadUint32(&calls), 1)
+}
+
+func TestClientRootCAProviderWithoutTLS(t *testing.T) {
+	t.Parallel()
+
+	_, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		ClientRootCAProvider: func() ([][]byte, error) { return nil, nil },
+	})
+	require.EqualError(t, err, "serverConfig.ClientRootCAProvider requires UseTLS to be true")
+}
+
 func TestUpdateTLSCert(t *testing.T) {
 	t.Parallel()
 
@@ -1264,3 +1630,546 @@ func TestServerInterceptors(t *testing.T) {
 	require.Equal(t, status.Convert(err).Message(), msg, "Expected error from second ssi")
 	require.Equal(t, uint32(2), atomic.LoadUint32(&ssiCount), "Expected both ssi handlers to be invoked")
 }
+
+func TestExtraServerOptions(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "listen failed")
+
+	var order []string
+	var lock sync.Mutex
+	record := func(name string) {
+		lock.Lock()
+		defer lock.Unlock()
+		order = append(order, name)
+	}
+	configured := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		record("configured")
+		return handler(ctx, req)
+	}
+	extra := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		record("extra")
+		return handler(ctx, req)
+	}
+
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+		UnaryInterceptors: []grpc.UnaryServerInterceptor{configured},
+		ExtraServerOptions: []grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(extra),
+			// overrides the derived maximum receive size
+			grpc.MaxRecvMsgSize(1),
+		},
+	})
+	require.NoError(t, err, "failed to create gRPC server")
+	testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+	defer srv.Stop()
+	go srv.Start()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithBlock(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	client := testpb.NewEchoServiceClient(conn)
+
+	_, err = client.EchoCall(context.Background(), &testpb.Echo{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"configured", "extra"}, order)
+
+	_, err = client.EchoCall(context.Background(), &testpb.Echo{Payload: []byte{0, 0, 0, 0, 0}})
+	require.Error(t, err)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestListenerFile(t *testing.T) {
+	t.Parallel()
+
+	oldSrv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	require.NoError(t, err)
+	address := oldSrv.Address()
+	testpb.RegisterEmptyServiceServer(oldSrv.Server(), &emptyServiceServer{})
+	go oldSrv.Start()
+	defer oldSrv.Stop()
+
+	_, err = invokeEmptyCall(address, grpc.WithBlock(), grpc.WithInsecure())
+	require.NoError(t, err)
+
+	// hand the listener over to a new server
+	f, err := oldSrv.ListenerFile()
+	require.NoError(t, err)
+	inherited, err := net.FileListener(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	newSrv, err := comm.NewGRPCServerFromListener(inherited, comm.ServerConfig{})
+	require.NoError(t, err)
+	require.Equal(t, address, newSrv.Address())
+	testpb.RegisterEmptyServiceServer(newSrv.Server(), &emptyServiceServer{})
+	go newSrv.Start()
+	defer newSrv.Stop()
+
+	// the old server drains and the new one keeps serving the address
+	oldSrv.Stop()
+	_, err = invokeEmptyCall(address, grpc.WithBlock(), grpc.WithInsecure())
+	require.NoError(t, err)
+
+	// only TCP listeners can be exported
+	srv, err := comm.NewGRPCServerFromListener(&unixListener{}, comm.ServerConfig{})
+	require.NoError(t, err)
+	_, err = srv.ListenerFile()
+	require.EqualError(t, err, "listener of type *comm_test.unixListener is not a TCP listener")
+}
+
+func TestNewGRPCServerFromFd(t *testing.T) {
+	t.Parallel()
+
+	oldSrv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+	require.NoError(t, err)
+	address := oldSrv.Address()
+	testpb.RegisterEmptyServiceServer(oldSrv.Server(), &emptyServiceServer{})
+	go oldSrv.Start()
+	defer oldSrv.Stop()
+
+	f, err := oldSrv.ListenerFile()
+	require.NoError(t, err)
+	newSrv, err := comm.NewGRPCServerFromFd(f, comm.ServerConfig{})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Equal(t, address, newSrv.Address())
+	testpb.RegisterEmptyServiceServer(newSrv.Server(), &emptyServiceServer{})
+	go newSrv.Start()
+	defer newSrv.Stop()
+
+	// both servers accept on the socket until the old one stops; calls on
+	// open connections complete while it drains
+	conn, err := grpc.Dial(address, grpc.WithBlock(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	stopped := make(chan struct{})
+	go func() {
+		oldSrv.GracefulStop("restarting")
+		close(stopped)
+	}()
+	_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	require.NoError(t, err)
+	conn.Close()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("old server did not stop")
+	}
+
+	// the new server keeps serving the address once the old one is gone
+	_, err = invokeEmptyCall(address, grpc.WithBlock(), grpc.WithInsecure())
+	require.NoError(t, err)
+
+	// files that are not listening sockets are rejected
+	tmp, err := ioutil.TempFile("", "fd")
+	require.NoError(t, err)
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	_, err = comm.NewGRPCServerFromFd(tmp, comm.ServerConfig{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to create a listener from file "+tmp.Name())
+}
+
+type unixListener struct{ net.Listener }
+
+func (*unixListener) Addr() net.Addr { return &net.UnixAddr{Name: "/tmp/test.sock", Net: "unix"} }
+
+func TestSetClientRootCAsConcurrentHandshakes(t *testing.T) {
+	t.Parallel()
+
+	newCA := func() tlsgen.CA {
+		ca, err := tlsgen.NewCA()
+		require.NoError(t, err)
+		return ca
+	}
+	serverCA, trustedCA, otherCA1, otherCA2 := newCA(), newCA(), newCA(), newCA()
+	serverKeyPair, err := serverCA.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	clientKeyPair, err := trustedCA.NewClientCertKeyPair()
+	require.NoError(t, err)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:            true,
+			RequireClientCert: true,
+			Certificate:       serverKeyPair.Cert,
+			Key:               serverKeyPair.Key,
+			ClientRootCAs:     [][]byte{trustedCA.CertBytes()},
+		},
+	})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	// every pool the server publishes trusts the client's CA, so a handshake
+	// can only fail if it sees a pool that is being rebuilt
+	pools := [][][]byte{
+		{otherCA1.CertBytes(), trustedCA.CertBytes()},
+		{trustedCA.CertBytes(), otherCA2.CertBytes()},
+		{otherCA2.CertBytes(), otherCA1.CertBytes(), trustedCA.CertBytes()},
+	}
+	stop := make(chan struct{})
+	swapped := make(chan int)
+	go func() {
+		swaps := 0
+		defer func() { swapped <- swaps }()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := srv.SetClientRootCAs(pools[swaps%len(pools)]); err != nil {
+				t.Errorf("failed to swap client root CAs: %s", err)
+				return
+			}
+			swaps++
+		}
+	}()
+
+	cert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+	require.NoError(t, err)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(serverCA.CertBytes())
+	clientConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+		// with TLS 1.3 client certificates are verified after the client
+		// completes the handshake
+		MaxVersion: tls.VersionTLS12,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				conn, err := tls.Dial("tcp", srv.Address(), clientConfig)
+				if err != nil {
+					t.Errorf("handshake failed during client root CA swaps: %s", err)
+					return
+				}
+				conn.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	require.NotZero(t, <-swapped)
+}
+
+func TestGetConfigForClient(t *testing.T) {
+	t.Parallel()
+
+	defaultCA, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	defaultKeyPair, err := defaultCA.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	tenantCA, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	tenantKeyPair, err := tenantCA.NewServerCertKeyPair("tenant.example.com")
+	require.NoError(t, err)
+	tenantClientKeyPair, err := tenantCA.NewClientCertKeyPair()
+	require.NoError(t, err)
+
+	var lock sync.Mutex
+	var serverNames []string
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:      true,
+			Certificate: defaultKeyPair.Cert,
+			Key:         defaultKeyPair.Key,
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*comm.SecureOptions, error) {
+				lock.Lock()
+				serverNames = append(serverNames, hello.ServerName)
+				lock.Unlock()
+				switch hello.ServerName {
+				case "tenant.example.com":
+					return &comm.SecureOptions{
+						Certificate:       tenantKeyPair.Cert,
+						Key:               tenantKeyPair.Key,
+						RequireClientCert: true,
+						ClientRootCAs:     [][]byte{tenantCA.CertBytes()},
+					}, nil
+				case "blocked.example.com":
+					return nil, errors.New("server name is blocked")
+				case "invalid.example.com":
+					return &comm.SecureOptions{Certificate: tenantKeyPair.Cert}, nil
+				default:
+					return nil, nil
+				}
+			},
+		},
+	})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	handshake := func(serverName string, ca tlsgen.CA, clientKeyPair *tlsgen.CertKeyPair) (*x509.Certificate, error) {
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(ca.CertBytes())
+		config := &tls.Config{
+			ServerName: serverName,
+			RootCAs:    rootCAs,
+			NextProtos: []string{"h2"},
+			// with TLS 1.3 client certificates are verified after the client
+			// completes the handshake
+			MaxVersion: tls.VersionTLS12,
+		}
+		if clientKeyPair != nil {
+			cert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+			require.NoError(t, err)
+			config.Certificates = []tls.Certificate{cert}
+		}
+		conn, err := tls.Dial("tcp", srv.Address(), config)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		state := conn.ConnectionState()
+		require.Equal(t, "h2", state.NegotiatedProtocol)
+		return state.PeerCertificates[0], nil
+	}
+
+	cert, err := handshake("127.0.0.1", defaultCA, nil)
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", cert.IPAddresses[0].String())
+
+	cert, err = handshake("tenant.example.com", tenantCA, tenantClientKeyPair)
+	require.NoError(t, err)
+	require.Equal(t, []string{"tenant.example.com"}, cert.DNSNames)
+
+	_, err = handshake("tenant.example.com", tenantCA, nil)
+	require.Error(t, err, "the tenant options require a client certificate")
+
+	_, err = handshake("blocked.example.com", defaultCA, nil)
+	require.Error(t, err)
+
+	_, err = handshake("invalid.example.com", tenantCA, nil)
+	require.Error(t, err)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(t, []string{"", "tenant.example.com", "tenant.example.com", "blocked.example.com", "invalid.example.com"}, serverNames)
+
+}
+
+func TestGetConfigForClientCurvePreferences(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:           true,
+			Certificate:      serverKeyPair.Cert,
+			Key:              serverKeyPair.Key,
+			CurvePreferences: []tls.CurveID{tls.CurveP256},
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*comm.SecureOptions, error) {
+				opts := &comm.SecureOptions{Certificate: serverKeyPair.Cert, Key: serverKeyPair.Key}
+				if hello.ServerName == "empty.example.com" {
+					opts.CurvePreferences = []tls.CurveID{}
+				}
+				return opts, nil
+			},
+		},
+	})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	handshake := func(serverName string, curve tls.CurveID) error {
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(ca.CertBytes())
+		conn, err := tls.Dial("tcp", srv.Address(), &tls.Config{
+			ServerName:       serverName,
+			RootCAs:          rootCAs,
+			CurvePreferences: []tls.CurveID{curve},
+			// the certificate is only valid for the IP address
+			InsecureSkipVerify: serverName != "",
+		})
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	// the connections default to the curves of the server
+	require.NoError(t, handshake("", tls.CurveP256))
+	require.Error(t, handshake("", tls.X25519))
+	// and the options of a connection are validated like those of the server
+	require.Error(t, handshake("empty.example.com", tls.CurveP256))
+}
+
+func TestStartLogsEffectiveKeepalive(t *testing.T) {
+	t.Parallel()
+
+	logger, recorder := floggingtest.NewTestLogger(t)
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		Logger: logger,
+		KaOpts: comm.KeepaliveOptions{
+			ServerInterval:    time.Minute,
+			ServerTimeout:     10 * time.Second,
+			ServerMinInterval: 30 * time.Second,
+		},
+	})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	require.Eventually(t, func() bool {
+		return len(recorder.MessagesContaining("Starting server with effective keepalive settings")) == 1
+	}, testTimeout, 10*time.Millisecond)
+	entry := recorder.EntriesContaining("Starting server with effective keepalive settings")[0]
+	require.Contains(t, entry, "address="+srv.Address()+" time=1m0s timeout=10s minTime=30s permitWithoutStream=true")
+}
+
+func TestReloadSecureOptions(t *testing.T) {
+	t.Parallel()
+
+	newCA := func() tlsgen.CA {
+		ca, err := tlsgen.NewCA()
+		require.NoError(t, err)
+		return ca
+	}
+	oldCA, rotatedCA := newCA(), newCA()
+	secureOptions := func(ca tlsgen.CA) (comm.SecureOptions, *x509.Certificate) {
+		serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+		require.NoError(t, err)
+		return comm.SecureOptions{
+			UseTLS:            true,
+			RequireClientCert: true,
+			Certificate:       serverKeyPair.Cert,
+			Key:               serverKeyPair.Key,
+			ClientRootCAs:     [][]byte{ca.CertBytes()},
+		}, serverKeyPair.TLSCert
+	}
+	oldOpts, oldCert := secureOptions(oldCA)
+	newOpts, newCert := secureOptions(rotatedCA)
+
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{SecOpts: oldOpts})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	// the clients trust both server CAs but present a certificate issued by
+	// one of them, so their handshakes succeed if and only if the server
+	// presents the certificate that goes with its client root CAs
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(oldCA.CertBytes())
+	rootCAs.AppendCertsFromPEM(rotatedCA.CertBytes())
+	clientCert := func(ca tlsgen.CA) tls.Certificate {
+		clientKeyPair, err := ca.NewClientCertKeyPair()
+		require.NoError(t, err)
+		cert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+		require.NoError(t, err)
+		return cert
+	}
+	oldClientCert, newClientCert := clientCert(oldCA), clientCert(rotatedCA)
+	handshake := func(cert tls.Certificate) (*x509.Certificate, error) {
+		var serverCert *x509.Certificate
+		conn, err := tls.Dial("tcp", srv.Address(), &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      rootCAs,
+			// with TLS 1.3 client certificates are verified after the
+			// client completes the handshake
+			MaxVersion: tls.VersionTLS12,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				var err error
+				serverCert, err = x509.ParseCertificate(rawCerts[0])
+				return err
+			},
+		})
+		if err == nil {
+			conn.Close()
+		}
+		return serverCert, err
+	}
+
+	serverCert, err := handshake(oldClientCert)
+	require.NoError(t, err)
+	require.True(t, serverCert.Equal(oldCert))
+	_, err = handshake(newClientCert)
+	require.Error(t, err)
+
+	// invalid options are rejected and the previous ones are kept
+	for _, invalid := range []struct {
+		opts *comm.SecureOptions
+		err  string
+	}{
+		{nil, "the new secure options must use TLS"},
+		{&comm.SecureOptions{UseTLS: true}, "the new secure options must contain both Key and Certificate"},
+		{&comm.SecureOptions{UseTLS: true, Certificate: newOpts.Certificate, Key: oldOpts.Key}, "failed to load the new certificate"},
+		{&comm.SecureOptions{UseTLS: true, RequireClientCert: true, Certificate: newOpts.Certificate, Key: newOpts.Key, ClientRootCAs: [][]byte{[]byte("garbage")}}, "no client root certificates found"},
+	} {
+		err := srv.ReloadSecureOptions(invalid.opts)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), invalid.err)
+	}
+	serverCert, err = handshake(oldClientCert)
+	require.NoError(t, err)
+	require.True(t, serverCert.Equal(oldCert))
+
+	// while the options are swapped back and forth, every handshake sees
+	// the certificate and the client root CAs of the same options
+	stop := make(chan struct{})
+	swapped := make(chan int)
+	go func() {
+		swaps := 0
+		defer func() { swapped <- swaps }()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			opts := []comm.SecureOptions{newOpts, oldOpts}[swaps%2]
+			if err := srv.ReloadSecureOptions(&opts); err != nil {
+				t.Errorf("failed to reload secure options: %s", err)
+				return
+			}
+			swaps++
+		}
+	}()
+	var wg sync.WaitGroup
+	for _, client := range []struct {
+		cert     tls.Certificate
+		matching *x509.Certificate
+	}{
+		{oldClientCert, oldCert},
+		{newClientCert, newCert},
+	} {
+		wg.Add(1)
+		go func(clientCert tls.Certificate, matching *x509.Certificate) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				serverCert, err := handshake(clientCert)
+				if serverCert == nil {
+					t.Errorf("no server certificate received: %v", err)
+					return
+				}
+				if succeeded := err == nil; succeeded != serverCert.Equal(matching) {
+					t.Errorf("handshake presenting %s got a mismatched configuration: %v", serverCert.Subject, err)
+					return
+				}
+			}
+		}(client.cert, client.matching)
+	}
+	wg.Wait()
+	close(stop)
+	require.NotZero(t, <-swapped)
+
+	require.NoError(t, srv.ReloadSecureOptions(&newOpts))
+	serverCert, err = handshake(newClientCert)
+	require.NoError(t, err)
+	require.True(t, serverCert.Equal(newCert))
+	_, err = handshake(oldClientCert)
+	require.Error(t, err)
+	require.Equal(t, newCert.Raw, srv.ServerCertificate().Certificate[0])
+}
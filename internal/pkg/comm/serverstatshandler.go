@@ -8,31 +8,111 @@ package comm
 
 import (
 	"context"
+	"time"
 
 	"github.com/hyperledger/fabric/common/metrics"
 	"google.golang.org/grpc/stats"
 )
 
+// ServerStatsHandler is a stats.Handler that counts the connections opened
+// and closed. Counters that are nil are not reported.
 type ServerStatsHandler struct {
 	OpenConnCounter   metrics.Counter
 	ClosedConnCounter metrics.Counter
+	// Histograms, if not nil, records the duration of TLS handshakes, the
+	// lifetime of connections and the duration of RPCs.
+	Histograms *ConnectionHistograms
 }
 
+type connStartKey struct{}
+
+type rpcMethodKey struct{}
+
 func (h *ServerStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
-	return ctx
+	if h.Histograms == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, rpcMethodKey{}, info.FullMethodName)
 }
 
-func (h *ServerStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {}
+func (h *ServerStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	end, ok := s.(*stats.End)
+	if !ok || h.Histograms == nil {
+		return
+	}
+	fullMethod, _ := ctx.Value(rpcMethodKey{}).(string)
+	h.Histograms.observeRPC(fullMethod, end.EndTime.Sub(end.BeginTime), end.Error)
+}
 
 func (h *ServerStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
-	return ctx
+	if h.Histograms == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, connStartKey{}, time.Now())
 }
 
 func (h *ServerStatsHandler) HandleConn(ctx context.Context, s stats.ConnStats) {
 	switch s.(type) {
 	case *stats.ConnBegin:
-		h.OpenConnCounter.Add(1)
+		if h.OpenConnCounter != nil {
+			emitterFromContext(ctx).emit(func() { h.OpenConnCounter.Add(1) })
+		}
 	case *stats.ConnEnd:
-		h.ClosedConnCounter.Add(1)
+		if h.ClosedConnCounter != nil {
+			emitterFromContext(ctx).emit(func() { h.ClosedConnCounter.Add(1) })
+		}
+		if start, ok := ctx.Value(connStartKey{}).(time.Time); ok && h.Histograms != nil {
+			h.Histograms.observeConnection(time.Since(start))
+		}
+	}
+}
+
+// observeHandshake records the duration of a successful TLS handshake
+func (h *ServerStatsHandler) observeHandshake(duration time.Duration) {
+	if h.Histograms != nil {
+		h.Histograms.observeHandshake(duration)
+	}
+}
+
+// multiStatsHandler dispatches to several stats handlers as gRPC servers
+// only accept a single one
+type multiStatsHandler []stats.Handler
+
+// newStatsHandler returns a stats.Handler dispatching to the handlers, or
+// nil if there are none
+func newStatsHandler(handlers ...stats.Handler) stats.Handler {
+	switch len(handlers) {
+	case 0:
+		return nil
+	case 1:
+		return handlers[0]
+	default:
+		return multiStatsHandler(handlers)
+	}
+}
+
+func (msh multiStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	for _, h := range msh {
+		ctx = h.TagRPC(ctx, info)
+	}
+	return ctx
+}
+
+func (msh multiStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	for _, h := range msh {
+		h.HandleRPC(ctx, s)
+	}
+}
+
+func (msh multiStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	for _, h := range msh {
+		ctx = h.TagConn(ctx, info)
+	}
+	return ctx
+}
+
+func (msh multiStatsHandler) HandleConn(ctx context.Context, s stats.ConnStats) {
+	for _, h := range msh {
+		h.HandleConn(ctx, s)
 	}
 }
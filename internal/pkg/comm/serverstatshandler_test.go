@@ -97,7 +97,7 @@ func TestConnMetricsGRPCServer(t *testing.T) {
 		client := testpb.NewEmptyServiceClient(clientConn)
 		_, err = client.EmptyCall(context.Background(), &testpb.Empty{})
 		gt.Expect(err).NotTo(HaveOccurred())
-		gt.Expect(openConn.AddCallCount()).To(Equal(i))
+		gt.Eventually(openConn.AddCallCount, time.Second).Should(Equal(i))
 	}
 
 	for i, conn := range clientConns {
@@ -0,0 +1,77 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// serviceDrainer rejects the calls to services marked as not serving
+type serviceDrainer struct {
+	lock       sync.RWMutex
+	notServing map[string]struct{}
+}
+
+func newServiceDrainer() *serviceDrainer {
+	return &serviceDrainer{notServing: map[string]struct{}{}}
+}
+
+func (d *serviceDrainer) setServing(service string, serving bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if serving {
+		delete(d.notServing, service)
+	} else {
+		d.notServing[service] = struct{}{}
+	}
+}
+
+func (d *serviceDrainer) healthStatus(service string) healthpb.HealthCheckResponse_ServingStatus {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if _, ok := d.notServing[service]; ok {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+func (d *serviceDrainer) check(fullMethod string) error {
+	// full method names are of the form /service/method
+	service := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(service, "/"); i >= 0 {
+		service = service[:i]
+	}
+	if d.healthStatus(service) == healthpb.HealthCheckResponse_NOT_SERVING {
+		return status.Errorf(codes.Unavailable, "service %s is not serving", service)
+	}
+	return nil
+}
+
+func (d *serviceDrainer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := d.check(info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (d *serviceDrainer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := d.check(info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
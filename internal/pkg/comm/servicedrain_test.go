@@ -0,0 +1,79 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestSetServiceServingStatus(t *testing.T) {
+	t.Parallel()
+
+	srv, conn := newTestServer(t, comm.ServerConfig{HealthCheckEnabled: true}, func(srv *comm.GRPCServer) {
+		testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+		testpb.RegisterEchoServiceServer(srv.Server(), &echoServer{})
+		// services drained before the server starts stay drained
+		srv.SetServiceServingStatus("EchoService", false)
+	})
+	echo := testpb.NewEchoServiceClient(conn)
+	empty := testpb.NewEmptyServiceClient(conn)
+	health := healthpb.NewHealthClient(conn)
+	healthStatus := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.Status
+	}
+	emptyStream := func() error {
+		stream, err := empty.EmptyStream(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, stream.CloseSend())
+		_, err = stream.Recv()
+		return err
+	}
+
+	_, err := echo.EchoCall(context.Background(), &testpb.Echo{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, "service EchoService is not serving", status.Convert(err).Message())
+	_, err = empty.EmptyCall(context.Background(), &testpb.Empty{})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, healthStatus("EchoService"))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, healthStatus("EmptyService"))
+
+	srv.SetServiceServingStatus("EchoService", true)
+	srv.SetServiceServingStatus("EmptyService", false)
+	_, err = echo.EchoCall(context.Background(), &testpb.Echo{})
+	require.NoError(t, err)
+	_, err = empty.EmptyCall(context.Background(), &testpb.Empty{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	err = emptyStream()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, "service EmptyService is not serving", status.Convert(err).Message())
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, healthStatus("EchoService"))
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, healthStatus("EmptyService"))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, healthStatus(""))
+}
+
+func TestSetServiceServingStatusWithoutHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	srv, conn := newTestServer(t, comm.ServerConfig{}, registerEmptyService)
+
+	srv.SetServiceServingStatus("EmptyService", false)
+	_, err := testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	srv.SetServiceServingStatus("EmptyService", true)
+	_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	require.NoError(t, err)
+}
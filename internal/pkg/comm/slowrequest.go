@@ -0,0 +1,69 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// SlowRequestInterceptor logs a warning for every call that takes longer
+// than its threshold to complete
+type SlowRequestInterceptor struct {
+	// Threshold is the call duration above which calls are logged
+	Threshold time.Duration
+	// MethodThresholds overrides Threshold for the full method names it
+	// contains. It must not be modified once the interceptors are in use.
+	MethodThresholds map[string]time.Duration
+	Logger           *flogging.FabricLogger
+}
+
+// NewSlowRequestInterceptor creates a SlowRequestInterceptor logging calls
+// that exceed threshold to logger. If logger is nil, the comm logger is used.
+func NewSlowRequestInterceptor(threshold time.Duration, logger *flogging.FabricLogger) *SlowRequestInterceptor {
+	if logger == nil {
+		logger = commLogger
+	}
+	return &SlowRequestInterceptor{
+		Threshold:        threshold,
+		MethodThresholds: map[string]time.Duration{},
+		Logger:           logger,
+	}
+}
+
+func (s *SlowRequestInterceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		s.observe(info.FullMethod, time.Since(start), err)
+		return resp, err
+	}
+}
+
+func (s *SlowRequestInterceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		s.observe(info.FullMethod, time.Since(start), err)
+		return err
+	}
+}
+
+func (s *SlowRequestInterceptor) observe(fullMethod string, duration time.Duration, err error) {
+	threshold, ok := s.MethodThresholds[fullMethod]
+	if !ok {
+		threshold = s.Threshold
+	}
+	if duration <= threshold {
+		return
+	}
+	s.Logger.Warningf("Slow request to %s took %s (threshold %s) and completed with code %s", fullMethod, duration, threshold, status.Code(err))
+}
@@ -0,0 +1,111 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type recordedWarnings struct {
+	lock     sync.Mutex
+	messages []string
+}
+
+func (rw *recordedWarnings) logger() *flogging.FabricLogger {
+	return flogging.MustGetLogger("test").WithOptions(zap.Hooks(func(entry zapcore.Entry) error {
+		if entry.Level == zapcore.WarnLevel {
+			rw.lock.Lock()
+			rw.messages = append(rw.messages, entry.Message)
+			rw.lock.Unlock()
+		}
+		return nil
+	}))
+}
+
+func (rw *recordedWarnings) get() []string {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+	return append([]string(nil), rw.messages...)
+}
+
+func TestSlowRequestInterceptor(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	warnings := &recordedWarnings{}
+	sri := comm.NewSlowRequestInterceptor(50*time.Millisecond, warnings.logger())
+	sri.MethodThresholds["/svc/tolerant"] = time.Hour
+	unary := sri.UnaryServerInterceptor()
+	stream := sri.StreamServerInterceptor()
+
+	unaryHandler := func(delay time.Duration, err error) grpc.UnaryHandler {
+		return func(context.Context, interface{}) (interface{}, error) {
+			time.Sleep(delay)
+			return nil, err
+		}
+	}
+	streamHandler := func(delay time.Duration, err error) grpc.StreamHandler {
+		return func(interface{}, grpc.ServerStream) error {
+			time.Sleep(delay)
+			return err
+		}
+	}
+
+	_, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/fast"}, unaryHandler(0, nil))
+	gt.Expect(err).NotTo(HaveOccurred())
+	err = stream(nil, nil, &grpc.StreamServerInfo{FullMethod: "/svc/fastStream"}, streamHandler(0, nil))
+	gt.Expect(err).NotTo(HaveOccurred())
+	_, err = unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/tolerant"}, unaryHandler(100*time.Millisecond, nil))
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(warnings.get()).To(BeEmpty())
+
+	_, err = unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/slow"}, unaryHandler(100*time.Millisecond, nil))
+	gt.Expect(err).NotTo(HaveOccurred())
+	err = stream(nil, nil, &grpc.StreamServerInfo{FullMethod: "/svc/slowStream"}, streamHandler(100*time.Millisecond, status.Error(codes.Unavailable, "gone")))
+	gt.Expect(err).To(HaveOccurred())
+
+	logged := warnings.get()
+	gt.Expect(logged).To(HaveLen(2))
+	gt.Expect(logged[0]).To(MatchRegexp(`^Slow request to /svc/slow took \d+(\.\d+)?ms \(threshold 50ms\) and completed with code OK$`))
+	gt.Expect(logged[1]).To(MatchRegexp(`^Slow request to /svc/slowStream took \d+(\.\d+)?ms \(threshold 50ms\) and completed with code Unavailable$`))
+}
+
+func TestSlowRequestInterceptorMethodThreshold(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	warnings := &recordedWarnings{}
+	sri := comm.NewSlowRequestInterceptor(time.Hour, warnings.logger())
+	sri.MethodThresholds["/svc/strict"] = time.Millisecond
+	unary := sri.UnaryServerInterceptor()
+
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	}
+	_, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/lenient"}, handler)
+	gt.Expect(err).NotTo(HaveOccurred())
+	_, err = unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/strict"}, handler)
+	gt.Expect(err).NotTo(HaveOccurred())
+
+	logged := warnings.get()
+	gt.Expect(logged).To(HaveLen(1))
+	gt.Expect(logged[0]).To(ContainSubstring("Slow request to /svc/strict"))
+	gt.Expect(logged[0]).To(ContainSubstring("(threshold 1ms)"))
+}
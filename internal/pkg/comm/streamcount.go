@@ -0,0 +1,173 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"google.golang.org/grpc/stats"
+)
+
+// DefaultStreamWarningRatio is the fraction of MaxConcurrentStreams a
+// connection must reach for StreamCountStatsHandler to log a warning
+const DefaultStreamWarningRatio = 0.9
+
+// ConnectionStreams is the number of active streams of a connection
+type ConnectionStreams struct {
+	RemoteAddress string
+	LocalAddress  string
+	ActiveStreams int
+}
+
+// StreamCountStatsHandler is a stats.Handler tracking the number of active
+// streams of every connection of a server, to diagnose clients that
+// exhaust the streams a connection allows
+type StreamCountStatsHandler struct {
+	// MaxConcurrentStreams is the stream limit the server applies to each
+	// connection, as set with grpc.MaxConcurrentStreams. If it is zero, no
+	// warnings are logged.
+	MaxConcurrentStreams uint32
+	// WarningRatio is the fraction of MaxConcurrentStreams a connection
+	// must reach for a warning to be logged. A connection is warned about
+	// again only after its stream count dropped below that fraction. If it
+	// is zero, DefaultStreamWarningRatio is used.
+	WarningRatio float64
+	Logger       *flogging.FabricLogger
+
+	lock  sync.Mutex
+	conns map[*connStreams]struct{}
+}
+
+// NewStreamCountStatsHandler creates a StreamCountStatsHandler warning about
+// connections approaching maxConcurrentStreams. If logger is nil, the comm
+// logger is used.
+func NewStreamCountStatsHandler(maxConcurrentStreams uint32, logger *flogging.FabricLogger) *StreamCountStatsHandler {
+	if logger == nil {
+		logger = commLogger
+	}
+	return &StreamCountStatsHandler{
+		MaxConcurrentStreams: maxConcurrentStreams,
+		Logger:               logger,
+	}
+}
+
+type connStreams struct {
+	remoteAddress string
+	localAddress  string
+
+	lock   sync.Mutex
+	active int
+	warned bool
+}
+
+type streamCountConnKey struct{}
+
+// Snapshot returns the number of active streams of every open connection,
+// ordered by remote address
+func (h *StreamCountStatsHandler) Snapshot() []ConnectionStreams {
+	h.lock.Lock()
+	snapshot := make([]ConnectionStreams, 0, len(h.conns))
+	for cs := range h.conns {
+		cs.lock.Lock()
+		snapshot = append(snapshot, ConnectionStreams{
+			RemoteAddress: cs.remoteAddress,
+			LocalAddress:  cs.localAddress,
+			ActiveStreams: cs.active,
+		})
+		cs.lock.Unlock()
+	}
+	h.lock.Unlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].RemoteAddress < snapshot[j].RemoteAddress
+	})
+	return snapshot
+}
+
+func (h *StreamCountStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	cs := &connStreams{}
+	if info.RemoteAddr != nil {
+		cs.remoteAddress = info.RemoteAddr.String()
+	}
+	if info.LocalAddr != nil {
+		cs.localAddress = info.LocalAddr.String()
+	}
+	return context.WithValue(ctx, streamCountConnKey{}, cs)
+}
+
+func (h *StreamCountStatsHandler) HandleConn(ctx context.Context, s stats.ConnStats) {
+	cs, ok := ctx.Value(streamCountConnKey{}).(*connStreams)
+	if !ok {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	switch s.(type) {
+	case *stats.ConnBegin:
+		if h.conns == nil {
+			h.conns = map[*connStreams]struct{}{}
+		}
+		h.conns[cs] = struct{}{}
+	case *stats.ConnEnd:
+		delete(h.conns, cs)
+	}
+}
+
+func (h *StreamCountStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *StreamCountStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	cs, ok := ctx.Value(streamCountConnKey{}).(*connStreams)
+	if !ok {
+		return
+	}
+
+	switch s.(type) {
+	case *stats.Begin:
+		cs.lock.Lock()
+		cs.active++
+		active := cs.active
+		warn := h.approachingLimit(active) && !cs.warned
+		if warn {
+			cs.warned = true
+		}
+		cs.lock.Unlock()
+		if warn {
+			h.logger().Warningf("Connection from %s has %d active streams out of a maximum of %d", cs.remoteAddress, active, h.MaxConcurrentStreams)
+		}
+	case *stats.End:
+		cs.lock.Lock()
+		cs.active--
+		if !h.approachingLimit(cs.active) {
+			cs.warned = false
+		}
+		cs.lock.Unlock()
+	}
+}
+
+func (h *StreamCountStatsHandler) approachingLimit(active int) bool {
+	if h.MaxConcurrentStreams == 0 {
+		return false
+	}
+	ratio := h.WarningRatio
+	if ratio == 0 {
+		ratio = DefaultStreamWarningRatio
+	}
+	return float64(active) >= ratio*float64(h.MaxConcurrentStreams)
+}
+
+func (h *StreamCountStatsHandler) logger() *flogging.FabricLogger {
+	if h.Logger == nil {
+		return commLogger
+	}
+	return h.Logger
+}
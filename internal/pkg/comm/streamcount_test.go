@@ -0,0 +1,115 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+)
+
+func TestStreamCountStatsHandler(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	warnings := &recordedWarnings{}
+	sh := comm.NewStreamCountStatsHandler(4, warnings.logger())
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		StreamCountStatsHandler: sh,
+		ExtraServerOptions:      []grpc.ServerOption{grpc.MaxConcurrentStreams(4)},
+	})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(srv.Address(), grpc.WithInsecure(), grpc.WithBlock())
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer conn.Close()
+	client := testpb.NewEmptyServiceClient(conn)
+
+	activeStreams := func() []int {
+		var counts []int
+		for _, cs := range sh.Snapshot() {
+			counts = append(counts, cs.ActiveStreams)
+		}
+		return counts
+	}
+	gt.Eventually(activeStreams).Should(Equal([]int{0}))
+	snapshot := sh.Snapshot()
+	gt.Expect(snapshot[0].LocalAddress).To(Equal(srv.Address()))
+	gt.Expect(snapshot[0].RemoteAddress).NotTo(BeEmpty())
+
+	var cancels []context.CancelFunc
+	openStream := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels = append(cancels, cancel)
+		stream, err := client.EmptyStream(ctx)
+		gt.Expect(err).NotTo(HaveOccurred())
+		// a round trip ensures the server has seen the stream
+		gt.Expect(stream.Send(&testpb.Empty{})).To(Succeed())
+		_, err = stream.Recv()
+		gt.Expect(err).NotTo(HaveOccurred())
+	}
+
+	for i := 0; i < 3; i++ {
+		openStream()
+	}
+	gt.Eventually(activeStreams).Should(Equal([]int{3}))
+	gt.Expect(warnings.get()).To(BeEmpty())
+
+	openStream()
+	gt.Eventually(activeStreams).Should(Equal([]int{4}))
+	gt.Eventually(warnings.get).Should(ConsistOf(
+		MatchRegexp(`^Connection from 127\.0\.0\.1:\d+ has 4 active streams out of a maximum of 4$`),
+	))
+
+	cancels[0]()
+	cancels[1]()
+	gt.Eventually(activeStreams, 5*time.Second).Should(Equal([]int{2}))
+
+	// the connection is warned about again once it approaches the limit again
+	openStream()
+	openStream()
+	gt.Eventually(warnings.get).Should(HaveLen(2))
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+	gt.Eventually(activeStreams, 5*time.Second).Should(Equal([]int{0}))
+
+	conn.Close()
+	gt.Eventually(sh.Snapshot, 5*time.Second).Should(BeEmpty())
+}
+
+func TestStreamCountStatsHandlerWithoutLimit(t *testing.T) {
+	t.Parallel()
+	gt := NewGomegaWithT(t)
+
+	warnings := &recordedWarnings{}
+	sh := &comm.StreamCountStatsHandler{Logger: warnings.logger()}
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{StreamCountStatsHandler: sh})
+	gt.Expect(err).NotTo(HaveOccurred())
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(srv.Address(), grpc.WithInsecure(), grpc.WithBlock())
+	gt.Expect(err).NotTo(HaveOccurred())
+	defer conn.Close()
+
+	_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Eventually(sh.Snapshot).Should(HaveLen(1))
+	gt.Eventually(func() int { return sh.Snapshot()[0].ActiveStreams }).Should(Equal(0))
+	gt.Expect(warnings.get()).To(BeEmpty())
+}
@@ -0,0 +1,69 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TenantHeader is the default metadata key carrying the tenant of a call
+const TenantHeader = "x-tenant-id"
+
+type tenantRouting struct {
+	metadataKey string
+	optional    bool
+}
+
+// TenantRoutingOption configures TenantRoutingUnaryClientInterceptor
+type TenantRoutingOption func(*tenantRouting)
+
+// WithTenantMetadataKey sets the metadata key the tenant is attached with
+// instead of TenantHeader
+func WithTenantMetadataKey(key string) TenantRoutingOption {
+	return func(tr *tenantRouting) {
+		tr.metadataKey = strings.ToLower(key)
+	}
+}
+
+// TenantOptional lets the calls without a tenant in their context proceed
+// without the tenant metadata instead of failing
+func TenantOptional() TenantRoutingOption {
+	return func(tr *tenantRouting) {
+		tr.optional = true
+	}
+}
+
+// TenantRoutingUnaryClientInterceptor returns a unary client interceptor
+// attaching the tenant extract finds in the context of every call to its
+// outgoing metadata, replacing the tenant already attached, if any. Calls
+// whose context has no tenant fail with InvalidArgument without being sent
+// unless TenantOptional is given.
+func TenantRoutingUnaryClientInterceptor(extract func(context.Context) (string, bool), opts ...TenantRoutingOption) grpc.UnaryClientInterceptor {
+	tr := &tenantRouting{metadataKey: TenantHeader}
+	for _, opt := range opts {
+		opt(tr)
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		tenant, ok := extract(ctx)
+		if !ok {
+			if tr.optional {
+				return invoker(ctx, method, req, reply, cc, opts...)
+			}
+			return status.Errorf(codes.InvalidArgument, "no tenant found in the context of the call to %s", method)
+		}
+		md, _ := metadata.FromOutgoingContext(ctx)
+		md = md.Copy()
+		md.Set(tr.metadataKey, tenant)
+		return invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+	}
+}
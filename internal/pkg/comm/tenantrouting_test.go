@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type tenantKey struct{}
+
+func tenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+func TestTenantRoutingUnaryClientInterceptor(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan metadata.MD, 1)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+		UnaryInterceptors: []grpc.UnaryServerInterceptor{
+			func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				received <- md
+				return handler(ctx, req)
+			},
+		},
+	})
+	require.NoError(t, err)
+	testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+	go srv.Start()
+	defer srv.Stop()
+
+	dial := func(opts ...comm.TenantRoutingOption) testpb.EmptyServiceClient {
+		conn, err := grpc.Dial(
+			lis.Addr().String(),
+			grpc.WithInsecure(),
+			grpc.WithBlock(),
+			grpc.WithUnaryInterceptor(comm.TenantRoutingUnaryClientInterceptor(tenantFromContext, opts...)),
+		)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return testpb.NewEmptyServiceClient(conn)
+	}
+	withTenant := context.WithValue(context.Background(), tenantKey{}, "org1")
+
+	t.Run("tenant attached", func(t *testing.T) {
+		client := dial()
+		ctx := metadata.AppendToOutgoingContext(withTenant, comm.TenantHeader, "stale", "other", "value")
+		_, err := client.EmptyCall(ctx, &testpb.Empty{})
+		require.NoError(t, err)
+		md := <-received
+		require.Equal(t, []string{"org1"}, md.Get(comm.TenantHeader))
+		require.Equal(t, []string{"value"}, md.Get("other"))
+	})
+
+	t.Run("custom metadata key", func(t *testing.T) {
+		client := dial(comm.WithTenantMetadataKey("X-Org"))
+		_, err := client.EmptyCall(withTenant, &testpb.Empty{})
+		require.NoError(t, err)
+		md := <-received
+		require.Equal(t, []string{"org1"}, md.Get("x-org"))
+		require.Empty(t, md.Get(comm.TenantHeader))
+	})
+
+	t.Run("missing required tenant", func(t *testing.T) {
+		client := dial()
+		_, err := client.EmptyCall(context.Background(), &testpb.Empty{})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.EqualError(t, err, "rpc error: code = InvalidArgument desc = no tenant found in the context of the call to /EmptyService/EmptyCall")
+		require.Empty(t, received, "the call must fail locally")
+	})
+
+	t.Run("missing optional tenant", func(t *testing.T) {
+		client := dial(comm.TenantOptional())
+		_, err := client.EmptyCall(context.Background(), &testpb.Empty{})
+		require.NoError(t, err)
+		md := <-received
+		require.Empty(t, md.Get(comm.TenantHeader))
+	})
+}
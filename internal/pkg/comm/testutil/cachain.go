@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testutil
+
+import (
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/pkg/errors"
+)
+
+// CAChain is a root CA and a chain of intermediate CAs, each one issued by
+// the previous one, to test the building and verification of certificate
+// chains. Levels are numbered from the root, at level 0, to the last
+// intermediate CA.
+type CAChain struct {
+	// CAs holds the root CA followed by the intermediate CAs
+	CAs []tlsgen.CA
+}
+
+// NewCAChain creates a root CA followed by depth intermediate CAs
+func NewCAChain(depth int) (*CAChain, error) {
+	if depth < 0 {
+		return nil, errors.Errorf("invalid depth %d, it must not be negative", depth)
+	}
+	root, err := tlsgen.NewCA()
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to create root CA")
+	}
+	chain := &CAChain{CAs: []tlsgen.CA{root}}
+	for i := 1; i <= depth; i++ {
+		intermediate, err := chain.CAs[i-1].NewIntermediateCA()
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to create intermediate CA at level %d", i)
+		}
+		chain.CAs = append(chain.CAs, intermediate)
+	}
+	return chain, nil
+}
+
+// Root returns the root CA
+func (c *CAChain) Root() tlsgen.CA {
+	return c.CAs[0]
+}
+
+// Last returns the CA at the deepest level
+func (c *CAChain) Last() tlsgen.CA {
+	return c.CAs[len(c.CAs)-1]
+}
+
+// IntermediatesPEM returns the PEM encoded certificates of the intermediate
+// CAs from level up to the first one, in the order a certificate issued at
+// level is followed by them in a chain. It is empty at level 0.
+func (c *CAChain) IntermediatesPEM(level int) []byte {
+	var certs []byte
+	for i := level; i > 0; i-- {
+		certs = append(certs, c.CAs[i].CertBytes()...)
+	}
+	return certs
+}
+
+// NewServerCertKeyPair issues a server certificate for host from the CA at
+// level. The Cert of the returned pair is followed by IntermediatesPEM(level)
+// so that a server loading it presents the full chain; TLSCert is the leaf
+// certificate.
+func (c *CAChain) NewServerCertKeyPair(level int, host string) (*tlsgen.CertKeyPair, error) {
+	if err := c.checkLevel(level); err != nil {
+		return nil, err
+	}
+	keyPair, err := c.CAs[level].NewServerCertKeyPair(host)
+	if err != nil {
+		return nil, err
+	}
+	return c.bundle(keyPair, level), nil
+}
+
+// NewClientCertKeyPair issues a client certificate from the CA at level. As
+// for NewServerCertKeyPair, the Cert of the returned pair is followed by
+// IntermediatesPEM(level).
+func (c *CAChain) NewClientCertKeyPair(level int) (*tlsgen.CertKeyPair, error) {
+	if err := c.checkLevel(level); err != nil {
+		return nil, err
+	}
+	keyPair, err := c.CAs[level].NewClientCertKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	return c.bundle(keyPair, level), nil
+}
+
+func (c *CAChain) checkLevel(level int) error {
+	if level < 0 || level >= len(c.CAs) {
+		return errors.Errorf("invalid level %d, the chain has levels 0 to %d", level, len(c.CAs)-1)
+	}
+	return nil
+}
+
+func (c *CAChain) bundle(keyPair *tlsgen.CertKeyPair, level int) *tlsgen.CertKeyPair {
+	keyPair.Cert = append(keyPair.Cert[:len(keyPair.Cert):len(keyPair.Cert)], c.IntermediatesPEM(level)...)
+	return keyPair
+}
@@ -0,0 +1,126 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testutil_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCAChain(t *testing.T) {
+	t.Parallel()
+
+	chain, err := testutil.NewCAChain(2)
+	require.NoError(t, err)
+	require.Len(t, chain.CAs, 3)
+	require.Equal(t, chain.CAs[0], chain.Root())
+	require.Equal(t, chain.CAs[2], chain.Last())
+	require.Empty(t, chain.IntermediatesPEM(0))
+
+	// every intermediate is issued by the previous level
+	for level := 1; level < len(chain.CAs); level++ {
+		block, _ := pem.Decode(chain.CAs[level].CertBytes())
+		cert, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		block, _ = pem.Decode(chain.CAs[level-1].CertBytes())
+		issuer, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		require.NoError(t, cert.CheckSignatureFrom(issuer))
+	}
+
+	// issued certificates are followed by the intermediates up to the root
+	keyPair, err := chain.NewClientCertKeyPair(2)
+	require.NoError(t, err)
+	var certs []*x509.Certificate
+	for rest := keyPair.Cert; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		certs = append(certs, cert)
+	}
+	require.Len(t, certs, 3)
+	require.Equal(t, keyPair.TLSCert.Raw, certs[0].Raw)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(chain.Root().CertBytes())
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(certs[1])
+	intermediates.AddCert(certs[2])
+	verified, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err)
+	require.Len(t, verified[0], 4)
+
+	_, err = chain.NewServerCertKeyPair(3, "127.0.0.1")
+	require.EqualError(t, err, "invalid level 3, the chain has levels 0 to 2")
+	_, err = chain.NewClientCertKeyPair(-1)
+	require.EqualError(t, err, "invalid level -1, the chain has levels 0 to 2")
+	_, err = testutil.NewCAChain(-1)
+	require.EqualError(t, err, "invalid depth -1, it must not be negative")
+}
+
+func TestCAChainMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	chain, err := testutil.NewCAChain(2)
+	require.NoError(t, err)
+	serverKeyPair, err := chain.NewServerCertKeyPair(2, "127.0.0.1")
+	require.NoError(t, err)
+	clientKeyPair, err := chain.NewClientCertKeyPair(1)
+	require.NoError(t, err)
+
+	// both sides only trust the root and rely on the chains presented
+	srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:            true,
+			RequireClientCert: true,
+			Certificate:       serverKeyPair.Cert,
+			Key:               serverKeyPair.Key,
+			ClientRootCAs:     [][]byte{chain.Root().CertBytes()},
+		},
+	})
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(chain.Root().CertBytes())
+	clientCert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+	require.NoError(t, err)
+	handshake := func(clientCert tls.Certificate) (tls.ConnectionState, error) {
+		conn, err := tls.Dial("tcp", srv.Address(), &tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      roots,
+			MaxVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			return tls.ConnectionState{}, err
+		}
+		defer conn.Close()
+		return conn.ConnectionState(), nil
+	}
+
+	state, err := handshake(clientCert)
+	require.NoError(t, err)
+	require.Len(t, state.PeerCertificates, 3)
+	require.Len(t, state.VerifiedChains[0], 4)
+
+	// a client certificate presented without its intermediate is rejected
+	leafOnly := clientCert
+	leafOnly.Certificate = leafOnly.Certificate[:1]
+	_, err = handshake(leafOnly)
+	require.Error(t, err)
+}
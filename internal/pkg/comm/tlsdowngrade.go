@@ -0,0 +1,153 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/common/metrics"
+	"google.golang.org/grpc/credentials"
+)
+
+// ErrTLSDowngrade is wrapped by the errors of the handshakes rejected by a
+// TLSDowngradeDetector
+var ErrTLSDowngrade = errors.New("core/comm: the client negotiated a lower TLS version than it did before")
+
+// TLSDowngrade describes a connection that negotiated a lower TLS version
+// than the highest version previously negotiated with the same client
+// certificate
+type TLSDowngrade struct {
+	// Fingerprint is the hex-encoded SHA-256 hash of the client certificate
+	Fingerprint string
+	// RemoteAddress is the address of the client
+	RemoteAddress string
+	// Highest is the highest TLS version negotiated with the certificate
+	Highest uint16
+	// Negotiated is the TLS version of the connection
+	Negotiated uint16
+}
+
+// TLSDowngradeDetector flags the TLS connections of the clients negotiating
+// a lower TLS version than the highest one they negotiated before, keyed by
+// the fingerprint of their certificate, as a sign of an attacker forcing a
+// downgrade. It is advisory: clients may legitimately negotiate a lower
+// version, e.g. after a rollback of their software, and the history is lost
+// when the server restarts. Connections without a client certificate are
+// not tracked. A detector must not be copied after first use and may be
+// shared by several servers.
+type TLSDowngradeDetector struct {
+	// MaxVersionDrop is the number of versions connections may negotiate
+	// below the highest one without being flagged, e.g. 1 tolerates TLS 1.2
+	// after TLS 1.3 but flags TLS 1.1. Zero flags any lower version.
+	MaxVersionDrop int
+	// Reject makes the handshakes of the flagged connections fail with an
+	// error wrapping ErrTLSDowngrade instead of only reporting them
+	Reject bool
+	// OnDowngrade, if not nil, is called with every flagged connection
+	OnDowngrade func(TLSDowngrade)
+	// Counter, if not nil, counts the flagged connections
+	Counter metrics.Counter
+
+	lock    sync.Mutex
+	highest map[string]uint16
+}
+
+// observe records that the certificate with fingerprint negotiated version
+// and returns the highest version negotiated with it before, and whether
+// version is too low compared to it
+func (d *TLSDowngradeDetector) observe(fingerprint string, version uint16) (uint16, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.highest == nil {
+		d.highest = map[string]uint16{}
+	}
+	highest, seen := d.highest[fingerprint]
+	if !seen || version > highest {
+		d.highest[fingerprint] = version
+		return highest, false
+	}
+	// the versions from TLS 1.0 to TLS 1.3 are consecutive numbers
+	return highest, int(highest)-int(version) > d.MaxVersionDrop
+}
+
+// downgradeCredentials reports the successful handshakes of the
+// TransportCredentials flagged by the detector, counting them through the
+// metrics emitter of the server
+type downgradeCredentials struct {
+	credentials.TransportCredentials
+	detector *TLSDowngradeDetector
+	logger   *flogging.FabricLogger
+	emitter  *metricsEmitter
+}
+
+func (dc *downgradeCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := dc.TransportCredentials.ServerHandshake(rawConn)
+	if err != nil {
+		return conn, authInfo, err
+	}
+	tlsInfo, ok := authInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return conn, authInfo, nil
+	}
+
+	hash := sha256.Sum256(tlsInfo.State.PeerCertificates[0].Raw)
+	downgrade := TLSDowngrade{
+		Fingerprint:   hex.EncodeToString(hash[:]),
+		RemoteAddress: rawConn.RemoteAddr().String(),
+		Negotiated:    tlsInfo.State.Version,
+	}
+	var flagged bool
+	downgrade.Highest, flagged = dc.detector.observe(downgrade.Fingerprint, downgrade.Negotiated)
+	if !flagged {
+		return conn, authInfo, nil
+	}
+
+	dc.logger.Warningf("Client %s with certificate %s negotiated %s after negotiating %s before", downgrade.RemoteAddress, downgrade.Fingerprint, tlsVersionName(downgrade.Negotiated), tlsVersionName(downgrade.Highest))
+	if dc.detector.Counter != nil {
+		counter := dc.detector.Counter
+		dc.emitter.emit(func() { counter.Add(1) })
+	}
+	if dc.detector.OnDowngrade != nil {
+		dc.detector.OnDowngrade(downgrade)
+	}
+	if dc.detector.Reject {
+		conn.Close()
+		return nil, nil, fmt.Errorf("%w: %s negotiated %s, the highest version negotiated with its certificate is %s", ErrTLSDowngrade, downgrade.RemoteAddress, tlsVersionName(downgrade.Negotiated), tlsVersionName(downgrade.Highest))
+	}
+	return conn, authInfo, nil
+}
+
+func (dc *downgradeCredentials) Clone() credentials.TransportCredentials {
+	return &downgradeCredentials{
+		TransportCredentials: dc.TransportCredentials.Clone(),
+		detector:             dc.detector,
+		logger:               dc.logger,
+		emitter:              dc.emitter,
+	}
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("TLS version %#04x", version)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func TestTLSDowngradeDetector(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	clientKeyPair, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+	otherClientKeyPair, err := ca.NewClientCertKeyPair()
+	require.NoError(t, err)
+	hash := sha256.Sum256(clientKeyPair.TLSCert.Raw)
+	fingerprint := hex.EncodeToString(hash[:])
+
+	tests := []struct {
+		name           string
+		maxVersionDrop int
+		reject         bool
+		flagged        bool
+	}{
+		{name: "Reject", reject: true, flagged: true},
+		{name: "ReportOnly", flagged: true},
+		{name: "Tolerated", maxVersionDrop: 1},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			warnings := &recordedWarnings{}
+			counter := &metricsfakes.Counter{}
+			downgrades := make(chan comm.TLSDowngrade, 10)
+			srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{
+				SecOpts: comm.SecureOptions{
+					UseTLS:            true,
+					Certificate:       serverKeyPair.Cert,
+					Key:               serverKeyPair.Key,
+					RequireClientCert: true,
+					ClientRootCAs:     [][]byte{ca.CertBytes()},
+				},
+				Logger: warnings.logger(),
+				TLSDowngradeDetector: &comm.TLSDowngradeDetector{
+					MaxVersionDrop: test.maxVersionDrop,
+					Reject:         test.reject,
+					OnDowngrade:    func(d comm.TLSDowngrade) { downgrades <- d },
+					Counter:        counter,
+				},
+			})
+			require.NoError(t, err)
+			testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+			go srv.Start()
+			defer srv.Stop()
+
+			invoke := func(clientKeyPair *tlsgen.CertKeyPair, maxVersion uint16) error {
+				cert, err := tls.X509KeyPair(clientKeyPair.Cert, clientKeyPair.Key)
+				require.NoError(t, err)
+				rootCAs := x509.NewCertPool()
+				rootCAs.AppendCertsFromPEM(ca.CertBytes())
+				creds := credentials.NewTLS(&tls.Config{
+					Certificates: []tls.Certificate{cert},
+					RootCAs:      rootCAs,
+					MaxVersion:   maxVersion,
+				})
+				_, err = invokeEmptyCall(srv.Address(), grpc.WithTransportCredentials(creds), grpc.WithBlock())
+				return err
+			}
+
+			// the first connection of a certificate is never flagged, nor
+			// are the ones negotiating the same version
+			require.NoError(t, invoke(clientKeyPair, tls.VersionTLS13))
+			require.NoError(t, invoke(clientKeyPair, tls.VersionTLS13))
+			require.NoError(t, invoke(otherClientKeyPair, tls.VersionTLS12))
+
+			err = invoke(clientKeyPair, tls.VersionTLS12)
+			if !test.flagged {
+				require.NoError(t, err)
+				require.Zero(t, counter.AddCallCount())
+				require.Empty(t, downgrades)
+				require.Empty(t, warnings.get())
+				return
+			}
+			if test.reject {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NotEmpty(t, downgrades)
+			downgrade := <-downgrades
+			require.Equal(t, fingerprint, downgrade.Fingerprint)
+			require.NotEmpty(t, downgrade.RemoteAddress)
+			require.Equal(t, uint16(tls.VersionTLS13), downgrade.Highest)
+			require.Equal(t, uint16(tls.VersionTLS12), downgrade.Negotiated)
+			require.Eventually(t, func() bool { return counter.AddCallCount() >= 1 }, time.Second, 10*time.Millisecond)
+			require.Equal(t, float64(1), counter.AddArgsForCall(0))
+			require.NotEmpty(t, warnings.get())
+			require.Contains(t, warnings.get()[0], "with certificate "+fingerprint+" negotiated TLS 1.2 after negotiating TLS 1.3 before")
+
+			// the flagged connections leave the highest version unchanged
+			flagged := len(downgrades)
+			invoke(clientKeyPair, tls.VersionTLS12)
+			require.Greater(t, len(downgrades), flagged)
+			require.Eventually(t, func() bool { return counter.AddCallCount() >= 2 }, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestTLSDowngradeDetectorWithoutTLS(t *testing.T) {
+	t.Parallel()
+
+	_, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{TLSDowngradeDetector: &comm.TLSDowngradeDetector{}})
+	require.EqualError(t, err, "serverConfig.TLSDowngradeDetector requires UseTLS to be true")
+}
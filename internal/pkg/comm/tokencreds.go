@@ -0,0 +1,51 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+)
+
+// tokenCredentials is a credentials.PerRPCCredentials carrying a bearer
+// token in the authorization header of every call
+type tokenCredentials struct {
+	tokenSource func() (string, error)
+	requireTLS  bool
+}
+
+// NewTokenCredentials returns per call credentials sending the token
+// obtained from tokenSource as a bearer token in the authorization header.
+// tokenSource is called for every call so that it can refresh the token.
+// If requireTLS is set, the token is only sent over connections protected
+// by TLS.
+func NewTokenCredentials(tokenSource func() (string, error), requireTLS bool) credentials.PerRPCCredentials {
+	return &tokenCredentials{
+		tokenSource: tokenSource,
+		requireTLS:  requireTLS,
+	}
+}
+
+func (tc *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if tc.requireTLS {
+		if err := credentials.CheckSecurityLevel(ctx, credentials.PrivacyAndIntegrity); err != nil {
+			return nil, errors.WithMessage(err, "refusing to send token over an insecure connection")
+		}
+	}
+
+	token, err := tc.tokenSource()
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to obtain token")
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+func (tc *tokenCredentials) RequireTransportSecurity() bool {
+	return tc.requireTLS
+}
@@ -0,0 +1,121 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTokenCredentials(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	serverKeyPair, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+
+	authorization := make(chan []string, 1)
+	captureAuthorization := func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		authorization <- md.Get("authorization")
+		return handler(ctx, req)
+	}
+	newServer := func(secOpts comm.SecureOptions) string {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv, err := comm.NewGRPCServerFromListener(lis, comm.ServerConfig{
+			SecOpts:           secOpts,
+			UnaryInterceptors: []grpc.UnaryServerInterceptor{captureAuthorization},
+		})
+		require.NoError(t, err)
+		testpb.RegisterEmptyServiceServer(srv.Server(), &emptyServiceServer{})
+		go srv.Start()
+		t.Cleanup(srv.Stop)
+		return lis.Addr().String()
+	}
+	tlsAddress := newServer(comm.SecureOptions{
+		UseTLS:      true,
+		Certificate: serverKeyPair.Cert,
+		Key:         serverKeyPair.Key,
+	})
+	plaintextAddress := newServer(comm.SecureOptions{})
+	tlsOpts := comm.SecureOptions{
+		UseTLS:        true,
+		ServerRootCAs: [][]byte{ca.CertBytes()},
+	}
+
+	token := func() (string, error) { return "t0k3n", nil }
+	call := func(address string, secOpts comm.SecureOptions, creds comm.ClientConfig) error {
+		creds.SecOpts = secOpts
+		creds.Timeout = testTimeout
+		client, err := comm.NewGRPCClient(creds)
+		require.NoError(t, err)
+		conn, err := client.NewConnection(address)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = testpb.NewEmptyServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+		return err
+	}
+
+	t.Run("over TLS", func(t *testing.T) {
+		err := call(tlsAddress, tlsOpts, comm.ClientConfig{PerRPCCredentials: comm.NewTokenCredentials(token, true)})
+		require.NoError(t, err)
+		require.Equal(t, []string{"Bearer t0k3n"}, <-authorization)
+	})
+
+	t.Run("insecure allowed", func(t *testing.T) {
+		err := call(plaintextAddress, comm.SecureOptions{}, comm.ClientConfig{PerRPCCredentials: comm.NewTokenCredentials(token, false)})
+		require.NoError(t, err)
+		require.Equal(t, []string{"Bearer t0k3n"}, <-authorization)
+	})
+
+	t.Run("insecure refused", func(t *testing.T) {
+		err := call(plaintextAddress, comm.SecureOptions{}, comm.ClientConfig{PerRPCCredentials: comm.NewTokenCredentials(token, true)})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the credentials require transport level security")
+	})
+
+	t.Run("token source fails", func(t *testing.T) {
+		failing := func() (string, error) { return "", errors.New("token expired") }
+		err := call(tlsAddress, tlsOpts, comm.ClientConfig{PerRPCCredentials: comm.NewTokenCredentials(failing, true)})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to obtain token: token expired")
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		err := call(tlsAddress, tlsOpts, comm.ClientConfig{})
+		require.NoError(t, err)
+		require.Empty(t, <-authorization)
+	})
+}
+
+func TestTokenCredentialsWithoutSecurityInfo(t *testing.T) {
+	t.Parallel()
+
+	creds := comm.NewTokenCredentials(func() (string, error) { return "t0k3n", nil }, true)
+	require.True(t, creds.RequireTransportSecurity())
+	_, err := creds.GetRequestMetadata(context.Background())
+	require.EqualError(t, err, "refusing to send token over an insecure connection: unable to obtain SecurityLevel from context")
+
+	creds = comm.NewTokenCredentials(func() (string, error) { return "t0k3n", nil }, false)
+	require.False(t, creds.RequireTransportSecurity())
+	md, err := creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"authorization": "Bearer t0k3n"}, md)
+}
@@ -32,6 +32,52 @@ func AddPemToCertPool(pemCerts []byte, pool *x509.CertPool) error {
 	return nil
 }
 
+// newRootCertPool builds a cert pool from PEM-encoded root CAs. In strict
+// mode, any entry that does not contain only valid certificates is an error.
+// Otherwise invalid certificates, and entries without certificates, are
+// logged and skipped, and an error is only returned if roots were provided
+// but none of them are valid, wrapping the last parse error if any.
+func newRootCertPool(roots [][]byte, strict bool) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	var valid int
+	var lastErr error
+	for i, root := range roots {
+		var found bool
+		for rest := root; len(rest) > 0; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				if strict {
+					return nil, errors.WithMessagef(err, "invalid certificate in root CA entry %d", i)
+				}
+				commLogger.Warningf("Skipping invalid certificate in root CA entry %d: %s", i, err)
+				lastErr = err
+				continue
+			}
+			pool.AddCert(cert)
+			found = true
+			valid++
+		}
+		if !found {
+			if strict {
+				return nil, errors.Errorf("no valid certificates in root CA entry %d", i)
+			}
+			commLogger.Warningf("Skipping root CA entry %d without valid certificates", i)
+		}
+	}
+	if len(roots) > 0 && valid == 0 {
+		if lastErr != nil {
+			return nil, errors.WithMessage(lastErr, "no valid root certificates found")
+		}
+		return nil, errors.New("no valid root certificates found")
+	}
+	return pool, nil
+}
+
 // parse PEM-encoded certs
 func pemToX509Certs(pemCerts []byte) ([]*x509.Certificate, error) {
 	var certs []*x509.Certificate
@@ -142,6 +188,20 @@ func ExtractCertificateFromContext(ctx context.Context) *x509.Certificate {
 	return certs[0]
 }
 
+// IsMutuallyAuthenticated returns whether the peer of the given context of
+// a gRPC stream presented a TLS client certificate that was verified
+func IsMutuallyAuthenticated(ctx context.Context) bool {
+	pr, extracted := peer.FromContext(ctx)
+	if !extracted {
+		return false
+	}
+	tlsInfo, isTLSConn := pr.AuthInfo.(credentials.TLSInfo)
+	if !isTLSConn {
+		return false
+	}
+	return len(tlsInfo.State.VerifiedChains) > 0
+}
+
 // ExtractRawCertificateFromContext returns the raw TLS certificate (if applicable)
 // from the given context of a gRPC stream
 func ExtractRawCertificateFromContext(ctx context.Context) []byte {
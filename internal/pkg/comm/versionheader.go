@@ -0,0 +1,43 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// headerSetter adds fixed metadata to the response headers of every RPC
+type headerSetter struct {
+	md metadata.MD
+}
+
+func newHeaderSetter(headers map[string]string) *headerSetter {
+	return &headerSetter{md: metadata.New(headers)}
+}
+
+func (h *headerSetter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := grpc.SetHeader(ctx, h.md); err != nil {
+			commLogger.Debugf("Failed setting response headers for %s: %s", info.FullMethod, err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (h *headerSetter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		// the headers are sent right away so that clients can read them
+		// before the first message of the stream
+		if err := ss.SendHeader(h.md); err != nil {
+			commLogger.Debugf("Failed sending response headers for %s: %s", info.FullMethod, err)
+		}
+		return handler(srv, ss)
+	}
+}
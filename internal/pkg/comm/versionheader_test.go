@@ -0,0 +1,73 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/internal/pkg/comm/testpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestVersionHeader(t *testing.T) {
+	t.Parallel()
+
+	_, conn := newTestServer(t, comm.ServerConfig{
+		VersionHeader: map[string]string{
+			"x-fabric-version": "2.5.1",
+			"X-Fabric-Commit":  "abc123",
+		},
+	}, registerEmptyService)
+	client := testpb.NewEmptyServiceClient(conn)
+
+	t.Run("unary", func(t *testing.T) {
+		var header metadata.MD
+		_, err := client.EmptyCall(context.Background(), &testpb.Empty{}, grpc.Header(&header))
+		require.NoError(t, err)
+		require.Equal(t, []string{"2.5.1"}, header.Get("x-fabric-version"))
+		require.Equal(t, []string{"abc123"}, header.Get("x-fabric-commit"))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		stream, err := client.EmptyStream(context.Background())
+		require.NoError(t, err)
+		err = pingPong(stream, 1)
+		require.NoError(t, err)
+		header, err := stream.Header()
+		require.NoError(t, err)
+		require.Equal(t, []string{"2.5.1"}, header.Get("x-fabric-version"))
+		require.Equal(t, []string{"abc123"}, header.Get("x-fabric-commit"))
+		require.NoError(t, stream.CloseSend())
+	})
+
+	t.Run("stream before the first message", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stream, err := client.EmptyStream(ctx)
+		require.NoError(t, err)
+		header, err := stream.Header()
+		require.NoError(t, err)
+		require.Equal(t, []string{"2.5.1"}, header.Get("x-fabric-version"))
+		require.NoError(t, stream.CloseSend())
+	})
+}
+
+func TestVersionHeaderDisabled(t *testing.T) {
+	t.Parallel()
+
+	_, conn := newTestServer(t, comm.ServerConfig{}, registerEmptyService)
+	client := testpb.NewEmptyServiceClient(conn)
+	var header metadata.MD
+	_, err := client.EmptyCall(context.Background(), &testpb.Empty{}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Empty(t, header.Get("x-fabric-version"))
+}
@@ -0,0 +1,67 @@
+// +build cgo
+
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package comm
+
+import (
+	"io"
+	"runtime"
+
+	"github.com/DataDog/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+func init() {
+	encoding.RegisterCompressor(zstdCompressor{})
+}
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w), nil
+}
+
+func (zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return newZstdReader(r), nil
+}
+
+func (zstdCompressor) Name() string {
+	return ZstdCompressor
+}
+
+// zstdReader frees the decompression context once the stream ends since
+// gRPC does not close the readers it decompresses from. Readers abandoned
+// before the end of the stream are freed when they are garbage collected.
+type zstdReader struct {
+	r      io.ReadCloser
+	closed bool
+}
+
+func newZstdReader(r io.Reader) *zstdReader {
+	zr := &zstdReader{r: zstd.NewReader(r)}
+	runtime.SetFinalizer(zr, (*zstdReader).close)
+	return zr
+}
+
+func (zr *zstdReader) Read(p []byte) (int, error) {
+	if zr.closed {
+		return 0, io.EOF
+	}
+	n, err := zr.r.Read(p)
+	if err != nil {
+		zr.close()
+	}
+	return n, err
+}
+
+func (zr *zstdReader) close() {
+	if !zr.closed {
+		zr.closed = true
+		zr.r.Close()
+	}
+}
@@ -156,7 +156,7 @@ func TestDialerBadConfig(t *testing.T) {
 	_, err := dialer.Dial("127.0.0.1:8080", func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
 		return nil
 	})
-	require.EqualError(t, err, "error adding root certificate: asn1: syntax error: sequence truncated")
+	require.EqualError(t, err, "error adding root certificate: no valid root certificates found: asn1: syntax error: sequence truncated")
 }
 
 func TestDERtoPEM(t *testing.T) {
@@ -177,7 +177,7 @@ func TestStandardDialer(t *testing.T) {
 	_, err := standardDialer.Dial(cluster.EndpointCriteria{Endpoint: "127.0.0.1:8080", TLSRootCAs: certPool})
 	require.EqualError(t,
 		err,
-		"failed creating gRPC client: error adding root certificate: asn1: syntax error: sequence truncated",
+		"failed creating gRPC client: error adding root certificate: no valid root certificates found: asn1: syntax error: sequence truncated",
 	)
 }
 